@@ -0,0 +1,126 @@
+package v1beta1
+
+import (
+	"fmt"
+)
+
+// ARNResolver returns the ARN of the referenced resource. The namespace of the reference is always set.
+// +kubebuilder:object:generate=false
+type ARNResolver func(ref ARNReference) (string, error)
+
+// InNamespace returns the reference with its namespace defaulted to the given one
+func (ref ARNReference) InNamespace(namespace string) ARNReference {
+	if ref.Namespace == "" {
+		ref.Namespace = namespace
+	}
+	return ref
+}
+
+// Key identifies the referenced resource, as used in the ResolvedReferences of the status
+func (ref ARNReference) Key() string {
+	return fmt.Sprintf("%s/%s/%s", ref.Kind, ref.Namespace, ref.Name)
+}
+
+// ARNReferences returns all resources referenced by the statement, with their namespaces defaulted to the given one
+func (ps PolicyStatement) ARNReferences(namespace string) []ARNReference {
+	var refs []ARNReference
+	for _, entry := range ps {
+		for _, ref := range entry.ResourceRefs {
+			refs = append(refs, ref.InNamespace(namespace))
+		}
+	}
+	return refs
+}
+
+// ResolveReferences returns a copy of the statement, with the ARNs of all referenced resources added to the resources
+// of their entries. References without a namespace are resolved in the given one.
+func (ps PolicyStatement) ResolveReferences(namespace string, resolve ARNResolver) (PolicyStatement, error) {
+	var resolved PolicyStatement
+	for _, entry := range ps {
+		e, err := entry.resolveResourceRefs(namespace, resolve)
+		if err != nil {
+			return nil, err
+		}
+		resolved = append(resolved, e)
+	}
+	return resolved, nil
+}
+
+// ARNReferences returns all resources referenced by the statement, with their namespaces defaulted to the given one
+func (arps AssumeRolePolicyStatement) ARNReferences(namespace string) []ARNReference {
+	var refs []ARNReference
+	for _, entry := range arps {
+		for _, ref := range entry.ResourceRefs {
+			refs = append(refs, ref.InNamespace(namespace))
+		}
+		for _, ref := range entry.PrincipalRefs {
+			refs = append(refs, ref.InNamespace(namespace))
+		}
+	}
+	return refs
+}
+
+// ResolveReferences returns a copy of the statement, with the ARNs of all referenced resources added to the resources
+// of their entries, and the ARNs of all referenced principals added as AWS principals. A principal can only hold a
+// single AWS ARN, so an entry is split up into one entry per principal ARN; statement IDs are numbered to keep them
+// unique. References without a namespace are resolved in the given one.
+func (arps AssumeRolePolicyStatement) ResolveReferences(namespace string, resolve ARNResolver) (AssumeRolePolicyStatement, error) {
+	var resolved AssumeRolePolicyStatement
+	for _, entry := range arps {
+		e, err := entry.PolicyStatementEntry.resolveResourceRefs(namespace, resolve)
+		if err != nil {
+			return nil, err
+		}
+
+		var principals []map[string]string
+		if len(entry.Principal) != 0 {
+			principals = append(principals, entry.Principal)
+		}
+		for _, ref := range entry.PrincipalRefs {
+			ref = ref.InNamespace(namespace)
+			if ref.Kind != "Role" && ref.Kind != "User" {
+				return nil, fmt.Errorf("%s '%s/%s' cannot be a principal, only Roles and Users can", ref.Kind, ref.Namespace, ref.Name)
+			}
+			arn, err := resolve(ref)
+			if err != nil {
+				return nil, err
+			}
+			// fill in the AWS principal of the entry itself, if it has none yet
+			if len(principals) == 1 && principals[0]["AWS"] == "" {
+				principal := map[string]string{"AWS": arn}
+				for typ, p := range principals[0] {
+					principal[typ] = p
+				}
+				principals[0] = principal
+				continue
+			}
+			principals = append(principals, map[string]string{"AWS": arn})
+		}
+		if len(principals) == 0 {
+			principals = append(principals, nil)
+		}
+
+		for i, principal := range principals {
+			split := AssumeRolePolicyStatementEntry{PolicyStatementEntry: *e.DeepCopy(), Principal: principal}
+			if len(principals) > 1 && split.Sid != "" {
+				split.Sid = fmt.Sprintf("%s%d", split.Sid, i+1)
+			}
+			resolved = append(resolved, split)
+		}
+	}
+	return resolved, nil
+}
+
+// resolveResourceRefs returns a copy of the entry, with the ARNs of the referenced resources added to its resources
+func (pse PolicyStatementEntry) resolveResourceRefs(namespace string, resolve ARNResolver) (PolicyStatementEntry, error) {
+	resolved := *pse.DeepCopy()
+	resolved.ResourceRefs = nil
+	for _, ref := range pse.ResourceRefs {
+		arn, err := resolve(ref.InNamespace(namespace))
+		if err != nil {
+			return PolicyStatementEntry{}, err
+		}
+		resolved.Resources = append(resolved.Resources, arn)
+	}
+	return resolved, nil
+}
@@ -18,6 +18,7 @@ package v1beta1
 
 import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 )
 
 // EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
@@ -31,6 +32,11 @@ type AssumeRolePolicyStatementEntry struct {
 	// Principal denotes an account, user, role, or federated user to which you would
 	// like to allow or deny access with a resource-based policy
 	Principal map[string]string `json:"principal,omitempty"`
+
+	//+kubebuilder:validation:Optional
+	//
+	// PrincipalRefs references Roles or Users managed by the operator, whose ARNs are added as AWS principals
+	PrincipalRefs []ARNReference `json:"principalRefs,omitempty"`
 }
 
 type AssumeRolePolicyStatement []AssumeRolePolicyStatementEntry
@@ -38,10 +44,23 @@ type AssumeRolePolicyStatement []AssumeRolePolicyStatementEntry
 // AssumeRolePolicySpec defines the desired state of AssumeRolePolicy
 type AssumeRolePolicySpec struct {
 
-	//+kubebuilder:validation:Required
+	//+kubebuilder:validation:Optional
 	//
-	// Statements holds the list of all the policy statement entries
+	// Statements holds the list of all the policy statement entries. Exactly one of statement, document and
+	// documentFrom is required.
 	Statement AssumeRolePolicyStatement `json:"statement,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:pruning:PreserveUnknownFields
+	//
+	// Document holds a raw JSON trust policy document, which may use all elements of the IAM policy grammar. Template
+	// variables and ARN references are not expanded.
+	Document *runtime.RawExtension `json:"document,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	//
+	// DocumentFrom reads the raw JSON trust policy document from a key of a ConfigMap or Secret
+	DocumentFrom *DocumentSource `json:"documentFrom,omitempty"`
 }
 
 // AssumeRolePolicyStatus defines the observed state of AssumeRolePolicy
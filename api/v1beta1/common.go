@@ -1,13 +1,58 @@
 package v1beta1
 
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
 type SyncState string
 
 const (
 	SyncSyncState  SyncState = "SYNC"
 	OkSyncState    SyncState = "OK"
 	ErrorSyncState SyncState = "ERROR"
+	// PlannedSyncState means the resource is in dry-run mode, and the operations needed to sync it have only been
+	// planned
+	PlannedSyncState SyncState = "PLANNED"
+)
+
+// DryRunAnnotation puts a single resource into dry-run mode, if set to "true". The operator then only plans the AWS
+// operations needed to sync the resource, without executing them.
+const DryRunAnnotation = "aws-iam.redradrat.xyz/dry-run"
+
+// PausedAnnotation stops the operator from making any changes to a resource, if set to "true". The status of the
+// resource is still reported.
+const PausedAnnotation = "aws-iam.redradrat.xyz/paused"
+
+// ReconcileRequestAnnotation requests a full reconciliation of a resource, even if it's in sync. Its value is an
+// arbitrary token e.g. a timestamp, a reconciliation is done once per new value.
+const ReconcileRequestAnnotation = "aws-iam.redradrat.xyz/reconcile-request"
+
+// AdoptAnnotation holds the ARN of an existing AWS object, which the operator adopts instead of creating a new one.
+// It is only read as long as the resource has no AWS object of its own.
+const AdoptAnnotation = "aws-iam.redradrat.xyz/adopt-arn"
+
+// OperationType is the type of an operation on an AWS object
+type OperationType string
+
+const (
+	CreateOperation   OperationType = "Create"
+	AdoptOperation    OperationType = "Adopt"
+	UpdateOperation   OperationType = "Update"
+	RecreateOperation OperationType = "Recreate"
+	AttachOperation   OperationType = "Attach"
+	DetachOperation   OperationType = "Detach"
+	DeleteOperation   OperationType = "Delete"
 )
 
+// PlannedOperation is an operation on an AWS object, which the operator would make if it wasn't in dry-run mode
+type PlannedOperation struct {
+	// Operation is the type of the operation
+	Operation OperationType `json:"operation"`
+
+	// Target describes the AWS object the operation would be made on
+	Target string `json:"target"`
+}
+
 type AWSObjectStatus struct {
 
 	// +kubebuilder:validation:optional
@@ -34,4 +79,64 @@ type AWSObjectStatus struct {
 	//
 	// ObservedGeneration holds the generation (metadata.generation in CR) observed by the controller
 	ObservedGeneration int64 `json:"observedGeneration"`
+
+	// +kubebuilder:validation:optional
+	// +listType=map
+	// +listMapKey=type
+	//
+	// Conditions holds the conditions of the resource e.g. whether its references are authorized
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// +kubebuilder:validation:optional
+	//
+	// PlannedOperations holds the AWS operations planned during the last reconciliation in dry-run mode
+	PlannedOperations []PlannedOperation `json:"plannedOperations,omitempty"`
+
+	// +kubebuilder:validation:optional
+	//
+	// LastHandledReconcileRequest holds the value of the reconcile-request annotation, that has last been handled
+	LastHandledReconcileRequest string `json:"lastHandledReconcileRequest,omitempty"`
+}
+
+// DocumentStatus is the part of the status of resources, which apply a policy document
+type DocumentStatus struct {
+	// +kubebuilder:validation:optional
+	//
+	// ResolvedReferences holds the ARNs of the resources referenced in policy statements, as they have last been
+	// applied, keyed by kind, namespace and name of the resource
+	ResolvedReferences map[string]string `json:"resolvedReferences,omitempty"`
+
+	// +kubebuilder:validation:optional
+	//
+	// ReadDocumentVersion is the resource version of the ConfigMap or Secret, the raw policy document has last been
+	// read from
+	ReadDocumentVersion string `json:"readDocumentVersion,omitempty"`
 }
+
+// Condition types used in the status of our resources
+const (
+	// ReferencesAuthorizedCondition tells whether all cross-namespace references of the resource are granted by a
+	// ReferenceGrant in the referenced namespace
+	ReferencesAuthorizedCondition = "ReferencesAuthorized"
+
+	// ConstraintsSatisfiedCondition tells whether the policy documents of the resource satisfy all applicable
+	// IAMConstraints and ClusterIAMConstraints
+	ConstraintsSatisfiedCondition = "ConstraintsSatisfied"
+
+	// PolicyLintedCondition tells whether the offline linter found errors (False) in the policy documents of the
+	// resource. Warnings are listed in the message of a True condition.
+	PolicyLintedCondition = "PolicyLinted"
+
+	// WithinLimitsCondition tells whether the resource stays within the IAM quotas e.g. for policy sizes
+	WithinLimitsCondition = "WithinLimits"
+
+	// PausedCondition is set, while the resource is paused by the paused annotation
+	PausedCondition = "Paused"
+
+	// ReferencesResolvedCondition tells whether the ARNs of all resources referenced in policy statements are known
+	ReferencesResolvedCondition = "ReferencesResolved"
+
+	// CredentialSecretsInSyncCondition tells whether the credential Secrets of a user hold the credentials issued for
+	// it. Its reason tells, if credentials had to be issued again, because a Secret was deleted or altered.
+	CredentialSecretsInSyncCondition = "CredentialSecretsInSync"
+)
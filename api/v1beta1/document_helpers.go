@@ -0,0 +1,37 @@
+package v1beta1
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// UsesRawDocument returns true, if the policy is given as a raw document instead of statements. Giving more than one
+// of statement, document and documentFrom is an error.
+func (p *Policy) UsesRawDocument() (bool, error) {
+	return usesRawDocument(len(p.Spec.Statement) != 0, p.Spec.Document, p.Spec.DocumentFrom)
+}
+
+// UsesRawDocument returns true, if the trust policy is given as a raw document instead of statements. Giving more
+// than one of statement, document and documentFrom is an error.
+func (arp *AssumeRolePolicy) UsesRawDocument() (bool, error) {
+	return usesRawDocument(len(arp.Spec.Statement) != 0, arp.Spec.Document, arp.Spec.DocumentFrom)
+}
+
+func usesRawDocument(hasStatement bool, document *runtime.RawExtension, from *DocumentSource) (bool, error) {
+	given := 0
+	for _, g := range []bool{hasStatement, document != nil, from != nil} {
+		if g {
+			given++
+		}
+	}
+	switch {
+	case given == 0:
+		return false, fmt.Errorf("one of statement, document and documentFrom is required")
+	case given > 1:
+		return false, fmt.Errorf("only one of statement, document and documentFrom is allowed")
+	case from != nil && (from.ConfigMapKeyRef == nil) == (from.SecretKeyRef == nil):
+		return false, fmt.Errorf("documentFrom needs exactly one of configMapKeyRef and secretKeyRef")
+	}
+	return !hasStatement, nil
+}
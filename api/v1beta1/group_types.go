@@ -31,6 +31,11 @@ type GroupSpec struct {
 
 type GroupStatus struct {
 	AWSObjectStatus `json:",inline"`
+
+	// +kubebuilder:validation:optional
+	//
+	// Users holds the ARNs of the Users, which have been added to the group
+	Users []string `json:"users,omitempty"`
 }
 
 // +kubebuilder:object:root=true
@@ -0,0 +1,158 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ConstraintEnforcement defines what happens to resources violating a constraint
+type ConstraintEnforcement string
+
+const (
+	// DenyConstraintEnforcement rejects violating resources and keeps them from being reconciled
+	DenyConstraintEnforcement ConstraintEnforcement = "Deny"
+	// WarnConstraintEnforcement only reports violations, but admits and reconciles the resources
+	WarnConstraintEnforcement ConstraintEnforcement = "Warn"
+)
+
+// RequiredCondition is a condition, which every Allow statement has to specify
+type RequiredCondition struct {
+
+	// +kubebuilder:validation:Required
+	//
+	// Operator is the condition operator e.g. StringEquals
+	Operator PolicyStatementConditionOperator `json:"operator"`
+
+	// +kubebuilder:validation:Required
+	//
+	// Key is the condition key e.g. aws:SourceVpc
+	Key PolicyStatementConditionKey `json:"key"`
+
+	// +kubebuilder:validation:Optional
+	//
+	// Values restricts the values the condition may compare against. If empty, any value is allowed.
+	Values []string `json:"values,omitempty"`
+}
+
+// IAMConstraintSpec defines the guardrails for the policies of the resources the constraint applies to. Patterns may
+// contain the wildcards '*' and '?'.
+type IAMConstraintSpec struct {
+
+	// +kubebuilder:validation:Optional
+	//
+	// AllowedActions holds the action patterns, which Allow statements may grant. If empty, all actions are allowed.
+	AllowedActions []string `json:"allowedActions,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	//
+	// DeniedActions holds the action patterns, which Allow statements may not grant, not even by a wildcard
+	DeniedActions []string `json:"deniedActions,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	//
+	// AllowedResources holds the resource ARN patterns, which Allow statements may grant access to. If empty, all
+	// resources are allowed.
+	AllowedResources []string `json:"allowedResources,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	//
+	// RequiredConditions holds the conditions, which every Allow statement has to specify
+	RequiredConditions []RequiredCondition `json:"requiredConditions,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	//
+	// AllowedPrincipals holds the principal patterns, which trust policies may allow to assume a role. If empty, all
+	// principals are allowed.
+	AllowedPrincipals []string `json:"allowedPrincipals,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	//
+	// AllowedManagedPolicies holds the ARN patterns of the managed policies, which PolicyAttachments may attach as
+	// externalPolicy. If empty, all managed policies are allowed.
+	AllowedManagedPolicies []string `json:"allowedManagedPolicies,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	//
+	// DeniedManagedPolicies holds the ARN patterns of the managed policies, which PolicyAttachments may not attach as
+	// externalPolicy, e.g. arn:aws:iam::aws:policy/AdministratorAccess
+	DeniedManagedPolicies []string `json:"deniedManagedPolicies,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Enum=Deny;Warn
+	// +kubebuilder:default=Deny
+	//
+	// Enforcement defines whether violations are rejected (Deny) or only reported (Warn)
+	Enforcement ConstraintEnforcement `json:"enforcement,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:path=iamconstraints,shortName=iamconstraint
+// +kubebuilder:printcolumn:name="Enforcement",type=string,JSONPath=`.spec.enforcement`
+
+// IAMConstraint is the Schema for the iamconstraints API. It applies to all resources in its namespace.
+type IAMConstraint struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec IAMConstraintSpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// IAMConstraintList contains a list of IAMConstraint
+type IAMConstraintList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []IAMConstraint `json:"items"`
+}
+
+// ClusterIAMConstraintSpec defines the desired state of ClusterIAMConstraint
+type ClusterIAMConstraintSpec struct {
+	IAMConstraintSpec `json:",inline"`
+
+	// +kubebuilder:validation:Optional
+	//
+	// NamespaceSelector selects the namespaces the constraint applies to. If not set, it applies to all namespaces.
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:path=clusteriamconstraints,scope=Cluster,shortName=clusteriamconstraint
+// +kubebuilder:printcolumn:name="Enforcement",type=string,JSONPath=`.spec.enforcement`
+
+// ClusterIAMConstraint is the Schema for the clusteriamconstraints API. It applies to all resources in the selected
+// namespaces.
+type ClusterIAMConstraint struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec ClusterIAMConstraintSpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// ClusterIAMConstraintList contains a list of ClusterIAMConstraint
+type ClusterIAMConstraintList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ClusterIAMConstraint `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&IAMConstraint{}, &IAMConstraintList{}, &ClusterIAMConstraint{}, &ClusterIAMConstraintList{})
+}
@@ -25,7 +25,11 @@ func (psc PolicyStatementCondition) Normalize() map[string]map[string][]string {
 }
 
 func (p *Policy) GetStatus() *AWSObjectStatus {
-	return &p.Status
+	return &p.Status.AWSObjectStatus
+}
+
+func (p *Policy) GetDocumentStatus() *DocumentStatus {
+	return &p.Status.DocumentStatus
 }
 
 func (p *Policy) RuntimeObject() client.Object {
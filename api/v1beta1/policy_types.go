@@ -19,6 +19,7 @@ package v1beta1
 import (
 	"github.com/redradrat/cloud-objects/aws/iam"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 )
 
 // EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
@@ -75,18 +76,83 @@ type PolicyStatementEntry struct {
 	//
 	// Conditions specifies the circumstances under which the policy grants permission
 	Conditions PolicyStatementCondition `json:"conditions,omitempty"`
+
+	//+kubebuilder:validation:Optional
+	//
+	// ResourceRefs references resources managed by the operator, whose ARNs are added to the resources of the statement
+	ResourceRefs []ARNReference `json:"resourceRefs,omitempty"`
+}
+
+// ARNReference references a Role, User, Group or Policy resource, whose ARN is used in a policy statement. The ARN is
+// read from the status of the resource, once it has been created.
+type ARNReference struct {
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Enum=Role;User;Group;Policy
+	//
+	// Kind is the kind of the referenced resource
+	Kind string `json:"kind"`
+
+	// +kubebuilder:validation:Required
+	//
+	// Name is the name of the referenced resource
+	Name string `json:"name"`
+
+	// +kubebuilder:validation:Optional
+	//
+	// Namespace is the namespace of the referenced resource. Defaults to the namespace of the referencing resource.
+	Namespace string `json:"namespace,omitempty"`
 }
 
 type PolicyStatement []PolicyStatementEntry
 
+// DocumentSource selects the key of a ConfigMap or Secret, which holds a raw JSON policy document. Exactly one of
+// configMapKeyRef and secretKeyRef is required.
+type DocumentSource struct {
+	// +kubebuilder:validation:Optional
+	//
+	// ConfigMapKeyRef selects a key of a ConfigMap in the namespace of the resource
+	ConfigMapKeyRef *KeySelector `json:"configMapKeyRef,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	//
+	// SecretKeyRef selects a key of a Secret in the namespace of the resource
+	SecretKeyRef *KeySelector `json:"secretKeyRef,omitempty"`
+}
+
+// KeySelector selects a key of a ConfigMap or Secret
+type KeySelector struct {
+	// +kubebuilder:validation:Required
+	//
+	// Name is the name of the ConfigMap or Secret
+	Name string `json:"name"`
+
+	// +kubebuilder:validation:Required
+	//
+	// Key is the key holding the document
+	Key string `json:"key"`
+}
+
 // PolicySpec defines the desired state of Policy
 type PolicySpec struct {
 
-	//+kubebuilder:validation:Required
+	//+kubebuilder:validation:Optional
 	//
-	// Statements holds the list of all the policy statement entries
+	// Statements holds the list of all the policy statement entries. Exactly one of statement, document and
+	// documentFrom is required.
 	Statement PolicyStatement `json:"statement,omitempty"`
 
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:pruning:PreserveUnknownFields
+	//
+	// Document holds a raw JSON policy document, which may use all elements of the IAM policy grammar. Template
+	// variables and ARN references are not expanded.
+	Document *runtime.RawExtension `json:"document,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	//
+	// DocumentFrom reads the raw JSON policy document from a key of a ConfigMap or Secret
+	DocumentFrom *DocumentSource `json:"documentFrom,omitempty"`
+
 	// +kubebuilder:validation:Optional
 	//
 	// Description holds the description string for the Role
@@ -110,8 +176,13 @@ type Policy struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata,omitempty"`
 
-	Spec   PolicySpec      `json:"spec,omitempty"`
-	Status AWSObjectStatus `json:"status,omitempty"`
+	Spec   PolicySpec   `json:"spec,omitempty"`
+	Status PolicyStatus `json:"status,omitempty"`
+}
+
+type PolicyStatus struct {
+	AWSObjectStatus `json:",inline"`
+	DocumentStatus  `json:",inline"`
 }
 
 // +kubebuilder:object:root=true
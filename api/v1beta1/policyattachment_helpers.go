@@ -9,7 +9,7 @@ import (
 )
 
 func (pa *PolicyAttachment) GetStatus() *AWSObjectStatus {
-	return &pa.Status
+	return &pa.Status.AWSObjectStatus
 }
 
 func (pa *PolicyAttachment) RuntimeObject() client.Object {
@@ -94,8 +94,17 @@ type PolicyAttachment struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata,omitempty"`
 
-	Spec   PolicyAttachmentSpec `json:"spec,omitempty"`
-	Status AWSObjectStatus      `json:"status,omitempty"`
+	Spec   PolicyAttachmentSpec   `json:"spec,omitempty"`
+	Status PolicyAttachmentStatus `json:"status,omitempty"`
+}
+
+type PolicyAttachmentStatus struct {
+	AWSObjectStatus `json:",inline"`
+
+	// +kubebuilder:validation:optional
+	//
+	// PolicyARN holds the ARN of the policy, which has been attached to the target (status.arn)
+	PolicyARN string `json:"policyArn,omitempty"`
 }
 
 // +kubebuilder:object:root=true
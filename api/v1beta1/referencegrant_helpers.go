@@ -0,0 +1,23 @@
+package v1beta1
+
+// Permits returns true, if the grant allows a resource of fromKind in fromNamespace to reference the resource of toKind
+// with the given name in the namespace of the grant.
+func (rg *ReferenceGrant) Permits(fromKind, fromNamespace, toKind, toName string) bool {
+	fromAllowed := false
+	for _, from := range rg.Spec.From {
+		if from.Kind == fromKind && from.Namespace == fromNamespace {
+			fromAllowed = true
+			break
+		}
+	}
+	if !fromAllowed {
+		return false
+	}
+
+	for _, to := range rg.Spec.To {
+		if to.Kind == toKind && (to.Name == "" || to.Name == toName) {
+			return true
+		}
+	}
+	return false
+}
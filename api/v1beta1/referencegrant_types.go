@@ -0,0 +1,92 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ReferenceGrantFrom describes the resources, which are allowed to reference resources in the namespace of the grant
+type ReferenceGrantFrom struct {
+
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Enum=PolicyAttachment;Role;Group;Policy;User
+	//
+	// Kind is the kind of the referencing resource e.g. PolicyAttachment
+	Kind string `json:"kind"`
+
+	// +kubebuilder:validation:Required
+	//
+	// Namespace is the namespace of the referencing resource
+	Namespace string `json:"namespace"`
+}
+
+// ReferenceGrantTo describes the resources in the namespace of the grant, which may be referenced
+type ReferenceGrantTo struct {
+
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Enum=Policy;AssumeRolePolicy;Role;User;Group;ServiceAccount;Secret
+	//
+	// Kind is the kind of the referenced resource e.g. Policy
+	Kind string `json:"kind"`
+
+	// +kubebuilder:validation:Optional
+	//
+	// Name is the name of the referenced resource. If empty, all resources of the kind may be referenced.
+	Name string `json:"name,omitempty"`
+}
+
+// ReferenceGrantSpec defines the desired state of ReferenceGrant
+type ReferenceGrantSpec struct {
+
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinItems=1
+	//
+	// From holds the resources, which are allowed to reference the resources in To
+	From []ReferenceGrantFrom `json:"from"`
+
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinItems=1
+	//
+	// To holds the resources in the namespace of the grant, which may be referenced
+	To []ReferenceGrantTo `json:"to"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:path=referencegrants,shortName=iamreferencegrant
+
+// ReferenceGrant is the Schema for the referencegrants API. It allows resources in other namespaces to reference
+// resources in the namespace of the grant.
+type ReferenceGrant struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec ReferenceGrantSpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// ReferenceGrantList contains a list of ReferenceGrant
+type ReferenceGrantList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ReferenceGrant `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ReferenceGrant{}, &ReferenceGrantList{})
+}
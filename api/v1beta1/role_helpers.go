@@ -1,6 +1,11 @@
 package v1beta1
 
 import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	awsarn "github.com/aws/aws-sdk-go/aws/arn"
 	"github.com/redradrat/cloud-objects/aws/iam"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -10,6 +15,10 @@ func (r *Role) GetStatus() *AWSObjectStatus {
 	return &r.Status.AWSObjectStatus
 }
 
+func (r *Role) GetDocumentStatus() *DocumentStatus {
+	return &r.Status.DocumentStatus
+}
+
 func (r *Role) RuntimeObject() client.Object {
 	return r
 }
@@ -47,3 +56,177 @@ func (r *Role) RoleName() string {
 	}
 	return r.Name
 }
+
+// ReferencesAssumeRolePolicy returns true, if the trust policy of the role comes from the referenced AssumeRolePolicy
+func (r *Role) ReferencesAssumeRolePolicy() bool {
+	return len(r.Spec.AssumeRolePolicy) == 0 && !r.UsesIRSA() && r.Spec.PodIdentity == nil
+}
+
+// UsesIRSA returns true, if the trust policy of the role has IRSA statements
+func (r *Role) UsesIRSA() bool {
+	return r.Spec.AddIRSAPolicy || r.Spec.IRSA != nil
+}
+
+// IRSAServiceAccounts returns the ServiceAccounts, which may assume the role through IRSA, with their namespaces
+// defaulted. addIRSAPolicy stands for the ServiceAccount of the same namespace and name as the role.
+func (r *Role) IRSAServiceAccounts() []ServiceAccountSubject {
+	if r.Spec.IRSA == nil {
+		if r.Spec.AddIRSAPolicy {
+			return []ServiceAccountSubject{{Namespace: r.Namespace, Name: r.Name}}
+		}
+		return nil
+	}
+	var subjects []ServiceAccountSubject
+	for _, sa := range r.Spec.IRSA.ServiceAccounts {
+		if sa.Namespace == "" {
+			sa.Namespace = r.Namespace
+		}
+		subjects = append(subjects, sa)
+	}
+	return subjects
+}
+
+// IRSAAudiences returns the accepted audiences of the ServiceAccount tokens
+func (r *Role) IRSAAudiences() []string {
+	if r.Spec.IRSA == nil || len(r.Spec.IRSA.Audiences) == 0 {
+		return []string{DefaultIRSAAudience}
+	}
+	return r.Spec.IRSA.Audiences
+}
+
+// IsPattern returns true, if the name of the ServiceAccount is a pattern matching several ServiceAccounts
+func (sa ServiceAccountSubject) IsPattern() bool {
+	return strings.ContainsAny(sa.Name, "*?")
+}
+
+// Subject returns the subject of the tokens of the ServiceAccount
+func (sa ServiceAccountSubject) Subject() string {
+	return fmt.Sprintf("system:serviceaccount:%s:%s", sa.Namespace, sa.Name)
+}
+
+// TrustPolicyDocument builds the trust policy document of the role, and adds the IRSA statement if requested. It needs
+// no access to the cluster or AWS, so if the role references an AssumeRolePolicy, its statement has to be passed in.
+func (r *Role) TrustPolicyDocument(referenced *AssumeRolePolicyStatement, oidcProviderARN string) (iam.PolicyDocument, error) {
+	var statement AssumeRolePolicyStatement
+	if len(r.Spec.AssumeRolePolicy) != 0 {
+		if !reflect.DeepEqual(r.Spec.AssumeRolePolicyReference, ResourceReference{}) {
+			return iam.PolicyDocument{}, fmt.Errorf("only one specification of AssumeRolePolicy and AssumeRolePolicyReference is allowed")
+		}
+		statement = r.Spec.AssumeRolePolicy
+	}
+	if r.ReferencesAssumeRolePolicy() {
+		if reflect.DeepEqual(r.Spec.AssumeRolePolicyReference, ResourceReference{}) {
+			return iam.PolicyDocument{}, fmt.Errorf("specification of either AssumeRolePolicy or AssumeRolePolicyReference is mandatory")
+		}
+		if referenced == nil {
+			arpr := r.Spec.AssumeRolePolicyReference
+			return iam.PolicyDocument{}, fmt.Errorf("referenced AssumeRolePolicy '%s/%s' is not available", arpr.Namespace, arpr.Name)
+		}
+		statement = *referenced
+	}
+
+	if r.Spec.AddIRSAPolicy && r.Spec.IRSA != nil {
+		return iam.PolicyDocument{}, fmt.Errorf("only one of addIRSAPolicy and irsa is allowed")
+	}
+	if r.UsesIRSA() {
+		if oidcProviderARN == "" {
+			return iam.PolicyDocument{}, fmt.Errorf("IRSA is requested but no OIDC-Provider ARN has been given to the controller")
+		}
+		entries, err := IRSAStatement(oidcProviderARN, r.IRSAServiceAccounts(), r.IRSAAudiences())
+		if err != nil {
+			return iam.PolicyDocument{}, err
+		}
+		statement = append(statement, entries...)
+	}
+
+	if r.Spec.PodIdentity != nil {
+		if _, err := r.PodIdentityServiceAccounts(); err != nil {
+			return iam.PolicyDocument{}, err
+		}
+		statement = append(statement, PodIdentityStatement()...)
+	}
+
+	return statement.MarshalPolicyDocument(), nil
+}
+
+// PodIdentityServicePrincipal is the service principal, EKS Pod Identity assumes roles with
+const PodIdentityServicePrincipal = "pods.eks.amazonaws.com"
+
+// PodIdentityStatement returns the trust policy statement, which allows EKS Pod Identity to assume a role and to tag
+// the session with the attributes of the pod
+func PodIdentityStatement() AssumeRolePolicyStatement {
+	return AssumeRolePolicyStatement{{
+		PolicyStatementEntry: PolicyStatementEntry{
+			Effect:  "Allow",
+			Actions: []string{"sts:AssumeRole", "sts:TagSession"},
+		},
+		Principal: map[string]string{
+			"Service": PodIdentityServicePrincipal,
+		},
+	}}
+}
+
+// PodIdentityServiceAccounts returns the ServiceAccounts, the role is associated with through EKS Pod Identity, with
+// their namespaces defaulted to the one of the role
+func (r *Role) PodIdentityServiceAccounts() ([]ServiceAccountSubject, error) {
+	if r.Spec.PodIdentity == nil {
+		return nil, nil
+	}
+	var subjects []ServiceAccountSubject
+	for _, sa := range r.Spec.PodIdentity.ServiceAccounts {
+		if sa.IsPattern() {
+			return nil, fmt.Errorf("pod identity associations need a ServiceAccount name, '%s' is a pattern", sa.Name)
+		}
+		if sa.Namespace == "" {
+			sa.Namespace = r.Namespace
+		}
+		subjects = append(subjects, sa)
+	}
+	return subjects, nil
+}
+
+// DefaultIRSAAudience is the audience of ServiceAccount tokens, the EKS pod identity webhook requests
+const DefaultIRSAAudience = "sts.amazonaws.com"
+
+// IRSAStatement returns the trust policy statement, which allows the given ServiceAccounts to assume a role through
+// the given OIDC provider with tokens for one of the given audiences. Conditions hold a single value per key, so there
+// is a statement entry per ServiceAccount and audience. Patterns in ServiceAccount names are matched with StringLike.
+func IRSAStatement(oidcProviderARN string, serviceAccounts []ServiceAccountSubject, audiences []string) (AssumeRolePolicyStatement, error) {
+	arn, err := awsarn.Parse(oidcProviderARN)
+	if err != nil {
+		return nil, fmt.Errorf("OIDC-Provider ARN '%s' is invalid: %w", oidcProviderARN, err)
+	}
+	parts := strings.SplitAfterN(arn.Resource, "/", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("OIDC-Provider ARN '%s' has no provider URL", oidcProviderARN)
+	}
+	resourceWithoutType := parts[1]
+	audKey := PolicyStatementConditionKey(fmt.Sprintf("%s:aud", resourceWithoutType))
+	subKey := PolicyStatementConditionKey(fmt.Sprintf("%s:sub", resourceWithoutType))
+
+	var statement AssumeRolePolicyStatement
+	for _, sa := range serviceAccounts {
+		for _, aud := range audiences {
+			conditions := PolicyStatementCondition{
+				"StringEquals": {audKey: aud},
+			}
+			if sa.IsPattern() {
+				conditions["StringLike"] = PolicyStatementConditionComparison{subKey: sa.Subject()}
+			} else {
+				conditions["StringEquals"][subKey] = sa.Subject()
+			}
+
+			statement = append(statement, AssumeRolePolicyStatementEntry{
+				PolicyStatementEntry: PolicyStatementEntry{
+					Effect:     "Allow",
+					Actions:    []string{"sts:AssumeRoleWithWebIdentity"},
+					Conditions: conditions,
+				},
+				Principal: map[string]string{
+					"Federated": oidcProviderARN,
+				},
+			})
+		}
+	}
+	return statement, nil
+}
@@ -36,9 +36,27 @@ type RoleSpec struct {
 	// CreateServiceAccount triggers the creation of an annotated ServiceAccount for the created role
 	CreateServiceAccount bool `json:"createServiceAccount,omitempty"`
 
-	// AddIRSAPolicy adds the assume-role-policy statement to the trust policy.
+	// +kubebuilder:validation:Optional
+	//
+	// ServiceAccount configures the annotations of the ServiceAccounts created for the role
+	ServiceAccount *ServiceAccountOptions `json:"serviceAccount,omitempty"`
+
+	// AddIRSAPolicy adds the assume-role-policy statement to the trust policy, which allows the ServiceAccount of the
+	// same namespace and name as the role to assume it. Use IRSA for anything else.
 	AddIRSAPolicy bool `json:"addIRSAPolicy,omitempty"`
 
+	// +kubebuilder:validation:Optional
+	//
+	// IRSA adds trust policy statements for IAM Roles for Service Accounts, which allow the listed ServiceAccounts to
+	// assume the role through the OIDC provider of the cluster. Only one of addIRSAPolicy and irsa is allowed.
+	IRSA *IRSA `json:"irsa,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	//
+	// PodIdentity adds the trust policy statement for EKS Pod Identity, and associates the role with the listed
+	// ServiceAccounts of the EKS cluster
+	PodIdentity *PodIdentity `json:"podIdentity,omitempty"`
+
 	// +kubebuilder:validation:Optional
 	// +nullable
 	// MaxSessionDuration specifies the maximum duration a session with this role assumed can last
@@ -55,6 +73,98 @@ type RoleSpec struct {
 	AWSRoleName string `json:"awsRoleName,omitempty"`
 }
 
+// ServiceAccountOptions configures the ServiceAccounts of a role, and the annotations the EKS pod identity webhook reads
+// from them
+type ServiceAccountOptions struct {
+	// +kubebuilder:validation:Optional
+	//
+	// STSRegionalEndpoints sets the eks.amazonaws.com/sts-regional-endpoints annotation, so pods use the regional STS
+	// endpoint
+	STSRegionalEndpoints *bool `json:"stsRegionalEndpoints,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=600
+	// +kubebuilder:validation:Maximum=86400
+	//
+	// TokenExpiration sets the eks.amazonaws.com/token-expiration annotation, the lifetime of the projected
+	// ServiceAccount token in seconds
+	TokenExpiration *int64 `json:"tokenExpiration,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	//
+	// AnnotateExisting annotates ServiceAccounts, which already exist and have not been created for the role. They are
+	// left alone otherwise.
+	AnnotateExisting bool `json:"annotateExisting,omitempty"`
+}
+
+// IRSA configures the ServiceAccounts, which may assume a role through the OIDC provider of the cluster
+type IRSA struct {
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinItems=1
+	//
+	// ServiceAccounts holds the ServiceAccounts, which may assume the role
+	ServiceAccounts []ServiceAccountSubject `json:"serviceAccounts"`
+
+	// +kubebuilder:validation:Optional
+	//
+	// Audiences holds the accepted audiences of the ServiceAccount tokens. Defaults to sts.amazonaws.com.
+	Audiences []string `json:"audiences,omitempty"`
+}
+
+// ServiceAccountSubject selects one or more ServiceAccounts of a namespace
+type ServiceAccountSubject struct {
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	//
+	// Namespace is the namespace of the ServiceAccounts. Defaults to the namespace of the role, other namespaces need
+	// a ReferenceGrant for ServiceAccounts.
+	Namespace string `json:"namespace,omitempty"`
+
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
+	//
+	// Name is the name of the ServiceAccount. It may be a pattern with the wildcards * and ?, which is matched with
+	// StringLike.
+	Name string `json:"name"`
+}
+
+// PodIdentity configures the EKS pod identity associations of a role
+type PodIdentity struct {
+	// +kubebuilder:validation:Optional
+	//
+	// ClusterName is the name of the EKS cluster to create the associations in. Defaults to the cluster name of the
+	// operator.
+	ClusterName string `json:"clusterName,omitempty"`
+
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinItems=1
+	//
+	// ServiceAccounts holds the ServiceAccounts, which are associated with the role. Patterns are not supported.
+	ServiceAccounts []ServiceAccountSubject `json:"serviceAccounts"`
+}
+
+// PodIdentityAssociation is an EKS pod identity association, which has been created for a role
+type PodIdentityAssociation struct {
+	ClusterName    string `json:"clusterName"`
+	Namespace      string `json:"namespace"`
+	ServiceAccount string `json:"serviceAccount"`
+	AssociationID  string `json:"associationId"`
+	// RoleARN is the ARN of the role, the association has been created or last updated with
+	RoleARN string `json:"roleArn"`
+}
+
+// ManagedServiceAccount is a ServiceAccount, which has been created or annotated for a role
+type ManagedServiceAccount struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+
+	// +kubebuilder:validation:Optional
+	//
+	// Created is true, if the ServiceAccount has been created for the role. It is deleted, once it's no longer wanted,
+	// otherwise only the annotations of the role are removed from it.
+	Created bool `json:"created,omitempty"`
+}
+
 // +kubebuilder:object:root=true
 // +kubebuilder:resource:path=roles,shortName=iamrole
 // +kubebuilder:subresource:status
@@ -74,7 +184,18 @@ type Role struct {
 
 type RoleStatus struct {
 	AWSObjectStatus             `json:",inline"`
+	DocumentStatus              `json:",inline"`
 	ReadAssumeRolePolicyVersion string `json:"ReadAssumeRolePolicyVersion"`
+
+	// +kubebuilder:validation:Optional
+	//
+	// PodIdentityAssociations holds the EKS pod identity associations, which have been created for the role
+	PodIdentityAssociations []PodIdentityAssociation `json:"podIdentityAssociations,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	//
+	// ServiceAccounts holds the ServiceAccounts, which have been created or annotated for the role
+	ServiceAccounts []ManagedServiceAccount `json:"serviceAccounts,omitempty"`
 }
 
 // +kubebuilder:object:root=true
@@ -28,6 +28,151 @@ type UserSpec struct {
 
 	// CreateProgrammaticAccess triggers the creation of API creds in AWS and creates a cred secret
 	CreateProgrammaticAccess bool `json:"createProgrammaticAccess,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	//
+	// CredentialSecret configures the names, metadata and format of the Secrets the credentials are written to
+	CredentialSecret *CredentialSecret `json:"credentialSecret,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	//
+	// CredentialSink selects where the credentials are written to instead of Secrets in the namespace of the user. The
+	// names of the credentialSecret are kept, and so is the format of the access key.
+	CredentialSink *CredentialSink `json:"credentialSink,omitempty"`
+}
+
+// CredentialSink selects an external store for the credentials of a user. At most one of vault, secretsManager and ssm
+// may be set. All locations are below aws-iam-operator/<namespace>, so users of different namespaces cannot overwrite
+// each other's credentials.
+type CredentialSink struct {
+	// +kubebuilder:validation:Optional
+	//
+	// Vault writes the credentials to a KV version 2 secrets engine of the Vault server the operator is configured for
+	Vault *VaultCredentialSink `json:"vault,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	//
+	// SecretsManager writes the credentials to AWS Secrets Manager, as JSON object
+	SecretsManager *SecretsManagerCredentialSink `json:"secretsManager,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	//
+	// SSM writes every key of the credentials to a SecureString parameter of the SSM Parameter Store
+	SSM *SSMCredentialSink `json:"ssm,omitempty"`
+}
+
+// VaultCredentialSink writes credentials to the secret <mount>/aws-iam-operator/<namespace>/<path>/<name>
+type VaultCredentialSink struct {
+	// +kubebuilder:validation:Optional
+	//
+	// Mount is the mount path of the KV version 2 secrets engine. Defaults to "secret".
+	Mount string `json:"mount,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	//
+	// Path is inserted between the namespace and the name of the secrets
+	Path string `json:"path,omitempty"`
+}
+
+// SecretsManagerCredentialSink writes credentials to the secret aws-iam-operator/<namespace>/<path>/<name>
+type SecretsManagerCredentialSink struct {
+	// +kubebuilder:validation:Optional
+	//
+	// Path is inserted between the namespace and the name of the secrets
+	Path string `json:"path,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	//
+	// KMSKeyID is the KMS key the secrets are encrypted with. Defaults to the aws/secretsmanager key of the account.
+	KMSKeyID string `json:"kmsKeyId,omitempty"`
+}
+
+// SSMCredentialSink writes credentials to the parameters /aws-iam-operator/<namespace>/<path>/<name>/<key>
+type SSMCredentialSink struct {
+	// +kubebuilder:validation:Optional
+	//
+	// Path is inserted between the namespace and the name of the parameters
+	Path string `json:"path,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	//
+	// KMSKeyID is the KMS key the parameters are encrypted with. Defaults to the aws/ssm key of the account.
+	KMSKeyID string `json:"kmsKeyId,omitempty"`
+}
+
+// CredentialSecretFormat is the format, access keys are written to their Secret in
+// +kubebuilder:validation:Enum=default;env;credentials-file;config-file;template
+type CredentialSecretFormat string
+
+const (
+	// DefaultCredentialSecretFormat writes the access key ID and secret access key as "id" and "secret"
+	DefaultCredentialSecretFormat CredentialSecretFormat = "default"
+	// EnvCredentialSecretFormat writes AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY, to be used with envFrom
+	EnvCredentialSecretFormat CredentialSecretFormat = "env"
+	// CredentialsFileCredentialSecretFormat writes an AWS shared credentials file as "credentials"
+	CredentialsFileCredentialSecretFormat CredentialSecretFormat = "credentials-file"
+	// ConfigFileCredentialSecretFormat writes an AWS config file with the region and the access key as "config"
+	ConfigFileCredentialSecretFormat CredentialSecretFormat = "config-file"
+	// TemplateCredentialSecretFormat writes every key of the template, rendered as Go template
+	TemplateCredentialSecretFormat CredentialSecretFormat = "template"
+)
+
+// CredentialSecret configures the Secrets the credentials of a user are written to
+type CredentialSecret struct {
+	// +kubebuilder:validation:Optional
+	//
+	// Name is the name of the access key Secret. Defaults to <user>-accesskey.
+	Name string `json:"name,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	//
+	// LoginName is the name of the login profile Secret. Defaults to <user>-login.
+	LoginName string `json:"loginName,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	//
+	// Labels are added to the Secrets
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	//
+	// Annotations are added to the Secrets
+	Annotations map[string]string `json:"annotations,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	//
+	// Format is the format of the access key Secret. Defaults to "default".
+	Format CredentialSecretFormat `json:"format,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	//
+	// Profile is the name of the profile in the credentials and config file formats. Defaults to "default".
+	Profile string `json:"profile,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	//
+	// Template holds the keys of the access key Secret with the format "template", and their values as Go templates.
+	// The templates are executed with .AccessKeyID, .SecretAccessKey, .UserName, .ARN, .AccountID and .Region.
+	Template map[string]string `json:"template,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	//
+	// ReplicateTo copies the Secrets into other namespaces, and keeps the copies in sync
+	ReplicateTo *SecretReplication `json:"replicateTo,omitempty"`
+}
+
+// SecretReplication selects the namespaces, the credential Secrets of a user are copied to. Both lists of namespaces
+// and selected namespaces are combined. Every namespace needs a ReferenceGrant from the User for the kind Secret.
+type SecretReplication struct {
+	// +kubebuilder:validation:Optional
+	//
+	// Namespaces are the names of the namespaces
+	Namespaces []string `json:"namespaces,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	//
+	// NamespaceSelector selects namespaces by their labels
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
 }
 
 type UserStatus struct {
@@ -52,6 +197,65 @@ type UserStatus struct {
 	//
 	// ProgrammaticAccessSecret holds the reference to the created LoginProfile Secret
 	ProgrammaticAccessSecret v1.SecretReference `json:"programmaticAccessSecret,omitempty"`
+
+	// +kubebuilder:validation:optional
+	//
+	// AccessKeyID is the ID of the access key, which has been written to the access key Secret
+	AccessKeyID string `json:"accessKeyId,omitempty"`
+
+	// +kubebuilder:validation:optional
+	//
+	// LoginProfileIssuedAt is the time the password of the login profile has been set
+	LoginProfileIssuedAt *metav1.Time `json:"loginProfileIssuedAt,omitempty"`
+
+	// +kubebuilder:validation:optional
+	//
+	// AccessKeyIssuedAt is the time the access key has been issued
+	AccessKeyIssuedAt *metav1.Time `json:"accessKeyIssuedAt,omitempty"`
+
+	// +kubebuilder:validation:optional
+	//
+	// LoginProfileSecretHash is the hash of the data written to the login profile Secret, to detect changes to it
+	LoginProfileSecretHash string `json:"loginProfileSecretHash,omitempty"`
+
+	// +kubebuilder:validation:optional
+	//
+	// ProgrammaticAccessSecretHash is the hash of the data written to the access key Secret, to detect changes to it
+	ProgrammaticAccessSecretHash string `json:"programmaticAccessSecretHash,omitempty"`
+
+	// +kubebuilder:validation:optional
+	//
+	// PendingIssuance is set, while credentials are being issued and have not been written to their Secrets yet
+	PendingIssuance *CredentialIssuance `json:"pendingIssuance,omitempty"`
+
+	// +kubebuilder:validation:optional
+	//
+	// CredentialSink is the sink the credentials have been written to, if they have not been written to Secrets. The
+	// namespace of the Secret references is empty then.
+	CredentialSink *CredentialSink `json:"credentialSink,omitempty"`
+
+	// +kubebuilder:validation:optional
+	//
+	// CredentialSecret is the credentialSecret, the credentials have been written with, to detect changes to their
+	// names, metadata and format. Its replicateTo is not recorded.
+	CredentialSecret *CredentialSecret `json:"credentialSecret,omitempty"`
+
+	// +kubebuilder:validation:optional
+	//
+	// ReplicatedSecrets are the copies of the credential Secrets in other namespaces
+	ReplicatedSecrets []v1.SecretReference `json:"replicatedSecrets,omitempty"`
+}
+
+// CredentialIssuance records the issuance of credentials, so credentials which have been issued, but never written to
+// their Secret, can be found and revoked
+type CredentialIssuance struct {
+	// StartedAt is the time the credentials started to be issued
+	StartedAt metav1.Time `json:"startedAt"`
+
+	// +kubebuilder:validation:optional
+	//
+	// PriorAccessKeyIDs are the access keys the IAM user had before. Every other access key has been issued since.
+	PriorAccessKeyIDs []string `json:"priorAccessKeyIds,omitempty"`
 }
 
 // +kubebuilder:object:root=true
@@ -22,13 +22,41 @@ limitations under the License.
 package v1beta1
 
 import (
-	"k8s.io/api/core/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ARNReference) DeepCopyInto(out *ARNReference) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ARNReference.
+func (in *ARNReference) DeepCopy() *ARNReference {
+	if in == nil {
+		return nil
+	}
+	out := new(ARNReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *AWSObjectStatus) DeepCopyInto(out *AWSObjectStatus) {
 	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.PlannedOperations != nil {
+		in, out := &in.PlannedOperations, &out.PlannedOperations
+		*out = make([]PlannedOperation, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AWSObjectStatus.
@@ -110,6 +138,16 @@ func (in *AssumeRolePolicySpec) DeepCopyInto(out *AssumeRolePolicySpec) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.Document != nil {
+		in, out := &in.Document, &out.Document
+		*out = new(runtime.RawExtension)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.DocumentFrom != nil {
+		in, out := &in.DocumentFrom, &out.DocumentFrom
+		*out = new(DocumentSource)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AssumeRolePolicySpec.
@@ -154,6 +192,11 @@ func (in *AssumeRolePolicyStatementEntry) DeepCopyInto(out *AssumeRolePolicyStat
 			(*out)[key] = val
 		}
 	}
+	if in.PrincipalRefs != nil {
+		in, out := &in.PrincipalRefs, &out.PrincipalRefs
+		*out = make([]ARNReference, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AssumeRolePolicyStatementEntry.
@@ -181,6 +224,224 @@ func (in *AssumeRolePolicyStatus) DeepCopy() *AssumeRolePolicyStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterIAMConstraint) DeepCopyInto(out *ClusterIAMConstraint) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterIAMConstraint.
+func (in *ClusterIAMConstraint) DeepCopy() *ClusterIAMConstraint {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterIAMConstraint)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ClusterIAMConstraint) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterIAMConstraintList) DeepCopyInto(out *ClusterIAMConstraintList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]ClusterIAMConstraint, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterIAMConstraintList.
+func (in *ClusterIAMConstraintList) DeepCopy() *ClusterIAMConstraintList {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterIAMConstraintList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ClusterIAMConstraintList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterIAMConstraintSpec) DeepCopyInto(out *ClusterIAMConstraintSpec) {
+	*out = *in
+	in.IAMConstraintSpec.DeepCopyInto(&out.IAMConstraintSpec)
+	if in.NamespaceSelector != nil {
+		in, out := &in.NamespaceSelector, &out.NamespaceSelector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterIAMConstraintSpec.
+func (in *ClusterIAMConstraintSpec) DeepCopy() *ClusterIAMConstraintSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterIAMConstraintSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CredentialIssuance) DeepCopyInto(out *CredentialIssuance) {
+	*out = *in
+	in.StartedAt.DeepCopyInto(&out.StartedAt)
+	if in.PriorAccessKeyIDs != nil {
+		in, out := &in.PriorAccessKeyIDs, &out.PriorAccessKeyIDs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CredentialIssuance.
+func (in *CredentialIssuance) DeepCopy() *CredentialIssuance {
+	if in == nil {
+		return nil
+	}
+	out := new(CredentialIssuance)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CredentialSecret) DeepCopyInto(out *CredentialSecret) {
+	*out = *in
+	if in.Labels != nil {
+		in, out := &in.Labels, &out.Labels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Annotations != nil {
+		in, out := &in.Annotations, &out.Annotations
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Template != nil {
+		in, out := &in.Template, &out.Template
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.ReplicateTo != nil {
+		in, out := &in.ReplicateTo, &out.ReplicateTo
+		*out = new(SecretReplication)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CredentialSecret.
+func (in *CredentialSecret) DeepCopy() *CredentialSecret {
+	if in == nil {
+		return nil
+	}
+	out := new(CredentialSecret)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CredentialSink) DeepCopyInto(out *CredentialSink) {
+	*out = *in
+	if in.Vault != nil {
+		in, out := &in.Vault, &out.Vault
+		*out = new(VaultCredentialSink)
+		**out = **in
+	}
+	if in.SecretsManager != nil {
+		in, out := &in.SecretsManager, &out.SecretsManager
+		*out = new(SecretsManagerCredentialSink)
+		**out = **in
+	}
+	if in.SSM != nil {
+		in, out := &in.SSM, &out.SSM
+		*out = new(SSMCredentialSink)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CredentialSink.
+func (in *CredentialSink) DeepCopy() *CredentialSink {
+	if in == nil {
+		return nil
+	}
+	out := new(CredentialSink)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DocumentSource) DeepCopyInto(out *DocumentSource) {
+	*out = *in
+	if in.ConfigMapKeyRef != nil {
+		in, out := &in.ConfigMapKeyRef, &out.ConfigMapKeyRef
+		*out = new(KeySelector)
+		**out = **in
+	}
+	if in.SecretKeyRef != nil {
+		in, out := &in.SecretKeyRef, &out.SecretKeyRef
+		*out = new(KeySelector)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DocumentSource.
+func (in *DocumentSource) DeepCopy() *DocumentSource {
+	if in == nil {
+		return nil
+	}
+	out := new(DocumentSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DocumentStatus) DeepCopyInto(out *DocumentStatus) {
+	*out = *in
+	if in.ResolvedReferences != nil {
+		in, out := &in.ResolvedReferences, &out.ResolvedReferences
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DocumentStatus.
+func (in *DocumentStatus) DeepCopy() *DocumentStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(DocumentStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ExternalResource) DeepCopyInto(out *ExternalResource) {
 	*out = *in
@@ -202,7 +463,7 @@ func (in *Group) DeepCopyInto(out *Group) {
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Group.
@@ -220,73 +481,293 @@ func (in *Group) DeepCopyObject() runtime.Object {
 	if c := in.DeepCopy(); c != nil {
 		return c
 	}
-	return nil
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GroupList) DeepCopyInto(out *GroupList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]Group, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GroupList.
+func (in *GroupList) DeepCopy() *GroupList {
+	if in == nil {
+		return nil
+	}
+	out := new(GroupList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *GroupList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GroupSpec) DeepCopyInto(out *GroupSpec) {
+	*out = *in
+	if in.Users != nil {
+		in, out := &in.Users, &out.Users
+		*out = make([]corev1.ObjectReference, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GroupSpec.
+func (in *GroupSpec) DeepCopy() *GroupSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(GroupSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GroupStatus) DeepCopyInto(out *GroupStatus) {
+	*out = *in
+	in.AWSObjectStatus.DeepCopyInto(&out.AWSObjectStatus)
+	if in.Users != nil {
+		in, out := &in.Users, &out.Users
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GroupStatus.
+func (in *GroupStatus) DeepCopy() *GroupStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(GroupStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IAMConstraint) DeepCopyInto(out *IAMConstraint) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IAMConstraint.
+func (in *IAMConstraint) DeepCopy() *IAMConstraint {
+	if in == nil {
+		return nil
+	}
+	out := new(IAMConstraint)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *IAMConstraint) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IAMConstraintList) DeepCopyInto(out *IAMConstraintList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]IAMConstraint, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IAMConstraintList.
+func (in *IAMConstraintList) DeepCopy() *IAMConstraintList {
+	if in == nil {
+		return nil
+	}
+	out := new(IAMConstraintList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *IAMConstraintList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IAMConstraintSpec) DeepCopyInto(out *IAMConstraintSpec) {
+	*out = *in
+	if in.AllowedActions != nil {
+		in, out := &in.AllowedActions, &out.AllowedActions
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.DeniedActions != nil {
+		in, out := &in.DeniedActions, &out.DeniedActions
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.AllowedResources != nil {
+		in, out := &in.AllowedResources, &out.AllowedResources
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.RequiredConditions != nil {
+		in, out := &in.RequiredConditions, &out.RequiredConditions
+		*out = make([]RequiredCondition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.AllowedPrincipals != nil {
+		in, out := &in.AllowedPrincipals, &out.AllowedPrincipals
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.AllowedManagedPolicies != nil {
+		in, out := &in.AllowedManagedPolicies, &out.AllowedManagedPolicies
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.DeniedManagedPolicies != nil {
+		in, out := &in.DeniedManagedPolicies, &out.DeniedManagedPolicies
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IAMConstraintSpec.
+func (in *IAMConstraintSpec) DeepCopy() *IAMConstraintSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(IAMConstraintSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IRSA) DeepCopyInto(out *IRSA) {
+	*out = *in
+	if in.ServiceAccounts != nil {
+		in, out := &in.ServiceAccounts, &out.ServiceAccounts
+		*out = make([]ServiceAccountSubject, len(*in))
+		copy(*out, *in)
+	}
+	if in.Audiences != nil {
+		in, out := &in.Audiences, &out.Audiences
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IRSA.
+func (in *IRSA) DeepCopy() *IRSA {
+	if in == nil {
+		return nil
+	}
+	out := new(IRSA)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KeySelector) DeepCopyInto(out *KeySelector) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeySelector.
+func (in *KeySelector) DeepCopy() *KeySelector {
+	if in == nil {
+		return nil
+	}
+	out := new(KeySelector)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ManagedServiceAccount) DeepCopyInto(out *ManagedServiceAccount) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ManagedServiceAccount.
+func (in *ManagedServiceAccount) DeepCopy() *ManagedServiceAccount {
+	if in == nil {
+		return nil
+	}
+	out := new(ManagedServiceAccount)
+	in.DeepCopyInto(out)
+	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *GroupList) DeepCopyInto(out *GroupList) {
+func (in *PlannedOperation) DeepCopyInto(out *PlannedOperation) {
 	*out = *in
-	out.TypeMeta = in.TypeMeta
-	in.ListMeta.DeepCopyInto(&out.ListMeta)
-	if in.Items != nil {
-		in, out := &in.Items, &out.Items
-		*out = make([]Group, len(*in))
-		for i := range *in {
-			(*in)[i].DeepCopyInto(&(*out)[i])
-		}
-	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GroupList.
-func (in *GroupList) DeepCopy() *GroupList {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlannedOperation.
+func (in *PlannedOperation) DeepCopy() *PlannedOperation {
 	if in == nil {
 		return nil
 	}
-	out := new(GroupList)
+	out := new(PlannedOperation)
 	in.DeepCopyInto(out)
 	return out
 }
 
-// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
-func (in *GroupList) DeepCopyObject() runtime.Object {
-	if c := in.DeepCopy(); c != nil {
-		return c
-	}
-	return nil
-}
-
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *GroupSpec) DeepCopyInto(out *GroupSpec) {
+func (in *PodIdentity) DeepCopyInto(out *PodIdentity) {
 	*out = *in
-	if in.Users != nil {
-		in, out := &in.Users, &out.Users
-		*out = make([]v1.ObjectReference, len(*in))
+	if in.ServiceAccounts != nil {
+		in, out := &in.ServiceAccounts, &out.ServiceAccounts
+		*out = make([]ServiceAccountSubject, len(*in))
 		copy(*out, *in)
 	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GroupSpec.
-func (in *GroupSpec) DeepCopy() *GroupSpec {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PodIdentity.
+func (in *PodIdentity) DeepCopy() *PodIdentity {
 	if in == nil {
 		return nil
 	}
-	out := new(GroupSpec)
+	out := new(PodIdentity)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *GroupStatus) DeepCopyInto(out *GroupStatus) {
+func (in *PodIdentityAssociation) DeepCopyInto(out *PodIdentityAssociation) {
 	*out = *in
-	out.AWSObjectStatus = in.AWSObjectStatus
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GroupStatus.
-func (in *GroupStatus) DeepCopy() *GroupStatus {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PodIdentityAssociation.
+func (in *PodIdentityAssociation) DeepCopy() *PodIdentityAssociation {
 	if in == nil {
 		return nil
 	}
-	out := new(GroupStatus)
+	out := new(PodIdentityAssociation)
 	in.DeepCopyInto(out)
 	return out
 }
@@ -297,7 +778,7 @@ func (in *Policy) DeepCopyInto(out *Policy) {
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Policy.
@@ -324,7 +805,7 @@ func (in *PolicyAttachment) DeepCopyInto(out *PolicyAttachment) {
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	out.Spec = in.Spec
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PolicyAttachment.
@@ -395,6 +876,22 @@ func (in *PolicyAttachmentSpec) DeepCopy() *PolicyAttachmentSpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PolicyAttachmentStatus) DeepCopyInto(out *PolicyAttachmentStatus) {
+	*out = *in
+	in.AWSObjectStatus.DeepCopyInto(&out.AWSObjectStatus)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PolicyAttachmentStatus.
+func (in *PolicyAttachmentStatus) DeepCopy() *PolicyAttachmentStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(PolicyAttachmentStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PolicyList) DeepCopyInto(out *PolicyList) {
 	*out = *in
@@ -437,6 +934,16 @@ func (in *PolicySpec) DeepCopyInto(out *PolicySpec) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.Document != nil {
+		in, out := &in.Document, &out.Document
+		*out = new(runtime.RawExtension)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.DocumentFrom != nil {
+		in, out := &in.DocumentFrom, &out.DocumentFrom
+		*out = new(DocumentSource)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PolicySpec.
@@ -552,6 +1059,11 @@ func (in *PolicyStatementEntry) DeepCopyInto(out *PolicyStatementEntry) {
 			(*out)[key] = outVal
 		}
 	}
+	if in.ResourceRefs != nil {
+		in, out := &in.ResourceRefs, &out.ResourceRefs
+		*out = make([]ARNReference, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PolicyStatementEntry.
@@ -564,6 +1076,156 @@ func (in *PolicyStatementEntry) DeepCopy() *PolicyStatementEntry {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PolicyStatus) DeepCopyInto(out *PolicyStatus) {
+	*out = *in
+	in.AWSObjectStatus.DeepCopyInto(&out.AWSObjectStatus)
+	in.DocumentStatus.DeepCopyInto(&out.DocumentStatus)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PolicyStatus.
+func (in *PolicyStatus) DeepCopy() *PolicyStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(PolicyStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ReferenceGrant) DeepCopyInto(out *ReferenceGrant) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ReferenceGrant.
+func (in *ReferenceGrant) DeepCopy() *ReferenceGrant {
+	if in == nil {
+		return nil
+	}
+	out := new(ReferenceGrant)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ReferenceGrant) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ReferenceGrantFrom) DeepCopyInto(out *ReferenceGrantFrom) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ReferenceGrantFrom.
+func (in *ReferenceGrantFrom) DeepCopy() *ReferenceGrantFrom {
+	if in == nil {
+		return nil
+	}
+	out := new(ReferenceGrantFrom)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ReferenceGrantList) DeepCopyInto(out *ReferenceGrantList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]ReferenceGrant, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ReferenceGrantList.
+func (in *ReferenceGrantList) DeepCopy() *ReferenceGrantList {
+	if in == nil {
+		return nil
+	}
+	out := new(ReferenceGrantList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ReferenceGrantList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ReferenceGrantSpec) DeepCopyInto(out *ReferenceGrantSpec) {
+	*out = *in
+	if in.From != nil {
+		in, out := &in.From, &out.From
+		*out = make([]ReferenceGrantFrom, len(*in))
+		copy(*out, *in)
+	}
+	if in.To != nil {
+		in, out := &in.To, &out.To
+		*out = make([]ReferenceGrantTo, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ReferenceGrantSpec.
+func (in *ReferenceGrantSpec) DeepCopy() *ReferenceGrantSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ReferenceGrantSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ReferenceGrantTo) DeepCopyInto(out *ReferenceGrantTo) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ReferenceGrantTo.
+func (in *ReferenceGrantTo) DeepCopy() *ReferenceGrantTo {
+	if in == nil {
+		return nil
+	}
+	out := new(ReferenceGrantTo)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RequiredCondition) DeepCopyInto(out *RequiredCondition) {
+	*out = *in
+	if in.Values != nil {
+		in, out := &in.Values, &out.Values
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RequiredCondition.
+func (in *RequiredCondition) DeepCopy() *RequiredCondition {
+	if in == nil {
+		return nil
+	}
+	out := new(RequiredCondition)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ResourceReference) DeepCopyInto(out *ResourceReference) {
 	*out = *in
@@ -585,7 +1247,7 @@ func (in *Role) DeepCopyInto(out *Role) {
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Role.
@@ -649,6 +1311,21 @@ func (in *RoleSpec) DeepCopyInto(out *RoleSpec) {
 		}
 	}
 	out.AssumeRolePolicyReference = in.AssumeRolePolicyReference
+	if in.ServiceAccount != nil {
+		in, out := &in.ServiceAccount, &out.ServiceAccount
+		*out = new(ServiceAccountOptions)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.IRSA != nil {
+		in, out := &in.IRSA, &out.IRSA
+		*out = new(IRSA)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.PodIdentity != nil {
+		in, out := &in.PodIdentity, &out.PodIdentity
+		*out = new(PodIdentity)
+		(*in).DeepCopyInto(*out)
+	}
 	if in.MaxSessionDuration != nil {
 		in, out := &in.MaxSessionDuration, &out.MaxSessionDuration
 		*out = new(int64)
@@ -669,7 +1346,18 @@ func (in *RoleSpec) DeepCopy() *RoleSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *RoleStatus) DeepCopyInto(out *RoleStatus) {
 	*out = *in
-	out.AWSObjectStatus = in.AWSObjectStatus
+	in.AWSObjectStatus.DeepCopyInto(&out.AWSObjectStatus)
+	in.DocumentStatus.DeepCopyInto(&out.DocumentStatus)
+	if in.PodIdentityAssociations != nil {
+		in, out := &in.PodIdentityAssociations, &out.PodIdentityAssociations
+		*out = make([]PodIdentityAssociation, len(*in))
+		copy(*out, *in)
+	}
+	if in.ServiceAccounts != nil {
+		in, out := &in.ServiceAccounts, &out.ServiceAccounts
+		*out = make([]ManagedServiceAccount, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RoleStatus.
@@ -682,6 +1370,101 @@ func (in *RoleStatus) DeepCopy() *RoleStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SSMCredentialSink) DeepCopyInto(out *SSMCredentialSink) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SSMCredentialSink.
+func (in *SSMCredentialSink) DeepCopy() *SSMCredentialSink {
+	if in == nil {
+		return nil
+	}
+	out := new(SSMCredentialSink)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SecretReplication) DeepCopyInto(out *SecretReplication) {
+	*out = *in
+	if in.Namespaces != nil {
+		in, out := &in.Namespaces, &out.Namespaces
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.NamespaceSelector != nil {
+		in, out := &in.NamespaceSelector, &out.NamespaceSelector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SecretReplication.
+func (in *SecretReplication) DeepCopy() *SecretReplication {
+	if in == nil {
+		return nil
+	}
+	out := new(SecretReplication)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SecretsManagerCredentialSink) DeepCopyInto(out *SecretsManagerCredentialSink) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SecretsManagerCredentialSink.
+func (in *SecretsManagerCredentialSink) DeepCopy() *SecretsManagerCredentialSink {
+	if in == nil {
+		return nil
+	}
+	out := new(SecretsManagerCredentialSink)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ServiceAccountOptions) DeepCopyInto(out *ServiceAccountOptions) {
+	*out = *in
+	if in.STSRegionalEndpoints != nil {
+		in, out := &in.STSRegionalEndpoints, &out.STSRegionalEndpoints
+		*out = new(bool)
+		**out = **in
+	}
+	if in.TokenExpiration != nil {
+		in, out := &in.TokenExpiration, &out.TokenExpiration
+		*out = new(int64)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ServiceAccountOptions.
+func (in *ServiceAccountOptions) DeepCopy() *ServiceAccountOptions {
+	if in == nil {
+		return nil
+	}
+	out := new(ServiceAccountOptions)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ServiceAccountSubject) DeepCopyInto(out *ServiceAccountSubject) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ServiceAccountSubject.
+func (in *ServiceAccountSubject) DeepCopy() *ServiceAccountSubject {
+	if in == nil {
+		return nil
+	}
+	out := new(ServiceAccountSubject)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *TargetReference) DeepCopyInto(out *TargetReference) {
 	*out = *in
@@ -702,8 +1485,8 @@ func (in *User) DeepCopyInto(out *User) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	out.Spec = in.Spec
-	out.Status = in.Status
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new User.
@@ -759,6 +1542,16 @@ func (in *UserList) DeepCopyObject() runtime.Object {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *UserSpec) DeepCopyInto(out *UserSpec) {
 	*out = *in
+	if in.CredentialSecret != nil {
+		in, out := &in.CredentialSecret, &out.CredentialSecret
+		*out = new(CredentialSecret)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.CredentialSink != nil {
+		in, out := &in.CredentialSink, &out.CredentialSink
+		*out = new(CredentialSink)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new UserSpec.
@@ -774,9 +1567,37 @@ func (in *UserSpec) DeepCopy() *UserSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *UserStatus) DeepCopyInto(out *UserStatus) {
 	*out = *in
-	out.AWSObjectStatus = in.AWSObjectStatus
+	in.AWSObjectStatus.DeepCopyInto(&out.AWSObjectStatus)
 	out.LoginProfileSecret = in.LoginProfileSecret
 	out.ProgrammaticAccessSecret = in.ProgrammaticAccessSecret
+	if in.LoginProfileIssuedAt != nil {
+		in, out := &in.LoginProfileIssuedAt, &out.LoginProfileIssuedAt
+		*out = (*in).DeepCopy()
+	}
+	if in.AccessKeyIssuedAt != nil {
+		in, out := &in.AccessKeyIssuedAt, &out.AccessKeyIssuedAt
+		*out = (*in).DeepCopy()
+	}
+	if in.PendingIssuance != nil {
+		in, out := &in.PendingIssuance, &out.PendingIssuance
+		*out = new(CredentialIssuance)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.CredentialSink != nil {
+		in, out := &in.CredentialSink, &out.CredentialSink
+		*out = new(CredentialSink)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.CredentialSecret != nil {
+		in, out := &in.CredentialSecret, &out.CredentialSecret
+		*out = new(CredentialSecret)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ReplicatedSecrets != nil {
+		in, out := &in.ReplicatedSecrets, &out.ReplicatedSecrets
+		*out = make([]corev1.SecretReference, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new UserStatus.
@@ -788,3 +1609,18 @@ func (in *UserStatus) DeepCopy() *UserStatus {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VaultCredentialSink) DeepCopyInto(out *VaultCredentialSink) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VaultCredentialSink.
+func (in *VaultCredentialSink) DeepCopy() *VaultCredentialSink {
+	if in == nil {
+		return nil
+	}
+	out := new(VaultCredentialSink)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -0,0 +1,236 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// iamctl renders the manifests of the operator as the IAM JSON the operator would send to AWS, validates and diffs it.
+// That works fully offline, so it can run in CI. It also imports the IAM objects of an existing account as manifests.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/iam"
+
+	"github.com/redradrat/aws-iam-operator/pkg/importer"
+	"github.com/redradrat/aws-iam-operator/pkg/limits"
+	"github.com/redradrat/aws-iam-operator/pkg/lint"
+	"github.com/redradrat/aws-iam-operator/pkg/render"
+)
+
+const usage = `iamctl renders aws-iam-operator manifests as IAM JSON, without access to a cluster or AWS.
+
+Usage:
+  iamctl render [flags] <path>...                  print the IAM JSON of all resources
+  iamctl validate [flags] <path>...                lint the IAM JSON and check it against limits and IAMConstraints
+  iamctl diff [flags] -previous <path> <path>...   diff the IAM JSON against a previous revision of the manifests
+  iamctl import [flags]                            generate manifests for the IAM objects of an existing account
+
+A path is a manifest file, a directory of manifests or "-" for stdin. Only "import" talks to AWS. Run "iamctl <command> -h" for the flags.
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "render":
+		err = runRender(os.Args[2:])
+	case "validate":
+		err = runValidate(os.Args[2:])
+	case "diff":
+		err = runDiff(os.Args[2:])
+	case "import":
+		err = runImport(os.Args[2:])
+	case "-h", "-help", "--help", "help":
+		fmt.Fprint(os.Stdout, usage)
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command '%s'\n\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		if exitErr, ok := err.(exitError); ok {
+			os.Exit(exitErr.code)
+		}
+		os.Exit(1)
+	}
+}
+
+// exitError makes iamctl exit with a specific code
+type exitError struct {
+	code int
+	msg  string
+}
+
+func (e exitError) Error() string {
+	return e.msg
+}
+
+// stringsFlag is a flag, which can be given multiple times
+type stringsFlag []string
+
+func (s *stringsFlag) String() string {
+	return fmt.Sprint(*s)
+}
+
+func (s *stringsFlag) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
+
+// commonFlags are the flags shared by all commands. Their names and defaults match the ones of the operator.
+type commonFlags struct {
+	namespace string
+	opts      render.Options
+}
+
+func newFlagSet(name string) (*flag.FlagSet, *commonFlags) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	c := &commonFlags{}
+	fs.StringVar(&c.namespace, "namespace", "default", "The namespace of resources without a namespace in their manifest.")
+	fs.StringVar(&c.opts.OidcProviderARN, "oidc-provider-arn", "", "The ARN of the identity provider to use for injecting IRSA trust statements.")
+	fs.StringVar(&c.opts.Region, "region", "eu-west-1", "The AWS region of the operator.")
+	fs.IntVar(&c.opts.MaxTrustPolicySize, "max-trust-policy-size", limits.DefaultTrustPolicySizeLimit, "The maximum size of role trust policies in characters.")
+	fs.StringVar(&c.opts.Values.AccountID, "account-id", "", "The ID of the AWS account, which ${aws:accountId} expands to.")
+	fs.StringVar(&c.opts.Values.ClusterName, "cluster-name", "", "The name of the cluster, which ${operator:clusterName} expands to.")
+	fs.StringVar(&c.opts.Values.Prefix, "resource-prefix", "", "The resource prefix of the operator, which ${operator:prefix} expands to, and the names of referenced resources are prefixed with.")
+	return fs, c
+}
+
+func runRender(args []string) error {
+	fs, c := newFlagSet("render")
+	fs.Parse(args)
+
+	m, err := render.LoadFiles(fs.Args(), c.namespace)
+	if err != nil {
+		return err
+	}
+
+	failed := false
+	for _, d := range render.Render(m, c.opts) {
+		text, err := d.JSON()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", d.ID(), err)
+			failed = true
+			continue
+		}
+		fmt.Printf("# %s\n%s", d.ID(), text)
+	}
+	if failed {
+		return exitError{code: 1, msg: "some resources could not be rendered"}
+	}
+	return nil
+}
+
+func runValidate(args []string) error {
+	fs, c := newFlagSet("validate")
+	strict := fs.Bool("strict", false, "Treat warnings as errors.")
+	fs.Parse(args)
+
+	m, err := render.LoadFiles(fs.Args(), c.namespace)
+	if err != nil {
+		return err
+	}
+
+	errs, warnings := 0, 0
+	for _, f := range render.Validate(m, render.Render(m, c.opts), c.opts) {
+		fmt.Println(f)
+		if f.Severity == lint.ErrorSeverity {
+			errs++
+		} else {
+			warnings++
+		}
+	}
+
+	if errs > 0 || *strict && warnings > 0 {
+		return exitError{code: 1, msg: fmt.Sprintf("validation failed with %d errors and %d warnings", errs, warnings)}
+	}
+	return nil
+}
+
+func runDiff(args []string) error {
+	fs, c := newFlagSet("diff")
+	var previousPaths stringsFlag
+	fs.Var(&previousPaths, "previous", "A path of the previous revision of the manifests. Can be given multiple times.")
+	exitCode := fs.Bool("exit-code", false, "Exit with code 1, if there are differences.")
+	fs.Parse(args)
+
+	var previous []render.Document
+	if len(previousPaths) > 0 {
+		m, err := render.LoadFiles(previousPaths, c.namespace)
+		if err != nil {
+			return err
+		}
+		previous = render.Render(m, c.opts)
+	}
+	m, err := render.LoadFiles(fs.Args(), c.namespace)
+	if err != nil {
+		return err
+	}
+
+	diff := render.Diff(previous, render.Render(m, c.opts))
+	fmt.Print(diff)
+	if *exitCode && diff != "" {
+		return exitError{code: 1, msg: "IAM JSON differs"}
+	}
+	return nil
+}
+
+func runImport(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	namespace := fs.String("namespace", "default", "The namespace of the generated resources.")
+	region := fs.String("region", "eu-west-1", "The AWS region to use for the IAM API.")
+	pathPrefix := fs.String("path-prefix", "/", "Only import IAM objects with this path prefix, when reading from the IAM API.")
+	resourcePrefix := fs.String("resource-prefix", "", "The resource prefix of the operator, which is stripped from the IAM names.")
+	fixture := fs.String("fixture", "", "Read the IAM objects from a recorded fixture instead of the IAM API.")
+	record := fs.String("record", "", "Record the IAM objects read from the IAM API as a fixture in this file.")
+	fs.Parse(args)
+
+	var acc *importer.Account
+	var err error
+	if *fixture != "" {
+		if acc, err = importer.LoadAccount(*fixture); err != nil {
+			return err
+		}
+	} else {
+		sess, err := session.NewSession(&aws.Config{Region: aws.String(*region)})
+		if err != nil {
+			return err
+		}
+		if acc, err = importer.ReadAccount(iam.New(sess), *pathPrefix); err != nil {
+			return err
+		}
+		if *record != "" {
+			if err := acc.Save(*record); err != nil {
+				return err
+			}
+		}
+	}
+
+	res := importer.Generate(acc, importer.Options{Namespace: *namespace, ResourcePrefix: *resourcePrefix})
+	for _, w := range res.Warnings {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", w)
+	}
+	return importer.WriteYAML(os.Stdout, res.Objects)
+}
@@ -0,0 +1,148 @@
+package controllers
+
+import (
+	"fmt"
+	"strings"
+
+	awssdk "github.com/aws/aws-sdk-go/aws"
+	awsarn "github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	awsiam "github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/iam/iamiface"
+	"github.com/redradrat/cloud-objects/aws"
+	"github.com/redradrat/cloud-objects/aws/iam"
+	"k8s.io/client-go/tools/record"
+
+	iamv1beta1 "github.com/redradrat/aws-iam-operator/api/v1beta1"
+)
+
+// adoptionARN returns the ARN of the adopt annotation of obj, as long as obj has no AWS object of its own yet. A
+// resource, which is being deleted, never adopts anything.
+func adoptionARN(obj AWSObjectStatusResource) string {
+	if obj.GetStatus().ARN != "" || !obj.RuntimeObject().GetDeletionTimestamp().IsZero() {
+		return ""
+	}
+	return obj.RuntimeObject().GetAnnotations()[iamv1beta1.AdoptAnnotation]
+}
+
+// objectARN returns the ARN of the AWS object behind obj: the one in its status, or the one it is about to adopt
+func objectARN(obj AWSObjectStatusResource) string {
+	if arn := adoptionARN(obj); arn != "" {
+		return arn
+	}
+	return obj.GetStatus().ARN
+}
+
+// AdoptionPolicy selects the namespaces, in which resources may adopt existing AWS objects. Adoption is disabled, unless
+// it's allowed in at least one namespace, as taking over an IAM object hands its permissions to the namespace.
+type AdoptionPolicy struct {
+	// Namespaces are the namespaces, in which adoption is allowed. "*" allows it in all namespaces.
+	Namespaces []string
+}
+
+// Allows returns true, if resources in the namespace may adopt existing AWS objects
+func (p AdoptionPolicy) Allows(namespace string) bool {
+	for _, ns := range p.Namespaces {
+		if ns == "*" || ns == namespace {
+			return true
+		}
+	}
+	return false
+}
+
+// AdoptAWSObject takes over the existing AWS object behind the given instance, instead of creating a new one. The AWS
+// object is left as it is, the spec of the resource is applied with its next change. In dry-run mode, the operation
+// is only planned. Adoption is blocked, unless the policy allows it in the namespace of obj, and the AWS object has the
+// name the resource would create.
+func AdoptAWSObject(svc iamiface.IAMAPI, ins aws.Instance, recorder record.EventRecorder, obj AWSObjectStatusResource, policy AdoptionPolicy, dryRun bool) (StatusUpdater, error) {
+	preFunc := func() error {
+		if ns := obj.RuntimeObject().GetNamespace(); !policy.Allows(ns) {
+			return fmt.Errorf("adopting existing IAM objects is not allowed in namespace '%s'", ns)
+		}
+		return validateAdoption(ins)
+	}
+	return applyAWSOperation(svc, awsOperation{Type: iamv1beta1.AdoptOperation, Instance: ins}, recorder, obj, preFunc, dryRun)
+}
+
+// isAlreadyExistsError returns true, if AWS refused to create an IAM object, as one with the same name exists
+func isAlreadyExistsError(err error) bool {
+	aerr, ok := err.(awserr.Error)
+	return ok && aerr.Code() == awsiam.ErrCodeEntityAlreadyExistsException
+}
+
+// alreadyExistsMessage returns the status message of obj, when its IAM object with the given name could not be created,
+// as one with that name exists. That object may belong to a resource in another namespace, or not be managed at all,
+// so it's never taken over without the adopt annotation.
+func alreadyExistsMessage(obj AWSObjectStatusResource, name string) string {
+	return fmt.Sprintf("%s '%s' already exists in AWS and may belong to another resource; to take it over, set the '%s' annotation to its ARN in a namespace adoption is allowed in",
+		kindOf(obj), name, iamv1beta1.AdoptAnnotation)
+}
+
+// adoptionTarget returns the IAM resource type and the name of the AWS object behind the given instance
+func adoptionTarget(ins aws.Instance) (string, string, error) {
+	switch i := ins.(type) {
+	case *iam.RoleInstance:
+		return "role", i.Name, nil
+	case *rawRoleInstance:
+		return "role", i.Name, nil
+	case *iam.PolicyInstance:
+		return "policy", i.Name, nil
+	case *rawPolicyInstance:
+		return "policy", i.Name, nil
+	case *iam.UserInstance:
+		return "user", i.Name, nil
+	case *iam.GroupInstance:
+		return "group", i.Name, nil
+	}
+	return "", "", fmt.Errorf("adopting %T is not supported", ins)
+}
+
+// validateAdoption makes sure the ARN of the given instance is the one of an IAM object of its kind, with the name the
+// instance has. Otherwise, any IAM object of the account could be taken over by naming its ARN.
+func validateAdoption(ins aws.Instance) error {
+	resourceType, name, err := adoptionTarget(ins)
+	if err != nil {
+		return err
+	}
+	arn := ins.ARN()
+	if arn.Service != "iam" || !strings.HasPrefix(arn.Resource, resourceType+"/") {
+		return fmt.Errorf("cannot adopt '%s', it is not an IAM %s", arn, resourceType)
+	}
+	if existing := iam.FriendlyNamefromARN(arn); existing != name {
+		return fmt.Errorf("cannot adopt '%s', its name '%s' differs from the name '%s' of the %s to be created", arn, existing, name, resourceType)
+	}
+	return nil
+}
+
+// checkAdoptable makes sure the AWS object behind the given instance can be adopted, and exists. The returned AWS
+// errors are not wrapped, so throttling is still detected.
+func checkAdoptable(svc iamiface.IAMAPI, ins aws.Instance) error {
+	if err := validateAdoption(ins); err != nil {
+		return err
+	}
+	arn := ins.ARN()
+	name := awssdk.String(iam.FriendlyNamefromARN(arn))
+
+	var err error
+	switch ins.(type) {
+	case *iam.RoleInstance, *rawRoleInstance:
+		_, err = svc.GetRole(&awsiam.GetRoleInput{RoleName: name})
+	case *iam.PolicyInstance, *rawPolicyInstance:
+		_, err = svc.GetPolicy(&awsiam.GetPolicyInput{PolicyArn: awssdk.String(arn.String())})
+	case *iam.UserInstance:
+		_, err = svc.GetUser(&awsiam.GetUserInput{UserName: name})
+	case *iam.GroupInstance:
+		_, err = svc.GetGroup(&awsiam.GetGroupInput{GroupName: name})
+	}
+	return err
+}
+
+// parseObjectARN parses the ARN of the AWS object behind obj, see objectARN
+func parseObjectARN(obj AWSObjectStatusResource) (awsarn.ARN, error) {
+	arn := objectARN(obj)
+	parsed, err := awsarn.Parse(arn)
+	if err != nil {
+		return awsarn.ARN{}, fmt.Errorf("ARN '%s' of %s is not valid/parsable", arn, kindOf(obj))
+	}
+	return parsed, nil
+}
@@ -0,0 +1,139 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	iamv1beta1 "github.com/redradrat/aws-iam-operator/api/v1beta1"
+)
+
+// Reasons for the ReferencesResolved condition
+const (
+	ReferencesResolvedReason = "Resolved"
+	ReferencePendingReason   = "ReferencePending"
+)
+
+// referenceNotReadyError is returned, while a referenced resource does not exist or has no ARN yet
+type referenceNotReadyError struct {
+	ref iamv1beta1.ARNReference
+}
+
+func (e *referenceNotReadyError) Error() string {
+	return fmt.Sprintf("referenced %s '%s/%s' has no ARN yet", e.ref.Kind, e.ref.Namespace, e.ref.Name)
+}
+
+// IsReferenceNotReady returns true, if err tells that a referenced resource has no ARN yet
+func IsReferenceNotReady(err error) bool {
+	var notReady *referenceNotReadyError
+	return errors.As(err, &notReady)
+}
+
+// ARNResolver resolves ARNReferences from the status of the referenced resources. It remembers all references it has
+// been asked for, and the ARNs it resolved.
+type ARNResolver struct {
+	ctx context.Context
+	c   client.Reader
+
+	refs     []objectReference
+	resolved map[string]string
+}
+
+// NewARNResolver returns an ARNResolver reading the referenced resources through the given client
+func NewARNResolver(ctx context.Context, c client.Reader) *ARNResolver {
+	return &ARNResolver{ctx: ctx, c: c, resolved: map[string]string{}}
+}
+
+// Resolve returns the ARN of the referenced resource. It's an iamv1beta1.ARNResolver.
+func (r *ARNResolver) Resolve(ref iamv1beta1.ARNReference) (string, error) {
+	r.refs = append(r.refs, objectReference{Kind: ref.Kind, Namespace: ref.Namespace, Name: ref.Name})
+
+	var obj AWSObjectStatusResource
+	switch ref.Kind {
+	case "Role":
+		obj = &iamv1beta1.Role{}
+	case "User":
+		obj = &iamv1beta1.User{}
+	case "Group":
+		obj = &iamv1beta1.Group{}
+	case "Policy":
+		obj = &iamv1beta1.Policy{}
+	default:
+		return "", fmt.Errorf("cannot reference the ARN of a %s", ref.Kind)
+	}
+
+	if err := r.c.Get(r.ctx, client.ObjectKey{Namespace: ref.Namespace, Name: ref.Name}, obj.RuntimeObject()); err != nil {
+		if apierrors.IsNotFound(err) {
+			return "", &referenceNotReadyError{ref: ref}
+		}
+		return "", err
+	}
+	arn := obj.GetStatus().ARN
+	if arn == "" {
+		return "", &referenceNotReadyError{ref: ref}
+	}
+	r.resolved[ref.Key()] = arn
+	return arn, nil
+}
+
+// referencesUpToDate returns true, if the ARNs of the referenced resources are the ones last applied for obj
+func referencesUpToDate(obj DocumentStatusResource, resolved map[string]string) bool {
+	applied := obj.GetDocumentStatus().ResolvedReferences
+	if len(applied) == 0 && len(resolved) == 0 {
+		return true
+	}
+	return reflect.DeepEqual(applied, resolved)
+}
+
+// markReferencesApplied records the given ARNs of the referenced resources as applied for obj
+func markReferencesApplied(obj DocumentStatusResource, resolved map[string]string) {
+	if len(resolved) == 0 {
+		resolved = nil
+	}
+	obj.GetDocumentStatus().ResolvedReferences = resolved
+}
+
+// setReferencesResolved records the outcome of resolving the references of obj in the ReferencesResolved condition.
+// The condition is removed, if obj references nothing. Returns whether the condition changed.
+func setReferencesResolved(obj AWSObjectStatusResource, hasReferences bool, err error) bool {
+	if !hasReferences {
+		if meta.FindStatusCondition(obj.GetStatus().Conditions, iamv1beta1.ReferencesResolvedCondition) == nil {
+			return false
+		}
+		meta.RemoveStatusCondition(&obj.GetStatus().Conditions, iamv1beta1.ReferencesResolvedCondition)
+		return true
+	}
+
+	cond := metav1.Condition{
+		Type:               iamv1beta1.ReferencesResolvedCondition,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: obj.RuntimeObject().GetGeneration(),
+		Reason:             ReferencesResolvedReason,
+		Message:            "the ARNs of all referenced resources are known",
+	}
+	if IsReferenceNotReady(err) {
+		cond.Status = metav1.ConditionFalse
+		cond.Reason = ReferencePendingReason
+		cond.Message = err.Error()
+	}
+	return setStatusCondition(obj, cond)
+}
+
+// requestsForARNReference returns a function mapping a Role, User, Group or Policy to reconcile requests for all
+// objects of the given list type, which reference its ARN
+func requestsForARNReference(c client.Reader, list client.ObjectList, kind string) func(client.Object) []reconcile.Request {
+	return requestsForIndex(c, list, arnReferencesIndex, func(obj client.Object) string {
+		return arnReferenceIndexKey(kind, obj.GetNamespace(), obj.GetName())
+	})
+}
+
+func arnReferenceIndexKey(kind, namespace, name string) string {
+	return iamv1beta1.ARNReference{Kind: kind, Namespace: namespace, Name: name}.Key()
+}
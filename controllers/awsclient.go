@@ -0,0 +1,260 @@
+package controllers
+
+import (
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	awssdk "github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/eks"
+	"github.com/aws/aws-sdk-go/service/eks/eksiface"
+	awsiam "github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/secretsmanager/secretsmanageriface"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/aws/aws-sdk-go/service/ssm/ssmiface"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/redradrat/cloud-objects/aws/iam"
+	"golang.org/x/time/rate"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// AWSClientOptions configures the process-wide AWS clients, which are shared by all reconcilers
+type AWSClientOptions struct {
+	// QPS is the sustained rate of AWS API requests per second, which the operator is allowed to make
+	QPS float64
+	// Burst is the maximum number of AWS API requests, which may be made at once
+	Burst int
+	// MaxRetries is the maximum number of retries for a single AWS API request
+	MaxRetries int
+	// ThrottleRequeueDelay is the base delay, after which a reconcile request is retried, if it ran into throttling
+	// after all retries have been exhausted
+	ThrottleRequeueDelay time.Duration
+}
+
+func DefaultAWSClientOptions() AWSClientOptions {
+	return AWSClientOptions{
+		QPS:                  10,
+		Burst:                20,
+		MaxRetries:           8,
+		ThrottleRequeueDelay: 30 * time.Second,
+	}
+}
+
+var (
+	awsClientsMu      sync.Mutex
+	awsClientOptions  = DefaultAWSClientOptions()
+	awsRequestLimiter = rate.NewLimiter(rate.Limit(awsClientOptions.QPS), awsClientOptions.Burst)
+	iamClients        = map[string]*awsiam.IAM{}
+	eksClients        = map[string]*eks.EKS{}
+	smClients         = map[string]*secretsmanager.SecretsManager{}
+	ssmClients        = map[string]*ssm.SSM{}
+)
+
+// ConfigureAWSClients sets the options for all AWS clients created from here on. It is meant to be called once on
+// startup, before any client is in use.
+func ConfigureAWSClients(opts AWSClientOptions) {
+	awsClientsMu.Lock()
+	defer awsClientsMu.Unlock()
+
+	awsClientOptions = opts
+	awsRequestLimiter = rate.NewLimiter(rate.Limit(opts.QPS), opts.Burst)
+	iamClients = map[string]*awsiam.IAM{}
+	eksClients = map[string]*eks.EKS{}
+	smClients = map[string]*secretsmanager.SecretsManager{}
+	ssmClients = map[string]*ssm.SSM{}
+}
+
+// IAMService returns the shared IAM client for the given region. The client is created on first use and is rate
+// limited and instrumented.
+func IAMService(region string) (*awsiam.IAM, error) {
+	awsClientsMu.Lock()
+	defer awsClientsMu.Unlock()
+
+	if svc, ok := iamClients[region]; ok {
+		return svc, nil
+	}
+
+	session, err := newAWSSession(region)
+	if err != nil {
+		return nil, err
+	}
+
+	svc := iam.Client(session)
+	instrumentAWSClient(&svc.Handlers)
+	iamClients[region] = svc
+
+	return svc, nil
+}
+
+// EKSService returns the shared EKS client for the given region, which is rate limited and instrumented like the IAM
+// client
+func EKSService(region string) (eksiface.EKSAPI, error) {
+	awsClientsMu.Lock()
+	defer awsClientsMu.Unlock()
+
+	if svc, ok := eksClients[region]; ok {
+		return svc, nil
+	}
+
+	session, err := newAWSSession(region)
+	if err != nil {
+		return nil, err
+	}
+
+	svc := eks.New(session)
+	instrumentAWSClient(&svc.Handlers)
+	eksClients[region] = svc
+
+	return svc, nil
+}
+
+// SecretsManagerService returns the shared Secrets Manager client for the given region, which is rate limited and
+// instrumented like the IAM client
+func SecretsManagerService(region string) (secretsmanageriface.SecretsManagerAPI, error) {
+	awsClientsMu.Lock()
+	defer awsClientsMu.Unlock()
+
+	if svc, ok := smClients[region]; ok {
+		return svc, nil
+	}
+
+	session, err := newAWSSession(region)
+	if err != nil {
+		return nil, err
+	}
+
+	svc := secretsmanager.New(session)
+	instrumentAWSClient(&svc.Handlers)
+	smClients[region] = svc
+
+	return svc, nil
+}
+
+// SSMService returns the shared SSM client for the given region, which is rate limited and instrumented like the IAM
+// client
+func SSMService(region string) (ssmiface.SSMAPI, error) {
+	awsClientsMu.Lock()
+	defer awsClientsMu.Unlock()
+
+	if svc, ok := ssmClients[region]; ok {
+		return svc, nil
+	}
+
+	session, err := newAWSSession(region)
+	if err != nil {
+		return nil, err
+	}
+
+	svc := ssm.New(session)
+	instrumentAWSClient(&svc.Handlers)
+	ssmClients[region] = svc
+
+	return svc, nil
+}
+
+// AccountID returns the ID of the AWS account the credentials of the operator belong to
+func AccountID(region string) (string, error) {
+	awsClientsMu.Lock()
+	session, err := newAWSSession(region)
+	awsClientsMu.Unlock()
+	if err != nil {
+		return "", err
+	}
+
+	out, err := sts.New(session).GetCallerIdentity(&sts.GetCallerIdentityInput{})
+	if err != nil {
+		return "", err
+	}
+	return awssdk.StringValue(out.Account), nil
+}
+
+// newAWSSession creates a session with our retry policy and the shared request limiter. Needs to be called with
+// awsClientsMu held.
+func newAWSSession(region string) (*session.Session, error) {
+	cfg := request.WithRetryer(&awssdk.Config{Region: awssdk.String(region)}, throttlingRetryer{
+		DefaultRetryer: client.DefaultRetryer{
+			NumMaxRetries:    awsClientOptions.MaxRetries,
+			MinThrottleDelay: time.Second,
+			MaxThrottleDelay: 30 * time.Second,
+		},
+	})
+	session, err := session.NewSession(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// The Sign handlers run for every attempt, so retries are accounted for as well
+	limiter := awsRequestLimiter
+	session.Handlers.Sign.PushFrontNamed(request.NamedHandler{
+		Name: "aws-iam-operator.ratelimit",
+		Fn: func(r *request.Request) {
+			if err := limiter.Wait(r.Context()); err != nil {
+				r.Error = awserr.New(request.CanceledErrorCode, "request rate limiter wait aborted", err)
+			}
+		},
+	})
+
+	return session, nil
+}
+
+// throttlingRetryer is the SDK default retryer (jittered exponential backoff with a longer backoff on throttling), that
+// additionally retries errors we know to be caused by IAM's eventual consistency.
+type throttlingRetryer struct {
+	client.DefaultRetryer
+}
+
+func (r throttlingRetryer) ShouldRetry(req *request.Request) bool {
+	if req.RetryCount < r.MaxRetries() && isEventualConsistencyError(req.Operation.Name, req.Error) {
+		return true
+	}
+	return r.DefaultRetryer.ShouldRetry(req)
+}
+
+// isEventualConsistencyError returns true for errors IAM returns, when an entity created a moment ago is referenced
+// before it has propagated.
+func isEventualConsistencyError(operation string, err error) bool {
+	aerr, ok := err.(awserr.Error)
+	if !ok {
+		return false
+	}
+	switch aerr.Code() {
+	case awsiam.ErrCodeMalformedPolicyDocumentException:
+		// a principal in a trust policy, which has just been created
+		return strings.Contains(aerr.Message(), "Invalid principal")
+	case awsiam.ErrCodeNoSuchEntityException:
+		// operations referencing another entity, which might have just been created
+		return strings.HasPrefix(operation, "Attach") ||
+			operation == "AddUserToGroup" ||
+			operation == "CreateLoginProfile" ||
+			operation == "CreateAccessKey"
+	case awsiam.ErrCodeConcurrentModificationException:
+		return true
+	}
+	return false
+}
+
+func isThrottlingError(err error) bool {
+	return request.IsErrorThrottle(err)
+}
+
+// resultForAWSError returns the reconcile result for an error returned by an AWS call. Throttling errors are not handed
+// back to controller-runtime, as that would requeue almost immediately and make the throttling worse. We requeue after
+// a jittered delay instead.
+func resultForAWSError(err error) (ctrl.Result, error) {
+	if err == nil {
+		return ctrl.Result{}, nil
+	}
+	if isThrottlingError(err) {
+		awsClientsMu.Lock()
+		delay := awsClientOptions.ThrottleRequeueDelay
+		awsClientsMu.Unlock()
+		return ctrl.Result{RequeueAfter: delay + time.Duration(rand.Int63n(int64(delay)/2+1))}, nil
+	}
+	return ctrl.Result{}, err
+}
@@ -0,0 +1,107 @@
+package controllers
+
+import (
+	"context"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	iamv1beta1 "github.com/redradrat/aws-iam-operator/api/v1beta1"
+	"github.com/redradrat/aws-iam-operator/pkg/constraints"
+)
+
+// Reasons for the ConstraintsSatisfied condition
+const (
+	ConstraintsSatisfiedReason = "ConstraintsSatisfied"
+	ConstraintsWarnedReason    = "ConstraintsWarned"
+	ConstraintsViolatedReason  = "ConstraintsViolated"
+)
+
+// checkConstraints evaluates the policy document of obj against all constraints applying to its namespace, and records
+// the result in the ConstraintsSatisfied condition of obj. Violations of warning constraints are emitted as Events.
+// Returns whether the condition changed, and an error if the document violates a denying constraint.
+func checkConstraints(ctx context.Context, c client.Reader, obj AWSObjectStatusResource, doc Document, trust bool, recorder record.EventRecorder) (bool, error) {
+	result, err := constraints.Check(ctx, c, obj.RuntimeObject().GetNamespace(), doc.PolicyDocument, trust, doc.Raw != nil)
+	if err != nil {
+		return false, err
+	}
+	return recordConstraintResult(obj, result, "policy satisfies all constraints", recorder)
+}
+
+// checkManagedPolicyConstraints evaluates the ARN of the managed policy, which the PolicyAttachment attaches as
+// externalPolicy, against all constraints applying to its namespace, and records the result like checkConstraints.
+func checkManagedPolicyConstraints(ctx context.Context, c client.Reader, policyAttachment *iamv1beta1.PolicyAttachment, recorder record.EventRecorder) (bool, error) {
+	arn := policyAttachment.Spec.ExternalPolicy.ARN
+	if arn == "" {
+		// policies managed by the operator are checked themselves
+		meta.RemoveStatusCondition(&policyAttachment.Status.Conditions, iamv1beta1.ConstraintsSatisfiedCondition)
+		return false, nil
+	}
+	result, err := constraints.CheckManagedPolicy(ctx, c, policyAttachment.Namespace, arn)
+	if err != nil {
+		return false, err
+	}
+	return recordConstraintResult(policyAttachment, result, "managed policy satisfies all constraints", recorder)
+}
+
+// recordConstraintResult records the result of evaluating constraints in the ConstraintsSatisfied condition of obj
+func recordConstraintResult(obj AWSObjectStatusResource, result constraints.Result, satisfied string, recorder record.EventRecorder) (bool, error) {
+	cond := metav1.Condition{
+		Type:               iamv1beta1.ConstraintsSatisfiedCondition,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: obj.RuntimeObject().GetGeneration(),
+		Reason:             ConstraintsSatisfiedReason,
+		Message:            satisfied,
+	}
+	switch {
+	case result.Error() != nil:
+		cond.Status = metav1.ConditionFalse
+		cond.Reason = ConstraintsViolatedReason
+		cond.Message = result.Error().Error()
+	case !result.Ok():
+		cond.Reason = ConstraintsWarnedReason
+		cond.Message = strings.Join(result.Warnings(), "; ")
+
+	}
+
+	changed := setStatusCondition(obj, cond)
+	// only emit the warnings, if they changed since we last looked
+	if changed && cond.Reason == ConstraintsWarnedReason {
+		recorder.Event(obj.RuntimeObject(), v1.EventTypeWarning, ConstraintViolationEventReason, cond.Message)
+	}
+
+	return changed, result.Error()
+}
+
+// requestsForConstraint returns a function mapping an IAMConstraint or ClusterIAMConstraint to reconcile requests for
+// all objects of the given list type, which the constraint might apply to.
+func requestsForConstraint(c client.Reader, list client.ObjectList) func(client.Object) []reconcile.Request {
+	return func(obj client.Object) []reconcile.Request {
+		var opts []client.ListOption
+		if _, ok := obj.(*iamv1beta1.IAMConstraint); ok {
+			opts = append(opts, client.InNamespace(obj.GetNamespace()))
+		}
+
+		l := list.DeepCopyObject().(client.ObjectList)
+		if err := c.List(context.Background(), l, opts...); err != nil {
+			return nil
+		}
+		items, err := meta.ExtractList(l)
+		if err != nil {
+			return nil
+		}
+
+		var requests []reconcile.Request
+		for _, item := range items {
+			if o, ok := item.(client.Object); ok {
+				requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(o)})
+			}
+		}
+		return requests
+	}
+}
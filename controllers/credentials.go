@@ -0,0 +1,507 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+
+	awssdk "github.com/aws/aws-sdk-go/aws"
+	awsarn "github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	awsiam "github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/iam/iamiface"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	iamv1beta1 "github.com/redradrat/aws-iam-operator/api/v1beta1"
+	"github.com/redradrat/aws-iam-operator/pkg/sinks"
+)
+
+// Keys of the access key Secret in the formats other than the default one
+const (
+	AccesskeySecretEnvIdKey       = "AWS_ACCESS_KEY_ID"
+	AccesskeySecretEnvSecretKey   = "AWS_SECRET_ACCESS_KEY"
+	AccesskeySecretCredentialsKey = "credentials"
+	AccesskeySecretConfigKey      = "config"
+	// LoginSecretConsoleURLKey is the key of the console sign-in URL of the account in the login profile Secret
+	LoginSecretConsoleURLKey = "consoleUrl"
+)
+
+// Reasons for the CredentialSecretsInSync condition
+const (
+	CredentialSecretsInSyncReason = "InSync"
+	CredentialsRegeneratedReason  = "Regenerated"
+)
+
+// accessKeyTemplateValues are the values, the templates of the "template" format are executed with
+type accessKeyTemplateValues struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	UserName        string
+	ARN             string
+	AccountID       string
+	Region          string
+}
+
+// accessKeySecretName returns the name of the access key Secret of the user
+func accessKeySecretName(user *iamv1beta1.User) string {
+	if cs := user.Spec.CredentialSecret; cs != nil && cs.Name != "" {
+		return cs.Name
+	}
+	return user.Name + AccesskeySecretSuffix
+}
+
+// loginSecretName returns the name of the login profile Secret of the user
+func loginSecretName(user *iamv1beta1.User) string {
+	if cs := user.Spec.CredentialSecret; cs != nil && cs.LoginName != "" {
+		return cs.LoginName
+	}
+	return user.Name + LoginSecretSuffix
+}
+
+// credentialSecretFormat returns the format of the access key Secret of the user, and its profile name
+func credentialSecretFormat(user *iamv1beta1.User) (iamv1beta1.CredentialSecretFormat, string) {
+	format, profile := iamv1beta1.DefaultCredentialSecretFormat, "default"
+	if cs := user.Spec.CredentialSecret; cs != nil {
+		if cs.Format != "" {
+			format = cs.Format
+		}
+		if cs.Profile != "" {
+			profile = cs.Profile
+		}
+	}
+	return format, profile
+}
+
+// validateCredentialSecret checks the format of the access key Secret of the user, so a broken template is reported
+// before any credentials are issued
+func validateCredentialSecret(user *iamv1beta1.User) error {
+	cs := user.Spec.CredentialSecret
+	if cs == nil {
+		return nil
+	}
+	if cs.Name != "" && cs.Name == cs.LoginName {
+		return fmt.Errorf("credentialSecret.name and credentialSecret.loginName must differ")
+	}
+	if format, _ := credentialSecretFormat(user); format != iamv1beta1.TemplateCredentialSecretFormat {
+		if len(cs.Template) > 0 {
+			return fmt.Errorf("credentialSecret.template is only allowed with the format 'template'")
+		}
+		return nil
+	}
+	if len(cs.Template) == 0 {
+		return fmt.Errorf("credentialSecret.template must not be empty with the format 'template'")
+	}
+	for key, text := range cs.Template {
+		if _, err := template.New(key).Option("missingkey=error").Parse(text); err != nil {
+			return fmt.Errorf("invalid template for key '%s' of credentialSecret: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// accessKeySecretData returns the data of the access key Secret of the user in its format
+func accessKeySecretData(user *iamv1beta1.User, id, secret, region string) (map[string]string, error) {
+	format, profile := credentialSecretFormat(user)
+	switch format {
+	case iamv1beta1.EnvCredentialSecretFormat:
+		return map[string]string{AccesskeySecretEnvIdKey: id, AccesskeySecretEnvSecretKey: secret}, nil
+	case iamv1beta1.CredentialsFileCredentialSecretFormat:
+		return map[string]string{AccesskeySecretCredentialsKey: iniSection(profile, map[string]string{
+			"aws_access_key_id":     id,
+			"aws_secret_access_key": secret,
+		})}, nil
+	case iamv1beta1.ConfigFileCredentialSecretFormat:
+		// in the config file, all profiles but the default one are prefixed
+		section := profile
+		if profile != "default" {
+			section = "profile " + profile
+		}
+		settings := map[string]string{"aws_access_key_id": id, "aws_secret_access_key": secret}
+		if region != "" {
+			settings["region"] = region
+		}
+		return map[string]string{AccesskeySecretConfigKey: iniSection(section, settings)}, nil
+	case iamv1beta1.TemplateCredentialSecretFormat:
+		values := accessKeyTemplateValues{AccessKeyID: id, SecretAccessKey: secret, UserName: user.Name, ARN: user.Status.ARN, Region: region}
+		if arn, err := awsarn.Parse(user.Status.ARN); err == nil {
+			values.AccountID = arn.AccountID
+		}
+		data := map[string]string{}
+		for key, text := range user.Spec.CredentialSecret.Template {
+			tmpl, err := template.New(key).Option("missingkey=error").Parse(text)
+			if err != nil {
+				return nil, fmt.Errorf("invalid template for key '%s' of credentialSecret: %w", key, err)
+			}
+			buf := bytes.Buffer{}
+			if err := tmpl.Execute(&buf, values); err != nil {
+				return nil, fmt.Errorf("unable to execute template for key '%s' of credentialSecret: %w", key, err)
+			}
+			data[key] = buf.String()
+		}
+		return data, nil
+	}
+	return map[string]string{AccesskeySecretIdKey: id, AccesskeySecretSecretKey: secret}, nil
+}
+
+// loginSecretData returns the data of the login profile Secret of the user. The console sign-in URL is left out, if
+// the ARN of the user is not known.
+func loginSecretData(user *iamv1beta1.User, username, password string) map[string]string {
+	data := map[string]string{LoginSecretUserKey: username, LoginSecretPassKey: password}
+	if arn, err := awsarn.Parse(user.Status.ARN); err == nil {
+		data[LoginSecretConsoleURLKey] = consoleSignInURL(arn.Partition, arn.AccountID)
+	}
+	return data
+}
+
+// consoleSignInURL returns the URL IAM users of the account sign in to the console with
+func consoleSignInURL(partition, accountID string) string {
+	switch partition {
+	case "aws-cn":
+		return fmt.Sprintf("https://%s.signin.amazonaws.cn/console", accountID)
+	case "aws-us-gov":
+		return fmt.Sprintf("https://%s.signin.amazonaws-us-gov.com/console", accountID)
+	}
+	return fmt.Sprintf("https://%s.signin.aws.amazon.com/console", accountID)
+}
+
+// iniSection renders a section of an AWS credentials or config file, with its keys in a stable order
+func iniSection(name string, settings map[string]string) string {
+	b := strings.Builder{}
+	fmt.Fprintf(&b, "[%s]\n", name)
+	for _, key := range []string{"region", "aws_access_key_id", "aws_secret_access_key"} {
+		if value, ok := settings[key]; ok {
+			fmt.Fprintf(&b, "%s = %s\n", key, value)
+		}
+	}
+	return b.String()
+}
+
+// credentialData returns the data of a credential Secret as bytes
+func credentialData(data map[string]string) map[string][]byte {
+	raw := map[string][]byte{}
+	for key, value := range data {
+		raw[key] = []byte(value)
+	}
+	return raw
+}
+
+// userSecret returns a credential Secret of the user, with the labels and annotations of its credentialSecret
+func userSecret(user *iamv1beta1.User, data map[string][]byte, name string) *v1.Secret {
+	sec := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: user.Namespace,
+		},
+		Data: data,
+		Type: v1.SecretTypeOpaque,
+	}
+	if cs := user.Spec.CredentialSecret; cs != nil {
+		sec.Labels = cs.Labels
+		sec.Annotations = cs.Annotations
+	}
+	return sec
+}
+
+// writeCredentialSecret creates the credential Secret, or overwrites the data of the existing one, if the owner
+// controls it. Secrets of anyone else are never overwritten. The labels and annotations of the previous
+// credentialSecret, which sec no longer has, are removed. As the credentials are lost, if they cannot be written,
+// transient errors are retried right away.
+func writeCredentialSecret(ctx context.Context, c client.Client, owner AWSObjectStatusResource, sec *v1.Secret, previous *iamv1beta1.CredentialSecret) error {
+	return retry.OnError(retry.DefaultBackoff, isTransientError, func() error {
+		return createOrUpdateCredentialSecret(ctx, c, owner, sec, previous)
+	})
+}
+
+// isTransientError returns true for API server errors, which are worth retrying
+func isTransientError(err error) bool {
+	return errors.IsConflict(err) || errors.IsServerTimeout(err) || errors.IsTimeout(err) ||
+		errors.IsTooManyRequests(err) || errors.IsInternalError(err) || errors.IsServiceUnavailable(err)
+}
+
+func createOrUpdateCredentialSecret(ctx context.Context, c client.Client, owner AWSObjectStatusResource, sec *v1.Secret, previous *iamv1beta1.CredentialSecret) error {
+	err := c.Create(ctx, sec)
+	if !errors.IsAlreadyExists(err) {
+		return err
+	}
+
+	existing := v1.Secret{}
+	if err := c.Get(ctx, client.ObjectKeyFromObject(sec), &existing); err != nil {
+		return err
+	}
+	if !metav1.IsControlledBy(&existing, owner.RuntimeObject()) {
+		return fmt.Errorf("Secret '%s/%s' already exists and is not controlled by %s '%s'", sec.Namespace, sec.Name, kindOf(owner), owner.RuntimeObject().GetName())
+	}
+	existing.Data = sec.Data
+	existing.StringData = nil
+	if previous != nil {
+		for key := range previous.Labels {
+			if _, ok := sec.Labels[key]; !ok {
+				delete(existing.Labels, key)
+			}
+		}
+		for key := range previous.Annotations {
+			if _, ok := sec.Annotations[key]; !ok {
+				delete(existing.Annotations, key)
+			}
+		}
+	}
+	for key, value := range sec.Labels {
+		metav1.SetMetaDataLabel(&existing.ObjectMeta, key, value)
+	}
+	for key, value := range sec.Annotations {
+		metav1.SetMetaDataAnnotation(&existing.ObjectMeta, key, value)
+	}
+	if err := c.Update(ctx, &existing); err != nil {
+		return err
+	}
+	sec.ObjectMeta = existing.ObjectMeta
+	return nil
+}
+
+// secretDataHash returns the hash of the data of a credential Secret
+func secretDataHash(data map[string][]byte) string {
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	h := sha256.New()
+	for _, key := range keys {
+		h.Write([]byte(key))
+		h.Write([]byte{0})
+		h.Write(data[key])
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// staleCredentialSecret returns why the credentials written to the sink under the name are no longer there ("deleted"
+// or "altered"), or "" if they still are. Without a recorded hash, only deleted credentials are detected.
+func staleCredentialSecret(ctx context.Context, sink sinks.Sink, name, hash string) (string, error) {
+	if name == "" {
+		return "", nil
+	}
+	data, err := sink.Read(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	if data == nil {
+		return "deleted", nil
+	}
+	if hash != "" && secretDataHash(data) != hash {
+		return "altered", nil
+	}
+	return "", nil
+}
+
+// staleCredentialSecrets checks the login profile and access key Secrets of the user in the sink they have been
+// written to, see staleCredentialSecret. Credentials which have been written to another sink than the one the user
+// asks for are "relocated", an access key in another format than the one it asks for is "written in another format".
+func staleCredentialSecrets(ctx context.Context, sink sinks.Sink, user *iamv1beta1.User) (login, accessKey string, err error) {
+	relocated := credentialSinkRelocated(user)
+	if user.Spec.CreateLoginProfile && user.Status.LoginProfileCreated {
+		if relocated {
+			login = "relocated"
+		} else if login, err = staleCredentialSecret(ctx, sink, user.Status.LoginProfileSecret.Name, user.Status.LoginProfileSecretHash); err != nil {
+			return "", "", err
+		}
+	}
+	if user.Spec.CreateProgrammaticAccess && user.Status.ProgrammaticAccessCreated {
+		if relocated {
+			accessKey = "relocated"
+		} else if accessKey, err = staleCredentialSecret(ctx, sink, user.Status.ProgrammaticAccessSecret.Name, user.Status.ProgrammaticAccessSecretHash); err != nil {
+			return "", "", err
+		} else if accessKey == "" && accessKeyReformatted(user) {
+			accessKey = "written in another format"
+		}
+	}
+	return login, accessKey, nil
+}
+
+// writtenCredentialSecret returns the credentialSecret of the user, as it is recorded in its status once the credentials
+// have been written with it. It's never nil, so users, which have never recorded it, can be told apart.
+func writtenCredentialSecret(user *iamv1beta1.User) *iamv1beta1.CredentialSecret {
+	cs := user.Spec.CredentialSecret.DeepCopy()
+	if cs == nil {
+		return &iamv1beta1.CredentialSecret{}
+	}
+	cs.ReplicateTo = nil
+	return cs
+}
+
+// accessKeyReformatted returns true, if the access key of the user has been written in another format than the one its
+// credentialSecret asks for. It cannot be written again without its secret, so it has to be issued again.
+func accessKeyReformatted(user *iamv1beta1.User) bool {
+	if user.Status.CredentialSecret == nil {
+		return false
+	}
+	written := &iamv1beta1.User{Spec: iamv1beta1.UserSpec{CredentialSecret: user.Status.CredentialSecret}}
+	writtenFormat, writtenProfile := credentialSecretFormat(written)
+	format, profile := credentialSecretFormat(user)
+	if writtenFormat != format || writtenProfile != profile {
+		return true
+	}
+	if format != iamv1beta1.TemplateCredentialSecretFormat {
+		return false
+	}
+	return !equality.Semantic.DeepEqual(user.Status.CredentialSecret.Template, user.Spec.CredentialSecret.Template)
+}
+
+// credentialMetadataChanged returns true, if the labels or annotations of the credentialSecret of the user differ from
+// the ones its Secrets have been written with. They only apply to Secrets in the namespace of the user.
+func credentialMetadataChanged(user *iamv1beta1.User) bool {
+	if user.Status.CredentialSecret == nil || externalCredentialSink(user.Spec.CredentialSink) != nil {
+		return false
+	}
+	wanted := writtenCredentialSecret(user)
+	return !equality.Semantic.DeepEqual(wanted.Labels, user.Status.CredentialSecret.Labels) ||
+		!equality.Semantic.DeepEqual(wanted.Annotations, user.Status.CredentialSecret.Annotations)
+}
+
+// moveCredentialSecrets writes the credentials of the user, which are still valid, to the Secrets named by its
+// credentialSecret with its current labels and annotations, and deletes the Secrets they have been written to before.
+// It returns true, if the status of the user changed.
+func (r *UserReconciler) moveCredentialSecrets(ctx context.Context, user *iamv1beta1.User, written, sink sinks.Sink, loginSecret, accessKeySecret string) (bool, error) {
+	metadataChanged := credentialMetadataChanged(user)
+	moved := false
+	if user.Spec.CreateLoginProfile && user.Status.LoginProfileCreated {
+		ref, err := r.moveCredentialSecret(ctx, user, written, sink, user.Status.LoginProfileSecret, loginSecret, metadataChanged, "login profile")
+		moved = moved || ref != user.Status.LoginProfileSecret
+		user.Status.LoginProfileSecret = ref
+		if err != nil {
+			return moved, err
+		}
+	}
+	if user.Spec.CreateProgrammaticAccess && user.Status.ProgrammaticAccessCreated {
+		ref, err := r.moveCredentialSecret(ctx, user, written, sink, user.Status.ProgrammaticAccessSecret, accessKeySecret, metadataChanged, "access key")
+		moved = moved || ref != user.Status.ProgrammaticAccessSecret
+		user.Status.ProgrammaticAccessSecret = ref
+		if err != nil {
+			return moved, err
+		}
+	}
+	return moved, nil
+}
+
+// moveCredentialSecret writes the credentials written under ref to name, and returns the reference to them. Credentials,
+// which are gone, are left to be issued again.
+func (r *UserReconciler) moveCredentialSecret(ctx context.Context, user *iamv1beta1.User, written, sink sinks.Sink, ref v1.SecretReference, name string, metadataChanged bool, what string) (v1.SecretReference, error) {
+	if ref.Name == name && !metadataChanged {
+		return ref, nil
+	}
+	data, err := written.Read(ctx, ref.Name)
+	if err != nil || data == nil {
+		return ref, err
+	}
+	if err := sink.Write(ctx, name, data); err != nil {
+		return ref, err
+	}
+	if ref.Name == name {
+		return ref, nil
+	}
+	if err := written.Delete(ctx, ref.Name); err != nil {
+		return credentialSecretReference(user, name), err
+	}
+	r.Recorder.Eventf(user, v1.EventTypeNormal, SecretCreatedEventReason, "moved %s from %s to %s", what, written.Location(ref.Name), sink.Location(name))
+	return credentialSecretReference(user, name), nil
+}
+
+// deleteRenamedCredentials deletes the credentials, which have been written to the sink under the previous name, if
+// they are written under another name now
+func deleteRenamedCredentials(ctx context.Context, sink sinks.Sink, previous, name string) error {
+	if previous == "" || previous == name {
+		return nil
+	}
+	return sink.Delete(ctx, previous)
+}
+
+// credentialsPending returns true, if credentials of the user have not been written to their Secrets yet, e.g. because
+// a reconciliation was interrupted after issuing them
+func credentialsPending(user *iamv1beta1.User) bool {
+	return user.Status.PendingIssuance != nil ||
+		user.Spec.CreateLoginProfile && !user.Status.LoginProfileCreated ||
+		user.Spec.CreateProgrammaticAccess && !user.Status.ProgrammaticAccessCreated
+}
+
+// regeneratedMessage describes the credentials, which have been issued again, and the access keys revoked for them.
+// The locations are the ones the stale credentials had been written to.
+func regeneratedMessage(user *iamv1beta1.User, loginLocation, login, accessKeyLocation, accessKey string, revoked []string) string {
+	var parts []string
+	if login != "" {
+		parts = append(parts, fmt.Sprintf("set a new password, as login profile %s was %s", loginLocation, login))
+	}
+	if accessKey != "" {
+		parts = append(parts, fmt.Sprintf("issued access key '%s', as access key %s was %s", user.Status.AccessKeyID, accessKeyLocation, accessKey))
+		if len(revoked) > 0 {
+			parts = append(parts, fmt.Sprintf("revoked access keys %s", strings.Join(revoked, ", ")))
+		}
+	}
+	return strings.Join(parts, "; ")
+}
+
+// accessKeyIDs returns the IDs of the access keys of the IAM user, none if the user does not exist
+func accessKeyIDs(svc iamiface.IAMAPI, userName string) ([]string, error) {
+	out, err := svc.ListAccessKeys(&awsiam.ListAccessKeysInput{UserName: awssdk.String(userName)})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == awsiam.ErrCodeNoSuchEntityException {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, key := range out.AccessKeyMetadata {
+		ids = append(ids, awssdk.StringValue(key.AccessKeyId))
+	}
+	return ids, nil
+}
+
+// revokeAccessKeys deletes the access keys of the IAM user, which are selected by revoke, and returns their IDs
+func revokeAccessKeys(svc iamiface.IAMAPI, userName string, revoke func(id string) bool) ([]string, error) {
+	ids, err := accessKeyIDs(svc, userName)
+	if err != nil {
+		return nil, err
+	}
+	var revoked []string
+	for _, id := range ids {
+		if !revoke(id) {
+			continue
+		}
+		_, err := svc.DeleteAccessKey(&awsiam.DeleteAccessKeyInput{UserName: awssdk.String(userName), AccessKeyId: awssdk.String(id)})
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == awsiam.ErrCodeNoSuchEntityException {
+			err = nil
+		}
+		if err != nil {
+			return revoked, err
+		}
+		revoked = append(revoked, id)
+	}
+	return revoked, nil
+}
+
+// staleAccessKeys selects the access keys to revoke, once the access key Secret of the user is stale: the one it has
+// been issued, or all of them, if its ID is not known
+func staleAccessKeys(user *iamv1beta1.User) func(id string) bool {
+	return func(id string) bool {
+		return user.Status.AccessKeyID == "" || id == user.Status.AccessKeyID
+	}
+}
+
+// deleteLoginProfile deletes the login profile of the IAM user, if it has one
+func deleteLoginProfile(svc iamiface.IAMAPI, userName string) error {
+	_, err := svc.DeleteLoginProfile(&awsiam.DeleteLoginProfileInput{UserName: awssdk.String(userName)})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == awsiam.ErrCodeNoSuchEntityException {
+		return nil
+	}
+	return err
+}
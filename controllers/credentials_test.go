@@ -0,0 +1,274 @@
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	awssdk "github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	awsiam "github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/iam/iamiface"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	iamv1beta1 "github.com/redradrat/aws-iam-operator/api/v1beta1"
+)
+
+// fakeIAM keeps the access keys and the login profile of a single IAM user in memory. Without any access keys and
+// login profile, the user does not exist, unless exists is set.
+type fakeIAM struct {
+	iamiface.IAMAPI
+
+	accessKeys   []string
+	loginProfile bool
+	exists       bool
+}
+
+func (f *fakeIAM) noSuchEntity() error {
+	return awserr.New(awsiam.ErrCodeNoSuchEntityException, "user not found", nil)
+}
+
+func (f *fakeIAM) found() bool {
+	return f.exists || f.loginProfile || len(f.accessKeys) > 0
+}
+
+func (f *fakeIAM) ListAccessKeys(in *awsiam.ListAccessKeysInput) (*awsiam.ListAccessKeysOutput, error) {
+	if !f.found() {
+		return nil, f.noSuchEntity()
+	}
+	out := &awsiam.ListAccessKeysOutput{}
+	for _, id := range f.accessKeys {
+		out.AccessKeyMetadata = append(out.AccessKeyMetadata, &awsiam.AccessKeyMetadata{AccessKeyId: awssdk.String(id), UserName: in.UserName})
+	}
+	return out, nil
+}
+
+func (f *fakeIAM) DeleteAccessKey(in *awsiam.DeleteAccessKeyInput) (*awsiam.DeleteAccessKeyOutput, error) {
+	for i, id := range f.accessKeys {
+		if id == *in.AccessKeyId {
+			f.accessKeys = append(f.accessKeys[:i], f.accessKeys[i+1:]...)
+			return &awsiam.DeleteAccessKeyOutput{}, nil
+		}
+	}
+	return nil, f.noSuchEntity()
+}
+
+func (f *fakeIAM) DeleteLoginProfile(in *awsiam.DeleteLoginProfileInput) (*awsiam.DeleteLoginProfileOutput, error) {
+	if !f.loginProfile {
+		return nil, f.noSuchEntity()
+	}
+	f.loginProfile = false
+	return &awsiam.DeleteLoginProfileOutput{}, nil
+}
+
+func TestRevokeAccessKeys(t *testing.T) {
+	tests := []struct {
+		name        string
+		keys        []string
+		accessKeyID string
+		wantRevoked []string
+		wantKept    []string
+	}{
+		{
+			name:        "the stale access key is revoked",
+			keys:        []string{"AKIAPRIOR", "AKIASTALE"},
+			accessKeyID: "AKIASTALE",
+			wantRevoked: []string{"AKIASTALE"},
+			wantKept:    []string{"AKIAPRIOR"},
+		},
+		{
+			name:        "all access keys are revoked without a known ID",
+			keys:        []string{"AKIAPRIOR", "AKIASTALE"},
+			wantRevoked: []string{"AKIAPRIOR", "AKIASTALE"},
+		},
+		{
+			name:        "an access key, which is already gone, is left alone",
+			keys:        []string{"AKIAPRIOR"},
+			accessKeyID: "AKIASTALE",
+			wantKept:    []string{"AKIAPRIOR"},
+		},
+		{
+			name:        "a user, which does not exist, has nothing to revoke",
+			accessKeyID: "AKIASTALE",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &fakeIAM{accessKeys: append([]string{}, tt.keys...)}
+			user := &iamv1beta1.User{}
+			user.Status.AccessKeyID = tt.accessKeyID
+
+			revoked, err := revokeAccessKeys(svc, "alice", staleAccessKeys(user))
+			if err != nil {
+				t.Fatalf("revokeAccessKeys() error = %v", err)
+			}
+			if !reflect.DeepEqual(revoked, tt.wantRevoked) {
+				t.Errorf("revoked = %v, want %v", revoked, tt.wantRevoked)
+			}
+			if (len(svc.accessKeys) > 0 || len(tt.wantKept) > 0) && !reflect.DeepEqual(svc.accessKeys, tt.wantKept) {
+				t.Errorf("kept access keys = %v, want %v", svc.accessKeys, tt.wantKept)
+			}
+		})
+	}
+}
+
+func TestStaleCredentialSecrets(t *testing.T) {
+	data := map[string][]byte{AccesskeySecretIdKey: []byte("AKIASTALE"), AccesskeySecretSecretKey: []byte("secret")}
+	altered := map[string][]byte{AccesskeySecretIdKey: []byte("AKIASTALE"), AccesskeySecretSecretKey: []byte("changed")}
+
+	tests := []struct {
+		name          string
+		secret        map[string][]byte
+		hash          string
+		sink          *iamv1beta1.CredentialSink
+		wantAccessKey string
+	}{
+		{
+			name:   "an intact Secret is not stale",
+			secret: data,
+			hash:   secretDataHash(data),
+		},
+		{
+			name:          "a deleted Secret is stale",
+			hash:          secretDataHash(data),
+			wantAccessKey: "deleted",
+		},
+		{
+			name:          "an altered Secret is stale",
+			secret:        altered,
+			hash:          secretDataHash(data),
+			wantAccessKey: "altered",
+		},
+		{
+			name:   "an altered Secret is not detected without a hash",
+			secret: altered,
+		},
+		{
+			name:          "credentials written to another sink are relocated",
+			secret:        data,
+			hash:          secretDataHash(data),
+			sink:          &iamv1beta1.CredentialSink{SSM: &iamv1beta1.SSMCredentialSink{}},
+			wantAccessKey: "relocated",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := &iamv1beta1.User{ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "alice"}}
+			user.Spec.CreateProgrammaticAccess = true
+			user.Spec.CredentialSink = tt.sink
+			user.Status.ProgrammaticAccessCreated = true
+			user.Status.ProgrammaticAccessSecret = v1.SecretReference{Namespace: "team-a", Name: "alice-credentials"}
+			user.Status.ProgrammaticAccessSecretHash = tt.hash
+
+			var objs []client.Object
+			if tt.secret != nil {
+				objs = append(objs, &v1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "alice-credentials"}, Data: tt.secret})
+			}
+			sink := &secretSink{client: newFakeClient(t, objs...), user: user}
+
+			login, accessKey, err := staleCredentialSecrets(context.Background(), sink, user)
+			if err != nil {
+				t.Fatalf("staleCredentialSecrets() error = %v", err)
+			}
+			if login != "" {
+				t.Errorf("login = %q, want none without a login profile", login)
+			}
+			if accessKey != tt.wantAccessKey {
+				t.Errorf("accessKey = %q, want %q", accessKey, tt.wantAccessKey)
+			}
+		})
+	}
+}
+
+func TestBeginCredentialIssuance(t *testing.T) {
+	tests := []struct {
+		name         string
+		keys         []string
+		loginProfile bool
+		pending      *iamv1beta1.CredentialIssuance
+		created      bool
+		accessKeyID  string
+		wantStray    []string
+		wantKept     []string
+		wantPrior    []string
+		wantPending  bool
+	}{
+		{
+			name:         "a new issuance records the prior access keys",
+			keys:         []string{"AKIAPRIOR"},
+			loginProfile: true,
+			wantKept:     []string{"AKIAPRIOR"},
+			wantPrior:    []string{"AKIAPRIOR"},
+			wantPending:  true,
+		},
+		{
+			name:        "an interrupted issuance revokes the access keys it issued",
+			keys:        []string{"AKIAPRIOR", "AKIASTRAY"},
+			pending:     &iamv1beta1.CredentialIssuance{PriorAccessKeyIDs: []string{"AKIAPRIOR"}},
+			wantStray:   []string{"AKIASTRAY"},
+			wantKept:    []string{"AKIAPRIOR"},
+			wantPrior:   []string{"AKIAPRIOR"},
+			wantPending: true,
+		},
+		{
+			name:        "an interrupted issuance keeps the access key, which has been written",
+			keys:        []string{"AKIAPRIOR", "AKIAWRITTEN", "AKIASTRAY"},
+			pending:     &iamv1beta1.CredentialIssuance{PriorAccessKeyIDs: []string{"AKIAPRIOR"}},
+			created:     true,
+			accessKeyID: "AKIAWRITTEN",
+			wantStray:   []string{"AKIASTRAY"},
+			wantKept:    []string{"AKIAPRIOR", "AKIAWRITTEN"},
+		},
+		{
+			name:     "nothing is recorded without credentials to issue",
+			keys:     []string{"AKIAWRITTEN"},
+			created:  true,
+			wantKept: []string{"AKIAWRITTEN"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := &iamv1beta1.User{ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "alice"}}
+			c := newFakeClient(t, user)
+			if err := c.Get(context.Background(), client.ObjectKeyFromObject(user), user); err != nil {
+				t.Fatal(err)
+			}
+			user.Spec.CreateLoginProfile = tt.loginProfile
+			user.Spec.CreateProgrammaticAccess = true
+			user.Status.PendingIssuance = tt.pending
+			user.Status.ProgrammaticAccessCreated = tt.created
+			user.Status.AccessKeyID = tt.accessKeyID
+			svc := &fakeIAM{accessKeys: append([]string{}, tt.keys...), loginProfile: tt.loginProfile, exists: true}
+			r := &UserReconciler{Client: c, Recorder: record.NewFakeRecorder(10)}
+
+			stray, err := r.beginCredentialIssuance(context.Background(), svc, user, "alice")
+			if err != nil {
+				t.Fatalf("beginCredentialIssuance() error = %v", err)
+			}
+			if !reflect.DeepEqual(stray, tt.wantStray) {
+				t.Errorf("stray = %v, want %v", stray, tt.wantStray)
+			}
+			if !reflect.DeepEqual(svc.accessKeys, tt.wantKept) {
+				t.Errorf("kept access keys = %v, want %v", svc.accessKeys, tt.wantKept)
+			}
+			if svc.loginProfile {
+				t.Errorf("login profile has not been deleted")
+			}
+			if !tt.wantPending {
+				if tt.pending == nil && user.Status.PendingIssuance != nil {
+					t.Errorf("pending issuance = %v, want none", user.Status.PendingIssuance)
+				}
+				return
+			}
+			if user.Status.PendingIssuance == nil {
+				t.Fatalf("pending issuance has not been recorded")
+			}
+			if !reflect.DeepEqual(user.Status.PendingIssuance.PriorAccessKeyIDs, tt.wantPrior) {
+				t.Errorf("prior access keys = %v, want %v", user.Status.PendingIssuance.PriorAccessKeyIDs, tt.wantPrior)
+			}
+		})
+	}
+}
@@ -0,0 +1,269 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"unicode/utf8"
+
+	awssdk "github.com/aws/aws-sdk-go/aws"
+	awsarn "github.com/aws/aws-sdk-go/aws/arn"
+	awsiam "github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/iam/iamiface"
+	"github.com/redradrat/cloud-objects/aws"
+	"github.com/redradrat/cloud-objects/aws/iam"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	iamv1beta1 "github.com/redradrat/aws-iam-operator/api/v1beta1"
+	"github.com/redradrat/aws-iam-operator/pkg/document"
+	"github.com/redradrat/aws-iam-operator/pkg/limits"
+	"github.com/redradrat/aws-iam-operator/pkg/templating"
+)
+
+// Document is the policy document of a Policy, AssumeRolePolicy or Role. Typed statements are marshalled by
+// cloud-objects; a raw document is sent to AWS as it is, and only approximated by the typed document for linting and
+// constraints.
+type Document struct {
+	iam.PolicyDocument
+	// Raw is the canonical JSON of a raw document, nil for typed statements
+	Raw []byte
+	// SourceVersion is the resource version of the ConfigMap or Secret, a raw document has been read from
+	SourceVersion string
+}
+
+// Size returns the size of the document, as IAM counts it
+func (d Document) Size() (int, error) {
+	if d.Raw != nil {
+		return utf8.RuneCount(d.Raw), nil
+	}
+	return limits.DocumentSize(d.PolicyDocument)
+}
+
+// readRawDocument returns the raw document given inline, or read from a ConfigMap or Secret in the given namespace,
+// after validating and canonicalizing it. If trust is true, it's validated as a trust policy.
+func readRawDocument(ctx context.Context, c client.Reader, namespace string, inline *runtime.RawExtension, from *iamv1beta1.DocumentSource, trust bool) (Document, error) {
+	var data []byte
+	var version, source string
+	switch {
+	case inline != nil:
+		data, source = inline.Raw, "spec.document"
+	case from.ConfigMapKeyRef != nil:
+		ref := from.ConfigMapKeyRef
+		source = fmt.Sprintf("key '%s' of ConfigMap '%s/%s'", ref.Key, namespace, ref.Name)
+		cm := v1.ConfigMap{}
+		if err := c.Get(ctx, client.ObjectKey{Namespace: namespace, Name: ref.Name}, &cm); err != nil {
+			return Document{}, fmt.Errorf("unable to read %s: %w", source, err)
+		}
+		value, ok := cm.Data[ref.Key]
+		if !ok {
+			binary, ok := cm.BinaryData[ref.Key]
+			if !ok {
+				return Document{}, fmt.Errorf("%s does not exist", source)
+			}
+			value = string(binary)
+		}
+		data, version = []byte(value), cm.ResourceVersion
+	case from.SecretKeyRef != nil:
+		ref := from.SecretKeyRef
+		source = fmt.Sprintf("key '%s' of Secret '%s/%s'", ref.Key, namespace, ref.Name)
+		secret := v1.Secret{}
+		if err := c.Get(ctx, client.ObjectKey{Namespace: namespace, Name: ref.Name}, &secret); err != nil {
+			return Document{}, fmt.Errorf("unable to read %s: %w", source, err)
+		}
+		value, ok := secret.Data[ref.Key]
+		if !ok {
+			return Document{}, fmt.Errorf("%s does not exist", source)
+		}
+		data, version = value, secret.ResourceVersion
+	}
+
+	doc, canonical, err := document.Canonicalize(data, trust)
+	if err != nil {
+		return Document{}, fmt.Errorf("invalid policy document in %s: %w", source, err)
+	}
+	return Document{PolicyDocument: doc.Typed(), Raw: canonical, SourceVersion: version}, nil
+}
+
+// GetAssumeRolePolicyDocument returns the trust policy document of the AssumeRolePolicy on its own: a raw document, or
+// its statements with the ARNs of all referenced resources resolved and the template variables expanded for itself
+func GetAssumeRolePolicyDocument(arp *iamv1beta1.AssumeRolePolicy, values templating.Values, c client.Client, ctx context.Context) (Document, error) {
+	raw, err := arp.UsesRawDocument()
+	if err != nil {
+		return Document{}, err
+	}
+	if raw {
+		return readRawDocument(ctx, c, arp.Namespace, arp.Spec.Document, arp.Spec.DocumentFrom, true)
+	}
+
+	statement, err := arp.Spec.Statement.ResolveReferences(arp.Namespace, NewARNResolver(ctx, c).Resolve)
+	if err != nil {
+		return Document{}, err
+	}
+	if statement, err = values.AssumeRolePolicyStatement(statement, arp); err != nil {
+		return Document{}, err
+	}
+	return Document{PolicyDocument: statement.MarshalPolicyDocument()}, nil
+}
+
+// documentSourceUpToDate returns true, if the raw document has been read from the same version of its ConfigMap or
+// Secret as last time
+func documentSourceUpToDate(obj DocumentStatusResource, doc Document) bool {
+	return obj.GetDocumentStatus().ReadDocumentVersion == doc.SourceVersion
+}
+
+// documentSourceIndexKeys returns the index keys of the ConfigMap or Secret, the document is read from
+func documentSourceIndexKeys(namespace string, from *iamv1beta1.DocumentSource) []string {
+	switch {
+	case from == nil:
+		return nil
+	case from.ConfigMapKeyRef != nil:
+		return []string{documentSourceIndexKey("ConfigMap", namespace, from.ConfigMapKeyRef.Name)}
+	case from.SecretKeyRef != nil:
+		return []string{documentSourceIndexKey("Secret", namespace, from.SecretKeyRef.Name)}
+	}
+	return nil
+}
+
+func documentSourceIndexKey(kind, namespace, name string) string {
+	return fmt.Sprintf("%s/%s/%s", kind, namespace, name)
+}
+
+// requestsForDocumentSource returns a function mapping a ConfigMap or Secret to reconcile requests for all objects of
+// the given list type, which read their document from it
+func requestsForDocumentSource(c client.Reader, list client.ObjectList, kind string) func(client.Object) []reconcile.Request {
+	return requestsForIndex(c, list, documentSourceIndex, func(obj client.Object) string {
+		return documentSourceIndexKey(kind, obj.GetNamespace(), obj.GetName())
+	})
+}
+
+// requestsForRoleDocumentSource returns a function mapping a ConfigMap or Secret to reconcile requests for all Roles,
+// which reference an AssumeRolePolicy reading its document from it
+func requestsForRoleDocumentSource(c client.Reader, kind string) func(client.Object) []reconcile.Request {
+	assumeRolePolicies := requestsForDocumentSource(c, &iamv1beta1.AssumeRolePolicyList{}, kind)
+	return func(obj client.Object) []reconcile.Request {
+		var requests []reconcile.Request
+		for _, arp := range assumeRolePolicies(obj) {
+			key := namespacedIndexKey(arp.Namespace, arp.Name)
+			requests = append(requests, requestsForIndex(c, &iamv1beta1.RoleList{}, roleAssumeRolePolicyIndex, func(client.Object) string {
+				return key
+			})(obj)...)
+		}
+		return requests
+	}
+}
+
+// rawPolicyInstance is the instance of a Policy with a raw document. cloud-objects can only marshal typed documents,
+// so creating and updating the policy goes through the IAM API directly.
+type rawPolicyInstance struct {
+	Name        string
+	Description string
+	Document    string
+	arn         awsarn.ARN
+}
+
+func (p *rawPolicyInstance) Create(svc iamiface.IAMAPI) error {
+	out, err := svc.CreatePolicy(&awsiam.CreatePolicyInput{
+		PolicyName:     awssdk.String(p.Name),
+		Description:    awssdk.String(p.Description),
+		PolicyDocument: awssdk.String(p.Document),
+	})
+	if err != nil {
+		return err
+	}
+	p.arn, err = awsarn.Parse(awssdk.StringValue(out.Policy.Arn))
+	return err
+}
+
+func (p *rawPolicyInstance) Update(svc iamiface.IAMAPI) error {
+	if !p.IsCreated(svc) {
+		return aws.NewInstanceNotYetCreatedError(fmt.Sprintf("Policy '%s' not yet created", p.Name))
+	}
+	_, err := svc.CreatePolicyVersion(&awsiam.CreatePolicyVersionInput{
+		PolicyArn:      awssdk.String(p.arn.String()),
+		PolicyDocument: awssdk.String(p.Document),
+		SetAsDefault:   awssdk.Bool(true),
+	})
+	return err
+}
+
+func (p *rawPolicyInstance) Delete(svc iamiface.IAMAPI) error {
+	return iam.NewExistingPolicyInstance(p.Name, p.Description, iam.PolicyDocument{}, p.arn).Delete(svc)
+}
+
+func (p *rawPolicyInstance) ARN() awsarn.ARN {
+	return p.arn
+}
+
+func (p *rawPolicyInstance) IsCreated(svc iamiface.IAMAPI) bool {
+	return p.arn.String() != awsarn.ARN{}.String()
+}
+
+// rawRoleInstance is the instance of a Role with a raw trust policy document, see rawPolicyInstance
+type rawRoleInstance struct {
+	Name               string
+	Description        string
+	MaxSessionDuration int64
+	Document           string
+	arn                awsarn.ARN
+}
+
+func (r *rawRoleInstance) Create(svc iamiface.IAMAPI) error {
+	out, err := svc.CreateRole(&awsiam.CreateRoleInput{
+		RoleName:                 awssdk.String(r.Name),
+		Description:              awssdk.String(r.Description),
+		MaxSessionDuration:       awssdk.Int64(r.MaxSessionDuration),
+		AssumeRolePolicyDocument: awssdk.String(r.Document),
+	})
+	if err != nil {
+		return err
+	}
+	r.arn, err = awsarn.Parse(awssdk.StringValue(out.Role.Arn))
+	return err
+}
+
+func (r *rawRoleInstance) Update(svc iamiface.IAMAPI) error {
+	return r.typed().Update(svc)
+}
+
+func (r *rawRoleInstance) Delete(svc iamiface.IAMAPI) error {
+	return r.typed().Delete(svc)
+}
+
+func (r *rawRoleInstance) ARN() awsarn.ARN {
+	return r.arn
+}
+
+func (r *rawRoleInstance) IsCreated(svc iamiface.IAMAPI) bool {
+	return r.arn.String() != awsarn.ARN{}.String()
+}
+
+// typed returns the cloud-objects instance of the role for everything, which doesn't involve the document
+func (r *rawRoleInstance) typed() *iam.RoleInstance {
+	return iam.NewExistingRoleInstance(r.Name, r.Description, r.MaxSessionDuration, iam.PolicyDocument{}, r.arn)
+}
+
+// newPolicyInstance returns the instance of a Policy with the given document. An empty ARN means the Policy has not
+// been created yet.
+func newPolicyInstance(name, description string, doc Document, arn awsarn.ARN) aws.Instance {
+	switch {
+	case doc.Raw != nil:
+		return &rawPolicyInstance{Name: name, Description: description, Document: string(doc.Raw), arn: arn}
+	case arn == awsarn.ARN{}:
+		return iam.NewPolicyInstance(name, description, doc.PolicyDocument)
+	}
+	return iam.NewExistingPolicyInstance(name, description, doc.PolicyDocument, arn)
+}
+
+// newRoleInstance returns the instance of a Role with the given trust policy document. An empty ARN means the Role
+// has not been created yet.
+func newRoleInstance(name, description string, duration int64, doc Document, arn awsarn.ARN) aws.Instance {
+	switch {
+	case doc.Raw != nil:
+		return &rawRoleInstance{Name: name, Description: description, MaxSessionDuration: duration, Document: string(doc.Raw), arn: arn}
+	case arn == awsarn.ARN{}:
+		return iam.NewRoleInstance(name, description, duration, doc.PolicyDocument)
+	}
+	return iam.NewExistingRoleInstance(name, description, duration, doc.PolicyDocument, arn)
+}
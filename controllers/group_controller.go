@@ -19,11 +19,18 @@ package controllers
 import (
 	"context"
 	"fmt"
+	"reflect"
 
+	"github.com/aws/aws-sdk-go/service/iam/iamiface"
 	"github.com/go-logr/logr"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	"github.com/redradrat/cloud-objects/aws"
 	"github.com/redradrat/cloud-objects/aws/iam"
@@ -37,13 +44,22 @@ type GroupReconciler struct {
 	Log            logr.Logger
 	Region         string
 	Scheme         *runtime.Scheme
+	Recorder       record.EventRecorder
 	ResourcePrefix string
+	// DryRun only plans the AWS operations for all Groups, instead of executing them
+	DryRun bool
+	// Adoption selects the namespaces, in which Groups may adopt existing IAM objects
+	Adoption AdoptionPolicy
 }
 
 // +kubebuilder:rbac:groups=aws-iam.redradrat.xyz,resources=groups,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=aws-iam.redradrat.xyz,resources=groups/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=aws-iam.redradrat.xyz,resources=groups/finalizers,verbs=get;update
 
+// +kubebuilder:rbac:groups=aws-iam.redradrat.xyz,resources=referencegrants,verbs=get;list;watch
+
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+
 func (r *GroupReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	log := r.Log.WithValues("group", req.NamespacedName)
 
@@ -57,26 +73,69 @@ func (r *GroupReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl
 	// Get our actual IAM Service to communicate with AWS; we don't need to continue without it
 	iamsvc, err := IAMService(r.Region)
 	if err != nil {
-		return ctrl.Result{}, errWithStatus(ctx, &group, err, r.Status())
+		return ctrl.Result{}, errWithStatus(ctx, &group, err, r.Status(), r.Recorder)
 	}
 
 	// new group instance
 	var ins *iam.GroupInstance
 	groupName := r.ResourcePrefix + group.Name
-	if group.Status.ARN != "" {
-		parsedArn, err := aws.ARNify(group.Status.ARN)
+	if objectARN(&group) != "" {
+		parsedArn, err := parseObjectARN(&group)
 		if err != nil {
-			return ctrl.Result{}, errWithStatus(ctx, &group, fmt.Errorf("ARN in Group status is not valid/parsable"), r.Status())
+			return ctrl.Result{}, errWithStatus(ctx, &group, err, r.Status(), r.Recorder)
 		}
-		ins = iam.NewExistingGroupInstance(groupName, parsedArn[len(parsedArn)-1])
+		ins = iam.NewExistingGroupInstance(groupName, parsedArn)
 	} else {
 		ins = iam.NewGroupInstance(groupName)
 	}
 
-	// return if only status/metadata updated
-	if group.Status.ObservedGeneration == group.ObjectMeta.Generation && group.Status.State == iamv1beta1.OkSyncState {
+	// make sure we are allowed to reference the users
+	if group.ObjectMeta.DeletionTimestamp.IsZero() {
+		var refs []objectReference
+		for _, user := range group.Spec.Users {
+			refs = append(refs, objectReference{Kind: "User", Namespace: user.Namespace, Name: user.Name})
+		}
+		if err := authorizeReferences(ctx, r.Client, &group, refs); err != nil {
+			// the users might have been granted, when we added them; without the grant they have to go
+			if IsReferenceNotGranted(err) {
+				if removeErr := r.removeUnauthorizedUsers(ctx, iamsvc, ins, &group); removeErr != nil {
+					log.Error(removeErr, "unable to remove unauthorized users from Group")
+					if updateErr := r.Status().Update(ctx, &group); updateErr != nil {
+						return ctrl.Result{}, updateErr
+					}
+					return resultForAWSError(removeErr)
+				}
+			}
+			return ctrl.Result{}, errWithStatus(ctx, &group, err, r.Status(), r.Recorder)
+		}
+	}
+
+	// resolve the ARNs of the referenced users; if we're being deleted, they don't matter anymore
+	userArns, err := getGroupUserARNs(ctx, &group, r.Client)
+	if err != nil && group.ObjectMeta.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, errWithStatus(ctx, &group, err, r.Status(), r.Recorder)
+	}
+
+	dryRun := dryRunEnabled(r.DryRun, &group)
+
+	// a paused Group is left alone, we only keep reporting its status
+	paused, pausedChanged := checkPaused(&group)
+	if paused {
+		if pausedChanged {
+			return ctrl.Result{}, r.Status().Update(ctx, &group)
+		}
+		return ctrl.Result{}, nil
+	}
+
+	// return if only status/metadata updated, and the referenced users still have the ARNs we added
+	generationObserved := group.Status.ObservedGeneration == group.ObjectMeta.Generation && upToDate(&group, dryRun)
+	if generationObserved && reflect.DeepEqual(group.Status.Users, userArns) {
+		if pausedChanged {
+			return ctrl.Result{}, r.Status().Update(ctx, &group)
+		}
 		return ctrl.Result{}, nil
 	}
+	group.Status.PlannedOperations = nil
 
 	// the finalizer for deleting the actual aws resources
 	groupsFinalizer := "group.aws-aws-iam.redradrat.xyz"
@@ -100,13 +159,19 @@ func (r *GroupReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl
 			// our finalizer is present, so lets handle any external dependency
 
 			// delete the actual AWS Object and pass the cleanup function
-			statusUpdater, err := DeleteAWSObject(iamsvc, ins, cleanupFunc)
+			statusUpdater, err := DeleteAWSObject(iamsvc, ins, r.Recorder, &group, cleanupFunc, dryRun)
 			// we got a StatusUpdater function returned... let's execute it
-			statusUpdater(ctx, ins, &group, r.Status(), log)
+			if updateErr := statusUpdater(ctx, ins, &group, r.Status()); updateErr != nil {
+				return ctrl.Result{}, updateErr
+			}
 			if err != nil {
 				// we had an error during AWS Object deletion... so we return here to retry
 				log.Error(err, "unable to delete Group")
-				return ctrl.Result{}, err
+				return resultForAWSError(err)
+			}
+			if planned(&group) {
+				// keep the finalizer, as the Group still exists in AWS
+				return ctrl.Result{}, nil
 			}
 
 			// remove our finalizer from the list and update it.
@@ -123,82 +188,163 @@ func (r *GroupReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl
 
 	// RECONCILE THE RESOURCE
 
-	// if there is already an ARN in our status, then we recreate the object completely
-	// (because AWS only supports description updates)
-	if group.Status.ARN != "" {
-		// Delete the actual AWS Object and pass the cleanup function
-		statusWriter, err := DeleteAWSObject(iamsvc, ins, cleanupFunc)
-		statusWriter(ctx, ins, &group, r.Status(), log)
-		if err != nil {
-			// we had an error during AWS Object deletion... so we return here to retry
-			log.Error(err, "error while deleting Group during reconciliation")
-			return ctrl.Result{}, err
-		}
+	// an existing Group is adopted, if we're asked to. If there is already an ARN in our status, then we recreate the
+	// object completely (because AWS only supports description updates). If only the referenced users changed, we just
+	// add them.
+	if generationObserved {
+		return r.addUsers(ctx, iamsvc, ins, &group, userArns, dryRun)
+	}
+	var statusWriter StatusUpdater
+	if adoptionARN(&group) != "" {
+		statusWriter, err = AdoptAWSObject(iamsvc, ins, r.Recorder, &group, r.Adoption, dryRun)
+	} else if group.Status.ARN != "" {
+		statusWriter, err = RecreateAWSObject(iamsvc, ins, r.Recorder, &group, cleanupFunc, dryRun)
+	} else {
+		statusWriter, err = CreateAWSObject(iamsvc, ins, r.Recorder, &group, DoNothingPreFunc, dryRun)
+	}
+	if updateErr := statusWriter(ctx, ins, &group, r.Status()); updateErr != nil {
+		return ctrl.Result{}, updateErr
 	}
-
-	statusWriter, err := CreateAWSObject(iamsvc, ins, DoNothingPreFunc)
-	statusWriter(ctx, ins, &group, r.Status(), log)
 	if err != nil {
 		log.Error(err, "error while creating Group during reconciliation")
-		return ctrl.Result{}, err
+		return resultForAWSError(err)
 	}
 
-	// Now add all required users
-	for _, user := range group.Spec.Users {
-		// Get the User object
-		userObj := iamv1beta1.User{}
-		r.Client.Get(ctx, client.ObjectKey{Name: user.Name, Namespace: user.Namespace}, &userObj)
-		if err != nil {
-			return ctrl.Result{}, errWithStatus(ctx, &group, err, r.Status())
-		}
-
-		// Err if ARN is not available in the user obj
-		if userObj.Status.ARN == "" {
-			return ctrl.Result{}, errWithStatus(ctx, &group, fmt.Errorf("referenced user resource '%s/%s' has not yet been created", user.Namespace, user.Name), r.Status())
-		}
+	return r.addUsers(ctx, iamsvc, ins, &group, userArns, dryRun)
+}
 
+// addUsers adds the users with the given ARNs to the group and records them in the status. In dry-run mode, the
+// additions are only planned.
+func (r *GroupReconciler) addUsers(ctx context.Context, iamsvc iamiface.IAMAPI, ins *iam.GroupInstance, group *iamv1beta1.Group, userArns []string, dryRun bool) (ctrl.Result, error) {
+	for _, userArn := range userArns {
 		// parse the user arn
-		parsedArn, err := aws.ARNify(userObj.Status.ARN)
+		parsedArn, err := aws.ARNify(userArn)
 		if err != nil {
-			return ctrl.Result{}, errWithStatus(ctx, &group, fmt.Errorf("ARN in referenced User status is not valid/parsable"), r.Status())
+			return ctrl.Result{}, errWithStatus(ctx, group, fmt.Errorf("ARN in referenced User status is not valid/parsable"), r.Status(), r.Recorder)
+		}
+
+		if dryRun {
+			op := iamv1beta1.PlannedOperation{Operation: iamv1beta1.AttachOperation, Target: fmt.Sprintf("User '%s' to Group", userArn)}
+			recordPlannedOperation(r.Recorder, group, op, "add "+op.Target)
+			continue
 		}
 
 		// Now add the user to our Group Instance
 		if err = ins.AddUser(iamsvc, parsedArn[len(parsedArn)-1]); err != nil {
-			return ctrl.Result{}, errWithStatus(ctx, &group, err, r.Status())
+			return resultForAWSError(errWithStatus(ctx, group, err, r.Status(), r.Recorder))
 		}
+		r.Recorder.Eventf(group, v1.EventTypeNormal, UserAddedEventReason, "added User '%s' to Group", userArn)
 	}
 
 	group.Status.ObservedGeneration = group.ObjectMeta.Generation
-	if err := r.Status().Update(ctx, &group); err != nil {
+	markReconcileRequestHandled(group)
+	if dryRun {
+		return ctrl.Result{}, PlannedStatusUpdater()(ctx, ins, group, r.Status())
+	}
+
+	group.Status.Users = userArns
+	if err := r.Status().Update(ctx, group); err != nil {
 		return ctrl.Result{}, err
 	}
 
 	return ctrl.Result{}, nil
 }
 
+// removeUnauthorizedUsers removes the users, which the group may no longer reference e.g. because the ReferenceGrant
+// has been revoked, from the group. Paused Groups are left alone, in dry-run mode the removals are only planned.
+func (r *GroupReconciler) removeUnauthorizedUsers(ctx context.Context, iamsvc iamiface.IAMAPI, ins *iam.GroupInstance, group *iamv1beta1.Group) error {
+	if paused, _ := checkPaused(group); paused || group.Status.ARN == "" {
+		return nil
+	}
+	dryRun := dryRunEnabled(r.DryRun, group)
+
+	group.Status.PlannedOperations = nil
+	for _, user := range group.Spec.Users {
+		ref := objectReference{Kind: "User", Namespace: user.Namespace, Name: user.Name}
+		granted, err := referenceGranted(ctx, r.Client, kindOf(group), group.Namespace, ref)
+		if err != nil {
+			return err
+		}
+		if granted {
+			continue
+		}
+
+		// only the users we added are removed; a deleted User has left the group with its IAM user
+		userObj := iamv1beta1.User{}
+		if err := r.Get(ctx, client.ObjectKey{Name: user.Name, Namespace: user.Namespace}, &userObj); err != nil {
+			if errors.IsNotFound(err) {
+				continue
+			}
+			return err
+		}
+		userArn := userObj.Status.ARN
+		if userArn == "" || !containsString(group.Status.Users, userArn) {
+			continue
+		}
+
+		if dryRun {
+			op := iamv1beta1.PlannedOperation{Operation: iamv1beta1.DetachOperation, Target: fmt.Sprintf("User '%s' from Group", userArn)}
+			recordPlannedOperation(r.Recorder, group, op, "remove "+op.Target)
+			continue
+		}
+
+		parsedArn, err := aws.ARNify(userArn)
+		if err != nil {
+			return fmt.Errorf("ARN in referenced User status is not valid/parsable")
+		}
+		if err := ins.RemoveUser(iamsvc, parsedArn[len(parsedArn)-1]); err != nil {
+			return err
+		}
+		r.Recorder.Eventf(group, v1.EventTypeNormal, UserRemovedEventReason, "removed User '%s' from Group, as the reference is no longer granted", userArn)
+		group.Status.Users = removeString(group.Status.Users, userArn)
+	}
+	return nil
+}
+
+// getGroupUserARNs returns the ARNs of all users referenced by the group
+func getGroupUserARNs(ctx context.Context, group *iamv1beta1.Group, c client.Client) ([]string, error) {
+	var arns []string
+	for _, user := range group.Spec.Users {
+		// Get the User object
+		userObj := iamv1beta1.User{}
+		if err := c.Get(ctx, client.ObjectKey{Name: user.Name, Namespace: user.Namespace}, &userObj); err != nil {
+			if errors.IsNotFound(err) {
+				return nil, fmt.Errorf("referenced user resource '%s/%s' does not exist", user.Namespace, user.Name)
+			}
+			return nil, err
+		}
+
+		// Err if ARN is not available in the user obj
+		if userObj.Status.ARN == "" {
+			return nil, fmt.Errorf("referenced user resource '%s/%s' has not yet been created", user.Namespace, user.Name)
+		}
+		arns = append(arns, userObj.Status.ARN)
+	}
+	return arns, nil
+}
+
 func (r *GroupReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&iamv1beta1.Group{}).
+		Watches(&source.Kind{Type: &iamv1beta1.User{}},
+			handler.EnqueueRequestsFromMapFunc(requestsForIndex(r.Client, &iamv1beta1.GroupList{}, groupUsersIndex, namespacedKeyOf))).
+		Watches(&source.Kind{Type: &iamv1beta1.ReferenceGrant{}},
+			handler.EnqueueRequestsFromMapFunc(requestsForReferenceGrant(r.Client, &iamv1beta1.GroupList{}, "Group"))).
 		Complete(r)
 }
 
 // Returns a function, that does everything necessary before we can delete our actual User (cleanup)
 func groupCleanup(r *GroupReconciler, ctx context.Context, group iamv1beta1.Group) func() error {
 	return func() error {
-		attachments := iamv1beta1.PolicyAttachmentList{}
-		if err := r.List(ctx, &attachments); err != nil {
+		attachments, err := listPolicyAttachments(ctx, r, policyAttachmentTargetIndex, targetIndexKey(iamv1beta1.GroupTargetType, group.Namespace, group.Name))
+		if err != nil {
 			return err
 		}
-		for _, att := range attachments.Items {
-			if att.Spec.TargetReference.Type == iamv1beta1.GroupTargetType {
-				if att.Spec.TargetReference.Name == group.Name && att.Spec.TargetReference.Namespace == group.Namespace {
-					err := fmt.Errorf("cannot delete Group due to existing PolicyAttachment '%s/%s'", att.Name, att.Namespace)
-					return err
-				}
-			}
+		if len(attachments) > 0 {
+			att := attachments[0]
+			err := fmt.Errorf("cannot delete Group due to existing PolicyAttachment '%s/%s'", att.Name, att.Namespace)
+			return err
 		}
-
 		return nil
 	}
 }
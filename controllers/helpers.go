@@ -2,14 +2,16 @@ package controllers
 
 import (
 	"context"
+	"fmt"
 	"time"
 
-	awssdk "github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
-	awsiam "github.com/aws/aws-sdk-go/service/iam"
+	awsarn "github.com/aws/aws-sdk-go/aws/arn"
 	"github.com/aws/aws-sdk-go/service/iam/iamiface"
-	"github.com/go-logr/logr"
 	"github.com/redradrat/cloud-objects/aws/iam"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	"github.com/redradrat/cloud-objects/aws"
@@ -22,6 +24,45 @@ type AWSObjectStatusResource interface {
 	RuntimeObject() client.Object
 }
 
+// DocumentStatusResource is an AWSObjectStatusResource, which applies a policy document
+type DocumentStatusResource interface {
+	AWSObjectStatusResource
+	GetDocumentStatus() *iamv1beta1.DocumentStatus
+}
+
+// Reasons of the Events we emit on the reconciled resources
+const (
+	CreatedEventReason                = "Created"
+	CreateFailedEventReason           = "CreateFailed"
+	UpdatedEventReason                = "Updated"
+	UpdateFailedEventReason           = "UpdateFailed"
+	DeletedEventReason                = "Deleted"
+	DeleteFailedEventReason           = "DeleteFailed"
+	DeleteBlockedEventReason          = "DeleteBlocked"
+	AttachedEventReason               = "Attached"
+	AttachFailedEventReason           = "AttachFailed"
+	DetachedEventReason               = "Detached"
+	DetachFailedEventReason           = "DetachFailed"
+	DetachBlockedEventReason          = "DetachBlocked"
+	SecretCreatedEventReason          = "SecretCreated"
+	SecretDeletedEventReason          = "SecretDeleted"
+	CredentialsRegeneratedEventReason = "CredentialsRegenerated"
+	CredentialsRevokedEventReason     = "CredentialsRevoked"
+	ServiceAccountCreatedEventReason  = "ServiceAccountCreated"
+	ServiceAccountSkippedEventReason  = "ServiceAccountSkipped"
+	ServiceAccountReleasedEventReason = "ServiceAccountReleased"
+	UserAddedEventReason              = "UserAdded"
+	UserRemovedEventReason            = "UserRemoved"
+	ConstraintViolationEventReason    = "ConstraintViolation"
+	PolicyLintWarningEventReason      = "PolicyLintWarning"
+	ReconcileErrorEventReason         = "ReconcileError"
+	RecreatedEventReason              = "Recreated"
+	RecreateFailedEventReason         = "RecreateFailed"
+	PlannedEventReason                = "Planned"
+	AdoptedEventReason                = "Adopted"
+	AdoptFailedEventReason            = "AdoptFailed"
+)
+
 // Helper functions to check and remove string from a slice of strings.
 func containsString(slice []string, s string) bool {
 	for _, item := range slice {
@@ -42,43 +83,45 @@ func removeString(slice []string, s string) (result []string) {
 	return
 }
 
-func CreateAWSObject(svc iamiface.IAMAPI, ins aws.Instance, preFunc func() error) (StatusUpdater, error) {
-
-	if err := preFunc(); err != nil {
-		return ErrorStatusUpdater(err.Error()), err
-	}
-
-	if err := ins.Create(svc); err != nil {
-		return ErrorStatusUpdater(err.Error()), err
-	}
-
-	return SuccessStatusUpdater(), nil
+// CreateAWSObject creates the AWS object behind the given instance, or attaches it, if the instance is an attachment.
+// In dry-run mode, the operation is only planned.
+func CreateAWSObject(svc iamiface.IAMAPI, ins aws.Instance, recorder record.EventRecorder, obj AWSObjectStatusResource, preFunc func() error, dryRun bool) (StatusUpdater, error) {
+	return applyAWSOperation(svc, planCreate(ins), recorder, obj, preFunc, dryRun)
 }
 
-func UpdateAWSObject(svc iamiface.IAMAPI, ins aws.Instance, preFunc func() error) (StatusUpdater, error) {
-
-	if err := preFunc(); err != nil {
-		return ErrorStatusUpdater(err.Error()), err
-	}
+// UpdateAWSObject updates the AWS object behind the given instance. In dry-run mode, the operation is only planned.
+func UpdateAWSObject(svc iamiface.IAMAPI, ins aws.Instance, recorder record.EventRecorder, obj AWSObjectStatusResource, preFunc func() error, dryRun bool) (StatusUpdater, error) {
+	return applyAWSOperation(svc, planUpdate(ins), recorder, obj, preFunc, dryRun)
+}
 
-	if err := ins.Update(svc); err != nil {
-		return ErrorStatusUpdater(err.Error()), err
-	}
+// RecreateAWSObject deletes the AWS object behind the given instance and creates it again, for objects AWS cannot
+// update in place. In dry-run mode, the operation is only planned.
+func RecreateAWSObject(svc iamiface.IAMAPI, ins aws.Instance, recorder record.EventRecorder, obj AWSObjectStatusResource, preFunc func() error, dryRun bool) (StatusUpdater, error) {
+	return applyAWSOperation(svc, planRecreate(ins), recorder, obj, preFunc, dryRun)
+}
 
-	return SuccessStatusUpdater(), nil
+// DeleteAWSObject deletes the AWS object behind the given instance, or detaches it, if the instance is an attachment.
+// In dry-run mode, the operation is only planned.
+func DeleteAWSObject(svc iamiface.IAMAPI, ins aws.Instance, recorder record.EventRecorder, obj AWSObjectStatusResource, preFunc func() error, dryRun bool) (StatusUpdater, error) {
+	return applyAWSOperation(svc, planDelete(ins), recorder, obj, preFunc, dryRun)
 }
 
-func DeleteAWSObject(svc iamiface.IAMAPI, ins aws.Instance, preFunc func() error) (StatusUpdater, error) {
+func isAttachment(ins aws.Instance) bool {
+	_, ok := ins.(*iam.PolicyAttachmentInstance)
+	return ok
+}
 
-	if err := preFunc(); err != nil {
-		return ErrorStatusUpdater(err.Error()), err
+// describeInstance returns a human readable description of the AWS object behind the given instance, to be used in
+// Event messages.
+func describeInstance(obj AWSObjectStatusResource, ins aws.Instance) string {
+	if att, ok := ins.(*iam.PolicyAttachmentInstance); ok {
+		return fmt.Sprintf("attachment of policy '%s' to %s '%s'", att.PolicyRef.String(), att.Type, att.TargetRef.String())
 	}
-
-	if err := ins.Delete(svc); ignoreDoesNotExistError(err) != nil {
-		return ErrorStatusUpdater(err.Error()), err
+	kind := kindOf(obj)
+	if arn := ins.ARN().String(); arn != (awsarn.ARN{}).String() {
+		return fmt.Sprintf("%s '%s'", kind, arn)
 	}
-
-	return DoNothingStatusUpdater, nil
+	return kind
 }
 
 func ignoreDoesNotExistError(err error) error {
@@ -94,8 +137,9 @@ func ignoreDoesNotExistError(err error) error {
 
 func DoNothingPreFunc() error { return nil }
 
-func errWithStatus(ctx context.Context, obj AWSObjectStatusResource, err error, sw client.StatusWriter) error {
+func errWithStatus(ctx context.Context, obj AWSObjectStatusResource, err error, sw client.StatusWriter, recorder record.EventRecorder) error {
 	origerr := err
+	recorder.Event(obj.RuntimeObject(), v1.EventTypeWarning, ReconcileErrorEventReason, origerr.Error())
 	obj.GetStatus().Message = origerr.Error()
 	obj.GetStatus().State = iamv1beta1.ErrorSyncState
 	if err = sw.Update(ctx, obj.RuntimeObject()); err != nil {
@@ -104,45 +148,40 @@ func errWithStatus(ctx context.Context, obj AWSObjectStatusResource, err error,
 	return origerr
 }
 
-func IAMService(region string) (*awsiam.IAM, error) {
-	session, err := session.NewSession(&awssdk.Config{
-		Region: awssdk.String(region)},
-	)
-	if err != nil {
-		return nil, err
-	}
-
-	return iam.Client(session), nil
+// setStatusCondition sets the given condition in the status of obj, and returns whether it changed
+func setStatusCondition(obj AWSObjectStatusResource, cond metav1.Condition) bool {
+	previous := meta.FindStatusCondition(obj.GetStatus().Conditions, cond.Type)
+	changed := previous == nil || previous.Status != cond.Status || previous.Reason != cond.Reason || previous.Message != cond.Message
+	meta.SetStatusCondition(&obj.GetStatus().Conditions, cond)
+	return changed
 }
 
-type StatusUpdater func(ctx context.Context, ins aws.Instance, obj AWSObjectStatusResource, sw client.StatusWriter, log logr.Logger)
+// StatusUpdater writes the outcome of an AWS operation to the status of the resource. A status, which could not be
+// written, is a reconcile error, as the next steps rely on it.
+type StatusUpdater func(ctx context.Context, ins aws.Instance, obj AWSObjectStatusResource, sw client.StatusWriter) error
 
 func SuccessStatusUpdater() StatusUpdater {
-	return func(ctx context.Context, ins aws.Instance, obj AWSObjectStatusResource, sw client.StatusWriter, log logr.Logger) {
+	return func(ctx context.Context, ins aws.Instance, obj AWSObjectStatusResource, sw client.StatusWriter) error {
 		obj.GetStatus().ARN = ins.ARN().String()
 		obj.GetStatus().Message = "Succesfully reconciled"
 		obj.GetStatus().State = iamv1beta1.OkSyncState
 		obj.GetStatus().LastSyncAttempt = time.Now().Format(time.RFC822Z)
+		obj.GetStatus().PlannedOperations = nil
 
-		err := sw.Update(ctx, obj.RuntimeObject())
-		if err != nil {
-			log.Error(err, "unable to write status to resource")
-		}
+		return sw.Update(ctx, obj.RuntimeObject())
 	}
 }
 
 func ErrorStatusUpdater(reason string) StatusUpdater {
-	return func(ctx context.Context, ins aws.Instance, obj AWSObjectStatusResource, sw client.StatusWriter, log logr.Logger) {
+	return func(ctx context.Context, ins aws.Instance, obj AWSObjectStatusResource, sw client.StatusWriter) error {
 		obj.GetStatus().Message = reason
 		obj.GetStatus().State = iamv1beta1.ErrorSyncState
 		obj.GetStatus().LastSyncAttempt = time.Now().Format(time.RFC822Z)
 
-		err := sw.Update(ctx, obj.RuntimeObject())
-		if err != nil {
-			log.Error(err, "unable to write status to resource")
-		}
+		return sw.Update(ctx, obj.RuntimeObject())
 	}
 }
 
-func DoNothingStatusUpdater(ctx context.Context, ins aws.Instance, obj AWSObjectStatusResource, sw client.StatusWriter, log logr.Logger) {
+func DoNothingStatusUpdater(ctx context.Context, ins aws.Instance, obj AWSObjectStatusResource, sw client.StatusWriter) error {
+	return nil
 }
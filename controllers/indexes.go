@@ -0,0 +1,174 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	iamv1beta1 "github.com/redradrat/aws-iam-operator/api/v1beta1"
+)
+
+// Field indexes on the references between our resources. They allow us to look up the dependents of a resource,
+// without listing all resources of a kind.
+const (
+	policyAttachmentPolicyIndex = "spec.policy"
+	policyAttachmentTargetIndex = "spec.target"
+	roleAssumeRolePolicyIndex   = "spec.assumeRolePolicyRef"
+	roleServiceAccountIndex     = "spec.serviceAccounts"
+	groupUsersIndex             = "spec.users"
+	arnReferencesIndex          = "spec.arnRefs"
+	documentSourceIndex         = "spec.documentFrom"
+)
+
+// SetupFieldIndexes registers all field indexes used by the reconcilers. It has to be called once, before the
+// reconcilers are set up.
+func SetupFieldIndexes(ctx context.Context, indexer client.FieldIndexer) error {
+	if err := indexer.IndexField(ctx, &iamv1beta1.PolicyAttachment{}, policyAttachmentPolicyIndex, func(obj client.Object) []string {
+		ref := obj.(*iamv1beta1.PolicyAttachment).Spec.PolicyReference
+		if ref.Name == "" {
+			return nil
+		}
+		return []string{namespacedIndexKey(ref.Namespace, ref.Name)}
+	}); err != nil {
+		return err
+	}
+
+	if err := indexer.IndexField(ctx, &iamv1beta1.PolicyAttachment{}, policyAttachmentTargetIndex, func(obj client.Object) []string {
+		ref := obj.(*iamv1beta1.PolicyAttachment).Spec.TargetReference
+		if ref.Name == "" {
+			return nil
+		}
+		return []string{targetIndexKey(ref.Type, ref.Namespace, ref.Name)}
+	}); err != nil {
+		return err
+	}
+
+	if err := indexer.IndexField(ctx, &iamv1beta1.Role{}, roleAssumeRolePolicyIndex, func(obj client.Object) []string {
+		ref := obj.(*iamv1beta1.Role).Spec.AssumeRolePolicyReference
+		if ref.Name == "" {
+			return nil
+		}
+		return []string{namespacedIndexKey(ref.Namespace, ref.Name)}
+	}); err != nil {
+		return err
+	}
+
+	if err := indexer.IndexField(ctx, &iamv1beta1.Role{}, roleServiceAccountIndex, func(obj client.Object) []string {
+		return serviceAccountIndexKeys(obj.(*iamv1beta1.Role))
+	}); err != nil {
+		return err
+	}
+
+	if err := indexer.IndexField(ctx, &iamv1beta1.Group{}, groupUsersIndex, func(obj client.Object) []string {
+		var keys []string
+		for _, user := range obj.(*iamv1beta1.Group).Spec.Users {
+			keys = append(keys, namespacedIndexKey(user.Namespace, user.Name))
+		}
+		return keys
+	}); err != nil {
+		return err
+	}
+
+	if err := indexer.IndexField(ctx, &iamv1beta1.Policy{}, arnReferencesIndex, func(obj client.Object) []string {
+		policy := obj.(*iamv1beta1.Policy)
+		return arnReferenceIndexKeys(policy, policy.Spec.Statement.ARNReferences(policy.Namespace))
+	}); err != nil {
+		return err
+	}
+
+	// the references of a referenced AssumeRolePolicy are only known from the status, once they have been resolved
+	if err := indexer.IndexField(ctx, &iamv1beta1.Role{}, arnReferencesIndex, func(obj client.Object) []string {
+		role := obj.(*iamv1beta1.Role)
+		return arnReferenceIndexKeys(role, role.Spec.AssumeRolePolicy.ARNReferences(role.Namespace))
+	}); err != nil {
+		return err
+	}
+
+	if err := indexer.IndexField(ctx, &iamv1beta1.Policy{}, documentSourceIndex, func(obj client.Object) []string {
+		policy := obj.(*iamv1beta1.Policy)
+		return documentSourceIndexKeys(policy.Namespace, policy.Spec.DocumentFrom)
+	}); err != nil {
+		return err
+	}
+
+	return indexer.IndexField(ctx, &iamv1beta1.AssumeRolePolicy{}, documentSourceIndex, func(obj client.Object) []string {
+		arp := obj.(*iamv1beta1.AssumeRolePolicy)
+		return documentSourceIndexKeys(arp.Namespace, arp.Spec.DocumentFrom)
+	})
+}
+
+// arnReferenceIndexKeys returns the index keys of the given references, and of the references resolved for obj before
+func arnReferenceIndexKeys(obj DocumentStatusResource, refs []iamv1beta1.ARNReference) []string {
+	seen := map[string]bool{}
+	for _, ref := range refs {
+		seen[ref.Key()] = true
+	}
+	for key := range obj.GetDocumentStatus().ResolvedReferences {
+		seen[key] = true
+	}
+	var keys []string
+	for key := range seen {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func namespacedIndexKey(namespace, name string) string {
+	return fmt.Sprintf("%s/%s", namespace, name)
+}
+
+func targetIndexKey(targetType iamv1beta1.TargetType, namespace, name string) string {
+	return fmt.Sprintf("%s/%s/%s", targetType, namespace, name)
+}
+
+// listPolicyAttachments returns all PolicyAttachments, whose given index field matches the given key
+func listPolicyAttachments(ctx context.Context, c client.Reader, index, key string) ([]iamv1beta1.PolicyAttachment, error) {
+	attachments := iamv1beta1.PolicyAttachmentList{}
+	if err := c.List(ctx, &attachments, client.MatchingFields{index: key}); err != nil {
+		return nil, err
+	}
+	return attachments.Items, nil
+}
+
+// ListTargetPolicyAttachments returns the PolicyAttachments of all namespaces, which attach a policy to the target. The
+// client has to read from a cache with the field indexes of SetupFieldIndexes.
+func ListTargetPolicyAttachments(ctx context.Context, c client.Reader, target iamv1beta1.TargetReference) ([]iamv1beta1.PolicyAttachment, error) {
+	return listPolicyAttachments(ctx, c, policyAttachmentTargetIndex, targetIndexKey(target.Type, target.Namespace, target.Name))
+}
+
+// requestsForIndex returns a function mapping an object to reconcile requests for all objects of the given list type,
+// whose index field points to that object.
+func requestsForIndex(c client.Reader, list client.ObjectList, index string, key func(client.Object) string) func(client.Object) []reconcile.Request {
+	return func(obj client.Object) []reconcile.Request {
+		l := list.DeepCopyObject().(client.ObjectList)
+		if err := c.List(context.Background(), l, client.MatchingFields{index: key(obj)}); err != nil {
+			return nil
+		}
+
+		items, err := meta.ExtractList(l)
+		if err != nil {
+			return nil
+		}
+
+		var requests []reconcile.Request
+		for _, item := range items {
+			if o, ok := item.(client.Object); ok {
+				requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(o)})
+			}
+		}
+		return requests
+	}
+}
+
+func namespacedKeyOf(obj client.Object) string {
+	return namespacedIndexKey(obj.GetNamespace(), obj.GetName())
+}
+
+func targetKeyOf(targetType iamv1beta1.TargetType) func(client.Object) string {
+	return func(obj client.Object) string {
+		return targetIndexKey(targetType, obj.GetNamespace(), obj.GetName())
+	}
+}
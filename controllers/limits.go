@@ -0,0 +1,66 @@
+package controllers
+
+import (
+	"context"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	iamv1beta1 "github.com/redradrat/aws-iam-operator/api/v1beta1"
+	"github.com/redradrat/aws-iam-operator/pkg/limits"
+)
+
+// Reasons for the WithinLimits condition
+const (
+	WithinLimitsReason       = "WithinLimits"
+	PolicyTooLargeReason     = "PolicyTooLarge"
+	TooManyAttachmentsReason = "TooManyAttachments"
+)
+
+// checkDocumentSize checks the size of the given policy document against the given limit, and records the result in
+// the WithinLimits condition of obj. Returns whether the condition changed, and an error if the document is too large.
+func checkDocumentSize(obj AWSObjectStatusResource, doc Document, limit int) (bool, error) {
+	size, err := doc.Size()
+	if err != nil {
+		return false, err
+	}
+	err = limits.CheckSize(size, limit)
+	return setLimitsCondition(obj, PolicyTooLargeReason, err), err
+}
+
+// checkAttachedPolicies checks whether the target of the given PolicyAttachment can take another attached policy, and
+// records the result in the WithinLimits condition. Returns an error if the limit is reached.
+func checkAttachedPolicies(ctx context.Context, c client.Reader, policyAttachment *iamv1beta1.PolicyAttachment, limit int) error {
+	tarRef := policyAttachment.Spec.TargetReference
+	attachments, err := ListTargetPolicyAttachments(ctx, c, tarRef)
+	if err != nil {
+		return err
+	}
+
+	attached := 0
+	for _, att := range attachments {
+		if att.UID != policyAttachment.UID && att.Status.ARN != "" {
+			attached++
+		}
+	}
+
+	err = limits.CheckAttachedPolicies(attached, limit)
+	setLimitsCondition(policyAttachment, TooManyAttachmentsReason, err)
+	return err
+}
+
+func setLimitsCondition(obj AWSObjectStatusResource, reason string, err error) bool {
+	cond := metav1.Condition{
+		Type:               iamv1beta1.WithinLimitsCondition,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: obj.RuntimeObject().GetGeneration(),
+		Reason:             WithinLimitsReason,
+		Message:            "within IAM limits",
+	}
+	if err != nil {
+		cond.Status = metav1.ConditionFalse
+		cond.Reason = reason
+		cond.Message = err.Error()
+	}
+	return setStatusCondition(obj, cond)
+}
@@ -0,0 +1,55 @@
+package controllers
+
+import (
+	"strings"
+
+	"github.com/redradrat/cloud-objects/aws/iam"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+
+	iamv1beta1 "github.com/redradrat/aws-iam-operator/api/v1beta1"
+	"github.com/redradrat/aws-iam-operator/pkg/lint"
+)
+
+// Reasons for the PolicyLinted condition
+const (
+	LintPassedReason   = "LintPassed"
+	LintWarningsReason = "LintWarnings"
+	LintErrorsReason   = "LintErrors"
+)
+
+// checkLint lints the policy document of obj, and records the result in the PolicyLinted condition of obj. Warnings are
+// emitted as Events. Returns whether the condition changed, and an error if the linter found errors.
+func checkLint(obj AWSObjectStatusResource, doc iam.PolicyDocument, trust bool, region string, recorder record.EventRecorder) (bool, error) {
+	result := lint.Lint(doc, trust, lint.Options{Partition: lint.PartitionForRegion(region)})
+
+	cond := metav1.Condition{
+		Type:               iamv1beta1.PolicyLintedCondition,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: obj.RuntimeObject().GetGeneration(),
+		Reason:             LintPassedReason,
+		Message:            "no findings",
+	}
+	var msgs []string
+	for _, f := range result.Findings {
+		msgs = append(msgs, string(f.Severity)+": "+f.String())
+	}
+	switch {
+	case result.Error() != nil:
+		cond.Status = metav1.ConditionFalse
+		cond.Reason = LintErrorsReason
+		cond.Message = strings.Join(msgs, "; ")
+	case len(result.Findings) > 0:
+		cond.Reason = LintWarningsReason
+		cond.Message = strings.Join(msgs, "; ")
+	}
+
+	changed := setStatusCondition(obj, cond)
+	// only emit the warnings, if they changed since we last looked
+	if changed && cond.Reason == LintWarningsReason {
+		recorder.Event(obj.RuntimeObject(), v1.EventTypeWarning, PolicyLintWarningEventReason, cond.Message)
+	}
+
+	return changed, result.Error()
+}
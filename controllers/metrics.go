@@ -0,0 +1,221 @@
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	awsiam "github.com/aws/aws-sdk-go/service/iam"
+	"github.com/prometheus/client_golang/prometheus"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	"github.com/redradrat/cloud-objects/aws"
+
+	iamv1beta1 "github.com/redradrat/aws-iam-operator/api/v1beta1"
+)
+
+const metricsNamespace = "aws_iam_operator"
+
+// Drift reasons used as label on the drift detection counter
+const (
+	AlreadyExistsDriftReason             = "AlreadyExists"
+	NotFoundDriftReason                  = "NotFound"
+	AssumeRolePolicyReferenceDriftReason = "AssumeRolePolicyReferenceChanged"
+)
+
+var (
+	awsAPICallsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "aws_api_calls_total",
+		Help:      "Number of AWS API calls made by the operator, partitioned by service, operation and error code.",
+	}, []string{"service", "operation", "code"})
+
+	awsAPICallDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "aws_api_call_duration_seconds",
+		Help:      "Latency of AWS API calls made by the operator (including retries), partitioned by service and operation.",
+		Buckets:   prometheus.ExponentialBuckets(0.05, 2, 10),
+	}, []string{"service", "operation"})
+
+	awsAPICallRetriesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "aws_api_call_retries_total",
+		Help:      "Number of retries of AWS API calls made by the operator, partitioned by service and operation.",
+	}, []string{"service", "operation"})
+
+	driftDetectionsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "drift_detections_total",
+		Help:      "Number of times the state in AWS was found to differ from the state recorded on a resource.",
+	}, []string{"kind", "reason"})
+
+	managedResourcesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "", "managed_resources"),
+		"Number of resources managed by the operator, partitioned by kind and sync state.",
+		[]string{"kind", "state"}, nil,
+	)
+
+	credentialAgeDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "", "credential_age_seconds"),
+		"Time since the credentials of a User have been issued, partitioned by credential type.",
+		[]string{"namespace", "name", "type"}, nil,
+	)
+)
+
+func init() {
+	metrics.Registry.MustRegister(awsAPICallsTotal, awsAPICallDuration, awsAPICallRetriesTotal, driftDetectionsTotal)
+}
+
+// instrumentAWSClient adds a handler to the given client handlers, which records count, latency and retries of every
+// API call.
+func instrumentAWSClient(handlers *request.Handlers) {
+	handlers.Complete.PushBackNamed(request.NamedHandler{
+		Name: "aws-iam-operator.metrics",
+		Fn: func(r *request.Request) {
+			code := "OK"
+			if r.Error != nil {
+				code = "Unknown"
+				if aerr, ok := r.Error.(awserr.Error); ok {
+					code = aerr.Code()
+				}
+			}
+			service, operation := r.ClientInfo.ServiceName, r.Operation.Name
+			awsAPICallsTotal.WithLabelValues(service, operation, code).Inc()
+			awsAPICallDuration.WithLabelValues(service, operation).Observe(time.Since(r.Time).Seconds())
+			if r.RetryCount > 0 {
+				awsAPICallRetriesTotal.WithLabelValues(service, operation).Add(float64(r.RetryCount))
+			}
+		},
+	})
+}
+
+// recordDrift increases the drift counter, if the given error tells us that AWS does not look like we expected it to.
+func recordDrift(obj AWSObjectStatusResource, err error) {
+	if aerr, ok := err.(awserr.Error); ok {
+		switch aerr.Code() {
+		case awsiam.ErrCodeEntityAlreadyExistsException:
+			driftDetectionsTotal.WithLabelValues(kindOf(obj), AlreadyExistsDriftReason).Inc()
+		case awsiam.ErrCodeNoSuchEntityException:
+			driftDetectionsTotal.WithLabelValues(kindOf(obj), NotFoundDriftReason).Inc()
+		}
+	}
+	if ierr, ok := err.(aws.InstanceError); ok && obj.GetStatus().ARN != "" {
+		// we have an ARN in our status, but the instance claims to not exist
+		if ierr.IsOfErrorCode(aws.ErrAWSInstanceNotYetCreated) {
+			driftDetectionsTotal.WithLabelValues(kindOf(obj), NotFoundDriftReason).Inc()
+		}
+	}
+}
+
+// kindOf returns the kind of the given resource, without relying on the TypeMeta being set.
+func kindOf(obj AWSObjectStatusResource) string {
+	return reflect.Indirect(reflect.ValueOf(obj.RuntimeObject())).Type().Name()
+}
+
+// ResourceCollector is a prometheus.Collector, which exposes metrics about the resources managed by the operator. The
+// values are read from the given (usually cache-backed) client on every scrape.
+type ResourceCollector struct {
+	client  client.Reader
+	timeout time.Duration
+}
+
+func NewResourceCollector(c client.Reader) *ResourceCollector {
+	return &ResourceCollector{client: c, timeout: 10 * time.Second}
+}
+
+func (rc *ResourceCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- managedResourcesDesc
+	ch <- credentialAgeDesc
+}
+
+func (rc *ResourceCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), rc.timeout)
+	defer cancel()
+
+	lists := map[string]client.ObjectList{
+		"Role":             &iamv1beta1.RoleList{},
+		"Policy":           &iamv1beta1.PolicyList{},
+		"PolicyAttachment": &iamv1beta1.PolicyAttachmentList{},
+		"User":             &iamv1beta1.UserList{},
+		"Group":            &iamv1beta1.GroupList{},
+	}
+	for kind, list := range lists {
+		if err := rc.client.List(ctx, list); err != nil {
+			continue
+		}
+		items, err := meta.ExtractList(list)
+		if err != nil {
+			continue
+		}
+
+		counts := map[iamv1beta1.SyncState]int{
+			iamv1beta1.SyncSyncState:  0,
+			iamv1beta1.OkSyncState:    0,
+			iamv1beta1.ErrorSyncState: 0,
+		}
+		for _, item := range items {
+			res, ok := item.(AWSObjectStatusResource)
+			if !ok {
+				continue
+			}
+			state := res.GetStatus().State
+			if state == "" {
+				// not yet touched by the controller
+				state = iamv1beta1.SyncSyncState
+			}
+			counts[state]++
+		}
+		for state, count := range counts {
+			ch <- prometheus.MustNewConstMetric(managedResourcesDesc, prometheus.GaugeValue, float64(count), kind, string(state))
+		}
+	}
+
+	users := iamv1beta1.UserList{}
+	if err := rc.client.List(ctx, &users); err != nil {
+		return
+	}
+	for _, user := range users.Items {
+		issued := map[string]*metav1.Time{}
+		if user.Status.ProgrammaticAccessCreated {
+			issued["accesskey"] = user.Status.AccessKeyIssuedAt
+		}
+		if user.Status.LoginProfileCreated {
+			issued["login"] = user.Status.LoginProfileIssuedAt
+		}
+		for credType, issuedAt := range issued {
+			// credentials issued before their time has been recorded are as old as their Secret, as long as they
+			// have not been issued again
+			if issuedAt == nil {
+				issuedAt = rc.credentialSecretCreation(ctx, &user, credType)
+			}
+			if issuedAt == nil {
+				continue
+			}
+			age := time.Since(issuedAt.Time).Seconds()
+			ch <- prometheus.MustNewConstMetric(credentialAgeDesc, prometheus.GaugeValue, age, user.Namespace, user.Name, credType)
+		}
+	}
+}
+
+// credentialSecretCreation returns the creation time of the Secret the credentials of the given type have been written
+// to, nil if they have not been written to a Secret
+func (rc *ResourceCollector) credentialSecretCreation(ctx context.Context, user *iamv1beta1.User, credType string) *metav1.Time {
+	ref := user.Status.LoginProfileSecret
+	if credType == "accesskey" {
+		ref = user.Status.ProgrammaticAccessSecret
+	}
+	if ref.Namespace == "" {
+		return nil
+	}
+	sec := v1.Secret{}
+	if err := rc.client.Get(ctx, client.ObjectKey{Name: ref.Name, Namespace: ref.Namespace}, &sec); err != nil {
+		return nil
+	}
+	return &sec.CreationTimestamp
+}
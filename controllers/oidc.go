@@ -0,0 +1,60 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"github.com/redradrat/aws-iam-operator/pkg/lint"
+)
+
+// openIDConfigurationPath is where the API server serves the discovery document of its service account issuer
+const openIDConfigurationPath = "/.well-known/openid-configuration"
+
+// +kubebuilder:rbac:urls=/.well-known/openid-configuration,verbs=get
+
+// ServiceAccountIssuer returns the issuer URL of the ServiceAccount tokens of the cluster, as published by the API
+// server in its OpenID configuration
+func ServiceAccountIssuer(ctx context.Context, cfg *rest.Config) (string, error) {
+	clientset, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return "", err
+	}
+	raw, err := clientset.Discovery().RESTClient().Get().AbsPath(openIDConfigurationPath).DoRaw(ctx)
+	if err != nil {
+		return "", fmt.Errorf("unable to read %s of the API server: %w", openIDConfigurationPath, err)
+	}
+
+	config := struct {
+		Issuer string `json:"issuer"`
+	}{}
+	if err := json.Unmarshal(raw, &config); err != nil {
+		return "", fmt.Errorf("invalid OpenID configuration of the API server: %w", err)
+	}
+	if config.Issuer == "" {
+		return "", fmt.Errorf("the OpenID configuration of the API server has no issuer")
+	}
+	return config.Issuer, nil
+}
+
+// OIDCProviderARN returns the ARN of the IAM OIDC provider of the given issuer URL, in the account and the partition
+// of the region. IAM identifies providers by the issuer URL without its https:// scheme.
+func OIDCProviderARN(issuer, accountID, region string) (string, error) {
+	u, err := url.Parse(issuer)
+	if err != nil {
+		return "", fmt.Errorf("service account issuer '%s' is invalid: %w", issuer, err)
+	}
+	if u.Scheme != "https" || u.Host == "" {
+		return "", fmt.Errorf("service account issuer '%s' is no https URL, which IAM requires for OIDC providers", issuer)
+	}
+	if accountID == "" {
+		return "", fmt.Errorf("the AWS account ID is unknown")
+	}
+	provider := u.Host + strings.TrimSuffix(u.Path, "/")
+	return fmt.Sprintf("arn:%s:iam::%s:oidc-provider/%s", lint.PartitionForRegion(region), accountID, provider), nil
+}
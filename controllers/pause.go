@@ -0,0 +1,45 @@
+package controllers
+
+import (
+	"strconv"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	iamv1beta1 "github.com/redradrat/aws-iam-operator/api/v1beta1"
+)
+
+// PausedReason is the reason of the Paused condition
+const PausedReason = "PausedByAnnotation"
+
+// checkPaused returns whether obj is paused by the paused annotation, and records it in the Paused condition. The
+// condition is removed again, once obj is unpaused. Also returns whether the condition changed.
+func checkPaused(obj AWSObjectStatusResource) (paused bool, changed bool) {
+	paused, _ = strconv.ParseBool(obj.RuntimeObject().GetAnnotations()[iamv1beta1.PausedAnnotation])
+	if !paused {
+		if meta.FindStatusCondition(obj.GetStatus().Conditions, iamv1beta1.PausedCondition) == nil {
+			return false, false
+		}
+		meta.RemoveStatusCondition(&obj.GetStatus().Conditions, iamv1beta1.PausedCondition)
+		return false, true
+	}
+
+	return true, setStatusCondition(obj, metav1.Condition{
+		Type:               iamv1beta1.PausedCondition,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: obj.RuntimeObject().GetGeneration(),
+		Reason:             PausedReason,
+		Message:            "the operator makes no changes, until the " + iamv1beta1.PausedAnnotation + " annotation is removed",
+	})
+}
+
+// reconcileRequested returns true, if the reconcile-request annotation of obj holds a value we have not handled yet
+func reconcileRequested(obj AWSObjectStatusResource) bool {
+	request := obj.RuntimeObject().GetAnnotations()[iamv1beta1.ReconcileRequestAnnotation]
+	return request != "" && request != obj.GetStatus().LastHandledReconcileRequest
+}
+
+// markReconcileRequestHandled records the current value of the reconcile-request annotation of obj as handled
+func markReconcileRequestHandled(obj AWSObjectStatusResource) {
+	obj.GetStatus().LastHandledReconcileRequest = obj.RuntimeObject().GetAnnotations()[iamv1beta1.ReconcileRequestAnnotation]
+}
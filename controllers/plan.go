@@ -0,0 +1,173 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/iam/iamiface"
+	"github.com/redradrat/cloud-objects/aws"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	iamv1beta1 "github.com/redradrat/aws-iam-operator/api/v1beta1"
+)
+
+// awsOperation is an operation on the AWS object behind an instance. Planning an operation is kept apart from
+// executing it, so that in dry-run mode it can be recorded instead.
+type awsOperation struct {
+	Type     iamv1beta1.OperationType
+	Instance aws.Instance
+}
+
+// operationEvents holds the Event reasons and wording for every type of operation
+var operationEvents = map[iamv1beta1.OperationType]struct {
+	reason, failedReason, blockedReason string
+	verb, pastVerb                      string
+}{
+	iamv1beta1.CreateOperation:   {CreatedEventReason, CreateFailedEventReason, CreateFailedEventReason, "create", "created"},
+	iamv1beta1.AdoptOperation:    {AdoptedEventReason, AdoptFailedEventReason, AdoptFailedEventReason, "adopt", "adopted"},
+	iamv1beta1.AttachOperation:   {AttachedEventReason, AttachFailedEventReason, AttachFailedEventReason, "create", "created"},
+	iamv1beta1.UpdateOperation:   {UpdatedEventReason, UpdateFailedEventReason, UpdateFailedEventReason, "update", "updated"},
+	iamv1beta1.RecreateOperation: {RecreatedEventReason, RecreateFailedEventReason, DeleteBlockedEventReason, "recreate", "recreated"},
+	iamv1beta1.DeleteOperation:   {DeletedEventReason, DeleteFailedEventReason, DeleteBlockedEventReason, "delete", "deleted"},
+	iamv1beta1.DetachOperation:   {DetachedEventReason, DetachFailedEventReason, DetachBlockedEventReason, "delete", "deleted"},
+}
+
+func planCreate(ins aws.Instance) awsOperation {
+	if isAttachment(ins) {
+		return awsOperation{Type: iamv1beta1.AttachOperation, Instance: ins}
+	}
+	return awsOperation{Type: iamv1beta1.CreateOperation, Instance: ins}
+}
+
+func planUpdate(ins aws.Instance) awsOperation {
+	return awsOperation{Type: iamv1beta1.UpdateOperation, Instance: ins}
+}
+
+func planRecreate(ins aws.Instance) awsOperation {
+	return awsOperation{Type: iamv1beta1.RecreateOperation, Instance: ins}
+}
+
+func planDelete(ins aws.Instance) awsOperation {
+	if isAttachment(ins) {
+		return awsOperation{Type: iamv1beta1.DetachOperation, Instance: ins}
+	}
+	return awsOperation{Type: iamv1beta1.DeleteOperation, Instance: ins}
+}
+
+// removal returns true, if the operation removes the AWS object
+func (op awsOperation) removal() bool {
+	return op.Type == iamv1beta1.DeleteOperation || op.Type == iamv1beta1.DetachOperation
+}
+
+// execute makes the operation in AWS. Recreating an object, which does not exist (anymore), just creates it.
+func (op awsOperation) execute(svc iamiface.IAMAPI) error {
+	switch op.Type {
+	case iamv1beta1.CreateOperation, iamv1beta1.AttachOperation:
+		return op.Instance.Create(svc)
+	case iamv1beta1.AdoptOperation:
+		return checkAdoptable(svc, op.Instance)
+	case iamv1beta1.UpdateOperation:
+		return op.Instance.Update(svc)
+	case iamv1beta1.RecreateOperation:
+		if err := ignoreDoesNotExistError(op.Instance.Delete(svc)); err != nil {
+			return err
+		}
+		return op.Instance.Create(svc)
+	case iamv1beta1.DeleteOperation, iamv1beta1.DetachOperation:
+		return op.Instance.Delete(svc)
+	}
+	return fmt.Errorf("unknown operation '%s'", op.Type)
+}
+
+// applyAWSOperation runs the preFunc and then executes the operation, or only records it in the status and Events of
+// obj, if we're in dry-run mode.
+func applyAWSOperation(svc iamiface.IAMAPI, op awsOperation, recorder record.EventRecorder, obj AWSObjectStatusResource, preFunc func() error, dryRun bool) (StatusUpdater, error) {
+	ev := operationEvents[op.Type]
+
+	if err := preFunc(); err != nil {
+		recorder.Event(obj.RuntimeObject(), v1.EventTypeWarning, ev.blockedReason, err.Error())
+		return ErrorStatusUpdater(err.Error()), err
+	}
+
+	if dryRun {
+		// there's nothing to remove, if the object has never been created
+		if op.removal() && obj.GetStatus().ARN == "" {
+			return DoNothingStatusUpdater, nil
+		}
+		target := describeInstance(obj, op.Instance)
+		recordPlannedOperation(recorder, obj, iamv1beta1.PlannedOperation{Operation: op.Type, Target: target}, ev.verb+" "+target)
+		return PlannedStatusUpdater(), nil
+	}
+
+	execErr := op.execute(svc)
+	err := execErr
+	if op.removal() {
+		err = ignoreDoesNotExistError(err)
+	}
+	if err != nil {
+		recordDrift(obj, err)
+		recorder.Eventf(obj.RuntimeObject(), v1.EventTypeWarning, ev.failedReason, "unable to %s %s: %s", ev.verb, describeInstance(obj, op.Instance), err.Error())
+		return ErrorStatusUpdater(err.Error()), err
+	}
+
+	if op.removal() {
+		// only tell about a deletion, if there actually was something to delete
+		if execErr == nil {
+			recorder.Eventf(obj.RuntimeObject(), v1.EventTypeNormal, ev.reason, "%s %s", ev.pastVerb, describeInstance(obj, op.Instance))
+		}
+		return DoNothingStatusUpdater, nil
+	}
+
+	recorder.Eventf(obj.RuntimeObject(), v1.EventTypeNormal, ev.reason, "%s %s", ev.pastVerb, describeInstance(obj, op.Instance))
+	return SuccessStatusUpdater(), nil
+}
+
+// recordPlannedOperation records the planned operation in the status of obj, and tells about it in an Event
+func recordPlannedOperation(recorder record.EventRecorder, obj AWSObjectStatusResource, op iamv1beta1.PlannedOperation, description string) {
+	obj.GetStatus().PlannedOperations = append(obj.GetStatus().PlannedOperations, op)
+	recorder.Eventf(obj.RuntimeObject(), v1.EventTypeNormal, PlannedEventReason, "dry run: would %s", description)
+}
+
+// dryRunEnabled returns true, if the whole operator runs in dry-run mode, or the resource is annotated for it
+func dryRunEnabled(global bool, obj client.Object) bool {
+	if global {
+		return true
+	}
+	enabled, _ := strconv.ParseBool(obj.GetAnnotations()[iamv1beta1.DryRunAnnotation])
+	return enabled
+}
+
+// PlannedStatusUpdater marks the resource as planned, with the operations recorded in its status
+func PlannedStatusUpdater() StatusUpdater {
+	return func(ctx context.Context, ins aws.Instance, obj AWSObjectStatusResource, sw client.StatusWriter) error {
+		var ops []string
+		for _, op := range obj.GetStatus().PlannedOperations {
+			ops = append(ops, fmt.Sprintf("%s %s", op.Operation, op.Target))
+		}
+		obj.GetStatus().Message = "dry run: no operations planned"
+		if len(ops) > 0 {
+			obj.GetStatus().Message = "dry run: planned " + strings.Join(ops, ", ")
+		}
+		obj.GetStatus().State = iamv1beta1.PlannedSyncState
+		obj.GetStatus().LastSyncAttempt = time.Now().Format(time.RFC822Z)
+
+		return sw.Update(ctx, obj.RuntimeObject())
+	}
+}
+
+// upToDate returns true, if the last reconciliation of obj succeeded (or, in dry-run mode, was planned), and no new
+// reconciliation has been requested through the reconcile-request annotation
+func upToDate(obj AWSObjectStatusResource, dryRun bool) bool {
+	state := obj.GetStatus().State
+	return (state == iamv1beta1.OkSyncState || dryRun && state == iamv1beta1.PlannedSyncState) && !reconcileRequested(obj)
+}
+
+// planned returns true, if operations have been planned for obj during this reconciliation
+func planned(obj AWSObjectStatusResource) bool {
+	return len(obj.GetStatus().PlannedOperations) > 0
+}
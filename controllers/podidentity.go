@@ -0,0 +1,151 @@
+package controllers
+
+import (
+	"fmt"
+
+	awssdk "github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/eks"
+	"github.com/aws/aws-sdk-go/service/eks/eksiface"
+
+	iamv1beta1 "github.com/redradrat/aws-iam-operator/api/v1beta1"
+)
+
+// podIdentityClusterName returns the EKS cluster, the pod identity associations of the role are created in
+func podIdentityClusterName(role *iamv1beta1.Role, defaultClusterName string) string {
+	if role.Spec.PodIdentity != nil && role.Spec.PodIdentity.ClusterName != "" {
+		return role.Spec.PodIdentity.ClusterName
+	}
+	return defaultClusterName
+}
+
+// syncPodIdentityAssociations makes the pod identity associations recorded in the status of the role match its spec:
+// missing associations are created, associations of ServiceAccounts which are no longer listed are deleted, and
+// associations still pointing at an old ARN of the role are updated. An existing association of a ServiceAccount is
+// taken over, if it already associates the role. The status is kept up to date, even if an operation fails.
+func syncPodIdentityAssociations(svc eksiface.EKSAPI, role *iamv1beta1.Role, defaultClusterName string) (created, deleted []iamv1beta1.PodIdentityAssociation, err error) {
+	desired, err := role.PodIdentityServiceAccounts()
+	if err != nil {
+		return nil, nil, err
+	}
+	cluster := podIdentityClusterName(role, defaultClusterName)
+	if len(desired) > 0 && cluster == "" {
+		return nil, nil, fmt.Errorf("pod identity needs spec.podIdentity.clusterName, as no cluster name has been given to the controller")
+	}
+
+	wanted := map[iamv1beta1.ServiceAccountSubject]bool{}
+	for _, sa := range desired {
+		wanted[sa] = true
+	}
+
+	var associations []iamv1beta1.PodIdentityAssociation
+	defer func() { role.Status.PodIdentityAssociations = associations }()
+
+	existing := map[iamv1beta1.ServiceAccountSubject]bool{}
+	for i, association := range role.Status.PodIdentityAssociations {
+		sa := iamv1beta1.ServiceAccountSubject{Namespace: association.Namespace, Name: association.ServiceAccount}
+		if association.ClusterName != cluster || !wanted[sa] || existing[sa] {
+			if err := deletePodIdentityAssociation(svc, association); err != nil {
+				associations = append(associations, role.Status.PodIdentityAssociations[i:]...)
+				return created, deleted, err
+			}
+			deleted = append(deleted, association)
+			continue
+		}
+		if association.RoleARN != role.Status.ARN {
+			_, err := svc.UpdatePodIdentityAssociation(&eks.UpdatePodIdentityAssociationInput{
+				ClusterName:   awssdk.String(association.ClusterName),
+				AssociationId: awssdk.String(association.AssociationID),
+				RoleArn:       awssdk.String(role.Status.ARN),
+			})
+			if err != nil {
+				associations = append(associations, role.Status.PodIdentityAssociations[i:]...)
+				return created, deleted, err
+			}
+			association.RoleARN = role.Status.ARN
+		}
+		existing[sa] = true
+		associations = append(associations, association)
+	}
+
+	for _, sa := range desired {
+		if existing[sa] {
+			continue
+		}
+		association, err := createPodIdentityAssociation(svc, cluster, sa, role.Status.ARN)
+		if err != nil {
+			return created, deleted, err
+		}
+		existing[sa] = true
+		associations = append(associations, association)
+		created = append(created, association)
+	}
+	return created, deleted, nil
+}
+
+// createPodIdentityAssociation associates the ServiceAccount with the role. If the ServiceAccount already has an
+// association with the role, it's returned instead; an association with another role is an error.
+func createPodIdentityAssociation(svc eksiface.EKSAPI, cluster string, sa iamv1beta1.ServiceAccountSubject, roleARN string) (iamv1beta1.PodIdentityAssociation, error) {
+	association := iamv1beta1.PodIdentityAssociation{ClusterName: cluster, Namespace: sa.Namespace, ServiceAccount: sa.Name, RoleARN: roleARN}
+	out, err := svc.CreatePodIdentityAssociation(&eks.CreatePodIdentityAssociationInput{
+		ClusterName:    awssdk.String(cluster),
+		Namespace:      awssdk.String(sa.Namespace),
+		ServiceAccount: awssdk.String(sa.Name),
+		RoleArn:        awssdk.String(roleARN),
+	})
+	if err == nil {
+		association.AssociationID = awssdk.StringValue(out.Association.AssociationId)
+		return association, nil
+	}
+	if aerr, ok := err.(awserr.Error); !ok || aerr.Code() != eks.ErrCodeResourceInUseException {
+		return association, err
+	}
+
+	list, err := svc.ListPodIdentityAssociations(&eks.ListPodIdentityAssociationsInput{
+		ClusterName:    awssdk.String(cluster),
+		Namespace:      awssdk.String(sa.Namespace),
+		ServiceAccount: awssdk.String(sa.Name),
+	})
+	if err != nil {
+		return association, err
+	}
+	for _, summary := range list.Associations {
+		described, err := svc.DescribePodIdentityAssociation(&eks.DescribePodIdentityAssociationInput{
+			ClusterName:   awssdk.String(cluster),
+			AssociationId: summary.AssociationId,
+		})
+		if err != nil {
+			return association, err
+		}
+		if other := awssdk.StringValue(described.Association.RoleArn); other != roleARN {
+			return association, fmt.Errorf("ServiceAccount '%s/%s' of cluster '%s' is already associated with role '%s'", sa.Namespace, sa.Name, cluster, other)
+		}
+		association.AssociationID = awssdk.StringValue(summary.AssociationId)
+		return association, nil
+	}
+	return association, fmt.Errorf("ServiceAccount '%s/%s' of cluster '%s' is already associated, but the association cannot be found", sa.Namespace, sa.Name, cluster)
+}
+
+// deletePodIdentityAssociation deletes the association, unless it's already gone
+func deletePodIdentityAssociation(svc eksiface.EKSAPI, association iamv1beta1.PodIdentityAssociation) error {
+	_, err := svc.DeletePodIdentityAssociation(&eks.DeletePodIdentityAssociationInput{
+		ClusterName:   awssdk.String(association.ClusterName),
+		AssociationId: awssdk.String(association.AssociationID),
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == eks.ErrCodeResourceNotFoundException {
+		return nil
+	}
+	return err
+}
+
+// deletePodIdentityAssociations deletes all pod identity associations recorded in the status of the role. The ones
+// which could not be deleted are kept in the status.
+func deletePodIdentityAssociations(svc eksiface.EKSAPI, role *iamv1beta1.Role) error {
+	for len(role.Status.PodIdentityAssociations) > 0 {
+		if err := deletePodIdentityAssociation(svc, role.Status.PodIdentityAssociations[0]); err != nil {
+			return err
+		}
+		role.Status.PodIdentityAssociations = role.Status.PodIdentityAssociations[1:]
+	}
+	return nil
+}
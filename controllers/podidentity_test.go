@@ -0,0 +1,293 @@
+package controllers
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+
+	awssdk "github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/eks"
+	"github.com/aws/aws-sdk-go/service/eks/eksiface"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	iamv1beta1 "github.com/redradrat/aws-iam-operator/api/v1beta1"
+)
+
+const (
+	testRoleARN    = "arn:aws:iam::123456789012:role/app"
+	testOldRoleARN = "arn:aws:iam::123456789012:role/app-old"
+	testOtherARN   = "arn:aws:iam::123456789012:role/other"
+)
+
+// fakeEKS keeps pod identity associations in memory. Operations on the ServiceAccounts and associations listed in
+// failCreate and failDelete fail.
+type fakeEKS struct {
+	eksiface.EKSAPI
+
+	associations map[string]*eks.PodIdentityAssociation
+	nextID       int
+	failCreate   map[string]bool
+	failDelete   map[string]bool
+}
+
+func newFakeEKS(existing ...iamv1beta1.PodIdentityAssociation) *fakeEKS {
+	f := &fakeEKS{associations: map[string]*eks.PodIdentityAssociation{}, failCreate: map[string]bool{}, failDelete: map[string]bool{}}
+	for _, a := range existing {
+		f.associations[a.AssociationID] = &eks.PodIdentityAssociation{
+			AssociationId:  awssdk.String(a.AssociationID),
+			ClusterName:    awssdk.String(a.ClusterName),
+			Namespace:      awssdk.String(a.Namespace),
+			ServiceAccount: awssdk.String(a.ServiceAccount),
+			RoleArn:        awssdk.String(a.RoleARN),
+		}
+	}
+	return f
+}
+
+func (f *fakeEKS) find(cluster, namespace, name string) *eks.PodIdentityAssociation {
+	for _, a := range f.associations {
+		if *a.ClusterName == cluster && *a.Namespace == namespace && *a.ServiceAccount == name {
+			return a
+		}
+	}
+	return nil
+}
+
+func (f *fakeEKS) CreatePodIdentityAssociation(in *eks.CreatePodIdentityAssociationInput) (*eks.CreatePodIdentityAssociationOutput, error) {
+	if f.failCreate[*in.Namespace+"/"+*in.ServiceAccount] {
+		return nil, awserr.New("InternalFailure", "create failed", nil)
+	}
+	if f.find(*in.ClusterName, *in.Namespace, *in.ServiceAccount) != nil {
+		return nil, awserr.New(eks.ErrCodeResourceInUseException, "association exists", nil)
+	}
+	f.nextID++
+	a := &eks.PodIdentityAssociation{
+		AssociationId:  awssdk.String(fmt.Sprintf("a-%d", f.nextID)),
+		ClusterName:    in.ClusterName,
+		Namespace:      in.Namespace,
+		ServiceAccount: in.ServiceAccount,
+		RoleArn:        in.RoleArn,
+	}
+	f.associations[*a.AssociationId] = a
+	return &eks.CreatePodIdentityAssociationOutput{Association: a}, nil
+}
+
+func (f *fakeEKS) ListPodIdentityAssociations(in *eks.ListPodIdentityAssociationsInput) (*eks.ListPodIdentityAssociationsOutput, error) {
+	out := &eks.ListPodIdentityAssociationsOutput{}
+	if a := f.find(*in.ClusterName, *in.Namespace, *in.ServiceAccount); a != nil {
+		out.Associations = append(out.Associations, &eks.PodIdentityAssociationSummary{
+			AssociationId:  a.AssociationId,
+			ClusterName:    a.ClusterName,
+			Namespace:      a.Namespace,
+			ServiceAccount: a.ServiceAccount,
+		})
+	}
+	return out, nil
+}
+
+func (f *fakeEKS) DescribePodIdentityAssociation(in *eks.DescribePodIdentityAssociationInput) (*eks.DescribePodIdentityAssociationOutput, error) {
+	a, ok := f.associations[*in.AssociationId]
+	if !ok {
+		return nil, awserr.New(eks.ErrCodeResourceNotFoundException, "not found", nil)
+	}
+	return &eks.DescribePodIdentityAssociationOutput{Association: a}, nil
+}
+
+func (f *fakeEKS) UpdatePodIdentityAssociation(in *eks.UpdatePodIdentityAssociationInput) (*eks.UpdatePodIdentityAssociationOutput, error) {
+	a, ok := f.associations[*in.AssociationId]
+	if !ok {
+		return nil, awserr.New(eks.ErrCodeResourceNotFoundException, "not found", nil)
+	}
+	a.RoleArn = in.RoleArn
+	return &eks.UpdatePodIdentityAssociationOutput{Association: a}, nil
+}
+
+func (f *fakeEKS) DeletePodIdentityAssociation(in *eks.DeletePodIdentityAssociationInput) (*eks.DeletePodIdentityAssociationOutput, error) {
+	if f.failDelete[*in.AssociationId] {
+		return nil, awserr.New("InternalFailure", "delete failed", nil)
+	}
+	a, ok := f.associations[*in.AssociationId]
+	if !ok {
+		return nil, awserr.New(eks.ErrCodeResourceNotFoundException, "not found", nil)
+	}
+	delete(f.associations, *in.AssociationId)
+	return &eks.DeletePodIdentityAssociationOutput{Association: a}, nil
+}
+
+func (f *fakeEKS) ids() []string {
+	var ids []string
+	for id := range f.associations {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func testAssociation(id, cluster, namespace, name, roleARN string) iamv1beta1.PodIdentityAssociation {
+	return iamv1beta1.PodIdentityAssociation{AssociationID: id, ClusterName: cluster, Namespace: namespace, ServiceAccount: name, RoleARN: roleARN}
+}
+
+func podIdentityRole(cluster string, serviceAccounts []string, status ...iamv1beta1.PodIdentityAssociation) *iamv1beta1.Role {
+	role := &iamv1beta1.Role{ObjectMeta: metav1.ObjectMeta{Namespace: "apps", Name: "app"}}
+	if serviceAccounts != nil {
+		role.Spec.PodIdentity = &iamv1beta1.PodIdentity{ClusterName: cluster}
+		for _, name := range serviceAccounts {
+			role.Spec.PodIdentity.ServiceAccounts = append(role.Spec.PodIdentity.ServiceAccounts, iamv1beta1.ServiceAccountSubject{Name: name})
+		}
+	}
+	role.Status.ARN = testRoleARN
+	role.Status.PodIdentityAssociations = status
+	return role
+}
+
+func TestSyncPodIdentityAssociations(t *testing.T) {
+	tests := []struct {
+		name          string
+		role          *iamv1beta1.Role
+		existing      []iamv1beta1.PodIdentityAssociation
+		failCreate    []string
+		failDelete    []string
+		wantErr       bool
+		wantStatus    []iamv1beta1.PodIdentityAssociation
+		wantCreated   int
+		wantDeleted   int
+		wantRemaining []string
+		noClusterName bool
+	}{
+		{
+			name:          "creates missing associations",
+			role:          podIdentityRole("", []string{"web"}),
+			wantStatus:    []iamv1beta1.PodIdentityAssociation{testAssociation("a-1", "prod", "apps", "web", testRoleARN)},
+			wantCreated:   1,
+			wantRemaining: []string{"a-1"},
+		},
+		{
+			name:          "keeps associations in sync",
+			role:          podIdentityRole("", []string{"web"}, testAssociation("x-1", "prod", "apps", "web", testRoleARN)),
+			existing:      []iamv1beta1.PodIdentityAssociation{testAssociation("x-1", "prod", "apps", "web", testRoleARN)},
+			wantStatus:    []iamv1beta1.PodIdentityAssociation{testAssociation("x-1", "prod", "apps", "web", testRoleARN)},
+			wantRemaining: []string{"x-1"},
+		},
+		{
+			name:          "takes over an association of the role on ResourceInUse",
+			role:          podIdentityRole("", []string{"web"}),
+			existing:      []iamv1beta1.PodIdentityAssociation{testAssociation("x-1", "prod", "apps", "web", testRoleARN)},
+			wantStatus:    []iamv1beta1.PodIdentityAssociation{testAssociation("x-1", "prod", "apps", "web", testRoleARN)},
+			wantCreated:   1,
+			wantRemaining: []string{"x-1"},
+		},
+		{
+			name:          "refuses to take over an association of another role",
+			role:          podIdentityRole("", []string{"web"}),
+			existing:      []iamv1beta1.PodIdentityAssociation{testAssociation("x-1", "prod", "apps", "web", testOtherARN)},
+			wantErr:       true,
+			wantRemaining: []string{"x-1"},
+		},
+		{
+			name:          "updates associations of an old role ARN",
+			role:          podIdentityRole("", []string{"web"}, testAssociation("x-1", "prod", "apps", "web", testOldRoleARN)),
+			existing:      []iamv1beta1.PodIdentityAssociation{testAssociation("x-1", "prod", "apps", "web", testOldRoleARN)},
+			wantStatus:    []iamv1beta1.PodIdentityAssociation{testAssociation("x-1", "prod", "apps", "web", testRoleARN)},
+			wantRemaining: []string{"x-1"},
+		},
+		{
+			name:          "deletes associations of ServiceAccounts no longer listed",
+			role:          podIdentityRole("", []string{"web"}, testAssociation("x-1", "prod", "apps", "web", testRoleARN), testAssociation("x-2", "prod", "apps", "worker", testRoleARN)),
+			existing:      []iamv1beta1.PodIdentityAssociation{testAssociation("x-1", "prod", "apps", "web", testRoleARN), testAssociation("x-2", "prod", "apps", "worker", testRoleARN)},
+			wantStatus:    []iamv1beta1.PodIdentityAssociation{testAssociation("x-1", "prod", "apps", "web", testRoleARN)},
+			wantDeleted:   1,
+			wantRemaining: []string{"x-1"},
+		},
+		{
+			name:          "moves associations to a changed cluster",
+			role:          podIdentityRole("staging", []string{"web"}, testAssociation("x-1", "prod", "apps", "web", testRoleARN)),
+			existing:      []iamv1beta1.PodIdentityAssociation{testAssociation("x-1", "prod", "apps", "web", testRoleARN)},
+			wantStatus:    []iamv1beta1.PodIdentityAssociation{testAssociation("a-1", "staging", "apps", "web", testRoleARN)},
+			wantCreated:   1,
+			wantDeleted:   1,
+			wantRemaining: []string{"a-1"},
+		},
+		{
+			name:          "keeps created associations in the status, if a later create fails",
+			role:          podIdentityRole("", []string{"web", "worker"}),
+			failCreate:    []string{"apps/worker"},
+			wantErr:       true,
+			wantStatus:    []iamv1beta1.PodIdentityAssociation{testAssociation("a-1", "prod", "apps", "web", testRoleARN)},
+			wantCreated:   1,
+			wantRemaining: []string{"a-1"},
+		},
+		{
+			name:          "keeps associations in the status, which could not be deleted",
+			role:          podIdentityRole("", nil, testAssociation("x-1", "prod", "apps", "web", testRoleARN), testAssociation("x-2", "prod", "apps", "worker", testRoleARN)),
+			existing:      []iamv1beta1.PodIdentityAssociation{testAssociation("x-1", "prod", "apps", "web", testRoleARN), testAssociation("x-2", "prod", "apps", "worker", testRoleARN)},
+			failDelete:    []string{"x-2"},
+			wantErr:       true,
+			wantStatus:    []iamv1beta1.PodIdentityAssociation{testAssociation("x-2", "prod", "apps", "worker", testRoleARN)},
+			wantDeleted:   1,
+			wantRemaining: []string{"x-2"},
+		},
+		{
+			name:          "needs a cluster name",
+			role:          podIdentityRole("", []string{"web"}),
+			noClusterName: true,
+			wantErr:       true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := newFakeEKS(tt.existing...)
+			for _, sa := range tt.failCreate {
+				svc.failCreate[sa] = true
+			}
+			for _, id := range tt.failDelete {
+				svc.failDelete[id] = true
+			}
+
+			defaultCluster := "prod"
+			if tt.noClusterName {
+				defaultCluster = ""
+			}
+			created, deleted, err := syncPodIdentityAssociations(svc, tt.role, defaultCluster)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("syncPodIdentityAssociations() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(tt.role.Status.PodIdentityAssociations, tt.wantStatus) {
+				t.Errorf("status = %+v, want %+v", tt.role.Status.PodIdentityAssociations, tt.wantStatus)
+			}
+			if len(created) != tt.wantCreated {
+				t.Errorf("created %d associations, want %d", len(created), tt.wantCreated)
+			}
+			if len(deleted) != tt.wantDeleted {
+				t.Errorf("deleted %d associations, want %d", len(deleted), tt.wantDeleted)
+			}
+			if got := svc.ids(); !reflect.DeepEqual(got, tt.wantRemaining) {
+				t.Errorf("associations in EKS = %v, want %v", got, tt.wantRemaining)
+			}
+		})
+	}
+}
+
+func TestDeletePodIdentityAssociations(t *testing.T) {
+	role := podIdentityRole("", nil, testAssociation("x-1", "prod", "apps", "web", testRoleARN), testAssociation("x-2", "prod", "apps", "worker", testRoleARN))
+	svc := newFakeEKS(testAssociation("x-2", "prod", "apps", "worker", testRoleARN))
+	svc.failDelete["x-2"] = true
+
+	if err := deletePodIdentityAssociations(svc, role); err == nil {
+		t.Fatal("deletePodIdentityAssociations() succeeded, although a delete failed")
+	}
+	want := []iamv1beta1.PodIdentityAssociation{testAssociation("x-2", "prod", "apps", "worker", testRoleARN)}
+	if !reflect.DeepEqual(role.Status.PodIdentityAssociations, want) {
+		t.Errorf("status = %+v, want %+v", role.Status.PodIdentityAssociations, want)
+	}
+
+	delete(svc.failDelete, "x-2")
+	if err := deletePodIdentityAssociations(svc, role); err != nil {
+		t.Fatalf("deletePodIdentityAssociations() error = %v", err)
+	}
+	if len(role.Status.PodIdentityAssociations) != 0 || len(svc.associations) != 0 {
+		t.Errorf("associations left: status %+v, EKS %v", role.Status.PodIdentityAssociations, svc.ids())
+	}
+}
@@ -20,18 +20,19 @@ import (
 	"context"
 	"fmt"
 
-	"github.com/aws/aws-sdk-go/aws/awserr"
-	awsiam "github.com/aws/aws-sdk-go/service/iam"
-
+	awsarn "github.com/aws/aws-sdk-go/aws/arn"
 	"github.com/go-logr/logr"
-	"github.com/redradrat/cloud-objects/aws"
+	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
-
-	"github.com/redradrat/cloud-objects/aws/iam"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	iamv1beta1 "github.com/redradrat/aws-iam-operator/api/v1beta1"
+	"github.com/redradrat/aws-iam-operator/pkg/limits"
+	"github.com/redradrat/aws-iam-operator/pkg/templating"
 )
 
 // PolicyReconciler reconciles a Policy object
@@ -40,13 +41,28 @@ type PolicyReconciler struct {
 	Log            logr.Logger
 	Region         string
 	Scheme         *runtime.Scheme
+	Recorder       record.EventRecorder
 	ResourcePrefix string
+	// DryRun only plans the AWS operations for all Policies, instead of executing them
+	DryRun bool
+	// Adoption selects the namespaces, in which Policies may adopt existing IAM objects
+	Adoption AdoptionPolicy
+	// TemplateValues are the values of the template variables in policy statements
+	TemplateValues templating.Values
 }
 
 // +kubebuilder:rbac:groups=aws-iam.redradrat.xyz,resources=policies,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=aws-iam.redradrat.xyz,resources=policies/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=aws-iam.redradrat.xyz,resources=policies/finalizers,verbs=get;update
 
+// +kubebuilder:rbac:groups=aws-iam.redradrat.xyz,resources=roles;users;groups,verbs=get;list;watch
+// +kubebuilder:rbac:groups=aws-iam.redradrat.xyz,resources=referencegrants,verbs=get;list;watch
+// +kubebuilder:rbac:groups=aws-iam.redradrat.xyz,resources=iamconstraints;clusteriamconstraints,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=configmaps;secrets,verbs=get;list;watch
+
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+
 func (r *PolicyReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	log := r.Log.WithValues("policy", req.NamespacedName)
 
@@ -57,10 +73,66 @@ func (r *PolicyReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
 
-	// return if only status/metadata updated
-	if policy.Status.ObservedGeneration == policy.ObjectMeta.Generation && policy.Status.State == iamv1beta1.OkSyncState {
+	// read the raw document, or resolve the referenced ARNs and expand the template variables; a Policy being deleted
+	// doesn't need its document anymore
+	polDoc, resolver, err := policyDocument(ctx, r.Client, &policy, r.TemplateValues)
+	var referencesChanged bool
+	if policy.ObjectMeta.DeletionTimestamp.IsZero() {
+		// make sure we are allowed to reference all resources, before we use their ARNs
+		if len(resolver.refs) > 0 {
+			if err := authorizeReferences(ctx, r.Client, &policy, resolver.refs); err != nil {
+				return ctrl.Result{}, errWithStatus(ctx, &policy, err, r.Status(), r.Recorder)
+			}
+		}
+		referencesChanged = setReferencesResolved(&policy, len(resolver.refs) > 0, err)
+		if IsReferenceNotReady(err) {
+			// we're triggered again, once the referenced resource has its ARN
+			log.V(1).Info("waiting for referenced resource", "reason", err.Error())
+			if referencesChanged {
+				return ctrl.Result{}, r.Status().Update(ctx, &policy)
+			}
+			return ctrl.Result{}, nil
+		}
+		if err != nil {
+			return ctrl.Result{}, errWithStatus(ctx, &policy, err, r.Status(), r.Recorder)
+		}
+	}
+
+	// make sure the policy is valid and satisfies all IAMConstraints
+	var lintChanged, constraintsChanged, limitsChanged bool
+	if policy.ObjectMeta.DeletionTimestamp.IsZero() {
+		if lintChanged, err = checkLint(&policy, polDoc.PolicyDocument, false, r.Region, r.Recorder); err != nil {
+			return ctrl.Result{}, errWithStatus(ctx, &policy, err, r.Status(), r.Recorder)
+		}
+		if constraintsChanged, err = checkConstraints(ctx, r.Client, &policy, polDoc, false, r.Recorder); err != nil {
+			return ctrl.Result{}, errWithStatus(ctx, &policy, err, r.Status(), r.Recorder)
+		}
+		if limitsChanged, err = checkDocumentSize(&policy, polDoc, limits.ManagedPolicySizeLimit); err != nil {
+			return ctrl.Result{}, errWithStatus(ctx, &policy, err, r.Status(), r.Recorder)
+		}
+	}
+	conditionsChanged := lintChanged || constraintsChanged || limitsChanged || referencesChanged
+	dryRun := dryRunEnabled(r.DryRun, &policy)
+
+	// a paused Policy is left alone, we only keep reporting its status
+	paused, pausedChanged := checkPaused(&policy)
+	conditionsChanged = conditionsChanged || pausedChanged
+	if paused {
+		if conditionsChanged {
+			return ctrl.Result{}, r.Status().Update(ctx, &policy)
+		}
+		return ctrl.Result{}, nil
+	}
+
+	// return if only status/metadata updated, and the referenced ARNs and the read document are still the same
+	if policy.Status.ObservedGeneration == policy.ObjectMeta.Generation && upToDate(&policy, dryRun) &&
+		referencesUpToDate(&policy, resolver.resolved) && documentSourceUpToDate(&policy, polDoc) {
+		if conditionsChanged {
+			return ctrl.Result{}, r.Status().Update(ctx, &policy)
+		}
 		return ctrl.Result{}, nil
 	}
+	policy.Status.PlannedOperations = nil
 
 	// Get our actual IAM Service to communicate with AWS; we don't need to continue without it
 	iamsvc, err := IAMService(r.Region)
@@ -72,17 +144,13 @@ func (r *PolicyReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 	policiesFinalizer := "policy.aws-iam.redradrat.xyz"
 
 	// now let's instantiate our PolicyInstance
-	var ins *iam.PolicyInstance
-	policyName := r.ResourcePrefix + policy.PolicyName()
-	if policy.Status.ARN != "" {
-		parsedArn, err := aws.ARNify(policy.Status.ARN)
-		if err != nil {
-			return ctrl.Result{}, fmt.Errorf("ARN in Role status is not valid/parsable")
+	var parsedArn awsarn.ARN
+	if objectARN(&policy) != "" {
+		if parsedArn, err = parseObjectARN(&policy); err != nil {
+			return ctrl.Result{}, errWithStatus(ctx, &policy, err, r.Status(), r.Recorder)
 		}
-		ins = iam.NewExistingPolicyInstance(policyName, policy.Spec.Description, policy.Marshal(), parsedArn[len(parsedArn)-1])
-	} else {
-		ins = iam.NewPolicyInstance(policyName, policy.Spec.Description, policy.Marshal())
 	}
+	ins := newPolicyInstance(r.ResourcePrefix+policy.PolicyName(), policy.Spec.Description, polDoc, parsedArn)
 
 	cleanupFunc := policyCleanup(r, ctx, &policy)
 
@@ -95,7 +163,7 @@ func (r *PolicyReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 			policy.ObjectMeta.Finalizers = append(policy.ObjectMeta.Finalizers, policiesFinalizer)
 			if err := r.Update(context.Background(), &policy); err != nil {
 				log.Error(err, "unable to register finalizer for Policy")
-				return ctrl.Result{}, errWithStatus(ctx, &policy, err, r.Status())
+				return ctrl.Result{}, errWithStatus(ctx, &policy, err, r.Status(), r.Recorder)
 			}
 		}
 	} else {
@@ -103,12 +171,18 @@ func (r *PolicyReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 			// our finalizer is present, so lets handle any external dependency
 
 			// delete the actual AWS Object and pass the cleanup function
-			statusWriter, err := DeleteAWSObject(iamsvc, ins, cleanupFunc)
-			statusWriter(ctx, ins, &policy, r.Status(), log)
+			statusWriter, err := DeleteAWSObject(iamsvc, ins, r.Recorder, &policy, cleanupFunc, dryRun)
+			if updateErr := statusWriter(ctx, ins, &policy, r.Status()); updateErr != nil {
+				return ctrl.Result{}, updateErr
+			}
 			if err != nil {
 				// we had an error during AWS Object deletion... so we return here to retry
 				log.Error(err, "unable to delete Policy")
-				return ctrl.Result{}, err
+				return resultForAWSError(err)
+			}
+			if planned(&policy) {
+				// keep the finalizer, as the Policy still exists in AWS
+				return ctrl.Result{}, nil
 			}
 
 			// remove our finalizer from the list and update it.
@@ -125,32 +199,54 @@ func (r *PolicyReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 
 	// RECONCILE THE RESOURCE
 
-	// if there is already an ARN in our status, then we update the object
-	statusWriter, err := CreateAWSObject(iamsvc, ins, DoNothingPreFunc)
-	statusWriter(ctx, ins, &policy, r.Status(), log)
-	if err != nil {
-		// If already exists, we just update the status
-		if aerr, ok := err.(awserr.Error); ok {
-			if aerr.Code() == awsiam.ErrCodeEntityAlreadyExistsException {
-				// Update the actual AWS Object and pass the DoNothing function
-				statusWriter, err := UpdateAWSObject(iamsvc, ins, DoNothingPreFunc)
-				statusWriter(ctx, ins, &policy, r.Status(), log)
-				if err != nil {
-					// we had an error during AWS Object update... so we return here to retry
-					log.Error(err, "error while updating Policy during reconciliation")
-					return ctrl.Result{}, err
-				}
-			}
+	// adopt an existing Policy, if we're asked to
+	if adoptionARN(&policy) != "" {
+		statusWriter, err := AdoptAWSObject(iamsvc, ins, r.Recorder, &policy, r.Adoption, dryRun)
+		if updateErr := statusWriter(ctx, ins, &policy, r.Status()); updateErr != nil {
+			return ctrl.Result{}, updateErr
+		}
+		if err != nil {
+			log.Error(err, "error while adopting Policy during reconciliation")
+			return resultForAWSError(err)
+		}
+	} else if policy.Status.ARN != "" {
+		// if there is already an ARN in our status, then we update the object
+		// Update the actual AWS Object and pass the DoNothing function
+		statusWriter, err := UpdateAWSObject(iamsvc, ins, r.Recorder, &policy, DoNothingPreFunc, dryRun)
+		if updateErr := statusWriter(ctx, ins, &policy, r.Status()); updateErr != nil {
+			return ctrl.Result{}, updateErr
+		}
+		if err != nil {
+			// we had an error during AWS Object update... so we return here to retry
+			log.Error(err, "error while updating Policy during reconciliation")
+			return resultForAWSError(err)
+		}
+	} else {
+		statusWriter, err := CreateAWSObject(iamsvc, ins, r.Recorder, &policy, DoNothingPreFunc, dryRun)
+		if isAlreadyExistsError(err) {
+			statusWriter = ErrorStatusUpdater(alreadyExistsMessage(&policy, r.ResourcePrefix+policy.PolicyName()))
+		}
+		if updateErr := statusWriter(ctx, ins, &policy, r.Status()); updateErr != nil {
+			return ctrl.Result{}, updateErr
+		}
+		if err != nil {
+			log.Error(err, "error while creating Policy during reconciliation")
+			return resultForAWSError(err)
 		}
-		log.Error(err, "error while creating Policy during reconciliation")
-		return ctrl.Result{}, err
 	}
 
 	policy.Status.ObservedGeneration = policy.ObjectMeta.Generation
+	markReconcileRequestHandled(&policy)
+	markReferencesApplied(&policy, resolver.resolved)
+	policy.Status.ReadDocumentVersion = polDoc.SourceVersion
 	if err := r.Status().Update(ctx, &policy); err != nil {
 		return ctrl.Result{}, err
 	}
 
+	if dryRun {
+		log.Info("Planned Policy", "operations", policy.Status.PlannedOperations)
+		return ctrl.Result{}, nil
+	}
 	log.Info(fmt.Sprintf("Created Policy '%s'", policy.Status.ARN))
 
 	return ctrl.Result{}, nil
@@ -159,21 +255,68 @@ func (r *PolicyReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 func (r *PolicyReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&iamv1beta1.Policy{}).
+		Watches(&source.Kind{Type: &iamv1beta1.Role{}},
+			handler.EnqueueRequestsFromMapFunc(requestsForARNReference(r.Client, &iamv1beta1.PolicyList{}, "Role"))).
+		Watches(&source.Kind{Type: &iamv1beta1.User{}},
+			handler.EnqueueRequestsFromMapFunc(requestsForARNReference(r.Client, &iamv1beta1.PolicyList{}, "User"))).
+		Watches(&source.Kind{Type: &iamv1beta1.Group{}},
+			handler.EnqueueRequestsFromMapFunc(requestsForARNReference(r.Client, &iamv1beta1.PolicyList{}, "Group"))).
+		Watches(&source.Kind{Type: &iamv1beta1.Policy{}},
+			handler.EnqueueRequestsFromMapFunc(requestsForARNReference(r.Client, &iamv1beta1.PolicyList{}, "Policy"))).
+		Watches(&source.Kind{Type: &iamv1beta1.ReferenceGrant{}},
+			handler.EnqueueRequestsFromMapFunc(requestsForReferenceGrant(r.Client, &iamv1beta1.PolicyList{}, "Policy"))).
+		Watches(&source.Kind{Type: &v1.ConfigMap{}},
+			handler.EnqueueRequestsFromMapFunc(requestsForDocumentSource(r.Client, &iamv1beta1.PolicyList{}, "ConfigMap"))).
+		Watches(&source.Kind{Type: &v1.Secret{}},
+			handler.EnqueueRequestsFromMapFunc(requestsForDocumentSource(r.Client, &iamv1beta1.PolicyList{}, "Secret"))).
+		Watches(&source.Kind{Type: &iamv1beta1.IAMConstraint{}},
+			handler.EnqueueRequestsFromMapFunc(requestsForConstraint(r.Client, &iamv1beta1.PolicyList{}))).
+		Watches(&source.Kind{Type: &iamv1beta1.ClusterIAMConstraint{}},
+			handler.EnqueueRequestsFromMapFunc(requestsForConstraint(r.Client, &iamv1beta1.PolicyList{}))).
 		Complete(r)
 }
 
+// GetPolicyDocument returns the document of the policy: its raw document, or its statements with the ARNs of all
+// referenced resources resolved and the template variables expanded
+func GetPolicyDocument(policy *iamv1beta1.Policy, values templating.Values, c client.Client, ctx context.Context) (Document, error) {
+	doc, _, err := policyDocument(ctx, c, policy, values)
+	return doc, err
+}
+
+// policyDocument returns the document of the policy like GetPolicyDocument, and the resolver, which knows the
+// referenced resources and their ARNs
+func policyDocument(ctx context.Context, c client.Reader, policy *iamv1beta1.Policy, values templating.Values) (Document, *ARNResolver, error) {
+	resolver := NewARNResolver(ctx, c)
+	raw, err := policy.UsesRawDocument()
+	if err != nil {
+		return Document{}, resolver, err
+	}
+	if raw {
+		doc, err := readRawDocument(ctx, c, policy.Namespace, policy.Spec.Document, policy.Spec.DocumentFrom, false)
+		return doc, resolver, err
+	}
+
+	statement, err := policy.Spec.Statement.ResolveReferences(policy.Namespace, resolver.Resolve)
+	if err != nil {
+		return Document{}, resolver, err
+	}
+	resolved := policy.DeepCopy()
+	resolved.Spec.Statement = statement
+	doc, err := values.PolicyDocument(resolved)
+	return Document{PolicyDocument: doc}, resolver, err
+}
+
 // Returns a function, that does everything necessary before we can delete our actual Policy (cleanup)
 func policyCleanup(r *PolicyReconciler, ctx context.Context, policy *iamv1beta1.Policy) func() error {
 	return func() error {
-		attachments := iamv1beta1.PolicyAttachmentList{}
-		if err := r.List(ctx, &attachments); err != nil {
+		attachments, err := listPolicyAttachments(ctx, r, policyAttachmentPolicyIndex, namespacedKeyOf(policy))
+		if err != nil {
 			return err
 		}
-		for _, att := range attachments.Items {
-			if att.Spec.PolicyReference.Name == policy.Name && att.Spec.PolicyReference.Namespace == policy.Namespace {
-				err := fmt.Errorf("cannot delete policy due to existing PolicyAttachment '%s/%s'", att.Name, att.Namespace)
-				return err
-			}
+		if len(attachments) > 0 {
+			att := attachments[0]
+			err := fmt.Errorf("cannot delete policy due to existing PolicyAttachment '%s/%s'", att.Name, att.Namespace)
+			return err
 		}
 		return nil
 	}
@@ -19,11 +19,16 @@ package controllers
 import (
 	"context"
 	"fmt"
+	"strings"
 
 	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	awsarn "github.com/aws/aws-sdk-go/aws/arn"
 
@@ -38,9 +43,15 @@ const policyAttachmentFinalizer = "policyattachment.aws-iam.redradrat.xyz"
 // PolicyAttachmentReconciler reconciles a PolicyAssignment object
 type PolicyAttachmentReconciler struct {
 	client.Client
-	Region string
-	Log    logr.Logger
-	Scheme *runtime.Scheme
+	Region   string
+	Log      logr.Logger
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+	// MaxAttachedPolicies is the maximum number of policies attached to a single principal, as configured in the IAM
+	// quotas
+	MaxAttachedPolicies int
+	// DryRun only plans the AWS operations for all PolicyAttachments, instead of executing them
+	DryRun bool
 }
 
 // Reconcile PolicyAttachment
@@ -48,6 +59,11 @@ type PolicyAttachmentReconciler struct {
 // +kubebuilder:rbac:groups=aws-iam.redradrat.xyz,resources=policyattachments/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=aws-iam.redradrat.xyz,resources=policyattachments/finalizers,verbs=get;update
 
+// +kubebuilder:rbac:groups=aws-iam.redradrat.xyz,resources=referencegrants,verbs=get;list;watch
+// +kubebuilder:rbac:groups=aws-iam.redradrat.xyz,resources=iamconstraints;clusteriamconstraints,verbs=get;list;watch
+
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+
 func (r *PolicyAttachmentReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	log := r.Log.WithValues("policyattachment", req.NamespacedName)
 
@@ -58,32 +74,84 @@ func (r *PolicyAttachmentReconciler) Reconcile(ctx context.Context, req ctrl.Req
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
 
-	// return if only status/metadata updated
-	if policyattachment.Status.ObservedGeneration == policyattachment.ObjectMeta.Generation && policyattachment.Status.State == iamv1beta1.OkSyncState {
-		return ctrl.Result{}, nil
+	// make sure we are allowed to reference the resources in the spec
+	if policyattachment.ObjectMeta.DeletionTimestamp.IsZero() {
+		if err := authorizeReferences(ctx, r.Client, &policyattachment, policyAttachmentReferences(&policyattachment)); err != nil {
+			// the reference might have been granted, when we attached the policy; without the grant it has to go
+			if IsReferenceNotGranted(err) {
+				if detachErr := r.detachUnauthorized(ctx, &policyattachment); detachErr != nil {
+					log.Error(detachErr, "unable to detach unauthorized PolicyAttachment")
+					return resultForAWSError(detachErr)
+				}
+			}
+			return ctrl.Result{}, errWithStatus(ctx, &policyattachment, err, r.Status(), r.Recorder)
+		}
 	}
 
-	// first let's get the ARNs from the referenced resources in the spec
+	// first let's get the ARNs from the referenced resources in the spec. If we are being deleted, the references might
+	// already be gone, so we rely on what we recorded in our status.
 	policyArn, targetArn, err := getPolicyAttachmentARNs(ctx, &policyattachment, r.Client)
-	if err != nil {
-		return ctrl.Result{}, errWithStatus(ctx, &policyattachment, err, r.Status())
+	if err != nil && policyattachment.ObjectMeta.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, errWithStatus(ctx, &policyattachment, err, r.Status(), r.Recorder)
+	}
+
+	// make sure an attached managed policy satisfies all IAMConstraints
+	var constraintsChanged bool
+	if policyattachment.ObjectMeta.DeletionTimestamp.IsZero() {
+		if constraintsChanged, err = checkManagedPolicyConstraints(ctx, r.Client, &policyattachment, r.Recorder); err != nil {
+			return ctrl.Result{}, errWithStatus(ctx, &policyattachment, err, r.Status(), r.Recorder)
+		}
+	}
+
+	dryRun := dryRunEnabled(r.DryRun, &policyattachment)
+
+	// a paused PolicyAttachment is left alone, we only keep reporting its status
+	paused, pausedChanged := checkPaused(&policyattachment)
+	conditionsChanged := constraintsChanged || pausedChanged
+	if paused {
+		if conditionsChanged {
+			return ctrl.Result{}, r.Status().Update(ctx, &policyattachment)
+		}
+		return ctrl.Result{}, nil
+	}
+
+	// return if only status/metadata updated, and the referenced resources still have the ARNs we attached. In dry-run
+	// mode nothing has been attached, so we only plan once per generation.
+	attachedARNsMatch := policyattachment.Status.ARN == targetArn.String() && policyattachment.Status.PolicyARN == policyArn.String()
+	reconcileUnneccessary :=
+		policyattachment.Status.ObservedGeneration == policyattachment.ObjectMeta.Generation &&
+			!reconcileRequested(&policyattachment) &&
+			(policyattachment.Status.State == iamv1beta1.OkSyncState && attachedARNsMatch ||
+				dryRun && policyattachment.Status.State == iamv1beta1.PlannedSyncState)
+	if reconcileUnneccessary {
+		if conditionsChanged {
+			return ctrl.Result{}, r.Status().Update(ctx, &policyattachment)
+		}
+		return ctrl.Result{}, nil
 	}
+	policyattachment.Status.PlannedOperations = nil
 
 	// now we need to translate the specified target resource in the CR to an IAM AttachmentType
 	attachType, err := policyattachment.GetAttachmentType()
 	if err != nil {
-		return ctrl.Result{}, errWithStatus(ctx, &policyattachment, err, r.Status())
+		return ctrl.Result{}, errWithStatus(ctx, &policyattachment, err, r.Status(), r.Recorder)
 	}
 
 	// Get our actual IAM Service to communicate with AWS; we don't need to continue without it
 	iamsvc, err := IAMService(r.Region)
 	if err != nil {
-		return ctrl.Result{}, errWithStatus(ctx, &policyattachment, err, r.Status())
+		return ctrl.Result{}, errWithStatus(ctx, &policyattachment, err, r.Status(), r.Recorder)
 	}
 
 	// now let's instantiate our PolicyAttachmentInstance
 	ins := iam.NewPolicyAttachmentInstance(policyArn, attachType, targetArn)
 
+	// and the instance of the attachment we made previously; policy or target might have changed since
+	attached := attachedPolicyAttachmentInstance(&policyattachment)
+	if attached == nil {
+		attached = ins
+	}
+
 	// Check Deletion and finalizer
 	if policyattachment.ObjectMeta.DeletionTimestamp.IsZero() {
 		// The object is not being deleted, so if it does not have our finalizer,
@@ -100,14 +168,23 @@ func (r *PolicyAttachmentReconciler) Reconcile(ctx context.Context, req ctrl.Req
 		if containsString(policyattachment.ObjectMeta.Finalizers, policyAttachmentFinalizer) {
 			// our finalizer is present, so lets handle any external dependency
 
-			// delete the actual AWS Object and pass the cleanup function
-			statusUpdater, err := DeleteAWSObject(iamsvc, ins, DoNothingPreFunc)
-			// we got a StatusUpdater function returned... let's execute it
-			statusUpdater(ctx, ins, &policyattachment, r.Status(), log)
-			if err != nil {
-				// we had an error during AWS Object deletion... so we return here to retry
-				log.Error(err, "unable to delete PolicyAttachment")
-				return ctrl.Result{}, err
+			// if we never attached anything, there is nothing to detach
+			if policyattachment.Status.ARN != "" {
+				// delete the actual AWS Object and pass the cleanup function
+				statusUpdater, err := DeleteAWSObject(iamsvc, attached, r.Recorder, &policyattachment, DoNothingPreFunc, dryRun)
+				// we got a StatusUpdater function returned... let's execute it
+				if updateErr := statusUpdater(ctx, attached, &policyattachment, r.Status()); updateErr != nil {
+					return ctrl.Result{}, updateErr
+				}
+				if err != nil {
+					// we had an error during AWS Object deletion... so we return here to retry
+					log.Error(err, "unable to delete PolicyAttachment")
+					return resultForAWSError(err)
+				}
+				if planned(&policyattachment) {
+					// keep the finalizer, as the policy is still attached in AWS
+					return ctrl.Result{}, nil
+				}
 			}
 
 			// remove our finalizer from the list and update it.
@@ -124,6 +201,11 @@ func (r *PolicyAttachmentReconciler) Reconcile(ctx context.Context, req ctrl.Req
 
 	// RECONCILE THE RESOURCE
 
+	// make sure the target can take another policy, before we touch anything
+	if err := checkAttachedPolicies(ctx, r.Client, &policyattachment, r.MaxAttachedPolicies); err != nil {
+		return ctrl.Result{}, errWithStatus(ctx, &policyattachment, err, r.Status(), r.Recorder)
+	}
+
 	// if there is already an ARN in our status, then we remove the PolicyAttachment from that ARN:
 	// 	1) 	A user could have changed the TargetReference,
 	//		so we need to remove it from the old status ARN
@@ -132,92 +214,129 @@ func (r *PolicyAttachmentReconciler) Reconcile(ctx context.Context, req ctrl.Req
 	//		so even if the target is the same as the ARN, we need to recreate
 	if policyattachment.Status.ARN != "" {
 		// delete the actual AWS Object and pass the cleanup function
-		statusUpdater, err := DeleteAWSObject(iamsvc, ins, DoNothingPreFunc)
+		statusUpdater, err := DeleteAWSObject(iamsvc, attached, r.Recorder, &policyattachment, DoNothingPreFunc, dryRun)
 		// we got a StatusUpdater function returned... let's execute it
-		statusUpdater(ctx, ins, &policyattachment, r.Status(), log)
+		if updateErr := statusUpdater(ctx, attached, &policyattachment, r.Status()); updateErr != nil {
+			return ctrl.Result{}, updateErr
+		}
 		if err != nil {
 			// we had an error during AWS Object deletion... so we return here to retry
 			log.Error(err, "error while deleting PolicyAttachment during reconciliation")
-			return ctrl.Result{}, err
+			return resultForAWSError(err)
 		}
 	}
-	statusUpdater, err := CreateAWSObject(iamsvc, ins, DoNothingPreFunc)
-	statusUpdater(ctx, ins, &policyattachment, r.Status(), log)
+	statusUpdater, err := CreateAWSObject(iamsvc, ins, r.Recorder, &policyattachment, DoNothingPreFunc, dryRun)
+	if updateErr := statusUpdater(ctx, ins, &policyattachment, r.Status()); updateErr != nil {
+		return ctrl.Result{}, updateErr
+	}
 	if err != nil {
 		log.Error(err, "error while creating PolicyAttachment during reconciliation")
-		return ctrl.Result{}, errWithStatus(ctx, &policyattachment, err, r.Status())
+		return resultForAWSError(err)
 	}
 
+	if !dryRun {
+		policyattachment.Status.PolicyARN = policyArn.String()
+	}
 	policyattachment.Status.ObservedGeneration = policyattachment.ObjectMeta.Generation
+	markReconcileRequestHandled(&policyattachment)
 	if err := r.Status().Update(ctx, &policyattachment); err != nil {
 		return ctrl.Result{}, err
 	}
 
+	if dryRun {
+		log.Info("Planned PolicyAttachment", "operations", policyattachment.Status.PlannedOperations)
+		return ctrl.Result{}, nil
+	}
+
 	log.Info(fmt.Sprintf("Created PolicyAttachment on target '%s'", policyattachment.Status.ARN))
 
 	return ctrl.Result{}, nil
 }
 
-func checkPolicyAttachmentRefs(ctx context.Context, policyAttachment *iamv1beta1.PolicyAttachment, c client.Client) error {
-	policies := iamv1beta1.PolicyList{}
-	if err := c.List(ctx, &policies); err != nil {
-		return err
+// detachUnauthorized detaches the policy of a PolicyAttachment, whose references are no longer authorized e.g. because
+// the ReferenceGrant has been revoked. Paused PolicyAttachments are left alone.
+func (r *PolicyAttachmentReconciler) detachUnauthorized(ctx context.Context, policyAttachment *iamv1beta1.PolicyAttachment) error {
+	attached := attachedPolicyAttachmentInstance(policyAttachment)
+	if attached == nil {
+		return nil
+	}
+	if paused, _ := checkPaused(policyAttachment); paused {
+		return nil
 	}
 
-	foundtarget := false
-	foundpolicy := false
-	targetReferenceType := policyAttachment.Spec.TargetReference.Type
-	switch targetReferenceType {
-	case iamv1beta1.RoleTargetType:
-		roles := iamv1beta1.RoleList{}
-		if err := c.List(ctx, &roles); err != nil {
-			return err
-		}
-		for _, role := range roles.Items {
-			tarref := policyAttachment.Spec.TargetReference
-			if tarref.Name == role.Name && tarref.Namespace == role.Namespace {
-				foundtarget = true
-			}
-		}
-	case iamv1beta1.UserTargetType:
-		users := iamv1beta1.UserList{}
-		if err := c.List(ctx, &users); err != nil {
-			return err
-		}
-		for _, user := range users.Items {
-			tarref := policyAttachment.Spec.TargetReference
-			if tarref.Name == user.Name && tarref.Namespace == user.Namespace {
-				foundtarget = true
-			}
-		}
-	case iamv1beta1.GroupTargetType:
-		groups := iamv1beta1.GroupList{}
-		if err := c.List(ctx, &groups); err != nil {
-			return err
-		}
-		for _, group := range groups.Items {
-			tarref := policyAttachment.Spec.TargetReference
-			if tarref.Name == group.Name && tarref.Namespace == group.Namespace {
-				foundtarget = true
-			}
-		}
-	default:
-		return fmt.Errorf("defined target reference type '%s' is unknown", targetReferenceType)
+	iamsvc, err := IAMService(r.Region)
+	if err != nil {
+		return err
 	}
-	for _, policy := range policies.Items {
-		polref := policyAttachment.Spec.PolicyReference
-		if polref.Name == policy.Name && polref.Namespace == policy.Namespace {
-			foundpolicy = true
-		}
+
+	policyAttachment.Status.PlannedOperations = nil
+	statusUpdater, err := DeleteAWSObject(iamsvc, attached, r.Recorder, policyAttachment, DoNothingPreFunc, dryRunEnabled(r.DryRun, policyAttachment))
+	if updateErr := statusUpdater(ctx, attached, policyAttachment, r.Status()); updateErr != nil {
+		return updateErr
 	}
-	if !(foundtarget == true && foundpolicy == true) {
-		err := fmt.Errorf("defined references do not exist for PolicyAttachment '%s/%s", policyAttachment.Name, policyAttachment.Namespace)
+	if err != nil {
 		return err
 	}
 
+	// nothing is attached anymore, so the policy is attached again, once the reference is granted
+	if !planned(policyAttachment) {
+		policyAttachment.Status.ARN = ""
+		policyAttachment.Status.PolicyARN = ""
+	}
 	return nil
 }
 
+// attachedPolicyAttachmentInstance returns the instance of the attachment, which has been made according to the status.
+// Returns nil, if the status doesn't tell.
+func attachedPolicyAttachmentInstance(policyAttachment *iamv1beta1.PolicyAttachment) *iam.PolicyAttachmentInstance {
+	if policyAttachment.Status.ARN == "" || policyAttachment.Status.PolicyARN == "" {
+		return nil
+	}
+
+	policyArn, err := awsarn.Parse(policyAttachment.Status.PolicyARN)
+	if err != nil {
+		return nil
+	}
+	targetArn, err := awsarn.Parse(policyAttachment.Status.ARN)
+	if err != nil {
+		return nil
+	}
+
+	// the resource of an IAM ARN is prefixed with its type e.g. "role/some-role"
+	var attachType iam.AttachmentType
+	switch strings.SplitN(targetArn.Resource, "/", 2)[0] {
+	case "role":
+		attachType = iam.RoleAttachmentType
+	case "user":
+		attachType = iam.UserAttachmentType
+	case "group":
+		attachType = iam.GroupAttachmentType
+	default:
+		return nil
+	}
+
+	return iam.NewPolicyAttachmentInstance(policyArn, attachType, targetArn)
+}
+
+// policyAttachmentReferences returns all resources referenced by the PolicyAttachment
+func policyAttachmentReferences(policyAttachment *iamv1beta1.PolicyAttachment) []objectReference {
+	var refs []objectReference
+	if polRef := policyAttachment.Spec.PolicyReference; polRef.Name != "" {
+		refs = append(refs, objectReference{Kind: "Policy", Namespace: polRef.Namespace, Name: polRef.Name})
+	}
+	tarRef := policyAttachment.Spec.TargetReference
+	refs = append(refs, objectReference{Kind: string(tarRef.Type), Namespace: tarRef.Namespace, Name: tarRef.Name})
+	return refs
+}
+
+// referenceError turns a NotFound error for a referenced resource into a meaningful error
+func referenceError(policyAttachment *iamv1beta1.PolicyAttachment, err error) error {
+	if errors.IsNotFound(err) {
+		return fmt.Errorf("defined references do not exist for PolicyAttachment '%s/%s'", policyAttachment.Name, policyAttachment.Namespace)
+	}
+	return err
+}
+
 func getPolicyAttachmentARNs(ctx context.Context, policyAttachment *iamv1beta1.PolicyAttachment, c client.Client) (targetArn, policyArn awsarn.ARN, err error) {
 
 	if policyAttachment.Spec.ExternalPolicy.ARN == "" && policyAttachment.Spec.PolicyReference.Name == "" {
@@ -241,13 +360,9 @@ func getPolicyAttachmentARNs(ctx context.Context, policyAttachment *iamv1beta1.P
 		}
 	} else {
 		polRef := policyAttachment.Spec.PolicyReference
-		if err := checkPolicyAttachmentRefs(ctx, policyAttachment, c); err != nil {
-			return policyArn, targetArn, err
-		}
-
 		policy := iamv1beta1.Policy{}
 		if err := c.Get(ctx, client.ObjectKey{Name: polRef.Name, Namespace: polRef.Namespace}, &policy); err != nil {
-			return policyArn, targetArn, err
+			return policyArn, targetArn, referenceError(policyAttachment, err)
 		}
 
 		if policy.Status.ARN == "" {
@@ -269,7 +384,7 @@ func getPolicyAttachmentARNs(ctx context.Context, policyAttachment *iamv1beta1.P
 	case iamv1beta1.RoleTargetType:
 		target := iamv1beta1.Role{}
 		if err := c.Get(ctx, *targetObj, &target); err != nil {
-			return policyArn, targetArn, err
+			return policyArn, targetArn, referenceError(policyAttachment, err)
 		}
 		if target.Status.ARN == "" {
 			return policyArn, targetArn, fmt.Errorf("ARN is empty in status for target reference")
@@ -281,7 +396,7 @@ func getPolicyAttachmentARNs(ctx context.Context, policyAttachment *iamv1beta1.P
 	case iamv1beta1.UserTargetType:
 		target := iamv1beta1.User{}
 		if err := c.Get(ctx, *targetObj, &target); err != nil {
-			return policyArn, targetArn, err
+			return policyArn, targetArn, referenceError(policyAttachment, err)
 		}
 		if target.Status.ARN == "" {
 			return policyArn, targetArn, fmt.Errorf("ARN is empty in status for target reference")
@@ -293,7 +408,7 @@ func getPolicyAttachmentARNs(ctx context.Context, policyAttachment *iamv1beta1.P
 	case iamv1beta1.GroupTargetType:
 		target := iamv1beta1.Group{}
 		if err := c.Get(ctx, *targetObj, &target); err != nil {
-			return policyArn, targetArn, err
+			return policyArn, targetArn, referenceError(policyAttachment, err)
 		}
 		if target.Status.ARN == "" {
 			return policyArn, targetArn, fmt.Errorf("ARN is empty in status for target reference")
@@ -310,7 +425,22 @@ func getPolicyAttachmentARNs(ctx context.Context, policyAttachment *iamv1beta1.P
 }
 
 func (r *PolicyAttachmentReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	list := &iamv1beta1.PolicyAttachmentList{}
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&iamv1beta1.PolicyAttachment{}).
+		Watches(&source.Kind{Type: &iamv1beta1.Policy{}},
+			handler.EnqueueRequestsFromMapFunc(requestsForIndex(r.Client, list, policyAttachmentPolicyIndex, namespacedKeyOf))).
+		Watches(&source.Kind{Type: &iamv1beta1.Role{}},
+			handler.EnqueueRequestsFromMapFunc(requestsForIndex(r.Client, list, policyAttachmentTargetIndex, targetKeyOf(iamv1beta1.RoleTargetType)))).
+		Watches(&source.Kind{Type: &iamv1beta1.User{}},
+			handler.EnqueueRequestsFromMapFunc(requestsForIndex(r.Client, list, policyAttachmentTargetIndex, targetKeyOf(iamv1beta1.UserTargetType)))).
+		Watches(&source.Kind{Type: &iamv1beta1.Group{}},
+			handler.EnqueueRequestsFromMapFunc(requestsForIndex(r.Client, list, policyAttachmentTargetIndex, targetKeyOf(iamv1beta1.GroupTargetType)))).
+		Watches(&source.Kind{Type: &iamv1beta1.IAMConstraint{}},
+			handler.EnqueueRequestsFromMapFunc(requestsForConstraint(r.Client, &iamv1beta1.PolicyAttachmentList{}))).
+		Watches(&source.Kind{Type: &iamv1beta1.ClusterIAMConstraint{}},
+			handler.EnqueueRequestsFromMapFunc(requestsForConstraint(r.Client, &iamv1beta1.PolicyAttachmentList{}))).
+		Watches(&source.Kind{Type: &iamv1beta1.ReferenceGrant{}},
+			handler.EnqueueRequestsFromMapFunc(requestsForReferenceGrant(r.Client, list, "PolicyAttachment"))).
 		Complete(r)
 }
@@ -0,0 +1,130 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	iamv1beta1 "github.com/redradrat/aws-iam-operator/api/v1beta1"
+)
+
+// Reasons for the ReferencesAuthorized condition
+const (
+	ReferencesGrantedReason    = "ReferencesGranted"
+	ReferenceNotGrantedReason  = "ReferenceNotGranted"
+	ReferenceNotGrantedMessage = "reference from %s '%s/%s' to %s '%s/%s' is not allowed by any ReferenceGrant in namespace '%s'"
+)
+
+// objectReference points to a resource, which is referenced by another resource
+type objectReference struct {
+	Kind      string
+	Namespace string
+	Name      string
+}
+
+// referenceNotGrantedError is returned, if a resource references a resource in another namespace, without a
+// ReferenceGrant allowing it
+type referenceNotGrantedError struct {
+	message string
+}
+
+func (e *referenceNotGrantedError) Error() string {
+	return e.message
+}
+
+// IsReferenceNotGranted returns true, if err tells that a reference into another namespace is not allowed
+func IsReferenceNotGranted(err error) bool {
+	var notGranted *referenceNotGrantedError
+	return errors.As(err, &notGranted)
+}
+
+// authorizeReferences checks whether obj is allowed to reference all given resources, and records the result in the
+// ReferencesAuthorized condition of obj. References within the same namespace are always allowed, references into other
+// namespaces need a ReferenceGrant in the referenced namespace.
+func authorizeReferences(ctx context.Context, c client.Reader, obj AWSObjectStatusResource, refs []objectReference) error {
+	from := obj.RuntimeObject()
+	fromKind := kindOf(obj)
+
+	for _, ref := range refs {
+		granted, err := referenceGranted(ctx, c, fromKind, from.GetNamespace(), ref)
+		if err != nil {
+			return err
+		}
+		if !granted {
+			err := &referenceNotGrantedError{message: fmt.Sprintf(ReferenceNotGrantedMessage, fromKind, from.GetNamespace(), from.GetName(), ref.Kind, ref.Namespace, ref.Name, ref.Namespace)}
+			meta.SetStatusCondition(&obj.GetStatus().Conditions, metav1.Condition{
+				Type:               iamv1beta1.ReferencesAuthorizedCondition,
+				Status:             metav1.ConditionFalse,
+				ObservedGeneration: from.GetGeneration(),
+				Reason:             ReferenceNotGrantedReason,
+				Message:            err.Error(),
+			})
+			return err
+		}
+	}
+
+	meta.SetStatusCondition(&obj.GetStatus().Conditions, metav1.Condition{
+		Type:               iamv1beta1.ReferencesAuthorizedCondition,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: from.GetGeneration(),
+		Reason:             ReferencesGrantedReason,
+		Message:            "all references are authorized",
+	})
+	return nil
+}
+
+// referenceGranted returns true, if a resource of fromKind in fromNamespace may reference the given resource
+func referenceGranted(ctx context.Context, c client.Reader, fromKind, fromNamespace string, ref objectReference) (bool, error) {
+	if ref.Namespace == fromNamespace {
+		return true, nil
+	}
+
+	grants := iamv1beta1.ReferenceGrantList{}
+	if err := c.List(ctx, &grants, client.InNamespace(ref.Namespace)); err != nil {
+		return false, err
+	}
+	for _, grant := range grants.Items {
+		if grant.Permits(fromKind, fromNamespace, ref.Kind, ref.Name) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// requestsForReferenceGrant returns a function mapping a ReferenceGrant to reconcile requests for all objects of the
+// given list type, which live in one of the namespaces the grant is given to.
+func requestsForReferenceGrant(c client.Reader, list client.ObjectList, kind string) func(client.Object) []reconcile.Request {
+	return func(obj client.Object) []reconcile.Request {
+		grant, ok := obj.(*iamv1beta1.ReferenceGrant)
+		if !ok {
+			return nil
+		}
+
+		var requests []reconcile.Request
+		for _, from := range grant.Spec.From {
+			if from.Kind != kind {
+				continue
+			}
+
+			l := list.DeepCopyObject().(client.ObjectList)
+			if err := c.List(context.Background(), l, client.InNamespace(from.Namespace)); err != nil {
+				continue
+			}
+			items, err := meta.ExtractList(l)
+			if err != nil {
+				continue
+			}
+			for _, item := range items {
+				if o, ok := item.(client.Object); ok {
+					requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(o)})
+				}
+			}
+		}
+		return requests
+	}
+}
@@ -0,0 +1,281 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	iamv1beta1 "github.com/redradrat/aws-iam-operator/api/v1beta1"
+)
+
+// ReplicatedFromAnnotation marks the copies of credential Secrets with the User, they have been replicated from
+const ReplicatedFromAnnotation = "aws-iam.redradrat.xyz/replicated-from"
+
+// replicaNamespaces returns the namespaces, the credential Secrets of the user are copied to, in a stable order
+func replicaNamespaces(ctx context.Context, c client.Reader, user *iamv1beta1.User) ([]string, error) {
+	cs := user.Spec.CredentialSecret
+	if cs == nil || cs.ReplicateTo == nil {
+		return nil, nil
+	}
+
+	selected := map[string]bool{}
+	for _, ns := range cs.ReplicateTo.Namespaces {
+		selected[ns] = true
+	}
+	if cs.ReplicateTo.NamespaceSelector != nil {
+		selector, err := metav1.LabelSelectorAsSelector(cs.ReplicateTo.NamespaceSelector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid credentialSecret.replicateTo.namespaceSelector: %w", err)
+		}
+		namespaces := v1.NamespaceList{}
+		if err := c.List(ctx, &namespaces, client.MatchingLabelsSelector{Selector: selector}); err != nil {
+			return nil, err
+		}
+		for _, ns := range namespaces.Items {
+			if ns.DeletionTimestamp.IsZero() {
+				selected[ns.Name] = true
+			}
+		}
+	}
+	delete(selected, user.Namespace)
+
+	var names []string
+	for ns := range selected {
+		names = append(names, ns)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// replicatedFrom returns the value of the ReplicatedFromAnnotation for copies of the Secrets of the user
+func replicatedFrom(user *iamv1beta1.User) string {
+	return user.Namespace + "/" + user.Name
+}
+
+// syncCredentialSecretReplicas copies the credential Secrets of the user into the namespaces of its replicateTo, and
+// deletes the copies, which are no longer wanted. Copying into a namespace needs a ReferenceGrant there. The copies are
+// recorded in the status of the user.
+func (r *UserReconciler) syncCredentialSecretReplicas(ctx context.Context, user *iamv1beta1.User) error {
+	var sources []v1.Secret
+	if externalCredentialSink(user.Status.CredentialSink) == nil {
+		for _, ref := range []v1.SecretReference{user.Status.LoginProfileSecret, user.Status.ProgrammaticAccessSecret} {
+			if ref.Name == "" {
+				continue
+			}
+			sec := v1.Secret{}
+			err := r.Get(ctx, client.ObjectKey{Namespace: user.Namespace, Name: ref.Name}, &sec)
+			if errors.IsNotFound(err) {
+				// the credentials are issued again, and replicated afterwards
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			sources = append(sources, sec)
+		}
+	}
+	namespaces, err := replicaNamespaces(ctx, r.Client, user)
+	if err != nil {
+		return err
+	}
+
+	if cs := user.Spec.CredentialSecret; cs != nil && cs.ReplicateTo != nil {
+		var refs []objectReference
+		for _, ns := range namespaces {
+			for _, sec := range sources {
+				refs = append(refs, objectReference{Kind: "Secret", Namespace: ns, Name: sec.Name})
+			}
+		}
+		if err := authorizeReferences(ctx, r.Client, user, refs); err != nil {
+			// the copies might have been granted, when we made them; without the grant they have to go
+			if IsReferenceNotGranted(err) {
+				if deleteErr := r.deleteUnauthorizedReplicas(ctx, user); deleteErr != nil {
+					return deleteErr
+				}
+			}
+			return err
+		}
+	} else {
+		meta.RemoveStatusCondition(&user.Status.Conditions, iamv1beta1.ReferencesAuthorizedCondition)
+	}
+
+	var replicas []v1.SecretReference
+	defer func() { user.Status.ReplicatedSecrets = replicas }()
+	wanted := map[v1.SecretReference]bool{}
+	for _, ns := range namespaces {
+		for i := range sources {
+			created, err := r.writeCredentialSecretReplica(ctx, user, &sources[i], ns)
+			if err != nil {
+				replicas = mergeSecretReferences(replicas, user.Status.ReplicatedSecrets)
+				return err
+			}
+			if created {
+				r.Recorder.Eventf(user, v1.EventTypeNormal, SecretCreatedEventReason, "replicated Secret '%s/%s' to namespace '%s'", user.Namespace, sources[i].Name, ns)
+			}
+			replica := v1.SecretReference{Namespace: ns, Name: sources[i].Name}
+			wanted[replica] = true
+			replicas = append(replicas, replica)
+		}
+	}
+
+	for i, replica := range user.Status.ReplicatedSecrets {
+		if wanted[replica] {
+			continue
+		}
+		if err := r.deleteCredentialSecretReplica(ctx, user, replica); err != nil {
+			replicas = mergeSecretReferences(replicas, user.Status.ReplicatedSecrets[i:])
+			return err
+		}
+	}
+	return nil
+}
+
+// writeCredentialSecretReplica creates or updates the copy of the Secret in the namespace, and returns true, if it has
+// been created. Secrets, which are not a copy of a Secret of the user, are never overwritten.
+func (r *UserReconciler) writeCredentialSecretReplica(ctx context.Context, user *iamv1beta1.User, sec *v1.Secret, namespace string) (bool, error) {
+	replica := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        sec.Name,
+			Namespace:   namespace,
+			Labels:      sec.Labels,
+			Annotations: map[string]string{},
+		},
+		Data: sec.Data,
+		Type: sec.Type,
+	}
+	for key, value := range sec.Annotations {
+		replica.Annotations[key] = value
+	}
+	replica.Annotations[ReplicatedFromAnnotation] = replicatedFrom(user)
+
+	existing := v1.Secret{}
+	err := r.Get(ctx, client.ObjectKeyFromObject(replica), &existing)
+	if errors.IsNotFound(err) {
+		return true, r.Create(ctx, replica)
+	}
+	if err != nil {
+		return false, err
+	}
+	if existing.Annotations[ReplicatedFromAnnotation] != replicatedFrom(user) {
+		return false, fmt.Errorf("Secret '%s/%s' already exists and is not replicated from User '%s'", namespace, sec.Name, replicatedFrom(user))
+	}
+	if equality.Semantic.DeepEqual(existing.Data, replica.Data) && equality.Semantic.DeepEqual(existing.Labels, replica.Labels) &&
+		equality.Semantic.DeepEqual(existing.Annotations, replica.Annotations) {
+		return false, nil
+	}
+	existing.Data = replica.Data
+	existing.StringData = nil
+	existing.Labels = replica.Labels
+	existing.Annotations = replica.Annotations
+	return false, r.Update(ctx, &existing)
+}
+
+// deleteCredentialSecretReplica deletes the copy of a Secret of the user, unless it's gone or no longer a copy
+func (r *UserReconciler) deleteCredentialSecretReplica(ctx context.Context, user *iamv1beta1.User, ref v1.SecretReference) error {
+	sec := v1.Secret{}
+	err := r.Get(ctx, client.ObjectKey{Namespace: ref.Namespace, Name: ref.Name}, &sec)
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if sec.Annotations[ReplicatedFromAnnotation] != replicatedFrom(user) {
+		return nil
+	}
+	if err := r.Delete(ctx, &sec); client.IgnoreNotFound(err) != nil {
+		return err
+	}
+	r.Recorder.Eventf(user, v1.EventTypeNormal, SecretDeletedEventReason, "deleted replicated Secret '%s/%s'", ref.Namespace, ref.Name)
+	return nil
+}
+
+// deleteUnauthorizedReplicas deletes the copies of the credential Secrets of the user, which it may no longer make e.g.
+// because the ReferenceGrant has been revoked. The ones which are kept or could not be deleted stay in the status.
+func (r *UserReconciler) deleteUnauthorizedReplicas(ctx context.Context, user *iamv1beta1.User) error {
+	var replicas []v1.SecretReference
+	for i, replica := range user.Status.ReplicatedSecrets {
+		granted, err := referenceGranted(ctx, r.Client, kindOf(user), user.Namespace, objectReference{Kind: "Secret", Namespace: replica.Namespace, Name: replica.Name})
+		if err == nil && !granted {
+			err = r.deleteCredentialSecretReplica(ctx, user, replica)
+		}
+		if err != nil {
+			user.Status.ReplicatedSecrets = append(replicas, user.Status.ReplicatedSecrets[i:]...)
+			return err
+		}
+		if granted {
+			replicas = append(replicas, replica)
+		}
+	}
+	user.Status.ReplicatedSecrets = replicas
+	return nil
+}
+
+// deleteCredentialSecretReplicas deletes all copies of the credential Secrets of the user. The ones which could not be
+// deleted are kept in the status.
+func (r *UserReconciler) deleteCredentialSecretReplicas(ctx context.Context, user *iamv1beta1.User) error {
+	for len(user.Status.ReplicatedSecrets) > 0 {
+		if err := r.deleteCredentialSecretReplica(ctx, user, user.Status.ReplicatedSecrets[0]); err != nil {
+			return err
+		}
+		user.Status.ReplicatedSecrets = user.Status.ReplicatedSecrets[1:]
+	}
+	return nil
+}
+
+// mergeSecretReferences appends the references of others, which are not in refs yet
+func mergeSecretReferences(refs, others []v1.SecretReference) []v1.SecretReference {
+	known := map[v1.SecretReference]bool{}
+	for _, ref := range refs {
+		known[ref] = true
+	}
+	for _, ref := range others {
+		if !known[ref] {
+			known[ref] = true
+			refs = append(refs, ref)
+		}
+	}
+	return refs
+}
+
+// requestsForReplicatedSecret maps a copy of a credential Secret to a reconcile request for the User it's replicated
+// from
+func requestsForReplicatedSecret(obj client.Object) []reconcile.Request {
+	from, ok := obj.GetAnnotations()[ReplicatedFromAnnotation]
+	if !ok {
+		return nil
+	}
+	parts := strings.SplitN(from, "/", 2)
+	if len(parts) != 2 {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: parts[0], Name: parts[1]}}}
+}
+
+// requestsForReplicaNamespace maps a namespace to reconcile requests for all Users, which replicate their credential
+// Secrets into selected namespaces, as the namespace may have started or stopped matching
+func requestsForReplicaNamespace(c client.Reader) func(client.Object) []reconcile.Request {
+	return func(obj client.Object) []reconcile.Request {
+		users := iamv1beta1.UserList{}
+		if err := c.List(context.Background(), &users); err != nil {
+			return nil
+		}
+		var requests []reconcile.Request
+		for _, user := range users.Items {
+			if cs := user.Spec.CredentialSecret; cs != nil && cs.ReplicateTo != nil && cs.ReplicateTo.NamespaceSelector != nil {
+				requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&user)})
+			}
+		}
+		return requests
+	}
+}
@@ -0,0 +1,81 @@
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	iamv1beta1 "github.com/redradrat/aws-iam-operator/api/v1beta1"
+)
+
+// newFakeClient returns a fake client knowing the core and the operator kinds, holding the given objects
+func newFakeClient(t *testing.T, objs ...client.Object) client.Client {
+	t.Helper()
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := iamv1beta1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	return fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build()
+}
+
+func replicaSecret(namespace, from string) *v1.Secret {
+	return &v1.Secret{ObjectMeta: metav1.ObjectMeta{
+		Namespace:   namespace,
+		Name:        "alice-credentials",
+		Annotations: map[string]string{ReplicatedFromAnnotation: from},
+	}}
+}
+
+func TestSyncCredentialSecretReplicasRevoked(t *testing.T) {
+	user := &iamv1beta1.User{ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "alice"}}
+	user.Spec.CredentialSecret = &iamv1beta1.CredentialSecret{ReplicateTo: &iamv1beta1.SecretReplication{Namespaces: []string{"apps", "jobs", "other"}}}
+	user.Status.ProgrammaticAccessSecret = v1.SecretReference{Namespace: "team-a", Name: "alice-credentials"}
+	user.Status.ReplicatedSecrets = []v1.SecretReference{
+		{Namespace: "apps", Name: "alice-credentials"},
+		{Namespace: "jobs", Name: "alice-credentials"},
+		{Namespace: "other", Name: "alice-credentials"},
+	}
+
+	c := newFakeClient(t,
+		&v1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "alice-credentials"}},
+		replicaSecret("apps", "team-a/alice"),
+		replicaSecret("jobs", "team-a/alice"),
+		// a Secret, which has been replaced by somebody else, is left alone
+		replicaSecret("other", "team-b/bob"),
+		&iamv1beta1.ReferenceGrant{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "apps", Name: "credentials"},
+			Spec: iamv1beta1.ReferenceGrantSpec{
+				From: []iamv1beta1.ReferenceGrantFrom{{Kind: "User", Namespace: "team-a"}},
+				To:   []iamv1beta1.ReferenceGrantTo{{Kind: "Secret"}},
+			},
+		},
+	)
+	r := &UserReconciler{Client: c, Recorder: record.NewFakeRecorder(10)}
+
+	err := r.syncCredentialSecretReplicas(context.Background(), user)
+	if !IsReferenceNotGranted(err) {
+		t.Fatalf("syncCredentialSecretReplicas() error = %v, want the reference not to be granted", err)
+	}
+
+	want := []v1.SecretReference{{Namespace: "apps", Name: "alice-credentials"}}
+	if !reflect.DeepEqual(user.Status.ReplicatedSecrets, want) {
+		t.Errorf("replicated Secrets = %v, want %v", user.Status.ReplicatedSecrets, want)
+	}
+	for ns, wantExists := range map[string]bool{"apps": true, "jobs": false, "other": true} {
+		err := c.Get(context.Background(), client.ObjectKey{Namespace: ns, Name: "alice-credentials"}, &v1.Secret{})
+		if exists := err == nil; exists != wantExists {
+			t.Errorf("Secret in namespace '%s' exists = %v, want %v (%v)", ns, exists, wantExists, err)
+		}
+	}
+}
@@ -18,23 +18,28 @@ package controllers
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
-	"reflect"
-	"strings"
 	"time"
 
+	awssdk "github.com/aws/aws-sdk-go/aws"
+	awsarn "github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/aws/aws-sdk-go/service/eks/eksiface"
+	awsiam "github.com/aws/aws-sdk-go/service/iam"
 	"github.com/go-logr/logr"
-	"github.com/redradrat/cloud-objects/aws"
 	"github.com/redradrat/cloud-objects/aws/iam"
 	v1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	iamv1beta1 "github.com/redradrat/aws-iam-operator/api/v1beta1"
+	"github.com/redradrat/aws-iam-operator/pkg/templating"
 )
 
 // RoleReconciler reconciles a Role object
@@ -44,8 +49,20 @@ type RoleReconciler struct {
 	Log             logr.Logger
 	Region          string
 	Scheme          *runtime.Scheme
+	Recorder        record.EventRecorder
 	ResourcePrefix  string
 	OidcProviderARN string
+	// MaxTrustPolicySize is the maximum size of a trust policy in characters, as configured in the IAM quotas
+	MaxTrustPolicySize int
+	// DryRun only plans the AWS operations for all Roles, instead of executing them
+	DryRun bool
+	// Adoption selects the namespaces, in which Roles may adopt existing IAM objects
+	Adoption AdoptionPolicy
+	// TemplateValues are the values of the template variables in trust policies
+	TemplateValues templating.Values
+	// EKS is the client pod identity associations are managed with. The shared EKS client of the region is used, if
+	// it's nil; it can be set to a stub.
+	EKS eksiface.EKSAPI
 }
 
 // +kubebuilder:rbac:groups=aws-iam.redradrat.xyz,resources=roles,verbs=get;list;watch;create;update;patch;delete
@@ -56,9 +73,16 @@ type RoleReconciler struct {
 // +kubebuilder:rbac:groups=aws-iam.redradrat.xyz,resources=assumerolepolicies/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=aws-iam.redradrat.xyz,resources=assumerolepolicies/finalizers,verbs=get;update
 
+// +kubebuilder:rbac:groups=aws-iam.redradrat.xyz,resources=referencegrants,verbs=get;list;watch
+// +kubebuilder:rbac:groups=aws-iam.redradrat.xyz,resources=iamconstraints;clusteriamconstraints,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=configmaps;secrets,verbs=get;list;watch
+
 // +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups="",resources=secrets/status,verbs=get;update;patch
 
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+
 func (r *RoleReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	log := r.Log.WithValues("role", req.NamespacedName)
 
@@ -69,22 +93,95 @@ func (r *RoleReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
 
-	// get the policy doc
-	polDoc, resVer, err := getPolicyDoc(&role, r.OidcProviderARN, r.Client, ctx)
-	if err != nil {
-		return ctrl.Result{}, errWithStatus(ctx, &role, err, r.Status())
+	// make sure we are allowed to reference the AssumeRolePolicy
+	if arpr := role.Spec.AssumeRolePolicyReference; arpr.Name != "" && role.ObjectMeta.DeletionTimestamp.IsZero() {
+		refs := []objectReference{{Kind: "AssumeRolePolicy", Namespace: arpr.Namespace, Name: arpr.Name}}
+		if err := authorizeReferences(ctx, r.Client, &role, refs); err != nil {
+			return r.unauthorized(ctx, &role, err)
+		}
+	}
+
+	// get the policy doc, with the referenced ARNs resolved; a Role being deleted doesn't need its trust policy anymore,
+	// its AssumeRolePolicy or document source may well be gone already
+	polDoc, resVer, resolver, err := trustPolicyDocument(ctx, r.Client, &role, r.OidcProviderARN, r.TemplateValues)
+	var referencesChanged bool
+	if role.ObjectMeta.DeletionTimestamp.IsZero() {
+		// make sure we are allowed to reference all resources, before we use their ARNs, and to trust all ServiceAccounts
+		if refs := append(resolver.refs, serviceAccountReferences(&role)...); len(refs) > 0 {
+			if err := authorizeReferences(ctx, r.Client, &role, refs); err != nil {
+				return r.unauthorized(ctx, &role, err)
+			}
+		}
+		referencesChanged = setReferencesResolved(&role, len(resolver.refs) > 0, err)
+		if IsReferenceNotReady(err) {
+			// we're triggered again, once the referenced resource has its ARN
+			log.V(1).Info("waiting for referenced resource", "reason", err.Error())
+			if referencesChanged {
+				return ctrl.Result{}, r.Status().Update(ctx, &role)
+			}
+			return ctrl.Result{RequeueAfter: r.Interval}, nil
+		}
+		if err != nil {
+			return ctrl.Result{}, errWithStatus(ctx, &role, err, r.Status(), r.Recorder)
+		}
+	}
+
+	// make sure the trust policy is valid and satisfies all IAMConstraints
+	var lintChanged, constraintsChanged, limitsChanged bool
+	if role.ObjectMeta.DeletionTimestamp.IsZero() {
+		if lintChanged, err = checkLint(&role, polDoc.PolicyDocument, true, r.Region, r.Recorder); err != nil {
+			return ctrl.Result{}, errWithStatus(ctx, &role, err, r.Status(), r.Recorder)
+		}
+		if constraintsChanged, err = checkConstraints(ctx, r.Client, &role, polDoc, true, r.Recorder); err != nil {
+			return ctrl.Result{}, errWithStatus(ctx, &role, err, r.Status(), r.Recorder)
+		}
+		if limitsChanged, err = checkDocumentSize(&role, polDoc, r.MaxTrustPolicySize); err != nil {
+			return ctrl.Result{}, errWithStatus(ctx, &role, err, r.Status(), r.Recorder)
+		}
+	}
+	conditionsChanged := lintChanged || constraintsChanged || limitsChanged || referencesChanged
+	dryRun := dryRunEnabled(r.DryRun, &role)
+
+	// a paused Role is left alone, we only keep reporting its status
+	paused, pausedChanged := checkPaused(&role)
+	conditionsChanged = conditionsChanged || pausedChanged
+	if paused {
+		if conditionsChanged {
+			return ctrl.Result{}, r.Status().Update(ctx, &role)
+		}
+		return ctrl.Result{RequeueAfter: r.Interval}, nil
 	}
 
 	reconcileUnneccessary :=
 		role.Status.ObservedGeneration == role.ObjectMeta.Generation &&
-			role.Status.State == iamv1beta1.OkSyncState &&
-			role.Status.ReadAssumeRolePolicyVersion == resVer
+			upToDate(&role, dryRun) &&
+			role.Status.ReadAssumeRolePolicyVersion == resVer &&
+			referencesUpToDate(&role, resolver.resolved) &&
+			documentSourceUpToDate(&role, polDoc)
 
 	if reconcileUnneccessary {
+		if conditionsChanged {
+			if err := r.Status().Update(ctx, &role); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+		// the ServiceAccounts may have been changed or deleted underneath us
+		if role.Status.ARN != "" && !dryRun && role.ObjectMeta.DeletionTimestamp.IsZero() {
+			if err := r.reconcileServiceAccounts(ctx, &role); err != nil {
+				log.Error(err, "unable to update ServiceAccounts of Role")
+				return ctrl.Result{}, client.IgnoreNotFound(err)
+			}
+		}
 		return ctrl.Result{RequeueAfter: r.Interval}, nil
 	} else {
+		if role.Status.ObservedGeneration == role.ObjectMeta.Generation && role.Status.State == iamv1beta1.OkSyncState && !reconcileRequested(&role) {
+			// only the referenced AssumeRolePolicy, its document or ARNs changed underneath us
+			driftDetectionsTotal.WithLabelValues(kindOf(&role), AssumeRolePolicyReferenceDriftReason).Inc()
+		}
 		role.Status.ReadAssumeRolePolicyVersion = resVer
+		role.Status.ReadDocumentVersion = polDoc.SourceVersion
 	}
+	role.Status.PlannedOperations = nil
 
 	// the finalizer for deleting the actual aws resources
 	rolesFinalizer := "role.aws-iam.redradrat.xyz"
@@ -92,25 +189,21 @@ func (r *RoleReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.
 	// Get our actual IAM Service to communicate with AWS; we don't need to continue without it
 	iamsvc, err := IAMService(r.Region)
 	if err != nil {
-		return ctrl.Result{}, errWithStatus(ctx, &role, err, r.Status())
+		return ctrl.Result{}, errWithStatus(ctx, &role, err, r.Status(), r.Recorder)
 	}
 
 	// new role instance
-	var ins *iam.RoleInstance
-	roleName := r.ResourcePrefix + role.RoleName()
 	var duration int64 = 3600
 	if role.Spec.MaxSessionDuration != nil {
 		duration = *role.Spec.MaxSessionDuration
 	}
-	if role.Status.ARN != "" {
-		parsedArn, err := aws.ARNify(role.Status.ARN)
-		if err != nil {
-			return ctrl.Result{}, errWithStatus(ctx, &role, fmt.Errorf("ARN in Role status is not valid/parsable"), r.Status())
+	var parsedArn awsarn.ARN
+	if objectARN(&role) != "" {
+		if parsedArn, err = parseObjectARN(&role); err != nil {
+			return ctrl.Result{}, errWithStatus(ctx, &role, err, r.Status(), r.Recorder)
 		}
-		ins = iam.NewExistingRoleInstance(roleName, role.Spec.Description, duration, polDoc, parsedArn[len(parsedArn)-1])
-	} else {
-		ins = iam.NewRoleInstance(roleName, role.Spec.Description, duration, polDoc)
 	}
+	ins := newRoleInstance(r.ResourcePrefix+role.RoleName(), role.Spec.Description, duration, polDoc, parsedArn)
 
 	cleanupFunc := roleCleanup(r, ctx, role)
 
@@ -130,14 +223,40 @@ func (r *RoleReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.
 		if containsString(role.ObjectMeta.Finalizers, rolesFinalizer) {
 			// our finalizer is present, so lets handle any external dependency
 
+			// the pod identity associations go first, as they reference the Role; but only once nothing blocks the
+			// deletion, as running pods still rely on them otherwise
+			deleteFunc := func() error {
+				if err := cleanupFunc(); err != nil {
+					return err
+				}
+				if len(role.Status.PodIdentityAssociations) > 0 && !dryRun {
+					return r.deletePodIdentityAssociations(ctx, &role)
+				}
+				return nil
+			}
+
 			// delete the actual AWS Object and pass the cleanup function
-			statusUpdater, err := DeleteAWSObject(iamsvc, ins, cleanupFunc)
+			statusUpdater, err := DeleteAWSObject(iamsvc, ins, r.Recorder, &role, deleteFunc, dryRun)
 			// we got a StatusUpdater function returned... let's execute it
-			statusUpdater(ctx, ins, &role, r.Status(), log)
+			if updateErr := statusUpdater(ctx, ins, &role, r.Status()); updateErr != nil {
+				return ctrl.Result{}, updateErr
+			}
 			if err != nil {
 				// we had an error during AWS Object deletion... so we return here to retry
 				log.Error(err, "unable to delete Role")
-				return ctrl.Result{}, err
+				return resultForAWSError(err)
+			}
+			if planned(&role) {
+				// keep the finalizer, as the Role still exists in AWS
+				return ctrl.Result{RequeueAfter: r.Interval}, nil
+			}
+
+			// the ServiceAccounts point to a Role, which no longer exists
+			if len(role.Status.ServiceAccounts) > 0 {
+				if err := r.releaseServiceAccounts(ctx, &role); err != nil {
+					log.Error(err, "unable to release ServiceAccounts of Role")
+					return ctrl.Result{}, err
+				}
 			}
 
 			// remove our finalizer from the list and update it.
@@ -154,33 +273,77 @@ func (r *RoleReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.
 
 	// RECONCILE THE RESOURCE
 
-	// if there is already an ARN in our status, then we recreate the object completely
-	// (because AWS only supports description updates)
-	if role.Status.ARN != "" {
-		// delete the actual AWS Object and pass the cleanup function
-		statusUpdater, err := DeleteAWSObject(iamsvc, ins, cleanupFunc)
-		// we got a StatusUpdater function returned... let's execute it
-		statusUpdater(ctx, ins, &role, r.Status(), log)
-		if err != nil {
-			// we had an error during AWS Object deletion... so we return here to retry
-			log.Error(err, "error while deleting Role during reconciliation")
+	// an existing Role is adopted, if we're asked to. If there is already an ARN in our status, then we recreate the
+	// object completely (because AWS only supports description updates)
+	var statusUpdater StatusUpdater
+	if adoptionARN(&role) != "" {
+		statusUpdater, err = AdoptAWSObject(iamsvc, ins, r.Recorder, &role, r.Adoption, dryRun)
+	} else if role.Status.ARN != "" {
+		statusUpdater, err = RecreateAWSObject(iamsvc, ins, r.Recorder, &role, cleanupFunc, dryRun)
+	} else {
+		statusUpdater, err = CreateAWSObject(iamsvc, ins, r.Recorder, &role, DoNothingPreFunc, dryRun)
+	}
+	if updateErr := statusUpdater(ctx, ins, &role, r.Status()); updateErr != nil {
+		return ctrl.Result{}, updateErr
+	}
+	if err != nil {
+		log.Error(err, "error while creating Role during reconciliation")
+		return resultForAWSError(err)
+	}
+
+	if dryRun {
+		// the ServiceAccount needs the ARN of the created Role, so there's nothing more to plan
+		role.Status.ObservedGeneration = role.ObjectMeta.Generation
+		markReconcileRequestHandled(&role)
+		markReferencesApplied(&role, resolver.resolved)
+		if err := r.Status().Update(ctx, &role); err != nil {
 			return ctrl.Result{}, err
 		}
+		log.Info("Planned Role", "operations", role.Status.PlannedOperations)
+		return ctrl.Result{RequeueAfter: r.Interval}, nil
 	}
 
-	statusUpdater, err := CreateAWSObject(iamsvc, ins, DoNothingPreFunc)
-	statusUpdater(ctx, ins, &role, r.Status(), log)
-	if err != nil {
-		log.Error(err, "error while creating Role during reconciliation")
+	log.Info(fmt.Sprintf("Created Role '%s'", role.Status.ARN))
+
+	// Create or annotate the ServiceAccounts for Role, and release the ones no longer listed
+	if err := r.reconcileServiceAccounts(ctx, &role); err != nil {
+		log.Error(err, "unable to create ServiceAccount for Role")
+		r.Recorder.Event(&role, v1.EventTypeWarning, ReconcileErrorEventReason, fmt.Sprintf("unable to create ServiceAccount: %s", err.Error()))
+		// the ServiceAccounts, which have been created or released so far, must not be lost
+		if err := r.Status().Update(ctx, &role); err != nil {
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	// Associate the Role with its ServiceAccounts through EKS Pod Identity
+	if err := r.reconcilePodIdentityAssociations(ctx, &role); err != nil {
+		log.Error(err, "unable to update pod identity associations of Role")
+		r.Recorder.Event(&role, v1.EventTypeWarning, ReconcileErrorEventReason, fmt.Sprintf("unable to update pod identity associations: %s", err.Error()))
+		// the associations, which have been created or deleted so far, must not be lost
+		if err := r.Status().Update(ctx, &role); err != nil {
+			return ctrl.Result{}, err
+		}
+		return resultForAWSError(err)
+	}
+
+	// Update Generation
+	role.Status.ObservedGeneration = role.ObjectMeta.Generation
+	markReconcileRequestHandled(&role)
+	markReferencesApplied(&role, resolver.resolved)
+	if err := r.Status().Update(ctx, &role); err != nil {
 		return ctrl.Result{}, err
 	}
 
-	log.Info(fmt.Sprintf("Created Role '%s'", role.Status.ARN))
+	return ctrl.Result{RequeueAfter: r.Interval}, nil
+}
 
+// reconcileServiceAccounts creates the ServiceAccounts of the Role, and keeps their annotations in sync with it
+func (r *RoleReconciler) reconcileServiceAccounts(ctx context.Context, role *iamv1beta1.Role) error {
 	truevar := true
-	gvk, err := apiutil.GVKForObject(&role, r.Scheme)
+	gvk, err := apiutil.GVKForObject(role, r.Scheme)
 	if err != nil {
-		return ctrl.Result{}, err
+		return err
 	}
 
 	ownerRef := metav1.OwnerReference{
@@ -191,35 +354,252 @@ func (r *RoleReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.
 		BlockOwnerDeletion: &truevar,
 		Controller:         &truevar,
 	}
-	// Create ServiceAccount for Role
-	if err = createRoleServiceAccount(role, ctx, r.Client, ownerRef); err != nil {
-		log.Error(err, "unable to create ServiceAccount for Role")
-		return ctrl.Result{}, client.IgnoreNotFound(err)
+	created, skipped, released, err := syncServiceAccounts(ctx, r.Client, role, ownerRef)
+	for _, sa := range created {
+		r.Recorder.Eventf(role, v1.EventTypeNormal, ServiceAccountCreatedEventReason, "created ServiceAccount '%s/%s'", sa.Namespace, sa.Name)
+	}
+	for _, sa := range skipped {
+		r.Recorder.Event(role, v1.EventTypeWarning, ServiceAccountSkippedEventReason, serviceAccountSkippedMessage(sa))
+	}
+	for _, sa := range released {
+		r.Recorder.Event(role, v1.EventTypeNormal, ServiceAccountReleasedEventReason, serviceAccountReleasedMessage(sa))
 	}
+	return err
+}
 
-	// Update Generation
-	role.Status.ObservedGeneration = role.ObjectMeta.Generation
-	if err := r.Status().Update(ctx, &role); err != nil {
-		return ctrl.Result{}, err
+// releaseServiceAccounts deletes the ServiceAccounts created for the Role, and removes its annotations from the ones it
+// has annotated. The ServiceAccounts released so far are removed from its status.
+func (r *RoleReconciler) releaseServiceAccounts(ctx context.Context, role *iamv1beta1.Role) error {
+	released, err := releaseServiceAccounts(ctx, r.Client, role)
+	for _, sa := range released {
+		r.Recorder.Event(role, v1.EventTypeNormal, ServiceAccountReleasedEventReason, serviceAccountReleasedMessage(sa))
 	}
+	if uerr := r.Status().Update(ctx, role); uerr != nil && err == nil {
+		err = uerr
+	}
+	return err
+}
 
-	return ctrl.Result{RequeueAfter: r.Interval}, nil
+// eksService returns the client for pod identity associations
+func (r *RoleReconciler) eksService() (eksiface.EKSAPI, error) {
+	if r.EKS != nil {
+		return r.EKS, nil
+	}
+	return EKSService(r.Region)
+}
+
+// reconcilePodIdentityAssociations creates, updates and deletes the pod identity associations of the Role, and records
+// them in its status
+func (r *RoleReconciler) reconcilePodIdentityAssociations(ctx context.Context, role *iamv1beta1.Role) error {
+	if role.Spec.PodIdentity == nil && len(role.Status.PodIdentityAssociations) == 0 {
+		return nil
+	}
+	svc, err := r.eksService()
+	if err != nil {
+		return err
+	}
+	created, deleted, err := syncPodIdentityAssociations(svc, role, r.TemplateValues.ClusterName)
+	for _, a := range created {
+		r.Recorder.Eventf(role, v1.EventTypeNormal, CreatedEventReason, "created pod identity association '%s' for ServiceAccount '%s/%s' in cluster '%s'", a.AssociationID, a.Namespace, a.ServiceAccount, a.ClusterName)
+	}
+	for _, a := range deleted {
+		r.Recorder.Eventf(role, v1.EventTypeNormal, DeletedEventReason, "deleted pod identity association '%s' for ServiceAccount '%s/%s' in cluster '%s'", a.AssociationID, a.Namespace, a.ServiceAccount, a.ClusterName)
+	}
+	return err
+}
+
+// deletePodIdentityAssociations deletes all pod identity associations of the Role, and records the ones left in its
+// status
+func (r *RoleReconciler) deletePodIdentityAssociations(ctx context.Context, role *iamv1beta1.Role) error {
+	svc, err := r.eksService()
+	if err != nil {
+		return err
+	}
+	err = deletePodIdentityAssociations(svc, role)
+	if uerr := r.Status().Update(ctx, role); uerr != nil && err == nil {
+		err = uerr
+	}
+	return err
+}
+
+// unauthorized reports the failed authorization of the references of the role. If a reference is not granted, the
+// trust the role got through it is revoked first.
+func (r *RoleReconciler) unauthorized(ctx context.Context, role *iamv1beta1.Role, err error) (ctrl.Result, error) {
+	if IsReferenceNotGranted(err) {
+		if revokeErr := r.revokeUnauthorizedTrust(ctx, role); revokeErr != nil {
+			r.Log.Error(revokeErr, "unable to revoke the trust of unauthorized references of Role", "role", client.ObjectKeyFromObject(role))
+			if updateErr := r.Status().Update(ctx, role); updateErr != nil {
+				return ctrl.Result{}, updateErr
+			}
+			return resultForAWSError(revokeErr)
+		}
+	}
+	return ctrl.Result{}, errWithStatus(ctx, role, err, r.Status(), r.Recorder)
+}
+
+// revokeUnauthorizedTrust reapplies the trust policy of the role without the references, which are no longer granted
+// e.g. because the ReferenceGrant has been revoked: Allow statements referencing them, ServiceAccounts trusted through
+// IRSA, and a referenced AssumeRolePolicy are left out, and the pod identity associations of ServiceAccounts are
+// deleted. If no trust is left, nobody may assume the role. The role is recreated with its full trust policy, once the
+// references are granted again. Paused Roles are left alone, in dry-run mode the update is only planned.
+func (r *RoleReconciler) revokeUnauthorizedTrust(ctx context.Context, role *iamv1beta1.Role) error {
+	if paused, _ := checkPaused(role); paused || role.Status.ARN == "" {
+		return nil
+	}
+	granted := func(kind, namespace, name string) (bool, error) {
+		return referenceGranted(ctx, r.Client, kindOf(role), role.Namespace, objectReference{Kind: kind, Namespace: namespace, Name: name})
+	}
+
+	authorized := role.DeepCopy()
+	var arp *iamv1beta1.AssumeRolePolicy
+	if arpr := role.Spec.AssumeRolePolicyReference; role.ReferencesAssumeRolePolicy() && arpr.Name != "" {
+		ok, err := granted("AssumeRolePolicy", arpr.Namespace, arpr.Name)
+		if err != nil {
+			return err
+		}
+		if ok {
+			arp = &iamv1beta1.AssumeRolePolicy{}
+			if err := r.Get(ctx, client.ObjectKey{Name: arpr.Name, Namespace: arpr.Namespace}, arp); err != nil {
+				return err
+			}
+			if arp.Spec.Statement, err = grantedStatements(arp.Spec.Statement, arp.Namespace, granted); err != nil {
+				return err
+			}
+		}
+	}
+	var err error
+	if authorized.Spec.AssumeRolePolicy, err = grantedStatements(role.Spec.AssumeRolePolicy, role.Namespace, granted); err != nil {
+		return err
+	}
+	if authorized.Spec.IRSA != nil {
+		if authorized.Spec.IRSA.ServiceAccounts, err = grantedServiceAccounts(role.Spec.IRSA.ServiceAccounts, role.Namespace, granted); err != nil {
+			return err
+		}
+		if len(authorized.Spec.IRSA.ServiceAccounts) == 0 {
+			authorized.Spec.IRSA = nil
+		}
+	}
+	if authorized.Spec.PodIdentity != nil {
+		if authorized.Spec.PodIdentity.ServiceAccounts, err = grantedServiceAccounts(role.Spec.PodIdentity.ServiceAccounts, role.Namespace, granted); err != nil {
+			return err
+		}
+		if len(authorized.Spec.PodIdentity.ServiceAccounts) == 0 {
+			authorized.Spec.PodIdentity = nil
+		}
+	}
+
+	// nothing is left to compose, if the referenced AssumeRolePolicy is not granted
+	doc := Document{PolicyDocument: noTrustPolicyDocument()}
+	if !authorized.ReferencesAssumeRolePolicy() || arp != nil {
+		if doc, err = composeTrustPolicyDocument(ctx, r.Client, authorized, arp, NewARNResolver(ctx, r.Client), r.OidcProviderARN, r.TemplateValues); err != nil {
+			return err
+		}
+	}
+	if doc.Raw == nil && len(doc.PolicyDocument.Statement) == 0 {
+		doc.PolicyDocument = noTrustPolicyDocument()
+	}
+
+	target := fmt.Sprintf("trust policy of Role '%s'", role.Status.ARN)
+	role.Status.PlannedOperations = nil
+	if dryRunEnabled(r.DryRun, role) {
+		recordPlannedOperation(r.Recorder, role, iamv1beta1.PlannedOperation{Operation: iamv1beta1.UpdateOperation, Target: target}, "update "+target)
+		return nil
+	}
+
+	iamsvc, err := IAMService(r.Region)
+	if err != nil {
+		return err
+	}
+	b := doc.Raw
+	if b == nil {
+		if b, err = json.Marshal(&doc.PolicyDocument); err != nil {
+			return err
+		}
+	}
+	if _, err := iamsvc.UpdateAssumeRolePolicy(&awsiam.UpdateAssumeRolePolicyInput{
+		RoleName:       awssdk.String(r.ResourcePrefix + role.RoleName()),
+		PolicyDocument: awssdk.String(string(b)),
+	}); err != nil {
+		r.Recorder.Eventf(role, v1.EventTypeWarning, UpdateFailedEventReason, "unable to update %s: %s", target, err.Error())
+		return err
+	}
+	r.Recorder.Eventf(role, v1.EventTypeNormal, UpdatedEventReason, "updated %s without the references, which are no longer granted", target)
+
+	if len(role.Status.PodIdentityAssociations) > 0 {
+		err := r.reconcilePodIdentityAssociations(ctx, authorized)
+		role.Status.PodIdentityAssociations = authorized.Status.PodIdentityAssociations
+		return err
+	}
+	return nil
+}
+
+// grantedStatements returns the entries of the statement, which only reference granted resources. Deny entries are
+// always kept, as they cannot grant anything.
+func grantedStatements(statement iamv1beta1.AssumeRolePolicyStatement, namespace string, granted func(kind, namespace, name string) (bool, error)) (iamv1beta1.AssumeRolePolicyStatement, error) {
+	var kept iamv1beta1.AssumeRolePolicyStatement
+	for _, entry := range statement {
+		ok := true
+		if entry.Effect == iamv1beta1.AllowPolicyStatementEffect {
+			for _, ref := range append(append([]iamv1beta1.ARNReference{}, entry.ResourceRefs...), entry.PrincipalRefs...) {
+				ref = ref.InNamespace(namespace)
+				var err error
+				if ok, err = granted(ref.Kind, ref.Namespace, ref.Name); err != nil {
+					return nil, err
+				}
+				if !ok {
+					break
+				}
+			}
+		}
+		if ok {
+			kept = append(kept, entry)
+		}
+	}
+	return kept, nil
+}
+
+// grantedServiceAccounts returns the ServiceAccounts, which may be referenced
+func grantedServiceAccounts(serviceAccounts []iamv1beta1.ServiceAccountSubject, namespace string, granted func(kind, namespace, name string) (bool, error)) ([]iamv1beta1.ServiceAccountSubject, error) {
+	var kept []iamv1beta1.ServiceAccountSubject
+	for _, sa := range serviceAccounts {
+		ns := sa.Namespace
+		if ns == "" {
+			ns = namespace
+		}
+		ok, err := granted("ServiceAccount", ns, sa.Name)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			kept = append(kept, sa)
+		}
+	}
+	return kept, nil
+}
+
+// noTrustPolicyDocument returns a trust policy, which doesn't allow anybody to assume a role
+func noTrustPolicyDocument() iam.PolicyDocument {
+	return iam.PolicyDocument{
+		Version: iam.PolicyVersion20121017,
+		Statement: []iam.StatementEntry{{
+			Effect:    "Deny",
+			Principal: map[string]string{"AWS": "*"},
+			Action:    []string{"sts:*"},
+		}},
+	}
 }
 
 // Returns a function, that does everything necessary before we can delete our actual Role (cleanup)
 func roleCleanup(r *RoleReconciler, ctx context.Context, role iamv1beta1.Role) func() error {
 	return func() error {
-		attachments := iamv1beta1.PolicyAttachmentList{}
-		if err := r.List(ctx, &attachments); err != nil {
+		attachments, err := listPolicyAttachments(ctx, r, policyAttachmentTargetIndex, targetIndexKey(iamv1beta1.RoleTargetType, role.Namespace, role.Name))
+		if err != nil {
 			return err
 		}
-		for _, att := range attachments.Items {
-			if att.Spec.TargetReference.Type == iamv1beta1.RoleTargetType {
-				if att.Spec.TargetReference.Name == role.Name && att.Spec.TargetReference.Namespace == role.Namespace {
-					err := fmt.Errorf("cannot delete Role due to existing PolicyAttachment '%s/%s'", att.Name, att.Namespace)
-					return err
-				}
-			}
+		if len(attachments) > 0 {
+			att := attachments[0]
+			err := fmt.Errorf("cannot delete Role due to existing PolicyAttachment '%s/%s'", att.Name, att.Namespace)
+			return err
 		}
 		return nil
 	}
@@ -228,87 +608,78 @@ func roleCleanup(r *RoleReconciler, ctx context.Context, role iamv1beta1.Role) f
 func (r *RoleReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&iamv1beta1.Role{}).
+		Watches(&source.Kind{Type: &iamv1beta1.AssumeRolePolicy{}},
+			handler.EnqueueRequestsFromMapFunc(requestsForIndex(r.Client, &iamv1beta1.RoleList{}, roleAssumeRolePolicyIndex, namespacedKeyOf))).
+		Watches(&source.Kind{Type: &v1.ServiceAccount{}},
+			handler.EnqueueRequestsFromMapFunc(requestsForIndex(r.Client, &iamv1beta1.RoleList{}, roleServiceAccountIndex, namespacedKeyOf))).
+		Watches(&source.Kind{Type: &iamv1beta1.Role{}},
+			handler.EnqueueRequestsFromMapFunc(requestsForARNReference(r.Client, &iamv1beta1.RoleList{}, "Role"))).
+		Watches(&source.Kind{Type: &iamv1beta1.User{}},
+			handler.EnqueueRequestsFromMapFunc(requestsForARNReference(r.Client, &iamv1beta1.RoleList{}, "User"))).
+		Watches(&source.Kind{Type: &iamv1beta1.Group{}},
+			handler.EnqueueRequestsFromMapFunc(requestsForARNReference(r.Client, &iamv1beta1.RoleList{}, "Group"))).
+		Watches(&source.Kind{Type: &iamv1beta1.Policy{}},
+			handler.EnqueueRequestsFromMapFunc(requestsForARNReference(r.Client, &iamv1beta1.RoleList{}, "Policy"))).
+		Watches(&source.Kind{Type: &iamv1beta1.ReferenceGrant{}},
+			handler.EnqueueRequestsFromMapFunc(requestsForReferenceGrant(r.Client, &iamv1beta1.RoleList{}, "Role"))).
+		Watches(&source.Kind{Type: &v1.ConfigMap{}},
+			handler.EnqueueRequestsFromMapFunc(requestsForRoleDocumentSource(r.Client, "ConfigMap"))).
+		Watches(&source.Kind{Type: &v1.Secret{}},
+			handler.EnqueueRequestsFromMapFunc(requestsForRoleDocumentSource(r.Client, "Secret"))).
+		Watches(&source.Kind{Type: &iamv1beta1.IAMConstraint{}},
+			handler.EnqueueRequestsFromMapFunc(requestsForConstraint(r.Client, &iamv1beta1.RoleList{}))).
+		Watches(&source.Kind{Type: &iamv1beta1.ClusterIAMConstraint{}},
+			handler.EnqueueRequestsFromMapFunc(requestsForConstraint(r.Client, &iamv1beta1.RoleList{}))).
 		Complete(r)
 }
 
-// this helper returns the referenced policy document, but if it's a reference, also returns its resource version as
-// string. This is so we can decide, whether we need to do reconciliation. Usually we would discard as no change, but
-// in this case, we don't know whether a reference might have changed.
-func getPolicyDoc(role *iamv1beta1.Role, oidcProviderARN string, c client.Client, ctx context.Context) (iam.PolicyDocument, string, error) {
-	var resourceVersion string
-	var p iam.PolicyDocument
-	var statement iamv1beta1.AssumeRolePolicyStatement
-	if len(role.Spec.AssumeRolePolicy) != 0 {
-		if !reflect.DeepEqual(role.Spec.AssumeRolePolicyReference, iamv1beta1.ResourceReference{}) {
-			err := fmt.Errorf("only one specification of AssumeRolePolicy and AssumeRolePolicyReference is allowed")
-			return p, "", err
-		}
-		statement = role.Spec.AssumeRolePolicy
-	}
-	if len(role.Spec.AssumeRolePolicy) == 0 && !role.Spec.AddIRSAPolicy {
-		if reflect.DeepEqual(role.Spec.AssumeRolePolicyReference, iamv1beta1.ResourceReference{}) {
-			err := fmt.Errorf("specification of either AssumeRolePolicy or AssumeRolePolicyReference is mandatory")
-			return p, "", err
-		}
-		var assumeRolePolicy iamv1beta1.AssumeRolePolicy
-		arpr := role.Spec.AssumeRolePolicyReference
-		if err := c.Get(ctx, client.ObjectKey{Name: arpr.Name, Namespace: arpr.Namespace}, &assumeRolePolicy); err != nil {
-			return p, "", err
-		}
-		resourceVersion = assumeRolePolicy.GetResourceVersion()
-		statement = assumeRolePolicy.Spec.Statement
-	}
-
-	if role.Spec.AddIRSAPolicy {
-		if oidcProviderARN == "" {
-			err := fmt.Errorf("addIRSAPolicy is true but no OIDC-Provider ARN has been given to the controller")
-			return p, "", err
-		}
-
-		arn := aws.MustParse(oidcProviderARN)
-		resourceWithoutType := strings.SplitAfterN(arn.Resource, "/", 2)[1]
-		conditions := make(map[iamv1beta1.PolicyStatementConditionKey]string)
-		conditions[iamv1beta1.PolicyStatementConditionKey(fmt.Sprintf("%s:aud", resourceWithoutType))] = "sts.amazonaws.com"
-		conditions[iamv1beta1.PolicyStatementConditionKey(fmt.Sprintf("%s:sub", resourceWithoutType))] = fmt.Sprintf("system:serviceaccount:%s:%s", role.Namespace, role.Name)
-
-		statement = append(statement, iamv1beta1.AssumeRolePolicyStatementEntry{
-			PolicyStatementEntry: iamv1beta1.PolicyStatementEntry{
-				Effect:  "Allow",
-				Actions: []string{"sts:AssumeRoleWithWebIdentity"},
-				Conditions: map[iamv1beta1.PolicyStatementConditionOperator]iamv1beta1.PolicyStatementConditionComparison{
-					"StringEquals": conditions,
-				},
-			},
-			Principal: map[string]string{
-				"Federated": oidcProviderARN,
-			},
-		})
-	}
-
-	p = statement.MarshalPolicyDocument()
-
-	return p, resourceVersion, nil
+// GetPolicyDoc returns the trust policy document of the role with its template variables expanded, but if it's a reference, also returns its resource
+// version as string. This is so we can decide, whether we need to do reconciliation. Usually we would discard as no
+// change, but in this case, we don't know whether a reference might have changed.
+func GetPolicyDoc(role *iamv1beta1.Role, oidcProviderARN string, values templating.Values, c client.Client, ctx context.Context) (Document, string, error) {
+	p, resourceVersion, _, err := trustPolicyDocument(ctx, c, role, oidcProviderARN, values)
+	return p, resourceVersion, err
 }
 
-func createRoleServiceAccount(role iamv1beta1.Role, ctx context.Context, client client.Client, ownerRef metav1.OwnerReference) error {
-	if role.Spec.CreateServiceAccount {
-		sa := v1.ServiceAccount{
-			ObjectMeta: metav1.ObjectMeta{
-				Name:      role.Name,
-				Namespace: role.Namespace,
-				Labels:    role.Labels,
-				Annotations: map[string]string{
-					"eks.amazonaws.com/role-arn": role.Status.ARN,
-				},
-				OwnerReferences: []metav1.OwnerReference{ownerRef},
-			},
-		}
-
-		if err := client.Create(ctx, &sa); err != nil && !errors.IsAlreadyExists(err) {
-			return err
+// trustPolicyDocument returns the trust policy document of the role like GetPolicyDoc, and the resolver, which knows
+// the referenced resources and their ARNs. References in a referenced AssumeRolePolicy default to its namespace, and
+// a raw document of a referenced AssumeRolePolicy is the trust policy as it is.
+func trustPolicyDocument(ctx context.Context, c client.Reader, role *iamv1beta1.Role, oidcProviderARN string, values templating.Values) (Document, string, *ARNResolver, error) {
+	resolver := NewARNResolver(ctx, c)
+	var resourceVersion string
+	var arp *iamv1beta1.AssumeRolePolicy
+	if arpr := role.Spec.AssumeRolePolicyReference; role.ReferencesAssumeRolePolicy() && arpr.Name != "" {
+		arp = &iamv1beta1.AssumeRolePolicy{}
+		if err := c.Get(ctx, client.ObjectKey{Name: arpr.Name, Namespace: arpr.Namespace}, arp); err != nil {
+			return Document{}, "", resolver, err
 		}
-
+		resourceVersion = arp.GetResourceVersion()
 	}
 
-	return nil
+	doc, err := composeTrustPolicyDocument(ctx, c, role, arp, resolver, oidcProviderARN, values)
+	return doc, resourceVersion, resolver, err
+}
+
+// composeTrustPolicyDocument composes the trust policy document of the role from its own statements and the ones of
+// the given AssumeRolePolicy (nil, if it references none), with the referenced ARNs resolved by resolver
+func composeTrustPolicyDocument(ctx context.Context, c client.Reader, role *iamv1beta1.Role, arp *iamv1beta1.AssumeRolePolicy, resolver *ARNResolver, oidcProviderARN string, values templating.Values) (Document, error) {
+	var sourceVersion string
+	p, raw, err := values.ComposeTrustPolicyDocument(role, arp, resolver.Resolve, oidcProviderARN, func(arp *iamv1beta1.AssumeRolePolicy) (iam.PolicyDocument, []byte, error) {
+		doc, err := readRawDocument(ctx, c, arp.Namespace, arp.Spec.Document, arp.Spec.DocumentFrom, true)
+		sourceVersion = doc.SourceVersion
+		return doc.PolicyDocument, doc.Raw, err
+	})
+	return Document{PolicyDocument: p, Raw: raw, SourceVersion: sourceVersion}, err
+}
+
+// serviceAccountReferences returns the ServiceAccounts the Role trusts through IRSA or is associated with through Pod
+// Identity as references, so ServiceAccounts in other namespaces need a ReferenceGrant there
+func serviceAccountReferences(role *iamv1beta1.Role) []objectReference {
+	var refs []objectReference
+	// invalid pod identity ServiceAccounts are reported with the trust policy
+	podIdentity, _ := role.PodIdentityServiceAccounts()
+	for _, sa := range append(role.IRSAServiceAccounts(), podIdentity...) {
+		refs = append(refs, objectReference{Kind: "ServiceAccount", Namespace: sa.Namespace, Name: sa.Name})
+	}
+	return refs
 }
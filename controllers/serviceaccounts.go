@@ -0,0 +1,259 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	iamv1beta1 "github.com/redradrat/aws-iam-operator/api/v1beta1"
+)
+
+// Annotations of the ServiceAccounts of a Role. The eks.amazonaws.com ones are read by the EKS pod identity webhook, or
+// the one served by the operator.
+const (
+	RoleARNAnnotation              = "eks.amazonaws.com/role-arn"
+	STSRegionalEndpointsAnnotation = "eks.amazonaws.com/sts-regional-endpoints"
+	TokenExpirationAnnotation      = "eks.amazonaws.com/token-expiration"
+	AudienceAnnotation             = "eks.amazonaws.com/audience"
+	// managedByRoleAnnotation marks a ServiceAccount, whose annotations are managed for the Role "<namespace>/<name>"
+	managedByRoleAnnotation = "aws-iam.redradrat.xyz/role"
+)
+
+// serviceAccountAnnotationKeys are all annotations, which are managed on the ServiceAccounts of a Role
+var serviceAccountAnnotationKeys = []string{RoleARNAnnotation, STSRegionalEndpointsAnnotation, TokenExpirationAnnotation, AudienceAnnotation, managedByRoleAnnotation}
+
+// roleServiceAccounts returns the ServiceAccounts, which are created and annotated for the Role: every ServiceAccount
+// listed for IRSA, which is not a pattern, or the one of the same namespace and name as the Role. None, unless
+// createServiceAccount is set.
+func roleServiceAccounts(role *iamv1beta1.Role) []iamv1beta1.ServiceAccountSubject {
+	if !role.Spec.CreateServiceAccount {
+		return nil
+	}
+
+	subjects := role.IRSAServiceAccounts()
+	if len(subjects) == 0 {
+		return []iamv1beta1.ServiceAccountSubject{{Namespace: role.Namespace, Name: role.Name}}
+	}
+	var literal []iamv1beta1.ServiceAccountSubject
+	for _, subject := range subjects {
+		if !subject.IsPattern() {
+			literal = append(literal, subject)
+		}
+	}
+	return literal
+}
+
+// serviceAccountAnnotations returns the annotations, the ServiceAccounts of the Role should have
+func serviceAccountAnnotations(role *iamv1beta1.Role) map[string]string {
+	annotations := map[string]string{
+		RoleARNAnnotation:       role.Status.ARN,
+		managedByRoleAnnotation: namespacedKeyOf(role),
+	}
+	// a token has a single audience, so pods request the first one the Role accepts
+	if audience := role.IRSAAudiences()[0]; audience != iamv1beta1.DefaultIRSAAudience {
+		annotations[AudienceAnnotation] = audience
+	}
+	if opts := role.Spec.ServiceAccount; opts != nil {
+		if opts.STSRegionalEndpoints != nil {
+			annotations[STSRegionalEndpointsAnnotation] = strconv.FormatBool(*opts.STSRegionalEndpoints)
+		}
+		if opts.TokenExpiration != nil {
+			annotations[TokenExpirationAnnotation] = strconv.FormatInt(*opts.TokenExpiration, 10)
+		}
+	}
+	return annotations
+}
+
+// syncServiceAccounts creates the ServiceAccounts of the Role, and makes sure the ServiceAccounts managed for the Role
+// carry its current annotations. ServiceAccounts which already exist, but have not been created for the Role, are only
+// annotated with annotateExisting, and never if they are managed for another Role. The managed ServiceAccounts are
+// recorded in the status of the Role, and the ones which are no longer wanted are released. It returns the
+// ServiceAccounts, which have been created, the ones which have been left alone, and the ones which have been released.
+func syncServiceAccounts(ctx context.Context, c client.Client, role *iamv1beta1.Role, ownerRef metav1.OwnerReference) (created, skipped []iamv1beta1.ServiceAccountSubject, released []iamv1beta1.ManagedServiceAccount, err error) {
+	annotations := serviceAccountAnnotations(role)
+	annotateExisting := role.Spec.ServiceAccount != nil && role.Spec.ServiceAccount.AnnotateExisting
+
+	var managed []iamv1beta1.ManagedServiceAccount
+	defer func() { role.Status.ServiceAccounts = managed }()
+	wanted := map[string]bool{}
+	for _, subject := range roleServiceAccounts(role) {
+		sa := v1.ServiceAccount{}
+		err := c.Get(ctx, client.ObjectKey{Namespace: subject.Namespace, Name: subject.Name}, &sa)
+		if errors.IsNotFound(err) {
+			sa = v1.ServiceAccount{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        subject.Name,
+					Namespace:   subject.Namespace,
+					Labels:      role.Labels,
+					Annotations: annotations,
+				},
+			}
+			// owner references cannot point into other namespaces
+			if subject.Namespace == role.Namespace {
+				sa.OwnerReferences = []metav1.OwnerReference{ownerRef}
+			}
+			if err := c.Create(ctx, &sa); err != nil {
+				managed = mergeManagedServiceAccounts(managed, role.Status.ServiceAccounts)
+				return created, skipped, released, err
+			}
+			created = append(created, subject)
+			wanted[namespacedIndexKey(subject.Namespace, subject.Name)] = true
+			managed = append(managed, iamv1beta1.ManagedServiceAccount{Namespace: subject.Namespace, Name: subject.Name, Created: true})
+			continue
+		}
+		if err != nil {
+			managed = mergeManagedServiceAccounts(managed, role.Status.ServiceAccounts)
+			return created, skipped, released, err
+		}
+
+		managedBy := sa.Annotations[managedByRoleAnnotation]
+		owned := managedBy == namespacedKeyOf(role) || metav1.IsControlledBy(&sa, role)
+		if !owned && (!annotateExisting || managedBy != "" || metav1.GetControllerOf(&sa) != nil) {
+			skipped = append(skipped, subject)
+			continue
+		}
+		if err := patchServiceAccountAnnotations(ctx, c, &sa, annotations); err != nil {
+			managed = mergeManagedServiceAccounts(managed, role.Status.ServiceAccounts)
+			return created, skipped, released, err
+		}
+		wanted[namespacedIndexKey(subject.Namespace, subject.Name)] = true
+		managed = append(managed, iamv1beta1.ManagedServiceAccount{
+			Namespace: subject.Namespace,
+			Name:      subject.Name,
+			Created:   createdServiceAccount(role, subject) || metav1.IsControlledBy(&sa, role),
+		})
+	}
+
+	for i, sa := range role.Status.ServiceAccounts {
+		if wanted[namespacedIndexKey(sa.Namespace, sa.Name)] {
+			continue
+		}
+		ok, err := releaseServiceAccount(ctx, c, role, sa)
+		if err != nil {
+			managed = mergeManagedServiceAccounts(managed, role.Status.ServiceAccounts[i:])
+			return created, skipped, released, err
+		}
+		if ok {
+			released = append(released, sa)
+		}
+	}
+	return created, skipped, released, nil
+}
+
+// createdServiceAccount returns true, if the status of the Role records, that the ServiceAccount has been created for it
+func createdServiceAccount(role *iamv1beta1.Role, subject iamv1beta1.ServiceAccountSubject) bool {
+	for _, sa := range role.Status.ServiceAccounts {
+		if sa.Namespace == subject.Namespace && sa.Name == subject.Name {
+			return sa.Created
+		}
+	}
+	return false
+}
+
+// releaseServiceAccount deletes the ServiceAccount, if it has been created for the Role, or removes the annotations of
+// the Role from it otherwise. It returns false, if the ServiceAccount is gone, or no longer managed for the Role.
+func releaseServiceAccount(ctx context.Context, c client.Client, role *iamv1beta1.Role, managed iamv1beta1.ManagedServiceAccount) (bool, error) {
+	sa := v1.ServiceAccount{}
+	err := c.Get(ctx, client.ObjectKey{Namespace: managed.Namespace, Name: managed.Name}, &sa)
+	if errors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if sa.Annotations[managedByRoleAnnotation] != namespacedKeyOf(role) && !metav1.IsControlledBy(&sa, role) {
+		return false, nil
+	}
+	if managed.Created {
+		if err := c.Delete(ctx, &sa); err != nil {
+			return false, client.IgnoreNotFound(err)
+		}
+		return true, nil
+	}
+	return true, patchServiceAccountAnnotations(ctx, c, &sa, nil)
+}
+
+// releaseServiceAccounts releases all ServiceAccounts managed for the Role. The ones which could not be released are
+// kept in the status.
+func releaseServiceAccounts(ctx context.Context, c client.Client, role *iamv1beta1.Role) (released []iamv1beta1.ManagedServiceAccount, err error) {
+	for len(role.Status.ServiceAccounts) > 0 {
+		sa := role.Status.ServiceAccounts[0]
+		ok, err := releaseServiceAccount(ctx, c, role, sa)
+		if err != nil {
+			return released, err
+		}
+		if ok {
+			released = append(released, sa)
+		}
+		role.Status.ServiceAccounts = role.Status.ServiceAccounts[1:]
+	}
+	return released, nil
+}
+
+// mergeManagedServiceAccounts appends the ServiceAccounts of others, which are not in managed yet
+func mergeManagedServiceAccounts(managed, others []iamv1beta1.ManagedServiceAccount) []iamv1beta1.ManagedServiceAccount {
+	known := map[string]bool{}
+	for _, sa := range managed {
+		known[namespacedIndexKey(sa.Namespace, sa.Name)] = true
+	}
+	for _, sa := range others {
+		if key := namespacedIndexKey(sa.Namespace, sa.Name); !known[key] {
+			known[key] = true
+			managed = append(managed, sa)
+		}
+	}
+	return managed
+}
+
+// serviceAccountReleasedMessage describes how a ServiceAccount has been released
+func serviceAccountReleasedMessage(sa iamv1beta1.ManagedServiceAccount) string {
+	if sa.Created {
+		return fmt.Sprintf("deleted ServiceAccount '%s/%s'", sa.Namespace, sa.Name)
+	}
+	return fmt.Sprintf("removed the annotations of this Role from ServiceAccount '%s/%s'", sa.Namespace, sa.Name)
+}
+
+// patchServiceAccountAnnotations sets the managed annotations of the ServiceAccount to the given ones, and removes the
+// managed annotations, which are not given. Nothing is patched, if the annotations are up to date.
+func patchServiceAccountAnnotations(ctx context.Context, c client.Client, sa *v1.ServiceAccount, annotations map[string]string) error {
+	patch := client.MergeFrom(sa.DeepCopy())
+	changed := false
+	for _, key := range serviceAccountAnnotationKeys {
+		current, exists := sa.Annotations[key]
+		desired, wanted := annotations[key]
+		switch {
+		case wanted && (!exists || current != desired):
+			if sa.Annotations == nil {
+				sa.Annotations = map[string]string{}
+			}
+			sa.Annotations[key] = desired
+			changed = true
+		case !wanted && exists:
+			delete(sa.Annotations, key)
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return c.Patch(ctx, sa, patch)
+}
+
+// serviceAccountIndexKeys returns the index keys of the ServiceAccounts, which are created and annotated for the Role
+func serviceAccountIndexKeys(role *iamv1beta1.Role) []string {
+	var keys []string
+	for _, subject := range roleServiceAccounts(role) {
+		keys = append(keys, namespacedIndexKey(subject.Namespace, subject.Name))
+	}
+	return keys
+}
+
+// serviceAccountSkippedMessage describes a ServiceAccount, which exists but is not annotated for the Role
+func serviceAccountSkippedMessage(subject iamv1beta1.ServiceAccountSubject) string {
+	return fmt.Sprintf("ServiceAccount '%s/%s' already exists and is not managed for this Role, set serviceAccount.annotateExisting to annotate it", subject.Namespace, subject.Name)
+}
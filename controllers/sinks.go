@@ -0,0 +1,176 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	iamv1beta1 "github.com/redradrat/aws-iam-operator/api/v1beta1"
+	"github.com/redradrat/aws-iam-operator/pkg/sinks"
+)
+
+// CredentialSinkRoot is the path, all external credential sinks write below
+const CredentialSinkRoot = "aws-iam-operator"
+
+// secretSink writes credentials to Secrets in the namespace of the user, which are controlled by the user
+type secretSink struct {
+	client client.Client
+	scheme *runtime.Scheme
+	user   *iamv1beta1.User
+}
+
+func (s *secretSink) Write(ctx context.Context, name string, data map[string][]byte) error {
+	sec := userSecret(s.user, data, name)
+	if err := ctrl.SetControllerReference(s.user, sec, s.scheme); err != nil {
+		return err
+	}
+	return writeCredentialSecret(ctx, s.client, s.user, sec, s.user.Status.CredentialSecret)
+}
+
+func (s *secretSink) Read(ctx context.Context, name string) (map[string][]byte, error) {
+	sec := v1.Secret{}
+	err := s.client.Get(ctx, client.ObjectKey{Namespace: s.user.Namespace, Name: name}, &sec)
+	if errors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if sec.Data == nil {
+		return map[string][]byte{}, nil
+	}
+	return sec.Data, nil
+}
+
+func (s *secretSink) Delete(ctx context.Context, name string) error {
+	sec := &v1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: s.user.Namespace, Name: name}}
+	return client.IgnoreNotFound(s.client.Delete(ctx, sec))
+}
+
+func (s *secretSink) Location(name string) string {
+	return fmt.Sprintf("Secret '%s/%s'", s.user.Namespace, name)
+}
+
+// externalCredentialSink returns the sink, unless it selects the Secrets in the namespace of the user
+func externalCredentialSink(sink *iamv1beta1.CredentialSink) *iamv1beta1.CredentialSink {
+	if sink == nil || sink.Vault == nil && sink.SecretsManager == nil && sink.SSM == nil {
+		return nil
+	}
+	return sink
+}
+
+// credentialSinkRelocated returns true, if the credentials of the user have been written to another sink than the one
+// in its spec
+func credentialSinkRelocated(user *iamv1beta1.User) bool {
+	return !equality.Semantic.DeepEqual(externalCredentialSink(user.Spec.CredentialSink), externalCredentialSink(user.Status.CredentialSink))
+}
+
+// validateCredentialSink checks that the sink of the user is usable, before any credentials are issued
+func (r *UserReconciler) validateCredentialSink(user *iamv1beta1.User) error {
+	sink := externalCredentialSink(user.Spec.CredentialSink)
+	if sink == nil {
+		return nil
+	}
+	if cs := user.Spec.CredentialSecret; cs != nil && cs.ReplicateTo != nil {
+		return fmt.Errorf("credentialSecret.replicateTo cannot be used with a credentialSink, only Secrets are replicated")
+	}
+	var selected []string
+	var sinkPath string
+	if sink.Vault != nil {
+		selected = append(selected, "vault")
+		sinkPath = sink.Vault.Path
+		if r.Vault == nil {
+			return fmt.Errorf("credentialSink.vault cannot be used, as no Vault server has been configured for the operator")
+		}
+	}
+	if sink.SecretsManager != nil {
+		selected = append(selected, "secretsManager")
+		sinkPath = sink.SecretsManager.Path
+	}
+	if sink.SSM != nil {
+		selected = append(selected, "ssm")
+		sinkPath = sink.SSM.Path
+	}
+	if len(selected) > 1 {
+		return fmt.Errorf("only one of credentialSink.%s may be set", strings.Join(selected, ", credentialSink."))
+	}
+	for _, segment := range strings.Split(sinkPath, "/") {
+		if segment == "." || segment == ".." {
+			return fmt.Errorf("credentialSink.%s.path must not contain '.' or '..'", selected[0])
+		}
+	}
+	return nil
+}
+
+// credentialSink returns the sink for the given spec of the user; the Secrets in its namespace, if there's no external
+// one
+func (r *UserReconciler) credentialSink(user *iamv1beta1.User, spec *iamv1beta1.CredentialSink) (sinks.Sink, error) {
+	spec = externalCredentialSink(spec)
+	switch {
+	case spec == nil:
+		return &secretSink{client: r.Client, scheme: r.Scheme, user: user}, nil
+	case spec.Vault != nil:
+		if r.Vault == nil {
+			return nil, fmt.Errorf("no Vault server has been configured for the operator")
+		}
+		return sinks.NewVault(r.Vault, spec.Vault.Mount, path.Join(CredentialSinkRoot, user.Namespace, spec.Vault.Path)), nil
+	case spec.SecretsManager != nil:
+		svc := r.SecretsManager
+		if svc == nil {
+			var err error
+			if svc, err = SecretsManagerService(r.Region); err != nil {
+				return nil, err
+			}
+		}
+		return sinks.NewSecretsManager(svc, path.Join(CredentialSinkRoot, user.Namespace, spec.SecretsManager.Path)+"/", spec.SecretsManager.KMSKeyID), nil
+	default:
+		svc := r.SSM
+		if svc == nil {
+			var err error
+			if svc, err = SSMService(r.Region); err != nil {
+				return nil, err
+			}
+		}
+		return sinks.NewSSM(svc, path.Join(CredentialSinkRoot, user.Namespace, spec.SSM.Path), spec.SSM.KMSKeyID), nil
+	}
+}
+
+// deleteExternalCredentials deletes the credentials of the user from the external sink they have been written to.
+// Secrets in the namespace of the user are garbage collected along with it.
+func (r *UserReconciler) deleteExternalCredentials(ctx context.Context, user *iamv1beta1.User) error {
+	if externalCredentialSink(user.Status.CredentialSink) == nil {
+		return nil
+	}
+	sink, err := r.credentialSink(user, user.Status.CredentialSink)
+	if err != nil {
+		return err
+	}
+	for _, ref := range []v1.SecretReference{user.Status.LoginProfileSecret, user.Status.ProgrammaticAccessSecret} {
+		if ref.Name == "" {
+			continue
+		}
+		if err := sink.Delete(ctx, ref.Name); err != nil {
+			return err
+		}
+		r.Recorder.Eventf(user, v1.EventTypeNormal, SecretDeletedEventReason, "deleted %s", sink.Location(ref.Name))
+	}
+	return nil
+}
+
+// credentialSecretReference returns the reference to credentials of the user written under the name. Only Secrets in
+// the namespace of the user have a namespace.
+func credentialSecretReference(user *iamv1beta1.User, name string) v1.SecretReference {
+	if externalCredentialSink(user.Spec.CredentialSink) != nil {
+		return v1.SecretReference{Name: name}
+	}
+	return v1.SecretReference{Name: name, Namespace: user.Namespace}
+}
@@ -19,19 +19,27 @@ package controllers
 import (
 	"context"
 	"fmt"
+	"strings"
 
+	"github.com/aws/aws-sdk-go/service/iam/iamiface"
+	"github.com/aws/aws-sdk-go/service/secretsmanager/secretsmanageriface"
+	"github.com/aws/aws-sdk-go/service/ssm/ssmiface"
 	"github.com/go-logr/logr"
 	v1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
-	"github.com/redradrat/cloud-objects/aws"
 	"github.com/redradrat/cloud-objects/aws/iam"
 
 	iamv1beta1 "github.com/redradrat/aws-iam-operator/api/v1beta1"
+	"github.com/redradrat/aws-iam-operator/pkg/sinks"
 )
 
 const (
@@ -49,7 +57,18 @@ type UserReconciler struct {
 	Log            logr.Logger
 	Region         string
 	Scheme         *runtime.Scheme
+	Recorder       record.EventRecorder
 	ResourcePrefix string
+	// DryRun only plans the AWS operations for all Users, instead of executing them
+	DryRun bool
+	// Adoption selects the namespaces, in which Users may adopt existing IAM objects
+	Adoption AdoptionPolicy
+	// Vault is the client for the Vault credential sink. Users cannot write their credentials to Vault, if it's nil.
+	Vault *sinks.VaultClient
+	// SecretsManager and SSM are the clients for the Secrets Manager and SSM credential sinks. The shared clients of
+	// the region are used, if they're nil; they can be set to stubs.
+	SecretsManager secretsmanageriface.SecretsManagerAPI
+	SSM            ssmiface.SSMAPI
 }
 
 // +kubebuilder:rbac:groups=aws-iam.redradrat.xyz,resources=users,verbs=get;list;watch;create;update;patch;delete
@@ -62,6 +81,11 @@ type UserReconciler struct {
 // +kubebuilder:rbac:groups="",resources=serviceaccounts,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups="",resources=serviceaccounts/status,verbs=get;update;patch
 
+// +kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
+// +kubebuilder:rbac:groups=aws-iam.redradrat.xyz,resources=referencegrants,verbs=get;list;watch
+
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+
 func (r *UserReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	log := r.Log.WithValues("user", req.NamespacedName)
 
@@ -72,10 +96,54 @@ func (r *UserReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
 
+	dryRun := dryRunEnabled(r.DryRun, &user)
+
+	// a paused User is left alone, we only keep reporting its status
+	paused, pausedChanged := checkPaused(&user)
+	if paused {
+		if pausedChanged {
+			return ctrl.Result{}, r.Status().Update(ctx, &user)
+		}
+		return ctrl.Result{}, nil
+	}
+
+	// credentials are lost, once their Secret has been deleted or altered, so they have to be issued again. The same
+	// goes for credentials, which have to be written to another sink, as we cannot read them back from AWS.
+	var staleLogin, staleAccessKey, staleLoginLocation, staleAccessKeyLocation string
+	var writtenSink sinks.Sink
+	if user.ObjectMeta.DeletionTimestamp.IsZero() && !dryRun {
+		// credentials written before their credentialSecret has been recorded are assumed to match it
+		if user.Status.CredentialSecret == nil && (user.Status.LoginProfileCreated || user.Status.ProgrammaticAccessCreated) {
+			user.Status.CredentialSecret = writtenCredentialSecret(&user)
+		}
+		if writtenSink, err = r.credentialSink(&user, user.Status.CredentialSink); err != nil {
+			return ctrl.Result{}, errWithStatus(ctx, &user, err, r.Status(), r.Recorder)
+		}
+		if staleLogin, staleAccessKey, err = staleCredentialSecrets(ctx, writtenSink, &user); err != nil {
+			return ctrl.Result{}, err
+		}
+		staleLoginLocation = writtenSink.Location(user.Status.LoginProfileSecret.Name)
+		staleAccessKeyLocation = writtenSink.Location(user.Status.ProgrammaticAccessSecret.Name)
+	}
+
 	// return if only status/metadata updated
-	if user.Status.ObservedGeneration == user.ObjectMeta.Generation && user.Status.State == iamv1beta1.OkSyncState {
+	if user.Status.ObservedGeneration == user.ObjectMeta.Generation && upToDate(&user, dryRun) && staleLogin == "" && staleAccessKey == "" &&
+		(dryRun || !credentialsPending(&user)) {
+		// the copies of the credential Secrets are kept in sync, even if the User itself is up to date
+		replicasChanged := false
+		if !dryRun {
+			before := user.Status.DeepCopy()
+			if err := r.syncCredentialSecretReplicas(ctx, &user); err != nil {
+				return ctrl.Result{}, errWithStatus(ctx, &user, err, r.Status(), r.Recorder)
+			}
+			replicasChanged = !equality.Semantic.DeepEqual(before, &user.Status)
+		}
+		if pausedChanged || replicasChanged {
+			return ctrl.Result{}, r.Status().Update(ctx, &user)
+		}
 		return ctrl.Result{}, nil
 	}
+	user.Status.PlannedOperations = nil
 
 	// the finalizer for deleting the actual aws resources
 	usersFinalizer := "user.aws-iam.redradrat.xyz"
@@ -83,18 +151,43 @@ func (r *UserReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.
 	// Get our actual IAM Service to communicate with AWS; we don't need to continue without it
 	iamsvc, err := IAMService(r.Region)
 	if err != nil {
-		return ctrl.Result{}, errWithStatus(ctx, &user, err, r.Status())
+		return ctrl.Result{}, errWithStatus(ctx, &user, err, r.Status(), r.Recorder)
 	}
 
 	// new user instance
 	userName := r.ResourcePrefix + user.Name
+
+	// nobody has the stale credentials anymore, so they're revoked, before new ones are issued. Without the ID of the
+	// access key in the Secret, we cannot tell it apart from the others.
+	var revoked []string
+	if staleAccessKey != "" {
+		if revoked, err = revokeAccessKeys(iamsvc, userName, staleAccessKeys(&user)); err != nil {
+			log.Error(err, "unable to revoke access keys of User")
+			return resultForAWSError(err)
+		}
+		user.Status.ProgrammaticAccessCreated = false
+	}
+	if staleLogin != "" {
+		user.Status.LoginProfileCreated = false
+	}
+	// relocated credentials are revoked now, so they're removed from where they have been written to
+	if staleLogin == "relocated" {
+		if err := writtenSink.Delete(ctx, user.Status.LoginProfileSecret.Name); err != nil {
+			return ctrl.Result{}, errWithStatus(ctx, &user, err, r.Status(), r.Recorder)
+		}
+	}
+	if staleAccessKey == "relocated" {
+		if err := writtenSink.Delete(ctx, user.Status.ProgrammaticAccessSecret.Name); err != nil {
+			return ctrl.Result{}, errWithStatus(ctx, &user, err, r.Status(), r.Recorder)
+		}
+	}
 	var ins *iam.UserInstance
-	if user.Status.ARN != "" {
-		parsedArn, err := aws.ARNify(user.Status.ARN)
+	if objectARN(&user) != "" {
+		parsedArn, err := parseObjectARN(&user)
 		if err != nil {
-			return ctrl.Result{}, errWithStatus(ctx, &user, fmt.Errorf("ARN in User status is not valid/parsable"), r.Status())
+			return ctrl.Result{}, errWithStatus(ctx, &user, err, r.Status(), r.Recorder)
 		}
-		ins = iam.NewExistingUserInstance(userName, user.Spec.CreateLoginProfile, user.Status.LoginProfileCreated, user.Spec.CreateProgrammaticAccess, user.Status.ProgrammaticAccessCreated, parsedArn[len(parsedArn)-1])
+		ins = iam.NewExistingUserInstance(userName, user.Spec.CreateLoginProfile, user.Status.LoginProfileCreated, user.Spec.CreateProgrammaticAccess, user.Status.ProgrammaticAccessCreated, parsedArn)
 	} else {
 		ins = iam.NewUserInstance(userName, user.Spec.CreateLoginProfile, user.Spec.CreateProgrammaticAccess)
 	}
@@ -118,13 +211,30 @@ func (r *UserReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.
 			// our finalizer is present, so lets handle any external dependency
 
 			// delete the actual AWS Object and pass the cleanup function
-			statusUpdater, err := DeleteAWSObject(iamsvc, ins, cleanupFunc)
+			statusUpdater, err := DeleteAWSObject(iamsvc, ins, r.Recorder, &user, cleanupFunc, dryRun)
 			// we got a StatusUpdater function returned... let's execute it
-			statusUpdater(ctx, ins, &user, r.Status(), log)
+			if updateErr := statusUpdater(ctx, ins, &user, r.Status()); updateErr != nil {
+				return ctrl.Result{}, updateErr
+			}
 			if err != nil {
 				// we had an error during AWS Object deletion... so we return here to retry
 				log.Error(err, "unable to delete User")
-				return ctrl.Result{}, err
+				return resultForAWSError(err)
+			}
+			if planned(&user) {
+				// keep the finalizer, as the User still exists in AWS
+				return ctrl.Result{}, nil
+			}
+
+			// Secrets are garbage collected along with the User, their copies in other namespaces and credentials in
+			// other sinks are not
+			if err := r.deleteCredentialSecretReplicas(ctx, &user); err != nil {
+				log.Error(err, "unable to delete replicated Secrets of User")
+				return ctrl.Result{}, errWithStatus(ctx, &user, err, r.Status(), r.Recorder)
+			}
+			if err := r.deleteExternalCredentials(ctx, &user); err != nil {
+				log.Error(err, "unable to delete credentials of User")
+				return ctrl.Result{}, errWithStatus(ctx, &user, err, r.Status(), r.Recorder)
 			}
 
 			// remove our finalizer from the list and update it.
@@ -141,128 +251,294 @@ func (r *UserReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.
 
 	// RECONCILE THE RESOURCE
 
-	loginSecret := user.Name + LoginSecretSuffix
-	accessKeySecret := user.Name + AccesskeySecretSuffix
+	// a broken Secret format has to be reported before any credentials are issued, which we could not write
+	if err := validateCredentialSecret(&user); err != nil {
+		return ctrl.Result{}, errWithStatus(ctx, &user, err, r.Status(), r.Recorder)
+	}
+	if err := r.validateCredentialSink(&user); err != nil {
+		return ctrl.Result{}, errWithStatus(ctx, &user, err, r.Status(), r.Recorder)
+	}
+	sink, err := r.credentialSink(&user, user.Spec.CredentialSink)
+	if err != nil {
+		return ctrl.Result{}, errWithStatus(ctx, &user, err, r.Status(), r.Recorder)
+	}
+	loginSecret := loginSecretName(&user)
+	accessKeySecret := accessKeySecretName(&user)
 
-	// if there is already an ARN in our status, then we recreate the object completely
-	// (because AWS only supports description updates)
-	if user.Status.ARN != "" {
+	if !dryRun {
+		stray, err := r.beginCredentialIssuance(ctx, iamsvc, &user, userName)
+		if len(stray) > 0 {
+			r.Recorder.Eventf(&user, v1.EventTypeWarning, CredentialsRevokedEventReason, "revoked access keys %s, which had been issued but never written to a Secret", strings.Join(stray, ", "))
+		}
+		if err != nil {
+			log.Error(err, "unable to prepare issuing credentials for User")
+			return resultForAWSError(err)
+		}
+	}
+
+	if adoptionARN(&user) != "" {
+		// User exists, but not as ours yet; let's adopt it
+		statusUpdater, err := AdoptAWSObject(iamsvc, ins, r.Recorder, &user, r.Adoption, dryRun)
+		if updateErr := statusUpdater(ctx, ins, &user, r.Status()); updateErr != nil {
+			return ctrl.Result{}, updateErr
+		}
+		if err != nil {
+			log.Error(err, "error while adopting User during reconciliation")
+			return resultForAWSError(err)
+		}
+		// we cannot read existing credentials, so the ones we're asked for are created
+		if user.Spec.CreateLoginProfile || user.Spec.CreateProgrammaticAccess {
+			statusUpdater, err := UpdateAWSObject(iamsvc, ins, r.Recorder, &user, DoNothingPreFunc, dryRun)
+			if updateErr := statusUpdater(ctx, ins, &user, r.Status()); updateErr != nil {
+				return ctrl.Result{}, updateErr
+			}
+			if err != nil {
+				log.Error(err, "error while updating adopted User during reconciliation")
+				return resultForAWSError(err)
+			}
+		}
+	} else if user.Status.ARN != "" {
 		// User already exists; we need to update it
-		statusUpdater, err := UpdateAWSObject(iamsvc, ins, DoNothingPreFunc)
-		statusUpdater(ctx, ins, &user, r.Status(), log)
+		statusUpdater, err := UpdateAWSObject(iamsvc, ins, r.Recorder, &user, DoNothingPreFunc, dryRun)
+		if updateErr := statusUpdater(ctx, ins, &user, r.Status()); updateErr != nil {
+			return ctrl.Result{}, updateErr
+		}
 		if err != nil {
 			log.Error(err, "error while updating User during reconciliation")
-			return ctrl.Result{}, err
+			return resultForAWSError(err)
 		}
 	} else {
 		// User does not yet exist, let's create it
-		statusUpdater, err := CreateAWSObject(iamsvc, ins, DoNothingPreFunc)
-		statusUpdater(ctx, ins, &user, r.Status(), log)
+		statusUpdater, err := CreateAWSObject(iamsvc, ins, r.Recorder, &user, DoNothingPreFunc, dryRun)
+		if updateErr := statusUpdater(ctx, ins, &user, r.Status()); updateErr != nil {
+			return ctrl.Result{}, updateErr
+		}
 		if err != nil {
 			log.Error(err, "error while creating User during reconciliation")
+			return resultForAWSError(err)
+		}
+	}
+
+	if dryRun {
+		// without calling AWS there are no credentials, so we leave the Secrets alone
+		user.Status.ObservedGeneration = user.ObjectMeta.Generation
+		markReconcileRequestHandled(&user)
+		if err := r.Status().Update(ctx, &user); err != nil {
 			return ctrl.Result{}, err
 		}
+		log.Info("Planned User", "operations", user.Status.PlannedOperations)
+		return ctrl.Result{}, nil
 	}
 
+	// credentials, whose Secrets have only been renamed or relabeled, are moved as they are
+	if moved, err := r.moveCredentialSecrets(ctx, &user, writtenSink, sink, loginSecret, accessKeySecret); err != nil {
+		return ctrl.Result{}, errWithStatus(ctx, &user, err, r.Status(), r.Recorder)
+	} else if moved {
+		if err := r.Status().Update(ctx, &user); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	// credentials are issued, when the User has been created or updated in AWS
+	issuedAt := metav1.Now()
+
 	// Create Secret if Login Profile
 	if user.Spec.CreateLoginProfile {
 		if !user.Status.LoginProfileCreated {
-			data := map[string]string{LoginSecretUserKey: ins.LoginProfileCredentials().Username(), LoginSecretPassKey: ins.LoginProfileCredentials().Password()}
-			sec := userSecret(data, loginSecret, user.Namespace)
-			if err = ctrl.SetControllerReference(&user, sec, r.Scheme); err != nil {
-				return ctrl.Result{}, err
+			data := credentialData(loginSecretData(&user, ins.LoginProfileCredentials().Username(), ins.LoginProfileCredentials().Password()))
+			if err = sink.Write(ctx, loginSecret, data); err != nil {
+				return ctrl.Result{}, errWithStatus(ctx, &user, err, r.Status(), r.Recorder)
 			}
-			if err = r.Client.Create(ctx, sec); err != nil {
-				return ctrl.Result{}, err
+			r.Recorder.Eventf(&user, v1.EventTypeNormal, SecretCreatedEventReason, "created login profile %s", sink.Location(loginSecret))
+			// the credentials issued again may have been written under another name before
+			if err := deleteRenamedCredentials(ctx, writtenSink, user.Status.LoginProfileSecret.Name, loginSecret); err != nil {
+				return ctrl.Result{}, errWithStatus(ctx, &user, err, r.Status(), r.Recorder)
 			}
 			user.Status.LoginProfileCreated = true
-			user.Status.LoginProfileSecret = v1.SecretReference{Name: sec.Name, Namespace: sec.Namespace}
-			r.Status().Update(ctx, &user)
+			user.Status.LoginProfileSecret = credentialSecretReference(&user, loginSecret)
+			user.Status.LoginProfileSecretHash = secretDataHash(data)
+			user.Status.LoginProfileIssuedAt = &issuedAt
+			user.Status.CredentialSink = externalCredentialSink(user.Spec.CredentialSink).DeepCopy()
+			if err := r.Status().Update(ctx, &user); err != nil {
+				return ctrl.Result{}, err
+			}
 		}
 	} else {
-		sec := &v1.Secret{}
-		if err = r.Client.Get(ctx, client.ObjectKey{Name: loginSecret, Namespace: user.Namespace}, sec); client.IgnoreNotFound(err) != nil {
+		// the Secret may have been created with another name
+		if ref := user.Status.LoginProfileSecret; ref.Name != "" {
+			loginSecret = ref.Name
+		}
+		data, err := writtenSink.Read(ctx, loginSecret)
+		if err != nil {
 			return ctrl.Result{}, err
 		}
-		if !errors.IsNotFound(err) {
-			if err = r.Client.Delete(ctx, sec); client.IgnoreNotFound(err) != nil {
+		if data != nil {
+			if err = writtenSink.Delete(ctx, loginSecret); err != nil {
 				return ctrl.Result{}, err
 			}
+			r.Recorder.Eventf(&user, v1.EventTypeNormal, SecretDeletedEventReason, "deleted login profile %s", writtenSink.Location(loginSecret))
 			user.Status.LoginProfileCreated = false
 			user.Status.LoginProfileSecret = v1.SecretReference{}
-			r.Status().Update(ctx, &user)
+			user.Status.LoginProfileSecretHash = ""
+			user.Status.LoginProfileIssuedAt = nil
+			if err := r.Status().Update(ctx, &user); err != nil {
+				return ctrl.Result{}, err
+			}
 		}
 	}
 
 	if user.Spec.CreateProgrammaticAccess {
 		if !user.Status.ProgrammaticAccessCreated {
-			data := map[string]string{AccesskeySecretIdKey: ins.AccessKey().Id(), AccesskeySecretSecretKey: ins.AccessKey().Secret()}
-			sec := userSecret(data, accessKeySecret, user.Namespace)
-			if err = ctrl.SetControllerReference(&user, sec, r.Scheme); err != nil {
-				return ctrl.Result{}, err
+			values, err := accessKeySecretData(&user, ins.AccessKey().Id(), ins.AccessKey().Secret(), r.Region)
+			if err != nil {
+				return ctrl.Result{}, errWithStatus(ctx, &user, err, r.Status(), r.Recorder)
 			}
-			if err = r.Client.Create(ctx, sec); err != nil {
-				return ctrl.Result{}, err
+			data := credentialData(values)
+			if err = sink.Write(ctx, accessKeySecret, data); err != nil {
+				return ctrl.Result{}, errWithStatus(ctx, &user, err, r.Status(), r.Recorder)
+			}
+			r.Recorder.Eventf(&user, v1.EventTypeNormal, SecretCreatedEventReason, "created access key %s", sink.Location(accessKeySecret))
+			if err := deleteRenamedCredentials(ctx, writtenSink, user.Status.ProgrammaticAccessSecret.Name, accessKeySecret); err != nil {
+				return ctrl.Result{}, errWithStatus(ctx, &user, err, r.Status(), r.Recorder)
 			}
 			user.Status.ProgrammaticAccessCreated = true
-			user.Status.ProgrammaticAccessSecret = v1.SecretReference{Name: sec.Name, Namespace: sec.Namespace}
-			r.Status().Update(ctx, &user)
+			user.Status.ProgrammaticAccessSecret = credentialSecretReference(&user, accessKeySecret)
+			user.Status.ProgrammaticAccessSecretHash = secretDataHash(data)
+			user.Status.AccessKeyIssuedAt = &issuedAt
+			user.Status.AccessKeyID = ins.AccessKey().Id()
+			user.Status.CredentialSink = externalCredentialSink(user.Spec.CredentialSink).DeepCopy()
+			if err := r.Status().Update(ctx, &user); err != nil {
+				return ctrl.Result{}, err
+			}
 		}
 	} else {
-		sec := &v1.Secret{}
-		if err = r.Client.Get(ctx, client.ObjectKey{Name: accessKeySecret, Namespace: user.Namespace}, sec); client.IgnoreNotFound(err) != nil {
+		if ref := user.Status.ProgrammaticAccessSecret; ref.Name != "" {
+			accessKeySecret = ref.Name
+		}
+		data, err := writtenSink.Read(ctx, accessKeySecret)
+		if err != nil {
 			return ctrl.Result{}, err
 		}
-		if !errors.IsNotFound(err) {
-			if err = r.Client.Delete(ctx, sec); client.IgnoreNotFound(err) != nil {
+		if data != nil {
+			if err = writtenSink.Delete(ctx, accessKeySecret); err != nil {
 				return ctrl.Result{}, err
 			}
+			r.Recorder.Eventf(&user, v1.EventTypeNormal, SecretDeletedEventReason, "deleted access key %s", writtenSink.Location(accessKeySecret))
 			user.Status.ProgrammaticAccessCreated = false
 			user.Status.ProgrammaticAccessSecret = v1.SecretReference{}
-			r.Status().Update(ctx, &user)
+			user.Status.ProgrammaticAccessSecretHash = ""
+			user.Status.AccessKeyIssuedAt = nil
+			user.Status.AccessKeyID = ""
+			if err := r.Status().Update(ctx, &user); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+	}
+
+	// report, whether the credentials had to be issued again
+	if user.Spec.CreateLoginProfile || user.Spec.CreateProgrammaticAccess {
+		cond := metav1.Condition{
+			Type:               iamv1beta1.CredentialSecretsInSyncCondition,
+			Status:             metav1.ConditionTrue,
+			ObservedGeneration: user.Generation,
+			Reason:             CredentialSecretsInSyncReason,
 		}
+		if staleLogin != "" || staleAccessKey != "" {
+			cond.Reason = CredentialsRegeneratedReason
+			cond.Message = regeneratedMessage(&user, staleLoginLocation, staleLogin, staleAccessKeyLocation, staleAccessKey, revoked)
+			r.Recorder.Event(&user, v1.EventTypeWarning, CredentialsRegeneratedEventReason, cond.Message)
+		}
+		setStatusCondition(&user, cond)
+	} else {
+		meta.RemoveStatusCondition(&user.Status.Conditions, iamv1beta1.CredentialSecretsInSyncCondition)
+	}
+
+	// all credentials are in their Secrets now
+	user.Status.PendingIssuance = nil
+	user.Status.CredentialSecret = writtenCredentialSecret(&user)
+	if !user.Status.LoginProfileCreated && !user.Status.ProgrammaticAccessCreated {
+		user.Status.CredentialSink = nil
+		user.Status.CredentialSecret = nil
+	}
+
+	if err := r.syncCredentialSecretReplicas(ctx, &user); err != nil {
+		log.Error(err, "unable to replicate Secrets of User")
+		return ctrl.Result{}, errWithStatus(ctx, &user, err, r.Status(), r.Recorder)
 	}
 
 	user.Status.ObservedGeneration = user.ObjectMeta.Generation
-	r.Status().Update(ctx, &user)
+	markReconcileRequestHandled(&user)
+	if err := r.Status().Update(ctx, &user); err != nil {
+		return ctrl.Result{}, err
+	}
 
 	log.Info(fmt.Sprintf("Created User '%s'", user.Status.ARN))
 	return ctrl.Result{}, nil
 }
 
+// beginCredentialIssuance records in the status of the User, that credentials are about to be issued, together with
+// the access keys the IAM user has before. If a previous issuance did not get to write all credentials to their
+// Secrets, the access keys it issued are revoked first, as nobody has their secrets; their IDs are returned. An
+// existing login profile is deleted, as only a new one lets us know its password.
+func (r *UserReconciler) beginCredentialIssuance(ctx context.Context, svc iamiface.IAMAPI, user *iamv1beta1.User, userName string) ([]string, error) {
+	var stray []string
+	if pending := user.Status.PendingIssuance; pending != nil {
+		prior := map[string]bool{}
+		for _, id := range pending.PriorAccessKeyIDs {
+			prior[id] = true
+		}
+		var err error
+		stray, err = revokeAccessKeys(svc, userName, func(id string) bool {
+			return !prior[id] && !(user.Status.ProgrammaticAccessCreated && id == user.Status.AccessKeyID)
+		})
+		if err != nil {
+			return stray, err
+		}
+	}
+
+	issueLogin := user.Spec.CreateLoginProfile && !user.Status.LoginProfileCreated
+	issueAccessKey := user.Spec.CreateProgrammaticAccess && !user.Status.ProgrammaticAccessCreated
+	if !issueLogin && !issueAccessKey {
+		return stray, nil
+	}
+	if issueLogin {
+		if err := deleteLoginProfile(svc, userName); err != nil {
+			return stray, err
+		}
+	}
+	prior, err := accessKeyIDs(svc, userName)
+	if err != nil {
+		return stray, err
+	}
+	user.Status.PendingIssuance = &iamv1beta1.CredentialIssuance{StartedAt: metav1.Now(), PriorAccessKeyIDs: prior}
+	return stray, r.Status().Update(ctx, user)
+}
+
 func (r *UserReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&iamv1beta1.User{}).
+		Owns(&v1.Secret{}).
+		Watches(&source.Kind{Type: &v1.Secret{}},
+			handler.EnqueueRequestsFromMapFunc(requestsForReplicatedSecret)).
+		Watches(&source.Kind{Type: &v1.Namespace{}},
+			handler.EnqueueRequestsFromMapFunc(requestsForReplicaNamespace(r.Client))).
+		Watches(&source.Kind{Type: &iamv1beta1.ReferenceGrant{}},
+			handler.EnqueueRequestsFromMapFunc(requestsForReferenceGrant(r.Client, &iamv1beta1.UserList{}, "User"))).
 		Complete(r)
 }
 
 // Returns a function, that does everything necessary before we can delete our actual User (cleanup)
 func userCleanup(r *UserReconciler, ctx context.Context, user iamv1beta1.User) func() error {
 	return func() error {
-		attachments := iamv1beta1.PolicyAttachmentList{}
-		if err := r.List(ctx, &attachments); err != nil {
+		attachments, err := listPolicyAttachments(ctx, r, policyAttachmentTargetIndex, targetIndexKey(iamv1beta1.UserTargetType, user.Namespace, user.Name))
+		if err != nil {
 			return err
 		}
-		for _, att := range attachments.Items {
-			if att.Spec.TargetReference.Type == iamv1beta1.UserTargetType {
-				if att.Spec.TargetReference.Name == user.Name && att.Spec.TargetReference.Namespace == user.Namespace {
-					err := fmt.Errorf("cannot delete User due to existing PolicyAttachment '%s/%s'", att.Name, att.Namespace)
-					return err
-				}
-			}
+		if len(attachments) > 0 {
+			att := attachments[0]
+			err := fmt.Errorf("cannot delete User due to existing PolicyAttachment '%s/%s'", att.Name, att.Namespace)
+			return err
 		}
-
 		return nil
 	}
 }
-
-func userSecret(data map[string]string, name, namespace string) *v1.Secret {
-	return &v1.Secret{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      name,
-			Namespace: namespace,
-		},
-		StringData: data,
-		Type:       v1.SecretTypeOpaque,
-	}
-}
@@ -17,9 +17,11 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/redradrat/cloud-objects/aws"
@@ -29,10 +31,16 @@ import (
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
 
 	awsiamv1beta1 "github.com/redradrat/aws-iam-operator/api/v1beta1"
 	iamv1beta1 "github.com/redradrat/aws-iam-operator/api/v1beta1"
 	"github.com/redradrat/aws-iam-operator/controllers"
+	"github.com/redradrat/aws-iam-operator/pkg/limits"
+	"github.com/redradrat/aws-iam-operator/pkg/sinks"
+	"github.com/redradrat/aws-iam-operator/pkg/templating"
+	"github.com/redradrat/aws-iam-operator/webhooks"
 	// +kubebuilder:scaffold:imports
 )
 
@@ -56,18 +64,54 @@ func main() {
 	var region string
 	var oidcProviderARN string
 	var resourcePrefix string
+	var clusterName string
+	var accountID string
 	var enableLeaderElection bool
+	var enableWebhooks bool
+	var enablePodIdentityWebhook bool
+	var discoverOIDCProvider bool
+	var dryRun bool
+	var maxTrustPolicySize int
+	var maxAttachedPolicies int
 	var requeueInterval time.Duration
+	var vaultConfig sinks.VaultConfig
+	var vaultTokenFile string
+	var adoptionNamespaces string
+	awsClientOptions := controllers.DefaultAWSClientOptions()
 	flag.StringVar(&metricsAddr, "metrics-addr", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&region, "region", "eu-west-1", "The AWS region to use.")
 	flag.StringVar(&oidcProviderARN, "oidc-provider-arn", "", "The ARN for the identity provider to use for injecting IRSA trust statements.")
+	flag.BoolVar(&discoverOIDCProvider, "discover-oidc-provider", false, "Derive the ARN of the identity provider for IRSA from the service account issuer of the cluster. Must match --oidc-provider-arn, if both are given.")
 	flag.DurationVar(&requeueInterval, "requeue-interaval", 30*time.Second, "The requeue interval to use do reconcile specific resources.")
 	flag.StringVar(&resourcePrefix, "resource-prefix", "", "A prefix to prepend to all created AWS resources.")
+	flag.StringVar(&clusterName, "cluster-name", "", "The name of the cluster, which ${operator:clusterName} in policies expands to.")
+	flag.StringVar(&accountID, "account-id", "", "The ID of the AWS account, which ${aws:accountId} in policies expands to. Determined through STS, if not given.")
+	flag.Float64Var(&awsClientOptions.QPS, "aws-api-qps", awsClientOptions.QPS, "The maximum sustained rate of AWS API requests per second.")
+	flag.IntVar(&awsClientOptions.Burst, "aws-api-burst", awsClientOptions.Burst, "The maximum burst of AWS API requests.")
+	flag.IntVar(&awsClientOptions.MaxRetries, "aws-max-retries", awsClientOptions.MaxRetries, "The maximum number of retries for throttled or failed AWS API requests.")
+	flag.DurationVar(&awsClientOptions.ThrottleRequeueDelay, "aws-throttle-requeue-delay", awsClientOptions.ThrottleRequeueDelay, "The delay after which a resource is reconciled again, when it was throttled by AWS.")
+	flag.IntVar(&maxTrustPolicySize, "max-trust-policy-size", limits.DefaultTrustPolicySizeLimit, "The maximum size of role trust policies in characters, as configured in the IAM quotas of the account.")
+	flag.IntVar(&maxAttachedPolicies, "max-attached-policies", limits.DefaultAttachedPoliciesLimit, "The maximum number of policies attached to a role, user or group, as configured in the IAM quotas of the account.")
+	flag.BoolVar(&dryRun, "dry-run", false, "Only plan the AWS operations for all resources and record them in their status and Events, instead of executing them.")
+	flag.StringVar(&adoptionNamespaces, "adoption-namespaces", "", "A comma-separated list of namespaces, in which resources may adopt existing IAM objects with the adopt annotation, or \"*\" for all namespaces. Adoption is disabled by default.")
+	flag.BoolVar(&enableWebhooks, "enable-webhooks", false, "Serve the admission webhooks e.g. for enforcing IAMConstraints. Requires a serving certificate.")
+	flag.BoolVar(&enablePodIdentityWebhook, "enable-pod-identity-webhook", false, "Serve the pod mutating webhook injecting IRSA credentials, for clusters without the EKS pod identity webhook. Requires a serving certificate.")
+	flag.StringVar(&vaultConfig.Address, "vault-address", os.Getenv("VAULT_ADDR"), "The address of the Vault server, which users can write their credentials to.")
+	flag.StringVar(&vaultTokenFile, "vault-token-file", "", "A file holding the Vault token. Defaults to the VAULT_TOKEN environment variable.")
+	flag.StringVar(&vaultConfig.KubernetesRole, "vault-kubernetes-role", "", "The role to log in to Vault with through its Kubernetes auth method, instead of a token.")
+	flag.StringVar(&vaultConfig.KubernetesAuthMount, "vault-kubernetes-auth-mount", "kubernetes", "The mount path of the Kubernetes auth method of Vault.")
 	flag.BoolVar(&enableLeaderElection, "enable-leader-election", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
 	flag.Parse()
 
+	var adoption controllers.AdoptionPolicy
+	for _, ns := range strings.Split(adoptionNamespaces, ",") {
+		if ns = strings.TrimSpace(ns); ns != "" {
+			adoption.Namespaces = append(adoption.Namespaces, ns)
+		}
+	}
+
 	ctrl.SetLogger(zap.New(zap.UseDevMode(true)))
 
 	ctrl.Log.Info(fmt.Sprintf("aws-iam-operator version: %s (built: %s)", operatorversion, operatorbuilddate))
@@ -79,7 +123,52 @@ func main() {
 		}
 	}
 
-	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
+	controllers.ConfigureAWSClients(awsClientOptions)
+
+	var vaultClient *sinks.VaultClient
+	if vaultConfig.Address != "" {
+		vaultConfig.Token = os.Getenv("VAULT_TOKEN")
+		if vaultTokenFile != "" {
+			token, err := os.ReadFile(vaultTokenFile)
+			if err != nil {
+				setupLog.Error(err, "unable to read the vault token file. exiting...")
+				os.Exit(1)
+			}
+			vaultConfig.Token = strings.TrimSpace(string(token))
+		}
+		vaultClient = sinks.NewVaultClient(vaultConfig)
+	}
+
+	if accountID == "" {
+		var err error
+		if accountID, err = controllers.AccountID(region); err != nil {
+			setupLog.Error(err, "unable to determine the AWS account ID, policies using ${aws:accountId} cannot be reconciled")
+		}
+	}
+	templateValues := templating.Values{AccountID: accountID, ClusterName: clusterName, Prefix: resourcePrefix}
+
+	restConfig := ctrl.GetConfigOrDie()
+	if discoverOIDCProvider {
+		issuer, err := controllers.ServiceAccountIssuer(context.Background(), restConfig)
+		if err != nil {
+			setupLog.Error(err, "unable to discover the service account issuer. exiting...")
+			os.Exit(1)
+		}
+		discovered, err := controllers.OIDCProviderARN(issuer, accountID, region)
+		if err != nil {
+			setupLog.Error(err, "unable to derive the oidc provider arn. exiting...")
+			os.Exit(1)
+		}
+		if oidcProviderARN != "" && oidcProviderARN != discovered {
+			setupLog.Error(fmt.Errorf("--oidc-provider-arn is '%s', but the service account issuer '%s' of the cluster is provider '%s'", oidcProviderARN, issuer, discovered),
+				"given oidc provider arn does not match the cluster. exiting...")
+			os.Exit(1)
+		}
+		oidcProviderARN = discovered
+		setupLog.Info("discovered oidc provider", "issuer", issuer, "arn", oidcProviderARN)
+	}
+
+	mgr, err := ctrl.NewManager(restConfig, ctrl.Options{
 		Scheme:             scheme,
 		MetricsBindAddress: metricsAddr,
 		Port:               9443,
@@ -91,14 +180,24 @@ func main() {
 		os.Exit(1)
 	}
 
+	if err = controllers.SetupFieldIndexes(context.Background(), mgr.GetFieldIndexer()); err != nil {
+		setupLog.Error(err, "unable to set up field indexes")
+		os.Exit(1)
+	}
+
 	if err = (&controllers.RoleReconciler{
-		Client:          mgr.GetClient(),
-		Interval:        requeueInterval,
-		Log:             ctrl.Log.WithName("controllers").WithName("Role"),
-		Region:          region,
-		Scheme:          mgr.GetScheme(),
-		ResourcePrefix:  resourcePrefix,
-		OidcProviderARN: oidcProviderARN,
+		Client:             mgr.GetClient(),
+		Interval:           requeueInterval,
+		Log:                ctrl.Log.WithName("controllers").WithName("Role"),
+		Region:             region,
+		Scheme:             mgr.GetScheme(),
+		Recorder:           mgr.GetEventRecorderFor("role-controller"),
+		ResourcePrefix:     resourcePrefix,
+		OidcProviderARN:    oidcProviderARN,
+		MaxTrustPolicySize: maxTrustPolicySize,
+		DryRun:             dryRun,
+		Adoption:           adoption,
+		TemplateValues:     templateValues,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Role")
 		os.Exit(1)
@@ -108,16 +207,23 @@ func main() {
 		Log:            ctrl.Log.WithName("controllers").WithName("Policy"),
 		Region:         region,
 		Scheme:         mgr.GetScheme(),
+		Recorder:       mgr.GetEventRecorderFor("policy-controller"),
 		ResourcePrefix: resourcePrefix,
+		DryRun:         dryRun,
+		Adoption:       adoption,
+		TemplateValues: templateValues,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Policy")
 		os.Exit(1)
 	}
 	if err = (&controllers.PolicyAttachmentReconciler{
-		Client: mgr.GetClient(),
-		Log:    ctrl.Log.WithName("controllers").WithName("PolicyAttachment"),
-		Region: region,
-		Scheme: mgr.GetScheme(),
+		Client:              mgr.GetClient(),
+		Log:                 ctrl.Log.WithName("controllers").WithName("PolicyAttachment"),
+		Region:              region,
+		Scheme:              mgr.GetScheme(),
+		Recorder:            mgr.GetEventRecorderFor("policyattachment-controller"),
+		MaxAttachedPolicies: maxAttachedPolicies,
+		DryRun:              dryRun,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "PolicyAttachment")
 		os.Exit(1)
@@ -127,7 +233,10 @@ func main() {
 		Log:            ctrl.Log.WithName("controllers").WithName("Group"),
 		Region:         region,
 		Scheme:         mgr.GetScheme(),
+		Recorder:       mgr.GetEventRecorderFor("group-controller"),
 		ResourcePrefix: resourcePrefix,
+		DryRun:         dryRun,
+		Adoption:       adoption,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Group")
 		os.Exit(1)
@@ -137,13 +246,49 @@ func main() {
 		Log:            ctrl.Log.WithName("controllers").WithName("User"),
 		Region:         region,
 		Scheme:         mgr.GetScheme(),
+		Recorder:       mgr.GetEventRecorderFor("user-controller"),
 		ResourcePrefix: resourcePrefix,
+		DryRun:         dryRun,
+		Adoption:       adoption,
+		Vault:          vaultClient,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "User")
 		os.Exit(1)
 	}
 	// +kubebuilder:scaffold:builder
 
+	if enableWebhooks {
+		mgr.GetWebhookServer().Register(webhooks.ConstraintValidatorPath, &webhook.Admission{Handler: &webhooks.ConstraintValidator{
+			Client:          mgr.GetClient(),
+			OidcProviderARN: oidcProviderARN,
+			TemplateValues:  templateValues,
+		}})
+		mgr.GetWebhookServer().Register(webhooks.LintValidatorPath, &webhook.Admission{Handler: &webhooks.LintValidator{
+			Client:          mgr.GetClient(),
+			OidcProviderARN: oidcProviderARN,
+			Region:          region,
+			TemplateValues:  templateValues,
+		}})
+		mgr.GetWebhookServer().Register(webhooks.LimitValidatorPath, &webhook.Admission{Handler: &webhooks.LimitValidator{
+			Client:              mgr.GetClient(),
+			OidcProviderARN:     oidcProviderARN,
+			MaxTrustPolicySize:  maxTrustPolicySize,
+			MaxAttachedPolicies: maxAttachedPolicies,
+			TemplateValues:      templateValues,
+		}})
+	}
+	if enablePodIdentityWebhook {
+		mgr.GetWebhookServer().Register(webhooks.PodIdentityMutatorPath, &webhook.Admission{Handler: &webhooks.PodIdentityMutator{
+			Client: mgr.GetClient(),
+			Region: region,
+		}})
+	}
+
+	if err := metrics.Registry.Register(controllers.NewResourceCollector(mgr.GetClient())); err != nil {
+		setupLog.Error(err, "unable to register metrics collector")
+		os.Exit(1)
+	}
+
 	setupLog.Info("starting manager")
 	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
 		setupLog.Error(err, "problem running manager")
@@ -0,0 +1,299 @@
+// Package constraints evaluates IAM policy documents against IAMConstraints and ClusterIAMConstraints.
+package constraints
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/redradrat/cloud-objects/aws/iam"
+
+	iamv1beta1 "github.com/redradrat/aws-iam-operator/api/v1beta1"
+)
+
+// Constraint is a constraint spec together with the name of the resource it originates from
+type Constraint struct {
+	Name string
+	Spec iamv1beta1.IAMConstraintSpec
+}
+
+// Violation is a single violation of a constraint by a policy document
+type Violation struct {
+	Constraint  string
+	Enforcement iamv1beta1.ConstraintEnforcement
+	Message     string
+}
+
+func (v Violation) String() string {
+	return fmt.Sprintf("%s: %s", v.Constraint, v.Message)
+}
+
+// Result holds all violations of a policy document, split by their enforcement
+type Result struct {
+	Denied []Violation
+	Warned []Violation
+}
+
+// Ok returns true, if there are no violations at all
+func (r Result) Ok() bool {
+	return len(r.Denied) == 0 && len(r.Warned) == 0
+}
+
+// Error returns an error describing all denied violations, or nil if there are none
+func (r Result) Error() error {
+	if len(r.Denied) == 0 {
+		return nil
+	}
+	return fmt.Errorf("policy violates constraints: %s", joinViolations(r.Denied))
+}
+
+// Warnings returns a message for every warned violation
+func (r Result) Warnings() []string {
+	var warnings []string
+	for _, v := range r.Warned {
+		warnings = append(warnings, v.String())
+	}
+	return warnings
+}
+
+func joinViolations(violations []Violation) string {
+	var msgs []string
+	for _, v := range violations {
+		msgs = append(msgs, v.String())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// ForNamespace returns all constraints, which apply to resources in the given namespace. These are the IAMConstraints
+// in the namespace, and the ClusterIAMConstraints selecting it.
+func ForNamespace(ctx context.Context, c client.Reader, namespace string) ([]Constraint, error) {
+	var constraints []Constraint
+
+	nsConstraints := iamv1beta1.IAMConstraintList{}
+	if err := c.List(ctx, &nsConstraints, client.InNamespace(namespace)); err != nil {
+		return nil, err
+	}
+	for i := range nsConstraints.Items {
+		constraints = append(constraints, FromIAMConstraint(&nsConstraints.Items[i]))
+	}
+
+	clusterConstraints := iamv1beta1.ClusterIAMConstraintList{}
+	if err := c.List(ctx, &clusterConstraints); err != nil {
+		return nil, err
+	}
+	var ns *v1.Namespace
+	for i, con := range clusterConstraints.Items {
+		if con.Spec.NamespaceSelector != nil {
+			selector, err := metav1.LabelSelectorAsSelector(con.Spec.NamespaceSelector)
+			if err != nil {
+				return nil, fmt.Errorf("invalid namespaceSelector in ClusterIAMConstraint '%s': %w", con.Name, err)
+			}
+			if ns == nil {
+				ns = &v1.Namespace{}
+				if err := c.Get(ctx, client.ObjectKey{Name: namespace}, ns); err != nil {
+					return nil, err
+				}
+			}
+			if !selector.Matches(labels.Set(ns.Labels)) {
+				continue
+			}
+		}
+		constraints = append(constraints, FromClusterIAMConstraint(&clusterConstraints.Items[i]))
+	}
+
+	return constraints, nil
+}
+
+// FromIAMConstraint returns the Constraint of the given IAMConstraint
+func FromIAMConstraint(con *iamv1beta1.IAMConstraint) Constraint {
+	return Constraint{
+		Name: fmt.Sprintf("IAMConstraint '%s/%s'", con.Namespace, con.Name),
+		Spec: con.Spec,
+	}
+}
+
+// FromClusterIAMConstraint returns the Constraint of the given ClusterIAMConstraint, regardless of its namespaceSelector
+func FromClusterIAMConstraint(con *iamv1beta1.ClusterIAMConstraint) Constraint {
+	return Constraint{
+		Name: fmt.Sprintf("ClusterIAMConstraint '%s'", con.Name),
+		Spec: con.Spec.IAMConstraintSpec,
+	}
+}
+
+// Check evaluates the given policy document against all constraints applying to the given namespace. If trust is true,
+// the document is treated as a trust (assume role) policy. If raw is true, the document is the approximation of a raw
+// document, see Evaluate.
+func Check(ctx context.Context, c client.Reader, namespace string, doc iam.PolicyDocument, trust, raw bool) (Result, error) {
+	constraints, err := ForNamespace(ctx, c, namespace)
+	if err != nil {
+		return Result{}, err
+	}
+	return EvaluateAll(doc, trust, raw, constraints), nil
+}
+
+// CheckManagedPolicy evaluates the ARN of a managed policy, which is attached by a PolicyAttachment, against all
+// constraints applying to the given namespace
+func CheckManagedPolicy(ctx context.Context, c client.Reader, namespace string, arn string) (Result, error) {
+	constraints, err := ForNamespace(ctx, c, namespace)
+	if err != nil {
+		return Result{}, err
+	}
+	return EvaluateAllManagedPolicy(arn, constraints), nil
+}
+
+// EvaluateAll evaluates the given policy document against all given constraints
+func EvaluateAll(doc iam.PolicyDocument, trust, raw bool, constraints []Constraint) Result {
+	return evaluateAll(constraints, func(con Constraint) []Violation { return Evaluate(doc, trust, raw, con) })
+}
+
+// EvaluateAllManagedPolicy evaluates the ARN of an attached managed policy against all given constraints
+func EvaluateAllManagedPolicy(arn string, constraints []Constraint) Result {
+	return evaluateAll(constraints, func(con Constraint) []Violation { return EvaluateManagedPolicy(arn, con) })
+}
+
+// evaluateAll collects the violations of all given constraints, split by their enforcement
+func evaluateAll(constraints []Constraint, evaluate func(Constraint) []Violation) Result {
+	result := Result{}
+	for _, con := range constraints {
+		for _, v := range evaluate(con) {
+			if v.Enforcement == iamv1beta1.WarnConstraintEnforcement {
+				result.Warned = append(result.Warned, v)
+			} else {
+				result.Denied = append(result.Denied, v)
+			}
+		}
+	}
+	return result
+}
+
+// enforcement returns the enforcement of the constraint, which defaults to Deny
+func (con Constraint) enforcement() iamv1beta1.ConstraintEnforcement {
+	if con.Spec.Enforcement == "" {
+		return iamv1beta1.DenyConstraintEnforcement
+	}
+	return con.Spec.Enforcement
+}
+
+// EvaluateManagedPolicy returns the violations of the given constraint by attaching the managed policy with the given
+// ARN. Managed policies are matched by their ARN, as their documents are not known.
+func EvaluateManagedPolicy(arn string, con Constraint) []Violation {
+	var violations []Violation
+	violate := func(format string, args ...interface{}) {
+		violations = append(violations, Violation{
+			Constraint:  con.Name,
+			Enforcement: con.enforcement(),
+			Message:     fmt.Sprintf(format, args...),
+		})
+	}
+
+	for _, denied := range con.Spec.DeniedManagedPolicies {
+		if match(denied, arn) {
+			violate("managed policy '%s' is denied by pattern '%s'", arn, denied)
+		}
+	}
+	if len(con.Spec.AllowedManagedPolicies) > 0 && !matchesAny(con.Spec.AllowedManagedPolicies, arn, match) {
+		violate("managed policy '%s' is not allowed", arn)
+	}
+	return violations
+}
+
+// Evaluate returns all violations of the given constraint by the given policy document. Only Allow statements are
+// evaluated, as Deny statements can only reduce permissions. Violations name the statement by its index, unless raw is
+// true: the statements of the approximation of a raw document don't line up with the ones of the raw document, as
+// statements with several principals are repeated for every further principal.
+func Evaluate(doc iam.PolicyDocument, trust, raw bool, con Constraint) []Violation {
+	enforcement := con.enforcement()
+
+	var violations []Violation
+	violate := func(stmt int, format string, args ...interface{}) {
+		msg := fmt.Sprintf(format, args...)
+		if !raw {
+			msg = fmt.Sprintf("statement %d: %s", stmt, msg)
+		}
+		violations = append(violations, Violation{
+			Constraint:  con.Name,
+			Enforcement: enforcement,
+			Message:     msg,
+		})
+	}
+
+	for i, stmt := range doc.Statement {
+		if stmt.Effect != iamv1beta1.AllowPolicyStatementEffect.String() {
+			continue
+		}
+
+		for _, action := range stmt.Action {
+			for _, denied := range con.Spec.DeniedActions {
+				// the action may be a wildcard itself, so it's denied if it could grant any of the denied actions
+				if matchAction(denied, action) || matchAction(action, denied) {
+					violate(i, "action '%s' is denied by pattern '%s'", action, denied)
+				}
+			}
+			if len(con.Spec.AllowedActions) > 0 && !matchesAny(con.Spec.AllowedActions, action, matchAction) {
+				violate(i, "action '%s' is not allowed", action)
+			}
+		}
+
+		if !trust && len(con.Spec.AllowedResources) > 0 {
+			for _, resource := range stmt.Resource {
+				if !matchesAny(con.Spec.AllowedResources, resource, match) {
+					violate(i, "resource '%s' is not allowed", resource)
+				}
+			}
+		}
+
+		for _, req := range con.Spec.RequiredConditions {
+			values, ok := stmt.Condition[string(req.Operator)][string(req.Key)]
+			if !ok {
+				violate(i, "required condition '%s' on '%s' is missing", req.Operator, req.Key)
+				continue
+			}
+			if len(req.Values) > 0 {
+				for _, value := range values {
+					if !matchesAny(req.Values, value, match) {
+						violate(i, "value '%s' of condition '%s' on '%s' is not allowed", value, req.Operator, req.Key)
+					}
+				}
+			}
+		}
+
+		if trust && len(con.Spec.AllowedPrincipals) > 0 {
+			for _, principal := range stmt.Principal {
+				if !matchesAny(con.Spec.AllowedPrincipals, principal, match) {
+					violate(i, "principal '%s' is not allowed", principal)
+				}
+			}
+		}
+	}
+
+	return violations
+}
+
+func matchesAny(patterns []string, value string, matchFunc func(pattern, value string) bool) bool {
+	for _, pattern := range patterns {
+		if matchFunc(pattern, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchAction matches IAM actions, which are case-insensitive
+func matchAction(pattern, action string) bool {
+	return match(strings.ToLower(pattern), strings.ToLower(action))
+}
+
+// match returns true, if the value matches the pattern. The pattern may contain the IAM wildcards '*' (any sequence of
+// characters) and '?' (any single character).
+func match(pattern, value string) bool {
+	expr := regexp.QuoteMeta(pattern)
+	expr = strings.ReplaceAll(expr, `\*`, ".*")
+	expr = strings.ReplaceAll(expr, `\?`, ".")
+	return regexp.MustCompile("^" + expr + "$").MatchString(value)
+}
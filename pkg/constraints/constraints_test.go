@@ -0,0 +1,354 @@
+package constraints
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/redradrat/cloud-objects/aws/iam"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	iamv1beta1 "github.com/redradrat/aws-iam-operator/api/v1beta1"
+	"github.com/redradrat/aws-iam-operator/pkg/document"
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		value   string
+		want    bool
+	}{
+		{pattern: "s3:GetObject", value: "s3:GetObject", want: true},
+		{pattern: "s3:*", value: "s3:GetObject", want: true},
+		{pattern: "s3:Get*", value: "s3:PutObject", want: false},
+		{pattern: "arn:aws:s3:::bucket-?", value: "arn:aws:s3:::bucket-a", want: true},
+		{pattern: "arn:aws:s3:::bucket-?", value: "arn:aws:s3:::bucket-ab", want: false},
+		{pattern: "arn:aws:s3:::bucket.a", value: "arn:aws:s3:::bucketxa", want: false},
+		{pattern: "arn:aws:s3:::bucket", value: "arn:aws:s3:::bucket/key", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := match(tt.pattern, tt.value); got != tt.want {
+			t.Errorf("match(%s, %s) = %v, want %v", tt.pattern, tt.value, got, tt.want)
+		}
+	}
+
+	if !matchAction("S3:getobject", "s3:GetObject") {
+		t.Error("matchAction() is case-sensitive")
+	}
+	if match("S3:getobject", "s3:GetObject") {
+		t.Error("match() is case-insensitive")
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	tests := []struct {
+		name  string
+		spec  iamv1beta1.IAMConstraintSpec
+		doc   string
+		trust bool
+		want  []string
+	}{
+		{
+			name: "allowed action",
+			spec: iamv1beta1.IAMConstraintSpec{AllowedActions: []string{"s3:Get*", "s3:List*"}},
+			doc:  `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":["s3:GetObject","s3:listbucket"],"Resource":"*"}]}`,
+		},
+		{
+			name: "action not allowed",
+			spec: iamv1beta1.IAMConstraintSpec{AllowedActions: []string{"s3:Get*"}},
+			doc:  `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":["s3:GetObject","s3:PutObject"],"Resource":"*"}]}`,
+			want: []string{"action 's3:PutObject' is not allowed"},
+		},
+		{
+			name: "denied action",
+			spec: iamv1beta1.IAMConstraintSpec{DeniedActions: []string{"iam:*"}},
+			doc:  `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"iam:CreateUser","Resource":"*"}]}`,
+			want: []string{"action 'iam:CreateUser' is denied by pattern 'iam:*'"},
+		},
+		{
+			name: "wildcard action granting a denied action",
+			spec: iamv1beta1.IAMConstraintSpec{DeniedActions: []string{"iam:CreateUser"}},
+			doc:  `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"iam:Create*","Resource":"*"}]}`,
+			want: []string{"action 'iam:Create*' is denied by pattern 'iam:CreateUser'"},
+		},
+		{
+			name: "action not denied",
+			spec: iamv1beta1.IAMConstraintSpec{DeniedActions: []string{"iam:*"}},
+			doc:  `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"s3:*","Resource":"*"}]}`,
+		},
+		{
+			name: "NotAction grants denied actions",
+			spec: iamv1beta1.IAMConstraintSpec{DeniedActions: []string{"iam:*"}},
+			doc:  `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","NotAction":"s3:*","Resource":"*"}]}`,
+			want: []string{"action '*' is denied by pattern 'iam:*'"},
+		},
+		{
+			name: "NotAction in a Deny statement is ignored",
+			spec: iamv1beta1.IAMConstraintSpec{AllowedActions: []string{"s3:Get*"}, DeniedActions: []string{"iam:*"}},
+			doc:  `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"s3:GetObject","Resource":"*"},{"Effect":"Deny","NotAction":"s3:GetObject","Resource":"*"}]}`,
+		},
+		{
+			name: "allowed resource",
+			spec: iamv1beta1.IAMConstraintSpec{AllowedResources: []string{"arn:aws:s3:::team-a-*"}},
+			doc:  `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"s3:*","Resource":["arn:aws:s3:::team-a-data","arn:aws:s3:::team-a-data/*"]}]}`,
+		},
+		{
+			name: "resource not allowed",
+			spec: iamv1beta1.IAMConstraintSpec{AllowedResources: []string{"arn:aws:s3:::team-a-*"}},
+			doc:  `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"s3:*","Resource":"arn:aws:s3:::team-b-data"}]}`,
+			want: []string{"resource 'arn:aws:s3:::team-b-data' is not allowed"},
+		},
+		{
+			name: "NotResource grants resources which are not allowed",
+			spec: iamv1beta1.IAMConstraintSpec{AllowedResources: []string{"arn:aws:s3:::team-a-*"}},
+			doc:  `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"s3:*","NotResource":"arn:aws:s3:::team-b-data"}]}`,
+			want: []string{"resource '*' is not allowed"},
+		},
+		{
+			name:  "resources are not checked in trust policies",
+			spec:  iamv1beta1.IAMConstraintSpec{AllowedResources: []string{"arn:aws:s3:::team-a-*"}},
+			doc:   `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"sts:AssumeRole","Principal":"*","Resource":"*"}]}`,
+			trust: true,
+		},
+		{
+			name: "required condition",
+			spec: iamv1beta1.IAMConstraintSpec{RequiredConditions: []iamv1beta1.RequiredCondition{
+				{Operator: "StringEquals", Key: "aws:SourceVpc", Values: []string{"vpc-*"}},
+			}},
+			doc: `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"s3:*","Resource":"*","Condition":{"StringEquals":{"aws:SourceVpc":"vpc-1"}}}]}`,
+		},
+		{
+			name: "required condition is missing",
+			spec: iamv1beta1.IAMConstraintSpec{RequiredConditions: []iamv1beta1.RequiredCondition{
+				{Operator: "StringEquals", Key: "aws:SourceVpc"},
+			}},
+			doc:  `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"s3:*","Resource":"*","Condition":{"StringLike":{"aws:SourceVpc":"*"}}}]}`,
+			want: []string{"required condition 'StringEquals' on 'aws:SourceVpc' is missing"},
+		},
+		{
+			name: "value of required condition not allowed",
+			spec: iamv1beta1.IAMConstraintSpec{RequiredConditions: []iamv1beta1.RequiredCondition{
+				{Operator: "StringEquals", Key: "aws:SourceVpc", Values: []string{"vpc-1"}},
+			}},
+			doc:  `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"s3:*","Resource":"*","Condition":{"StringEquals":{"aws:SourceVpc":["vpc-1","vpc-2"]}}}]}`,
+			want: []string{"value 'vpc-2' of condition 'StringEquals' on 'aws:SourceVpc' is not allowed"},
+		},
+		{
+			name: "required conditions are not checked in Deny statements",
+			spec: iamv1beta1.IAMConstraintSpec{RequiredConditions: []iamv1beta1.RequiredCondition{
+				{Operator: "StringEquals", Key: "aws:SourceVpc"},
+			}},
+			doc: `{"Version":"2012-10-17","Statement":[{"Effect":"Deny","Action":"s3:*","Resource":"*"}]}`,
+		},
+		{
+			name:  "allowed principal",
+			spec:  iamv1beta1.IAMConstraintSpec{AllowedPrincipals: []string{"arn:aws:iam::123456789012:*"}},
+			doc:   `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"sts:AssumeRole","Principal":{"AWS":"arn:aws:iam::123456789012:role/app"}}]}`,
+			trust: true,
+		},
+		{
+			name:  "principal not allowed",
+			spec:  iamv1beta1.IAMConstraintSpec{AllowedPrincipals: []string{"arn:aws:iam::123456789012:*"}},
+			doc:   `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"sts:AssumeRole","Principal":{"AWS":["arn:aws:iam::123456789012:root","arn:aws:iam::210987654321:root"]}}]}`,
+			trust: true,
+			want:  []string{"principal 'arn:aws:iam::210987654321:root' is not allowed"},
+		},
+		{
+			name:  "NotPrincipal allows principals which are not allowed",
+			spec:  iamv1beta1.IAMConstraintSpec{AllowedPrincipals: []string{"arn:aws:iam::123456789012:*"}},
+			doc:   `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"sts:AssumeRole","NotPrincipal":{"AWS":"arn:aws:iam::210987654321:root"}}]}`,
+			trust: true,
+			want:  []string{"principal '*' is not allowed"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := document.Parse([]byte(tt.doc))
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+
+			var got []string
+			for _, v := range Evaluate(doc.Typed(), tt.trust, true, Constraint{Name: "test", Spec: tt.spec}) {
+				if v.Constraint != "test" || v.Enforcement != iamv1beta1.DenyConstraintEnforcement {
+					t.Errorf("violation %+v, want constraint 'test' with enforcement Deny", v)
+				}
+				got = append(got, v.Message)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Evaluate() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvaluateStatementIndex(t *testing.T) {
+	doc := iam.PolicyDocument{Version: "2012-10-17", Statement: []iam.StatementEntry{
+		{Effect: "Allow", Action: []string{"s3:GetObject"}, Resource: []string{"*"}},
+		{Effect: "Allow", Action: []string{"iam:CreateUser"}, Resource: []string{"*"}},
+	}}
+	con := Constraint{Name: "test", Spec: iamv1beta1.IAMConstraintSpec{DeniedActions: []string{"iam:*"}}}
+
+	violations := Evaluate(doc, false, false, con)
+	if len(violations) != 1 || violations[0].Message != "statement 1: action 'iam:CreateUser' is denied by pattern 'iam:*'" {
+		t.Errorf("Evaluate() = %+v, want a violation of statement 1", violations)
+	}
+}
+
+func TestEvaluateManagedPolicy(t *testing.T) {
+	const admin = "arn:aws:iam::aws:policy/AdministratorAccess"
+	const readOnly = "arn:aws:iam::aws:policy/ReadOnlyAccess"
+
+	tests := []struct {
+		name string
+		spec iamv1beta1.IAMConstraintSpec
+		arn  string
+		want []string
+	}{
+		{
+			name: "no managed policy rules",
+			arn:  admin,
+		},
+		{
+			name: "allowed managed policy",
+			spec: iamv1beta1.IAMConstraintSpec{AllowedManagedPolicies: []string{"arn:aws:iam::aws:policy/*ReadOnly*"}},
+			arn:  readOnly,
+		},
+		{
+			name: "managed policy not allowed",
+			spec: iamv1beta1.IAMConstraintSpec{AllowedManagedPolicies: []string{"arn:aws:iam::aws:policy/*ReadOnly*"}},
+			arn:  admin,
+			want: []string{"managed policy '" + admin + "' is not allowed"},
+		},
+		{
+			name: "denied managed policy",
+			spec: iamv1beta1.IAMConstraintSpec{DeniedManagedPolicies: []string{admin}},
+			arn:  admin,
+			want: []string{"managed policy '" + admin + "' is denied by pattern '" + admin + "'"},
+		},
+		{
+			name: "managed policy not denied",
+			spec: iamv1beta1.IAMConstraintSpec{DeniedManagedPolicies: []string{admin}},
+			arn:  readOnly,
+		},
+		{
+			name: "denied and not allowed",
+			spec: iamv1beta1.IAMConstraintSpec{
+				AllowedManagedPolicies: []string{"arn:aws:iam::123456789012:policy/*"},
+				DeniedManagedPolicies:  []string{"arn:aws:iam::aws:policy/*"},
+			},
+			arn: readOnly,
+			want: []string{
+				"managed policy '" + readOnly + "' is denied by pattern 'arn:aws:iam::aws:policy/*'",
+				"managed policy '" + readOnly + "' is not allowed",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, v := range EvaluateManagedPolicy(tt.arn, Constraint{Name: "test", Spec: tt.spec}) {
+				got = append(got, v.Message)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("EvaluateManagedPolicy() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvaluateAllEnforcement(t *testing.T) {
+	doc := iam.PolicyDocument{Version: "2012-10-17", Statement: []iam.StatementEntry{
+		{Effect: "Allow", Action: []string{"iam:CreateUser"}, Resource: []string{"*"}},
+	}}
+	constraints := []Constraint{
+		{Name: "default", Spec: iamv1beta1.IAMConstraintSpec{DeniedActions: []string{"iam:*"}}},
+		{Name: "deny", Spec: iamv1beta1.IAMConstraintSpec{DeniedActions: []string{"iam:Create*"}, Enforcement: iamv1beta1.DenyConstraintEnforcement}},
+		{Name: "warn", Spec: iamv1beta1.IAMConstraintSpec{AllowedActions: []string{"s3:*"}, Enforcement: iamv1beta1.WarnConstraintEnforcement}},
+		{Name: "satisfied", Spec: iamv1beta1.IAMConstraintSpec{AllowedActions: []string{"iam:*"}}},
+	}
+
+	result := EvaluateAll(doc, false, false, constraints)
+	if len(result.Denied) != 2 || result.Denied[0].Constraint != "default" || result.Denied[1].Constraint != "deny" {
+		t.Errorf("denied = %+v, want the violations of 'default' and 'deny'", result.Denied)
+	}
+	if want := []string{"warn: statement 0: action 'iam:CreateUser' is not allowed"}; !reflect.DeepEqual(result.Warnings(), want) {
+		t.Errorf("Warnings() = %q, want %q", result.Warnings(), want)
+	}
+	if result.Ok() || result.Error() == nil {
+		t.Errorf("result with violations is Ok() = %v, Error() = %v", result.Ok(), result.Error())
+	}
+
+	warned := EvaluateAllManagedPolicy("arn:aws:iam::aws:policy/AdministratorAccess", constraints[2:])
+	if warned.Error() != nil || len(warned.Warned) != 0 || !warned.Ok() {
+		t.Errorf("managed policy result = %+v, want no violations", warned)
+	}
+	warned = EvaluateAllManagedPolicy("arn:aws:iam::aws:policy/AdministratorAccess", []Constraint{
+		{Name: "warn", Spec: iamv1beta1.IAMConstraintSpec{DeniedManagedPolicies: []string{"*Administrator*"}, Enforcement: iamv1beta1.WarnConstraintEnforcement}},
+	})
+	if warned.Error() != nil || len(warned.Warned) != 1 || warned.Ok() {
+		t.Errorf("managed policy result = %+v, want a single warning", warned)
+	}
+}
+
+func TestForNamespace(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := iamv1beta1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	spec := iamv1beta1.IAMConstraintSpec{DeniedManagedPolicies: []string{"arn:aws:iam::aws:policy/AdministratorAccess"}}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-a", Labels: map[string]string{"tier": "prod"}}},
+		&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-b"}},
+		&iamv1beta1.IAMConstraint{ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "local"}, Spec: spec},
+		&iamv1beta1.IAMConstraint{ObjectMeta: metav1.ObjectMeta{Namespace: "team-b", Name: "other"}, Spec: spec},
+		&iamv1beta1.ClusterIAMConstraint{ObjectMeta: metav1.ObjectMeta{Name: "all"}, Spec: iamv1beta1.ClusterIAMConstraintSpec{IAMConstraintSpec: spec}},
+		&iamv1beta1.ClusterIAMConstraint{ObjectMeta: metav1.ObjectMeta{Name: "prod"}, Spec: iamv1beta1.ClusterIAMConstraintSpec{
+			IAMConstraintSpec: spec,
+			NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"tier": "prod"}},
+		}},
+	).Build()
+
+	tests := []struct {
+		namespace string
+		want      []string
+	}{
+		{namespace: "team-a", want: []string{"IAMConstraint 'team-a/local'", "ClusterIAMConstraint 'all'", "ClusterIAMConstraint 'prod'"}},
+		{namespace: "team-b", want: []string{"IAMConstraint 'team-b/other'", "ClusterIAMConstraint 'all'"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.namespace, func(t *testing.T) {
+			constraints, err := ForNamespace(context.Background(), c, tt.namespace)
+			if err != nil {
+				t.Fatalf("ForNamespace() error = %v", err)
+			}
+			var got []string
+			for _, con := range constraints {
+				got = append(got, con.Name)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ForNamespace() = %q, want %q", got, tt.want)
+			}
+
+			result, err := CheckManagedPolicy(context.Background(), c, tt.namespace, "arn:aws:iam::aws:policy/AdministratorAccess")
+			if err != nil {
+				t.Fatalf("CheckManagedPolicy() error = %v", err)
+			}
+			if len(result.Denied) != len(tt.want) {
+				t.Errorf("CheckManagedPolicy() denied = %+v, want a violation of every constraint", result.Denied)
+			}
+		})
+	}
+}
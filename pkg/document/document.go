@@ -0,0 +1,296 @@
+// Package document parses raw JSON policy documents, which are given instead of typed statements. It validates them
+// against the IAM policy grammar, brings them into a canonical form, and approximates them with the typed documents
+// linting and constraints work on.
+package document
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/redradrat/cloud-objects/aws/iam"
+)
+
+// Versions holds the valid policy language versions
+var Versions = []string{"2012-10-17", "2008-10-17"}
+
+// Document is a parsed IAM policy document
+type Document struct {
+	Version   string      `json:"Version"`
+	ID        string      `json:"Id,omitempty"`
+	Statement []Statement `json:"Statement"`
+}
+
+// Statement is a statement of a policy document. All elements, which may be a single value or a list, are lists.
+type Statement struct {
+	Sid          string                       `json:"Sid,omitempty"`
+	Effect       string                       `json:"Effect"`
+	Principal    Principal                    `json:"Principal,omitempty"`
+	NotPrincipal Principal                    `json:"NotPrincipal,omitempty"`
+	Action       Values                       `json:"Action,omitempty"`
+	NotAction    Values                       `json:"NotAction,omitempty"`
+	Resource     Values                       `json:"Resource,omitempty"`
+	NotResource  Values                       `json:"NotResource,omitempty"`
+	Condition    map[string]map[string]Values `json:"Condition,omitempty"`
+}
+
+// Principal maps principal types to their principals. The principal "*" is the same as the AWS principal "*", and
+// is kept as such.
+type Principal map[string]Values
+
+func (p *Principal) UnmarshalJSON(data []byte) error {
+	var all string
+	if err := json.Unmarshal(data, &all); err == nil {
+		if all != "*" {
+			return fmt.Errorf("unsupported principal '%s'", all)
+		}
+		*p = Principal{"AWS": {"*"}}
+		return nil
+	}
+
+	var principal map[string]Values
+	if err := json.Unmarshal(data, &principal); err != nil {
+		return err
+	}
+	*p = principal
+	return nil
+}
+
+// Values is an element of a statement, which may be given as a single value or a list. Condition values may also be
+// booleans or numbers, they are kept as strings.
+type Values []string
+
+func (v *Values) UnmarshalJSON(data []byte) error {
+	var list []interface{}
+	if err := json.Unmarshal(data, &list); err != nil {
+		var single interface{}
+		if err := json.Unmarshal(data, &single); err != nil {
+			return err
+		}
+		list = []interface{}{single}
+	}
+
+	*v = Values{}
+	for _, item := range list {
+		switch item := item.(type) {
+		case string:
+			*v = append(*v, item)
+		case bool:
+			*v = append(*v, strconv.FormatBool(item))
+		case float64:
+			*v = append(*v, strconv.FormatFloat(item, 'f', -1, 64))
+		default:
+			return fmt.Errorf("unsupported value '%v'", item)
+		}
+	}
+	return nil
+}
+
+// rawDocument is a document before its statements have been parsed. The statement may be a single object or a list.
+type rawDocument struct {
+	Version   string          `json:"Version"`
+	ID        string          `json:"Id"`
+	Statement json.RawMessage `json:"Statement"`
+}
+
+// Parse parses the JSON of a policy document. Unknown elements are an error, the grammar is not checked any further.
+func Parse(data []byte) (*Document, error) {
+	var raw rawDocument
+	if err := unmarshalStrict(data, &raw); err != nil {
+		return nil, err
+	}
+	if raw.Statement == nil {
+		return nil, fmt.Errorf("document has no Statement")
+	}
+
+	doc := &Document{Version: raw.Version, ID: raw.ID}
+	if err := unmarshalStrict(raw.Statement, &doc.Statement); err != nil {
+		var single Statement
+		if err := unmarshalStrict(raw.Statement, &single); err != nil {
+			return nil, fmt.Errorf("Statement: %w", err)
+		}
+		doc.Statement = []Statement{single}
+	}
+	return doc, nil
+}
+
+// Canonicalize parses and validates the JSON of a policy document, and returns the document with its canonical JSON.
+// If trust is true, the document is validated as a trust (assume role) policy.
+func Canonicalize(data []byte, trust bool) (*Document, []byte, error) {
+	doc, err := Parse(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := doc.Validate(trust); err != nil {
+		return nil, nil, err
+	}
+	canonical, err := doc.JSON()
+	if err != nil {
+		return nil, nil, err
+	}
+	return doc, canonical, nil
+}
+
+// Validate checks the document against the IAM policy grammar. If trust is true, every statement needs a principal,
+// otherwise statements must not have one.
+func (d *Document) Validate(trust bool) error {
+	if !containsString(Versions, d.Version) {
+		return fmt.Errorf("Version '%s' is not one of %s", d.Version, strings.Join(Versions, ", "))
+	}
+	if len(d.Statement) == 0 {
+		return fmt.Errorf("document has no statements")
+	}
+	for i, s := range d.Statement {
+		if err := s.validate(trust); err != nil {
+			id := s.Sid
+			if id == "" {
+				id = strconv.Itoa(i)
+			}
+			return fmt.Errorf("statement '%s': %w", id, err)
+		}
+	}
+	return nil
+}
+
+func (s Statement) validate(trust bool) error {
+	if s.Effect != "Allow" && s.Effect != "Deny" {
+		return fmt.Errorf("Effect '%s' is neither Allow nor Deny", s.Effect)
+	}
+	if err := exactlyOne("Action", s.Action, "NotAction", s.NotAction); err != nil {
+		return err
+	}
+
+	hasPrincipal := s.Principal != nil || s.NotPrincipal != nil
+	switch {
+	case trust && !hasPrincipal:
+		return fmt.Errorf("a trust policy statement needs a Principal or NotPrincipal")
+	case !trust && hasPrincipal:
+		return fmt.Errorf("a Principal or NotPrincipal is only allowed in trust policies")
+	case s.Principal != nil && s.NotPrincipal != nil:
+		return fmt.Errorf("only one of Principal and NotPrincipal is allowed")
+	case !trust:
+		// identity based policies always name the resources
+		if err := exactlyOne("Resource", s.Resource, "NotResource", s.NotResource); err != nil {
+			return err
+		}
+	case s.Resource != nil && s.NotResource != nil:
+		return fmt.Errorf("only one of Resource and NotResource is allowed")
+	}
+
+	for _, principal := range []Principal{s.Principal, s.NotPrincipal} {
+		for typ, principals := range principal {
+			if len(principals) == 0 {
+				return fmt.Errorf("principal type '%s' has no principals", typ)
+			}
+		}
+	}
+	for op, comparison := range s.Condition {
+		for key, values := range comparison {
+			if len(values) == 0 {
+				return fmt.Errorf("condition '%s' on '%s' has no values", op, key)
+			}
+		}
+	}
+	return nil
+}
+
+// JSON returns the canonical JSON of the document: minified, with all elements in the order of the grammar, single
+// values as lists and the keys of principals and conditions sorted
+func (d *Document) JSON() ([]byte, error) {
+	buf := bytes.Buffer{}
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(d); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSpace(buf.Bytes()), nil
+}
+
+// Typed approximates the document with a typed document, as linting and constraints work on. Negated elements match
+// everything but the given values, so NotAction, NotResource and NotPrincipal are approximated by "*". A typed
+// statement holds a single principal per type, so statements are repeated for every further principal, without a Sid.
+func (d *Document) Typed() iam.PolicyDocument {
+	typed := iam.PolicyDocument{Version: iam.PolicyVersion(d.Version)}
+	for _, s := range d.Statement {
+		entry := iam.StatementEntry{
+			Sid:      s.Sid,
+			Effect:   s.Effect,
+			Action:   s.Action,
+			Resource: s.Resource,
+		}
+		if s.NotAction != nil {
+			entry.Action = []string{"*"}
+		}
+		if s.NotResource != nil {
+			entry.Resource = []string{"*"}
+		}
+		for op, comparison := range s.Condition {
+			if entry.Condition == nil {
+				entry.Condition = map[string]map[string][]string{}
+			}
+			entry.Condition[op] = map[string][]string{}
+			for key, values := range comparison {
+				entry.Condition[op][key] = values
+			}
+		}
+
+		principal := s.Principal
+		if s.NotPrincipal != nil {
+			principal = Principal{"AWS": {"*"}}
+		}
+		if principal == nil {
+			typed.Statement = append(typed.Statement, entry)
+			continue
+		}
+		for _, typ := range sortedKeys(principal) {
+			for _, p := range principal[typ] {
+				e := entry
+				e.Principal = map[string]string{typ: p}
+				typed.Statement = append(typed.Statement, e)
+				entry.Sid = ""
+			}
+		}
+	}
+	return typed
+}
+
+func exactlyOne(name string, values Values, notName string, notValues Values) error {
+	switch {
+	case values == nil && notValues == nil:
+		return fmt.Errorf("one of %s and %s is required", name, notName)
+	case values != nil && notValues != nil:
+		return fmt.Errorf("only one of %s and %s is allowed", name, notName)
+	case values != nil && len(values) == 0:
+		return fmt.Errorf("%s must not be empty", name)
+	case notValues != nil && len(notValues) == 0:
+		return fmt.Errorf("%s must not be empty", notName)
+	}
+	return nil
+}
+
+func unmarshalStrict(data []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
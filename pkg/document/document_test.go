@@ -0,0 +1,339 @@
+package document
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/redradrat/cloud-objects/aws/iam"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		doc     string
+		want    *Document
+		wantErr string
+	}{
+		{
+			name: "list of statements",
+			doc:  `{"Version":"2012-10-17","Id":"doc","Statement":[{"Sid":"Read","Effect":"Allow","Action":["s3:GetObject","s3:ListBucket"],"Resource":"*"}]}`,
+			want: &Document{Version: "2012-10-17", ID: "doc", Statement: []Statement{
+				{Sid: "Read", Effect: "Allow", Action: Values{"s3:GetObject", "s3:ListBucket"}, Resource: Values{"*"}},
+			}},
+		},
+		{
+			name: "single statement",
+			doc:  `{"Version":"2012-10-17","Statement":{"Effect":"Deny","NotAction":"iam:*","NotResource":["arn:aws:s3:::bucket"]}}`,
+			want: &Document{Version: "2012-10-17", Statement: []Statement{
+				{Effect: "Deny", NotAction: Values{"iam:*"}, NotResource: Values{"arn:aws:s3:::bucket"}},
+			}},
+		},
+		{
+			name: "the principal * is the AWS principal *",
+			doc:  `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"sts:AssumeRole","Principal":"*"}]}`,
+			want: &Document{Version: "2012-10-17", Statement: []Statement{
+				{Effect: "Allow", Action: Values{"sts:AssumeRole"}, Principal: Principal{"AWS": {"*"}}},
+			}},
+		},
+		{
+			name: "condition values of booleans and numbers are strings",
+			doc:  `{"Version":"2012-10-17","Statement":[{"Effect":"Deny","Action":"*","Resource":"*","Condition":{"Bool":{"aws:SecureTransport":false},"NumericLessThan":{"s3:max-keys":[10,2.5]}}}]}`,
+			want: &Document{Version: "2012-10-17", Statement: []Statement{
+				{Effect: "Deny", Action: Values{"*"}, Resource: Values{"*"}, Condition: map[string]map[string]Values{
+					"Bool":            {"aws:SecureTransport": {"false"}},
+					"NumericLessThan": {"s3:max-keys": {"10", "2.5"}},
+				}},
+			}},
+		},
+		{
+			name:    "unknown document element",
+			doc:     `{"Version":"2012-10-17","Statements":[]}`,
+			wantErr: "unknown field",
+		},
+		{
+			name:    "unknown statement element",
+			doc:     `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"*","Resource":"*","Resources":"*"}]}`,
+			wantErr: "Statement",
+		},
+		{
+			name:    "no Statement",
+			doc:     `{"Version":"2012-10-17"}`,
+			wantErr: "document has no Statement",
+		},
+		{
+			name:    "a principal string other than *",
+			doc:     `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"sts:AssumeRole","Principal":"arn:aws:iam::1:root"}]}`,
+			wantErr: "Statement",
+		},
+		{
+			name:    "object as value",
+			doc:     `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":{"s3":"GetObject"},"Resource":"*"}]}`,
+			wantErr: "Statement",
+		},
+		{
+			name:    "invalid JSON",
+			doc:     `{"Version":`,
+			wantErr: "unexpected EOF",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse([]byte(tt.doc))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Parse() error = %v, want it to contain '%s'", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		doc     string
+		trust   bool
+		wantErr string
+	}{
+		{
+			name: "identity policy",
+			doc:  `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"s3:GetObject","Resource":"*"}]}`,
+		},
+		{
+			name: "old version with NotAction and NotResource",
+			doc:  `{"Version":"2008-10-17","Statement":[{"Effect":"Deny","NotAction":"s3:*","NotResource":"arn:aws:s3:::bucket"}]}`,
+		},
+		{
+			name:    "unknown version",
+			doc:     `{"Version":"2012-10-18","Statement":[{"Effect":"Allow","Action":"*","Resource":"*"}]}`,
+			wantErr: "Version '2012-10-18' is not one of 2012-10-17, 2008-10-17",
+		},
+		{
+			name:    "no statements",
+			doc:     `{"Version":"2012-10-17","Statement":[]}`,
+			wantErr: "document has no statements",
+		},
+		{
+			name:    "invalid effect",
+			doc:     `{"Version":"2012-10-17","Statement":[{"Sid":"Read","Effect":"allow","Action":"*","Resource":"*"}]}`,
+			wantErr: "statement 'Read': Effect 'allow' is neither Allow nor Deny",
+		},
+		{
+			name:    "no Action",
+			doc:     `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Resource":"*"}]}`,
+			wantErr: "statement '0': one of Action and NotAction is required",
+		},
+		{
+			name:    "Action and NotAction",
+			doc:     `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"s3:*","NotAction":"s3:DeleteBucket","Resource":"*"}]}`,
+			wantErr: "only one of Action and NotAction is allowed",
+		},
+		{
+			name:    "empty Action",
+			doc:     `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":[],"Resource":"*"}]}`,
+			wantErr: "Action must not be empty",
+		},
+		{
+			name:    "no Resource in an identity policy",
+			doc:     `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"*"}]}`,
+			wantErr: "one of Resource and NotResource is required",
+		},
+		{
+			name:    "empty NotResource",
+			doc:     `{"Version":"2012-10-17","Statement":[{"Effect":"Deny","Action":"*","NotResource":[]}]}`,
+			wantErr: "NotResource must not be empty",
+		},
+		{
+			name:    "Principal in an identity policy",
+			doc:     `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"*","Resource":"*","Principal":"*"}]}`,
+			wantErr: "a Principal or NotPrincipal is only allowed in trust policies",
+		},
+		{
+			name:    "empty condition values",
+			doc:     `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"*","Resource":"*","Condition":{"StringEquals":{"aws:SourceVpc":[]}}}]}`,
+			wantErr: "condition 'StringEquals' on 'aws:SourceVpc' has no values",
+		},
+		{
+			name:  "trust policy",
+			doc:   `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"sts:AssumeRole","Principal":{"Service":"ec2.amazonaws.com"},"Condition":{"StringEquals":{"sts:ExternalId":"id"}}}]}`,
+			trust: true,
+		},
+		{
+			name:  "trust policy with NotPrincipal",
+			doc:   `{"Version":"2012-10-17","Statement":[{"Effect":"Deny","Action":"sts:AssumeRole","NotPrincipal":{"AWS":"arn:aws:iam::1:root"}}]}`,
+			trust: true,
+		},
+		{
+			name:    "trust policy without Principal",
+			doc:     `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"sts:AssumeRole"}]}`,
+			trust:   true,
+			wantErr: "a trust policy statement needs a Principal or NotPrincipal",
+		},
+		{
+			name:    "Principal and NotPrincipal",
+			doc:     `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"sts:AssumeRole","Principal":"*","NotPrincipal":{"AWS":"arn:aws:iam::1:root"}}]}`,
+			trust:   true,
+			wantErr: "only one of Principal and NotPrincipal is allowed",
+		},
+		{
+			name:    "Resource and NotResource in a trust policy",
+			doc:     `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"sts:AssumeRole","Principal":"*","Resource":"*","NotResource":"*"}]}`,
+			trust:   true,
+			wantErr: "only one of Resource and NotResource is allowed",
+		},
+		{
+			name:    "principal type without principals",
+			doc:     `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"sts:AssumeRole","Principal":{"AWS":[]}}]}`,
+			trust:   true,
+			wantErr: "principal type 'AWS' has no principals",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := Parse([]byte(tt.doc))
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			err = doc.Validate(tt.trust)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Validate() error = %v, want it to contain '%s'", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("Validate() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestCanonicalize(t *testing.T) {
+	tests := []struct {
+		name    string
+		doc     string
+		trust   bool
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "minifies and orders the elements by the grammar",
+			doc: `{
+				"Statement": {
+					"Resource": "arn:aws:s3:::bucket/*",
+					"Action": "s3:GetObject",
+					"Effect": "Allow"
+				},
+				"Version": "2012-10-17"
+			}`,
+			want: `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":["s3:GetObject"],"Resource":["arn:aws:s3:::bucket/*"]}]}`,
+		},
+		{
+			name:  "sorts principals and conditions and keeps special characters",
+			doc:   `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"sts:AssumeRoleWithWebIdentity","Principal":{"Service":"b","AWS":"a"},"Condition":{"StringLike":{"oidc:sub":"system:serviceaccount:<ns>:*","oidc:aud":"sts.amazonaws.com"},"Bool":{"aws:MultiFactorAuthPresent":true}}}]}`,
+			trust: true,
+			want:  `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":{"AWS":["a"],"Service":["b"]},"Action":["sts:AssumeRoleWithWebIdentity"],"Condition":{"Bool":{"aws:MultiFactorAuthPresent":["true"]},"StringLike":{"oidc:aud":["sts.amazonaws.com"],"oidc:sub":["system:serviceaccount:<ns>:*"]}}}]}`,
+		},
+		{
+			name:    "invalid document",
+			doc:     `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"*"}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "identity policy as trust policy",
+			doc:     `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"*","Resource":"*"}]}`,
+			trust:   true,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, got, err := Canonicalize([]byte(tt.doc), tt.trust)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Canonicalize() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && string(got) != tt.want {
+				t.Errorf("Canonicalize() = %s, want %s", got, tt.want)
+			}
+
+			if tt.wantErr {
+				return
+			}
+			// the canonical form is stable
+			_, again, err := Canonicalize(got, tt.trust)
+			if err != nil || string(again) != string(got) {
+				t.Errorf("Canonicalize() of the canonical form = %s, %v", again, err)
+			}
+		})
+	}
+}
+
+func TestTyped(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		want iam.PolicyDocument
+	}{
+		{
+			name: "keeps actions, resources and conditions",
+			doc:  `{"Version":"2012-10-17","Statement":[{"Sid":"Read","Effect":"Allow","Action":"s3:GetObject","Resource":"arn:aws:s3:::bucket/*","Condition":{"Bool":{"aws:SecureTransport":true}}}]}`,
+			want: iam.PolicyDocument{Version: "2012-10-17", Statement: []iam.StatementEntry{{
+				Sid:       "Read",
+				Effect:    "Allow",
+				Action:    []string{"s3:GetObject"},
+				Resource:  []string{"arn:aws:s3:::bucket/*"},
+				Condition: map[string]map[string][]string{"Bool": {"aws:SecureTransport": {"true"}}},
+			}}},
+		},
+		{
+			name: "approximates NotAction and NotResource with *",
+			doc:  `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","NotAction":"iam:*","NotResource":"arn:aws:s3:::bucket"}]}`,
+			want: iam.PolicyDocument{Version: "2012-10-17", Statement: []iam.StatementEntry{{
+				Effect:   "Allow",
+				Action:   []string{"*"},
+				Resource: []string{"*"},
+			}}},
+		},
+		{
+			name: "approximates NotPrincipal with the AWS principal *",
+			doc:  `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"sts:AssumeRole","NotPrincipal":{"Service":"ec2.amazonaws.com"}}]}`,
+			want: iam.PolicyDocument{Version: "2012-10-17", Statement: []iam.StatementEntry{{
+				Effect:    "Allow",
+				Action:    []string{"sts:AssumeRole"},
+				Principal: map[string]string{"AWS": "*"},
+			}}},
+		},
+		{
+			name: "repeats statements for every further principal without Sid",
+			doc:  `{"Version":"2012-10-17","Statement":[{"Sid":"Trust","Effect":"Allow","Action":"sts:AssumeRole","Principal":{"Service":"ec2.amazonaws.com","AWS":["arn:aws:iam::1:root","arn:aws:iam::2:root"]}}]}`,
+			want: iam.PolicyDocument{Version: "2012-10-17", Statement: []iam.StatementEntry{
+				{Sid: "Trust", Effect: "Allow", Action: []string{"sts:AssumeRole"}, Principal: map[string]string{"AWS": "arn:aws:iam::1:root"}},
+				{Effect: "Allow", Action: []string{"sts:AssumeRole"}, Principal: map[string]string{"AWS": "arn:aws:iam::2:root"}},
+				{Effect: "Allow", Action: []string{"sts:AssumeRole"}, Principal: map[string]string{"Service": "ec2.amazonaws.com"}},
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := Parse([]byte(tt.doc))
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if got := doc.Typed(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Typed() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,270 @@
+// Package importer reads the IAM objects of an existing AWS account, and turns them into manifests of the operator,
+// annotated so the operator adopts the objects instead of recreating them.
+package importer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+
+	awssdk "github.com/aws/aws-sdk-go/aws"
+	awsiam "github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/iam/iamiface"
+)
+
+// serviceLinkedRolePath is the path of roles AWS creates and manages for its services. They cannot be managed by us.
+const serviceLinkedRolePath = "/aws-service-role/"
+
+// Account is a snapshot of the IAM objects of an account. Recorded fixtures are Accounts as JSON.
+type Account struct {
+	Roles    []Role   `json:"roles,omitempty"`
+	Policies []Policy `json:"policies,omitempty"`
+	Users    []User   `json:"users,omitempty"`
+	Groups   []Group  `json:"groups,omitempty"`
+}
+
+// Role is an IAM role
+type Role struct {
+	Name               string          `json:"name"`
+	Path               string          `json:"path,omitempty"`
+	ARN                string          `json:"arn"`
+	Description        string          `json:"description,omitempty"`
+	MaxSessionDuration int64           `json:"maxSessionDuration,omitempty"`
+	AssumeRolePolicy   json.RawMessage `json:"assumeRolePolicy"`
+	AttachedPolicies   []string        `json:"attachedPolicies,omitempty"`
+	InlinePolicies     []string        `json:"inlinePolicies,omitempty"`
+}
+
+// Policy is a customer managed IAM policy, with the document of its default version
+type Policy struct {
+	Name        string          `json:"name"`
+	Path        string          `json:"path,omitempty"`
+	ARN         string          `json:"arn"`
+	Description string          `json:"description,omitempty"`
+	Document    json.RawMessage `json:"document"`
+}
+
+// User is an IAM user
+type User struct {
+	Name             string   `json:"name"`
+	Path             string   `json:"path,omitempty"`
+	ARN              string   `json:"arn"`
+	AttachedPolicies []string `json:"attachedPolicies,omitempty"`
+	InlinePolicies   []string `json:"inlinePolicies,omitempty"`
+}
+
+// Group is an IAM group, with the names of its users
+type Group struct {
+	Name             string   `json:"name"`
+	Path             string   `json:"path,omitempty"`
+	ARN              string   `json:"arn"`
+	Users            []string `json:"users,omitempty"`
+	AttachedPolicies []string `json:"attachedPolicies,omitempty"`
+	InlinePolicies   []string `json:"inlinePolicies,omitempty"`
+}
+
+// LoadAccount reads a recorded Account from the given file, or from stdin if the path is "-"
+func LoadAccount(path string) (*Account, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	acc := &Account{}
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(acc); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return acc, nil
+}
+
+// Save writes the Account as JSON to the given file, so it can be used as a fixture later on
+func (a *Account) Save(path string) error {
+	data, err := json.MarshalIndent(a, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// ReadAccount reads all roles, customer managed policies, users and groups with the given path prefix through the IAM
+// API. Service-linked roles are left out, as only AWS can manage them.
+func ReadAccount(svc iamiface.IAMAPI, pathPrefix string) (*Account, error) {
+	if pathPrefix == "" {
+		pathPrefix = "/"
+	}
+	acc := &Account{}
+
+	var roles []*awsiam.Role
+	err := svc.ListRolesPages(&awsiam.ListRolesInput{PathPrefix: awssdk.String(pathPrefix)}, func(out *awsiam.ListRolesOutput, _ bool) bool {
+		roles = append(roles, out.Roles...)
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list roles: %w", err)
+	}
+	for _, r := range roles {
+		if strings.HasPrefix(awssdk.StringValue(r.Path), serviceLinkedRolePath) {
+			continue
+		}
+		role := Role{
+			Name:               awssdk.StringValue(r.RoleName),
+			Path:               awssdk.StringValue(r.Path),
+			ARN:                awssdk.StringValue(r.Arn),
+			Description:        awssdk.StringValue(r.Description),
+			MaxSessionDuration: awssdk.Int64Value(r.MaxSessionDuration),
+		}
+		if role.AssumeRolePolicy, err = decodeDocument(awssdk.StringValue(r.AssumeRolePolicyDocument)); err != nil {
+			return nil, fmt.Errorf("trust policy of role '%s': %w", role.Name, err)
+		}
+		err = svc.ListAttachedRolePoliciesPages(&awsiam.ListAttachedRolePoliciesInput{RoleName: r.RoleName}, func(out *awsiam.ListAttachedRolePoliciesOutput, _ bool) bool {
+			role.AttachedPolicies = append(role.AttachedPolicies, attachedPolicyARNs(out.AttachedPolicies)...)
+			return true
+		})
+		if err != nil {
+			return nil, fmt.Errorf("unable to list attached policies of role '%s': %w", role.Name, err)
+		}
+		err = svc.ListRolePoliciesPages(&awsiam.ListRolePoliciesInput{RoleName: r.RoleName}, func(out *awsiam.ListRolePoliciesOutput, _ bool) bool {
+			role.InlinePolicies = append(role.InlinePolicies, awssdk.StringValueSlice(out.PolicyNames)...)
+			return true
+		})
+		if err != nil {
+			return nil, fmt.Errorf("unable to list inline policies of role '%s': %w", role.Name, err)
+		}
+		acc.Roles = append(acc.Roles, role)
+	}
+
+	var policies []*awsiam.Policy
+	listPoliciesInput := &awsiam.ListPoliciesInput{Scope: awssdk.String(awsiam.PolicyScopeTypeLocal), PathPrefix: awssdk.String(pathPrefix)}
+	err = svc.ListPoliciesPages(listPoliciesInput, func(out *awsiam.ListPoliciesOutput, _ bool) bool {
+		policies = append(policies, out.Policies...)
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list policies: %w", err)
+	}
+	for _, p := range policies {
+		policy := Policy{
+			Name: awssdk.StringValue(p.PolicyName),
+			Path: awssdk.StringValue(p.Path),
+			ARN:  awssdk.StringValue(p.Arn),
+		}
+		// the description is not part of the listing
+		getOut, err := svc.GetPolicy(&awsiam.GetPolicyInput{PolicyArn: p.Arn})
+		if err != nil {
+			return nil, fmt.Errorf("unable to get policy '%s': %w", policy.Name, err)
+		}
+		policy.Description = awssdk.StringValue(getOut.Policy.Description)
+		versionOut, err := svc.GetPolicyVersion(&awsiam.GetPolicyVersionInput{PolicyArn: p.Arn, VersionId: p.DefaultVersionId})
+		if err != nil {
+			return nil, fmt.Errorf("unable to get default version of policy '%s': %w", policy.Name, err)
+		}
+		if policy.Document, err = decodeDocument(awssdk.StringValue(versionOut.PolicyVersion.Document)); err != nil {
+			return nil, fmt.Errorf("document of policy '%s': %w", policy.Name, err)
+		}
+		acc.Policies = append(acc.Policies, policy)
+	}
+
+	var users []*awsiam.User
+	err = svc.ListUsersPages(&awsiam.ListUsersInput{PathPrefix: awssdk.String(pathPrefix)}, func(out *awsiam.ListUsersOutput, _ bool) bool {
+		users = append(users, out.Users...)
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list users: %w", err)
+	}
+	for _, u := range users {
+		user := User{
+			Name: awssdk.StringValue(u.UserName),
+			Path: awssdk.StringValue(u.Path),
+			ARN:  awssdk.StringValue(u.Arn),
+		}
+		err = svc.ListAttachedUserPoliciesPages(&awsiam.ListAttachedUserPoliciesInput{UserName: u.UserName}, func(out *awsiam.ListAttachedUserPoliciesOutput, _ bool) bool {
+			user.AttachedPolicies = append(user.AttachedPolicies, attachedPolicyARNs(out.AttachedPolicies)...)
+			return true
+		})
+		if err != nil {
+			return nil, fmt.Errorf("unable to list attached policies of user '%s': %w", user.Name, err)
+		}
+		err = svc.ListUserPoliciesPages(&awsiam.ListUserPoliciesInput{UserName: u.UserName}, func(out *awsiam.ListUserPoliciesOutput, _ bool) bool {
+			user.InlinePolicies = append(user.InlinePolicies, awssdk.StringValueSlice(out.PolicyNames)...)
+			return true
+		})
+		if err != nil {
+			return nil, fmt.Errorf("unable to list inline policies of user '%s': %w", user.Name, err)
+		}
+		acc.Users = append(acc.Users, user)
+	}
+
+	var groups []*awsiam.Group
+	err = svc.ListGroupsPages(&awsiam.ListGroupsInput{PathPrefix: awssdk.String(pathPrefix)}, func(out *awsiam.ListGroupsOutput, _ bool) bool {
+		groups = append(groups, out.Groups...)
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list groups: %w", err)
+	}
+	for _, g := range groups {
+		group := Group{
+			Name: awssdk.StringValue(g.GroupName),
+			Path: awssdk.StringValue(g.Path),
+			ARN:  awssdk.StringValue(g.Arn),
+		}
+		err = svc.GetGroupPages(&awsiam.GetGroupInput{GroupName: g.GroupName}, func(out *awsiam.GetGroupOutput, _ bool) bool {
+			for _, u := range out.Users {
+				group.Users = append(group.Users, awssdk.StringValue(u.UserName))
+			}
+			return true
+		})
+		if err != nil {
+			return nil, fmt.Errorf("unable to list users of group '%s': %w", group.Name, err)
+		}
+		err = svc.ListAttachedGroupPoliciesPages(&awsiam.ListAttachedGroupPoliciesInput{GroupName: g.GroupName}, func(out *awsiam.ListAttachedGroupPoliciesOutput, _ bool) bool {
+			group.AttachedPolicies = append(group.AttachedPolicies, attachedPolicyARNs(out.AttachedPolicies)...)
+			return true
+		})
+		if err != nil {
+			return nil, fmt.Errorf("unable to list attached policies of group '%s': %w", group.Name, err)
+		}
+		err = svc.ListGroupPoliciesPages(&awsiam.ListGroupPoliciesInput{GroupName: g.GroupName}, func(out *awsiam.ListGroupPoliciesOutput, _ bool) bool {
+			group.InlinePolicies = append(group.InlinePolicies, awssdk.StringValueSlice(out.PolicyNames)...)
+			return true
+		})
+		if err != nil {
+			return nil, fmt.Errorf("unable to list inline policies of group '%s': %w", group.Name, err)
+		}
+		acc.Groups = append(acc.Groups, group)
+	}
+
+	return acc, nil
+}
+
+// decodeDocument decodes a policy document as returned by the IAM API, which URL-encodes them. A "+" is kept as it
+// is, spaces are always encoded as "%20".
+func decodeDocument(encoded string) (json.RawMessage, error) {
+	doc, err := url.PathUnescape(encoded)
+	if err != nil {
+		return nil, err
+	}
+	if !json.Valid([]byte(doc)) {
+		return nil, fmt.Errorf("not a valid JSON document")
+	}
+	return json.RawMessage(doc), nil
+}
+
+func attachedPolicyARNs(policies []*awsiam.AttachedPolicy) []string {
+	var arns []string
+	for _, p := range policies {
+		arns = append(arns, awssdk.StringValue(p.PolicyArn))
+	}
+	return arns
+}
@@ -0,0 +1,182 @@
+package importer
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/runtime"
+
+	iamv1beta1 "github.com/redradrat/aws-iam-operator/api/v1beta1"
+	"github.com/redradrat/aws-iam-operator/pkg/document"
+)
+
+// ConvertPolicyDocument converts the JSON of an identity based policy document into the statement of a Policy
+func ConvertPolicyDocument(doc json.RawMessage) (iamv1beta1.PolicyStatement, error) {
+	entries, err := convertDocument(doc, false)
+	if err != nil {
+		return nil, err
+	}
+	var statement iamv1beta1.PolicyStatement
+	for _, entry := range entries {
+		statement = append(statement, entry.PolicyStatementEntry)
+	}
+	return statement, nil
+}
+
+// ConvertTrustPolicyDocument converts the JSON of a trust policy document into the statement of a Role
+func ConvertTrustPolicyDocument(doc json.RawMessage) (iamv1beta1.AssumeRolePolicyStatement, error) {
+	return convertDocument(doc, true)
+}
+
+// rawDocument returns the canonical JSON of a policy document, which cannot be converted into statements, as the raw
+// document of a Policy or AssumeRolePolicy
+func rawDocument(doc json.RawMessage, trust bool) (*runtime.RawExtension, error) {
+	_, canonical, err := document.Canonicalize(doc, trust)
+	if err != nil {
+		return nil, err
+	}
+	return &runtime.RawExtension{Raw: canonical}, nil
+}
+
+// convertDocument converts every statement of the document. The schema of the operator only allows a single principal
+// and a single value per condition key in a statement, so statements with more of them are split up into one statement
+// per combination. That grants (or denies) exactly the same, as long as no negated or ForAllValues condition operator
+// has multiple values. Those are reported as errors, just like the elements the schema doesn't know at all.
+func convertDocument(doc json.RawMessage, trust bool) (iamv1beta1.AssumeRolePolicyStatement, error) {
+	parsed, err := document.Parse(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	var result iamv1beta1.AssumeRolePolicyStatement
+	for i, s := range parsed.Statement {
+		entries, err := convertStatement(s, trust)
+		if err != nil {
+			id := s.Sid
+			if id == "" {
+				id = strconv.Itoa(i)
+			}
+			return nil, fmt.Errorf("statement '%s': %w", id, err)
+		}
+		result = append(result, entries...)
+	}
+	return result, nil
+}
+
+func convertStatement(s document.Statement, trust bool) ([]iamv1beta1.AssumeRolePolicyStatementEntry, error) {
+	switch {
+	case s.NotPrincipal != nil:
+		return nil, fmt.Errorf("NotPrincipal is not supported")
+	case s.NotAction != nil:
+		return nil, fmt.Errorf("NotAction is not supported")
+	case s.NotResource != nil:
+		return nil, fmt.Errorf("NotResource is not supported")
+	case s.Principal != nil && !trust:
+		return nil, fmt.Errorf("a Principal is only supported in trust policies")
+	case s.Principal == nil && trust:
+		return nil, fmt.Errorf("a trust policy statement needs a Principal")
+	}
+
+	principals := []map[string]string{nil}
+	if s.Principal != nil {
+		principals = splitPrincipal(s.Principal)
+	}
+	conditions, err := splitConditions(s.Condition)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []iamv1beta1.AssumeRolePolicyStatementEntry
+	for _, principal := range principals {
+		for _, condition := range conditions {
+			entries = append(entries, iamv1beta1.AssumeRolePolicyStatementEntry{
+				PolicyStatementEntry: iamv1beta1.PolicyStatementEntry{
+					Sid:        s.Sid,
+					Effect:     iamv1beta1.PolicyStatementEffect(s.Effect),
+					Actions:    s.Action,
+					Resources:  s.Resource,
+					Conditions: condition,
+				},
+				Principal: principal,
+			})
+		}
+	}
+
+	// statement IDs have to stay unique
+	if len(entries) > 1 && s.Sid != "" {
+		for i := range entries {
+			entries[i].Sid = fmt.Sprintf("%s%d", s.Sid, i+1)
+		}
+	}
+	return entries, nil
+}
+
+// splitPrincipal returns one principal per principal type and value
+func splitPrincipal(principal document.Principal) []map[string]string {
+	var split []map[string]string
+	for _, typ := range sortedKeys(principal) {
+		for _, v := range principal[typ] {
+			split = append(split, map[string]string{typ: v})
+		}
+	}
+	return split
+}
+
+// splitConditions returns one condition per combination of the values of all condition keys
+func splitConditions(condition map[string]map[string]document.Values) ([]iamv1beta1.PolicyStatementCondition, error) {
+	split := []iamv1beta1.PolicyStatementCondition{nil}
+	for _, op := range sortedKeys(condition) {
+		for _, key := range sortedKeys(condition[op]) {
+			vals := condition[op][key]
+			if len(vals) == 0 {
+				return nil, fmt.Errorf("condition '%s' on '%s' has no values", op, key)
+			}
+			if len(vals) > 1 && !splittableOperator(op) {
+				return nil, fmt.Errorf("condition '%s' on '%s' has multiple values, which cannot be split up for a negated or ForAllValues operator", op, key)
+			}
+
+			var next []iamv1beta1.PolicyStatementCondition
+			for _, c := range split {
+				for _, v := range vals {
+					next = append(next, withCondition(c, op, key, v))
+				}
+			}
+			split = next
+		}
+	}
+	return split, nil
+}
+
+// splittableOperator returns true, if a condition with multiple values matches, as soon as one of the values matches
+func splittableOperator(op string) bool {
+	return !strings.HasPrefix(op, "ForAllValues:") && !strings.Contains(op, "Not")
+}
+
+// withCondition returns a copy of the condition with the given comparison added
+func withCondition(c iamv1beta1.PolicyStatementCondition, op, key, value string) iamv1beta1.PolicyStatementCondition {
+	result := iamv1beta1.PolicyStatementCondition{}
+	for o, comparison := range c {
+		result[o] = iamv1beta1.PolicyStatementConditionComparison{}
+		for k, v := range comparison {
+			result[o][k] = v
+		}
+	}
+	operator := iamv1beta1.PolicyStatementConditionOperator(op)
+	if result[operator] == nil {
+		result[operator] = iamv1beta1.PolicyStatementConditionComparison{}
+	}
+	result[operator][iamv1beta1.PolicyStatementConditionKey(key)] = value
+	return result
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
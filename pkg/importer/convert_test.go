@@ -0,0 +1,242 @@
+package importer
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	iamv1beta1 "github.com/redradrat/aws-iam-operator/api/v1beta1"
+	"github.com/redradrat/aws-iam-operator/pkg/document"
+)
+
+func TestConvertTrustPolicyDocument(t *testing.T) {
+	tests := []struct {
+		name    string
+		doc     string
+		want    iamv1beta1.AssumeRolePolicyStatement
+		wantErr string
+	}{
+		{
+			name: "splits principals by type and value",
+			doc:  `{"Version":"2012-10-17","Statement":[{"Sid":"Trust","Effect":"Allow","Action":"sts:AssumeRole","Principal":{"Service":"ec2.amazonaws.com","AWS":["arn:aws:iam::1:root","arn:aws:iam::2:root"]}}]}`,
+			want: iamv1beta1.AssumeRolePolicyStatement{
+				trustEntry("Trust1", map[string]string{"AWS": "arn:aws:iam::1:root"}, nil),
+				trustEntry("Trust2", map[string]string{"AWS": "arn:aws:iam::2:root"}, nil),
+				trustEntry("Trust3", map[string]string{"Service": "ec2.amazonaws.com"}, nil),
+			},
+		},
+		{
+			name: "splits principals and conditions into all combinations",
+			doc:  `{"Version":"2012-10-17","Statement":{"Effect":"Allow","Action":"sts:AssumeRole","Principal":{"AWS":["arn:aws:iam::1:root","arn:aws:iam::2:root"]},"Condition":{"StringEquals":{"sts:ExternalId":["a","b"]}}}}`,
+			want: iamv1beta1.AssumeRolePolicyStatement{
+				trustEntry("", map[string]string{"AWS": "arn:aws:iam::1:root"}, condition("StringEquals", "sts:ExternalId", "a")),
+				trustEntry("", map[string]string{"AWS": "arn:aws:iam::1:root"}, condition("StringEquals", "sts:ExternalId", "b")),
+				trustEntry("", map[string]string{"AWS": "arn:aws:iam::2:root"}, condition("StringEquals", "sts:ExternalId", "a")),
+				trustEntry("", map[string]string{"AWS": "arn:aws:iam::2:root"}, condition("StringEquals", "sts:ExternalId", "b")),
+			},
+		},
+		{
+			name: "keeps the wildcard principal",
+			doc:  `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"sts:AssumeRole","Principal":"*"}]}`,
+			want: iamv1beta1.AssumeRolePolicyStatement{
+				trustEntry("", map[string]string{"AWS": "*"}, nil),
+			},
+		},
+		{
+			name:    "rejects NotPrincipal",
+			doc:     `{"Version":"2012-10-17","Statement":[{"Sid":"Not","Effect":"Allow","Action":"sts:AssumeRole","NotPrincipal":{"AWS":"arn:aws:iam::1:root"}}]}`,
+			wantErr: "statement 'Not': NotPrincipal is not supported",
+		},
+		{
+			name:    "rejects statements without Principal",
+			doc:     `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"sts:AssumeRole"}]}`,
+			wantErr: "statement '0': a trust policy statement needs a Principal",
+		},
+		{
+			name:    "rejects unknown elements",
+			doc:     `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"sts:AssumeRole","Principal":"*","Extra":true}]}`,
+			wantErr: "Statement",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ConvertTrustPolicyDocument([]byte(tt.doc))
+			checkConversion(t, got, err, tt.want, tt.wantErr)
+		})
+	}
+}
+
+func TestConvertPolicyDocument(t *testing.T) {
+	tests := []struct {
+		name    string
+		doc     string
+		want    iamv1beta1.PolicyStatement
+		wantErr string
+	}{
+		{
+			name: "converts statements",
+			doc:  `{"Version":"2012-10-17","Statement":[{"Sid":"Read","Effect":"Allow","Action":["s3:GetObject"],"Resource":"arn:aws:s3:::bucket/*","Condition":{"Bool":{"aws:SecureTransport":true}}}]}`,
+			want: iamv1beta1.PolicyStatement{
+				{Sid: "Read", Effect: "Allow", Actions: []string{"s3:GetObject"}, Resources: []string{"arn:aws:s3:::bucket/*"}, Conditions: condition("Bool", "aws:SecureTransport", "true")},
+			},
+		},
+		{
+			name: "splits conditions and keeps statement IDs unique",
+			doc:  `{"Version":"2012-10-17","Statement":[{"Sid":"Vpc","Effect":"Deny","Action":"*","Resource":"*","Condition":{"StringEquals":{"aws:SourceVpc":["vpc-1","vpc-2"]}}}]}`,
+			want: iamv1beta1.PolicyStatement{
+				{Sid: "Vpc1", Effect: "Deny", Actions: []string{"*"}, Resources: []string{"*"}, Conditions: condition("StringEquals", "aws:SourceVpc", "vpc-1")},
+				{Sid: "Vpc2", Effect: "Deny", Actions: []string{"*"}, Resources: []string{"*"}, Conditions: condition("StringEquals", "aws:SourceVpc", "vpc-2")},
+			},
+		},
+		{
+			name:    "rejects a Principal",
+			doc:     `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"s3:*","Resource":"*","Principal":"*"}]}`,
+			wantErr: "a Principal is only supported in trust policies",
+		},
+		{
+			name:    "rejects NotAction",
+			doc:     `{"Version":"2012-10-17","Statement":[{"Effect":"Deny","NotAction":"s3:*","Resource":"*"}]}`,
+			wantErr: "NotAction is not supported",
+		},
+		{
+			name:    "rejects NotResource",
+			doc:     `{"Version":"2012-10-17","Statement":[{"Effect":"Deny","Action":"s3:*","NotResource":"arn:aws:s3:::bucket"}]}`,
+			wantErr: "NotResource is not supported",
+		},
+		{
+			name:    "rejects multiple values of negated operators",
+			doc:     `{"Version":"2012-10-17","Statement":[{"Effect":"Deny","Action":"*","Resource":"*","Condition":{"StringNotEquals":{"aws:SourceVpc":["vpc-1","vpc-2"]}}}]}`,
+			wantErr: "cannot be split up",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ConvertPolicyDocument([]byte(tt.doc))
+			checkConversion(t, got, err, tt.want, tt.wantErr)
+		})
+	}
+}
+
+func TestSplitConditions(t *testing.T) {
+	tests := []struct {
+		name      string
+		condition map[string]map[string]document.Values
+		want      []iamv1beta1.PolicyStatementCondition
+		wantErr   bool
+	}{
+		{
+			name: "no condition",
+			want: []iamv1beta1.PolicyStatementCondition{nil},
+		},
+		{
+			name: "single values stay together",
+			condition: map[string]map[string]document.Values{
+				"StringEquals": {"aws:PrincipalOrgID": {"o-1"}, "aws:RequestedRegion": {"eu-west-1"}},
+				"Bool":         {"aws:SecureTransport": {"true"}},
+			},
+			want: []iamv1beta1.PolicyStatementCondition{{
+				"StringEquals": {"aws:PrincipalOrgID": "o-1", "aws:RequestedRegion": "eu-west-1"},
+				"Bool":         {"aws:SecureTransport": "true"},
+			}},
+		},
+		{
+			name: "multiple values of several keys",
+			condition: map[string]map[string]document.Values{
+				"StringEquals": {"aws:RequestedRegion": {"eu-west-1", "eu-central-1"}},
+				"StringLike":   {"s3:prefix": {"home/*", "public/*"}},
+			},
+			want: []iamv1beta1.PolicyStatementCondition{
+				{"StringEquals": {"aws:RequestedRegion": "eu-west-1"}, "StringLike": {"s3:prefix": "home/*"}},
+				{"StringEquals": {"aws:RequestedRegion": "eu-west-1"}, "StringLike": {"s3:prefix": "public/*"}},
+				{"StringEquals": {"aws:RequestedRegion": "eu-central-1"}, "StringLike": {"s3:prefix": "home/*"}},
+				{"StringEquals": {"aws:RequestedRegion": "eu-central-1"}, "StringLike": {"s3:prefix": "public/*"}},
+			},
+		},
+		{
+			name: "single value of a negated operator",
+			condition: map[string]map[string]document.Values{
+				"StringNotEquals": {"aws:SourceVpc": {"vpc-1"}},
+			},
+			want: []iamv1beta1.PolicyStatementCondition{{"StringNotEquals": {"aws:SourceVpc": "vpc-1"}}},
+		},
+		{
+			name: "multiple values of a negated operator",
+			condition: map[string]map[string]document.Values{
+				"ArnNotLike": {"aws:PrincipalArn": {"arn:aws:iam::1:role/a", "arn:aws:iam::1:role/b"}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "multiple values of a ForAllValues operator",
+			condition: map[string]map[string]document.Values{
+				"ForAllValues:StringEquals": {"aws:TagKeys": {"team", "env"}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "multiple values of a ForAnyValue operator",
+			condition: map[string]map[string]document.Values{
+				"ForAnyValue:StringEquals": {"aws:TagKeys": {"team", "env"}},
+			},
+			want: []iamv1beta1.PolicyStatementCondition{
+				{"ForAnyValue:StringEquals": {"aws:TagKeys": "team"}},
+				{"ForAnyValue:StringEquals": {"aws:TagKeys": "env"}},
+			},
+		},
+		{
+			name: "no values",
+			condition: map[string]map[string]document.Values{
+				"StringEquals": {"aws:SourceVpc": {}},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := splitConditions(tt.condition)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("splitConditions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitConditions() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func checkConversion(t *testing.T, got interface{}, err error, want interface{}, wantErr string) {
+	t.Helper()
+	if wantErr != "" {
+		if err == nil || !strings.Contains(err.Error(), wantErr) {
+			t.Fatalf("error = %v, want it to contain '%s'", err, wantErr)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func trustEntry(sid string, principal map[string]string, conditions iamv1beta1.PolicyStatementCondition) iamv1beta1.AssumeRolePolicyStatementEntry {
+	return iamv1beta1.AssumeRolePolicyStatementEntry{
+		PolicyStatementEntry: iamv1beta1.PolicyStatementEntry{
+			Sid:        sid,
+			Effect:     "Allow",
+			Actions:    []string{"sts:AssumeRole"},
+			Conditions: conditions,
+		},
+		Principal: principal,
+	}
+}
+
+func condition(op, key, value string) iamv1beta1.PolicyStatementCondition {
+	return iamv1beta1.PolicyStatementCondition{
+		iamv1beta1.PolicyStatementConditionOperator(op): {iamv1beta1.PolicyStatementConditionKey(key): value},
+	}
+}
@@ -0,0 +1,266 @@
+package importer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	awsarn "github.com/aws/aws-sdk-go/aws/arn"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/yaml"
+
+	iamv1beta1 "github.com/redradrat/aws-iam-operator/api/v1beta1"
+)
+
+// defaultMaxSessionDuration is the maximum session duration the operator gives roles, if none is specified
+const defaultMaxSessionDuration = 3600
+
+// Options configures the generation of manifests
+type Options struct {
+	// Namespace is the namespace of all generated resources
+	Namespace string
+	// ResourcePrefix is the resource prefix the operator runs with. It's stripped from the names of the IAM objects, so
+	// the operator ends up with the same names.
+	ResourcePrefix string
+}
+
+// Result holds the generated resources, and warnings about everything which could not be imported as it is
+type Result struct {
+	Objects  []runtime.Object
+	Warnings []string
+}
+
+func (r *Result) warnf(format string, args ...interface{}) {
+	r.Warnings = append(r.Warnings, fmt.Sprintf(format, args...))
+}
+
+// Generate turns the IAM objects of the account into Roles, Policies, Users, Groups and PolicyAttachments. Roles,
+// Policies, Users and Groups carry the adopt annotation, so the operator adopts the existing IAM objects. Attaching an
+// attached policy again changes nothing, so PolicyAttachments need no annotation.
+func Generate(acc *Account, opts Options) *Result {
+	res := &Result{}
+	names := newNamer()
+	meta := func(kind, iamName, arn string) metav1.ObjectMeta {
+		return metav1.ObjectMeta{
+			Name:        names.name(kind, strings.TrimPrefix(iamName, opts.ResourcePrefix)),
+			Namespace:   opts.Namespace,
+			Annotations: map[string]string{iamv1beta1.AdoptAnnotation: arn},
+		}
+	}
+	typeMeta := func(kind string) metav1.TypeMeta {
+		return metav1.TypeMeta{APIVersion: iamv1beta1.GroupVersion.String(), Kind: kind}
+	}
+
+	// imported policies are referenced by attachments, all others are external
+	policyRefs := map[string]iamv1beta1.ResourceReference{}
+	for _, p := range acc.Policies {
+		spec := iamv1beta1.PolicySpec{Description: p.Description}
+		statement, err := ConvertPolicyDocument(p.Document)
+		if err == nil {
+			spec.Statement = statement
+		} else if raw, rawErr := rawDocument(p.Document, false); rawErr == nil {
+			res.warnf("Policy '%s' is imported as a raw document, it cannot be expressed as statements: %s", p.Name, err)
+			spec.Document = raw
+		} else {
+			res.warnf("skipping Policy '%s': %s", p.Name, err)
+			continue
+		}
+		policy := &iamv1beta1.Policy{
+			TypeMeta:   typeMeta("Policy"),
+			ObjectMeta: meta("Policy", p.Name, p.ARN),
+			Spec:       spec,
+		}
+		if awsName := strings.TrimPrefix(p.Name, opts.ResourcePrefix); awsName != policy.Name {
+			policy.Spec.AWSPolicyName = awsName
+		}
+		warnPath(res, "Policy", p.Name, p.Path)
+		policyRefs[p.ARN] = iamv1beta1.ResourceReference{Name: policy.Name, Namespace: policy.Namespace}
+		res.Objects = append(res.Objects, policy)
+	}
+
+	var attachments []*iamv1beta1.PolicyAttachment
+	attach := func(targetType iamv1beta1.TargetType, target metav1.ObjectMeta, policyARNs []string) {
+		for _, policyARN := range policyARNs {
+			pa := &iamv1beta1.PolicyAttachment{
+				TypeMeta: typeMeta("PolicyAttachment"),
+				Spec: iamv1beta1.PolicyAttachmentSpec{
+					TargetReference: iamv1beta1.TargetReference{Type: targetType, Name: target.Name, Namespace: target.Namespace},
+				},
+			}
+			policyName := policyARN
+			if ref, ok := policyRefs[policyARN]; ok {
+				pa.Spec.PolicyReference = ref
+				policyName = ref.Name
+			} else {
+				pa.Spec.ExternalPolicy = iamv1beta1.ExternalResource{ARN: policyARN}
+				if parsed, err := awsarn.Parse(policyARN); err == nil {
+					policyName = parsed.Resource[strings.LastIndex(parsed.Resource, "/")+1:]
+				}
+			}
+			pa.ObjectMeta = metav1.ObjectMeta{
+				Name:      names.name("PolicyAttachment", fmt.Sprintf("%s-%s-%s", strings.ToLower(string(targetType)), target.Name, policyName)),
+				Namespace: opts.Namespace,
+			}
+			attachments = append(attachments, pa)
+		}
+	}
+	warnInline := func(kind, name string, inline []string) {
+		for _, policy := range inline {
+			res.warnf("inline policy '%s' of %s '%s' is not imported, only managed policies can be attached", policy, kind, name)
+		}
+	}
+
+	for _, r := range acc.Roles {
+		role := &iamv1beta1.Role{
+			TypeMeta:   typeMeta("Role"),
+			ObjectMeta: meta("Role", r.Name, r.ARN),
+			Spec:       iamv1beta1.RoleSpec{Description: r.Description},
+		}
+		statement, err := ConvertTrustPolicyDocument(r.AssumeRolePolicy)
+		if err == nil {
+			role.Spec.AssumeRolePolicy = statement
+		} else if raw, rawErr := rawDocument(r.AssumeRolePolicy, true); rawErr == nil {
+			// only an AssumeRolePolicy can hold a raw trust policy, so the Role references one of its own
+			res.warnf("trust policy of Role '%s' is imported as a raw document of an AssumeRolePolicy, it cannot be expressed as statements: %s", r.Name, err)
+			arp := &iamv1beta1.AssumeRolePolicy{
+				TypeMeta: typeMeta("AssumeRolePolicy"),
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      names.name("AssumeRolePolicy", role.Name),
+					Namespace: opts.Namespace,
+				},
+				Spec: iamv1beta1.AssumeRolePolicySpec{Document: raw},
+			}
+			res.Objects = append(res.Objects, arp)
+			role.Spec.AssumeRolePolicyReference = iamv1beta1.ResourceReference{Name: arp.Name, Namespace: arp.Namespace}
+		} else {
+			res.warnf("skipping Role '%s': trust policy: %s", r.Name, err)
+			continue
+		}
+		if awsName := strings.TrimPrefix(r.Name, opts.ResourcePrefix); awsName != role.Name {
+			role.Spec.AWSRoleName = awsName
+		}
+		if r.MaxSessionDuration != 0 && r.MaxSessionDuration != defaultMaxSessionDuration {
+			duration := r.MaxSessionDuration
+			role.Spec.MaxSessionDuration = &duration
+		}
+		warnPath(res, "Role", r.Name, r.Path)
+		warnInline("Role", r.Name, r.InlinePolicies)
+		res.Objects = append(res.Objects, role)
+		attach(iamv1beta1.RoleTargetType, role.ObjectMeta, r.AttachedPolicies)
+	}
+
+	userRefs := map[string]v1.ObjectReference{}
+	for _, u := range acc.Users {
+		user := &iamv1beta1.User{
+			TypeMeta:   typeMeta("User"),
+			ObjectMeta: meta("User", u.Name, u.ARN),
+		}
+		warnRenamed(res, "User", u.Name, opts.ResourcePrefix+user.Name)
+		warnPath(res, "User", u.Name, u.Path)
+		warnInline("User", u.Name, u.InlinePolicies)
+		userRefs[u.Name] = v1.ObjectReference{Name: user.Name, Namespace: user.Namespace}
+		res.Objects = append(res.Objects, user)
+		attach(iamv1beta1.UserTargetType, user.ObjectMeta, u.AttachedPolicies)
+	}
+
+	for _, g := range acc.Groups {
+		group := &iamv1beta1.Group{
+			TypeMeta:   typeMeta("Group"),
+			ObjectMeta: meta("Group", g.Name, g.ARN),
+		}
+		for _, userName := range g.Users {
+			ref, ok := userRefs[userName]
+			if !ok {
+				res.warnf("User '%s' of Group '%s' is not imported, it's left out of the Group", userName, g.Name)
+				continue
+			}
+			group.Spec.Users = append(group.Spec.Users, ref)
+		}
+		warnRenamed(res, "Group", g.Name, opts.ResourcePrefix+group.Name)
+		warnPath(res, "Group", g.Name, g.Path)
+		warnInline("Group", g.Name, g.InlinePolicies)
+		res.Objects = append(res.Objects, group)
+		attach(iamv1beta1.GroupTargetType, group.ObjectMeta, g.AttachedPolicies)
+	}
+
+	for _, pa := range attachments {
+		res.Objects = append(res.Objects, pa)
+	}
+	return res
+}
+
+// warnPath warns about IAM objects with a path, as the operator creates objects without one
+func warnPath(res *Result, kind, name, path string) {
+	if path != "" && path != "/" {
+		res.warnf("%s '%s' has the path '%s', which is lost if the operator ever recreates it", kind, name, path)
+	}
+}
+
+// warnRenamed warns about Users and Groups, which the operator would give a different name. Unlike Roles and Policies,
+// their name cannot be specified.
+func warnRenamed(res *Result, kind, name, operatorName string) {
+	if name != operatorName {
+		res.warnf("%s '%s' is renamed to '%s' by the operator, once it updates or recreates it", kind, name, operatorName)
+	}
+}
+
+// namer turns IAM names into unique names of Kubernetes resources
+type namer struct {
+	used map[string]bool
+}
+
+func newNamer() *namer {
+	return &namer{used: map[string]bool{}}
+}
+
+var invalidNameChars = regexp.MustCompile(`[^a-z0-9.-]+`)
+
+// name returns a valid resource name for the given IAM name, which is unique for the kind
+func (n *namer) name(kind, iamName string) string {
+	base := invalidNameChars.ReplaceAllString(strings.ToLower(iamName), "-")
+	base = strings.Trim(base, "-.")
+	if len(base) > 240 {
+		base = strings.Trim(base[:240], "-.")
+	}
+	if base == "" {
+		base = strings.ToLower(kind)
+	}
+
+	name := base
+	for i := 2; n.used[kind+"/"+name]; i++ {
+		name = fmt.Sprintf("%s-%d", base, i)
+	}
+	n.used[kind+"/"+name] = true
+	return name
+}
+
+// WriteYAML writes the objects as a multi-document YAML stream. The empty status and creation timestamp are left out.
+func WriteYAML(w io.Writer, objs []runtime.Object) error {
+	for _, obj := range objs {
+		data, err := json.Marshal(obj)
+		if err != nil {
+			return err
+		}
+		var m map[string]interface{}
+		if err := json.Unmarshal(data, &m); err != nil {
+			return err
+		}
+		delete(m, "status")
+		if metadata, ok := m["metadata"].(map[string]interface{}); ok {
+			delete(metadata, "creationTimestamp")
+		}
+
+		out, err := yaml.Marshal(m)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "---\n%s", out); err != nil {
+			return err
+		}
+	}
+	return nil
+}
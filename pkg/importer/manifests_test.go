@@ -0,0 +1,176 @@
+package importer
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	iamv1beta1 "github.com/redradrat/aws-iam-operator/api/v1beta1"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+// TestGenerateGolden generates the manifests of the recorded fixture in testdata/account.json, and compares them and
+// the warnings with the golden files. Run the test with -update after intended changes.
+func TestGenerateGolden(t *testing.T) {
+	acc, err := LoadAccount(filepath.Join("testdata", "account.json"))
+	if err != nil {
+		t.Fatalf("LoadAccount() error = %v", err)
+	}
+	res := Generate(acc, Options{Namespace: "imported", ResourcePrefix: "prefix-"})
+
+	manifests := bytes.Buffer{}
+	if err := WriteYAML(&manifests, res.Objects); err != nil {
+		t.Fatalf("WriteYAML() error = %v", err)
+	}
+	compareGolden(t, filepath.Join("testdata", "account.golden.yaml"), manifests.Bytes())
+	compareGolden(t, filepath.Join("testdata", "account.warnings.golden"), []byte(strings.Join(res.Warnings, "\n")+"\n"))
+}
+
+func compareGolden(t *testing.T, path string, got []byte) {
+	t.Helper()
+	if *update {
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s differs, got:\n%s", path, got)
+	}
+}
+
+func TestLoadAccountRejectsUnknownFields(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "account.json")
+	if err := os.WriteFile(path, []byte(`{"roles": [], "buckets": []}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadAccount(path); err == nil {
+		t.Error("LoadAccount() accepted a fixture with unknown fields")
+	}
+}
+
+func TestAccountSaveLoad(t *testing.T) {
+	acc, err := LoadAccount(filepath.Join("testdata", "account.json"))
+	if err != nil {
+		t.Fatalf("LoadAccount() error = %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "account.json")
+	if err := acc.Save(path); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	loaded, err := LoadAccount(path)
+	if err != nil {
+		t.Fatalf("LoadAccount() of a saved Account error = %v", err)
+	}
+	if len(loaded.Roles) != len(acc.Roles) || len(loaded.Policies) != len(acc.Policies) || !reflect.DeepEqual(loaded.Groups, acc.Groups) {
+		t.Errorf("saved Account differs, got %+v, want %+v", loaded, acc)
+	}
+}
+
+func TestNamer(t *testing.T) {
+	tests := []struct {
+		name     string
+		kind     string
+		iamNames []string
+		want     []string
+	}{
+		{
+			name:     "lowercases and replaces invalid characters",
+			kind:     "Role",
+			iamNames: []string{"My_App+Role@prod"},
+			want:     []string{"my-app-role-prod"},
+		},
+		{
+			name:     "trims dashes and dots",
+			kind:     "Role",
+			iamNames: []string{"_app_."},
+			want:     []string{"app"},
+		},
+		{
+			name:     "falls back to the kind",
+			kind:     "Policy",
+			iamNames: []string{"___"},
+			want:     []string{"policy"},
+		},
+		{
+			name:     "numbers colliding names",
+			kind:     "Role",
+			iamNames: []string{"App_Role", "app-role", "APP+ROLE"},
+			want:     []string{"app-role", "app-role-2", "app-role-3"},
+		},
+		{
+			name:     "truncates long names",
+			kind:     "User",
+			iamNames: []string{strings.Repeat("a", 239) + "-b"},
+			want:     []string{strings.Repeat("a", 239)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := newNamer()
+			var got []string
+			for _, iamName := range tt.iamNames {
+				got = append(got, n.name(tt.kind, iamName))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("name() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNamerKeepsKindsApart(t *testing.T) {
+	n := newNamer()
+	if role, policy := n.name("Role", "app"), n.name("Policy", "app"); role != "app" || policy != "app" {
+		t.Errorf("names of different kinds collide: Role '%s', Policy '%s'", role, policy)
+	}
+}
+
+func TestGenerateCollisions(t *testing.T) {
+	acc := &Account{
+		Users: []User{
+			{Name: "Alice", ARN: "arn:aws:iam::123456789012:user/Alice", AttachedPolicies: []string{"arn:aws:iam::aws:policy/ReadOnlyAccess"}},
+			{Name: "alice", ARN: "arn:aws:iam::123456789012:user/alice", AttachedPolicies: []string{"arn:aws:iam::aws:policy/ReadOnlyAccess"}},
+		},
+		Groups: []Group{
+			{Name: "devs", ARN: "arn:aws:iam::123456789012:group/devs", Users: []string{"Alice", "alice"}},
+		},
+	}
+	res := Generate(acc, Options{Namespace: "imported"})
+
+	var users, attachments []string
+	var group *iamv1beta1.Group
+	for _, obj := range res.Objects {
+		switch obj := obj.(type) {
+		case *iamv1beta1.User:
+			users = append(users, obj.Name)
+		case *iamv1beta1.PolicyAttachment:
+			attachments = append(attachments, obj.Name)
+			if obj.Spec.ExternalPolicy.ARN != "arn:aws:iam::aws:policy/ReadOnlyAccess" {
+				t.Errorf("PolicyAttachment '%s' attaches '%s'", obj.Name, obj.Spec.ExternalPolicy.ARN)
+			}
+		case *iamv1beta1.Group:
+			group = obj
+		}
+	}
+
+	if want := []string{"alice", "alice-2"}; !reflect.DeepEqual(users, want) {
+		t.Errorf("Users = %v, want %v", users, want)
+	}
+	if want := []string{"user-alice-readonlyaccess", "user-alice-2-readonlyaccess"}; !reflect.DeepEqual(attachments, want) {
+		t.Errorf("PolicyAttachments = %v, want %v", attachments, want)
+	}
+	if group == nil || len(group.Spec.Users) != 2 || group.Spec.Users[0].Name != "alice" || group.Spec.Users[1].Name != "alice-2" {
+		t.Errorf("Group does not reference both Users: %+v", group)
+	}
+}
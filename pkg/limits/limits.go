@@ -0,0 +1,61 @@
+// Package limits checks policy documents and attachments against the IAM quotas, before anything is sent to AWS.
+package limits
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/redradrat/cloud-objects/aws/iam"
+)
+
+const (
+	// ManagedPolicySizeLimit is the maximum size of a managed policy document in characters. It cannot be raised.
+	ManagedPolicySizeLimit = 6144
+	// DefaultTrustPolicySizeLimit is the default maximum size of a role trust policy in characters. The quota can be
+	// raised to 4096.
+	DefaultTrustPolicySizeLimit = 2048
+	// DefaultAttachedPoliciesLimit is the default maximum number of managed policies attached to a role, user or
+	// group. The quota can be raised to 20 (10 for groups).
+	DefaultAttachedPoliciesLimit = 10
+)
+
+// DocumentSize returns the size of the given policy document, as IAM counts it: the number of characters of the
+// minified JSON.
+func DocumentSize(doc iam.PolicyDocument) (int, error) {
+	buf := bytes.Buffer{}
+	enc := json.NewEncoder(&buf)
+	// we want the characters as they are, not escaped for HTML
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(doc); err != nil {
+		return 0, err
+	}
+	return utf8.RuneCount(bytes.TrimSpace(buf.Bytes())), nil
+}
+
+// CheckDocumentSize returns an error, if the given document is larger than the given limit
+func CheckDocumentSize(doc iam.PolicyDocument, limit int) error {
+	size, err := DocumentSize(doc)
+	if err != nil {
+		return err
+	}
+	return CheckSize(size, limit)
+}
+
+// CheckSize returns an error, if a policy document of the given size is larger than the given limit
+func CheckSize(size, limit int) error {
+	if size > limit {
+		return fmt.Errorf("policy document has %d characters, which exceeds the IAM limit of %d", size, limit)
+	}
+	return nil
+}
+
+// CheckAttachedPolicies returns an error, if attaching another policy to a principal with the given number of
+// attached policies would exceed the given limit
+func CheckAttachedPolicies(attached, limit int) error {
+	if attached >= limit {
+		return fmt.Errorf("principal already has %d attached policies, which is the IAM limit of %d", attached, limit)
+	}
+	return nil
+}
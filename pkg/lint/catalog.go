@@ -0,0 +1,100 @@
+package lint
+
+import (
+	_ "embed"
+	"encoding/json"
+	"strings"
+)
+
+// catalog.json holds a bundled (and necessarily incomplete) list of IAM actions and condition keys, so the linter can
+// run without access to AWS. Condition keys ending in '/' or ':' are prefixes e.g. "aws:RequestTag/".
+//
+//go:embed catalog.json
+var catalogJSON []byte
+
+type catalog struct {
+	GlobalConditionKeys []string                  `json:"globalConditionKeys"`
+	Services            map[string]catalogService `json:"services"`
+}
+
+type catalogService struct {
+	Actions       []string `json:"actions"`
+	ConditionKeys []string `json:"conditionKeys"`
+}
+
+var bundledCatalog = mustLoadCatalog()
+
+func mustLoadCatalog() catalog {
+	c := catalog{}
+	if err := json.Unmarshal(catalogJSON, &c); err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// service returns the catalog entry of the given service prefix
+func (c catalog) service(prefix string) (catalogService, bool) {
+	svc, ok := c.Services[strings.ToLower(prefix)]
+	return svc, ok
+}
+
+// hasAction returns true, if the service has an action of that name. Action names are case-insensitive.
+func (s catalogService) hasAction(name string) bool {
+	for _, action := range s.Actions {
+		if strings.EqualFold(action, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// closestAction returns the action of the service closest to the given name, if it's close enough to be a typo
+func (s catalogService) closestAction(name string) (string, bool) {
+	best, bestDistance := "", 3
+	for _, action := range s.Actions {
+		if d := distance(strings.ToLower(action), strings.ToLower(name)); d < bestDistance {
+			best, bestDistance = action, d
+		}
+	}
+	return best, best != ""
+}
+
+// hasConditionKey returns true, if the given key is a known global or service condition key
+func (c catalog) hasConditionKey(key string) bool {
+	keys := c.GlobalConditionKeys
+	if prefix := strings.SplitN(key, ":", 2)[0]; !strings.EqualFold(prefix, "aws") {
+		svc, _ := c.service(prefix)
+		keys = svc.ConditionKeys
+	}
+	for _, known := range keys {
+		if strings.EqualFold(known, key) {
+			return true
+		}
+		if (strings.HasSuffix(known, "/") || strings.HasSuffix(known, ":")) && len(key) > len(known) &&
+			strings.EqualFold(known, key[:len(known)]) {
+			return true
+		}
+	}
+	return false
+}
+
+// distance returns the Levenshtein distance of the given strings
+func distance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
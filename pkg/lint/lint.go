@@ -0,0 +1,321 @@
+// Package lint checks IAM policy documents for malformed or dangerous statements. It runs fully offline against a
+// bundled catalog of IAM actions and condition keys.
+package lint
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/redradrat/cloud-objects/aws/iam"
+
+	iamv1beta1 "github.com/redradrat/aws-iam-operator/api/v1beta1"
+)
+
+// Severity of a Finding
+type Severity string
+
+const (
+	// ErrorSeverity findings would be rejected by AWS, or are considered too dangerous to apply
+	ErrorSeverity Severity = "Error"
+	// WarningSeverity findings are probably mistakes, but the policy can be applied anyway
+	WarningSeverity Severity = "Warning"
+)
+
+// Finding is a single problem found in a policy document
+type Finding struct {
+	Severity  Severity
+	Statement int
+	Message   string
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("statement %d: %s", f.Statement, f.Message)
+}
+
+// Result holds all findings of a policy document
+type Result struct {
+	Findings []Finding
+}
+
+// Errors returns all findings of ErrorSeverity
+func (r Result) Errors() []Finding {
+	return r.filter(ErrorSeverity)
+}
+
+// Warnings returns all findings of WarningSeverity
+func (r Result) Warnings() []Finding {
+	return r.filter(WarningSeverity)
+}
+
+func (r Result) filter(severity Severity) []Finding {
+	var findings []Finding
+	for _, f := range r.Findings {
+		if f.Severity == severity {
+			findings = append(findings, f)
+		}
+	}
+	return findings
+}
+
+// Error returns an error describing all findings of ErrorSeverity, or nil if there are none
+func (r Result) Error() error {
+	errs := r.Errors()
+	if len(errs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("policy is invalid: %s", Join(errs))
+}
+
+// Join joins the messages of the given findings
+func Join(findings []Finding) string {
+	var msgs []string
+	for _, f := range findings {
+		msgs = append(msgs, f.String())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Options configures the linter
+type Options struct {
+	// Partition is the AWS partition all resource ARNs have to be in e.g. "aws"
+	Partition string
+}
+
+// PartitionForRegion returns the AWS partition of the given region
+func PartitionForRegion(region string) string {
+	switch {
+	case strings.HasPrefix(region, "cn-"):
+		return "aws-cn"
+	case strings.HasPrefix(region, "us-gov-"):
+		return "aws-us-gov"
+	case strings.HasPrefix(region, "us-iso-"):
+		return "aws-iso"
+	case strings.HasPrefix(region, "us-isob-"):
+		return "aws-iso-b"
+	}
+	return "aws"
+}
+
+// LintPolicy lints the statements of the given Policy
+func LintPolicy(policy *iamv1beta1.Policy, opts Options) Result {
+	return Lint(policy.Marshal(), false, opts)
+}
+
+// LintAssumeRolePolicy lints the given trust policy statements
+func LintAssumeRolePolicy(statement iamv1beta1.AssumeRolePolicyStatement, opts Options) Result {
+	return Lint(statement.MarshalPolicyDocument(), true, opts)
+}
+
+var (
+	sidPattern    = regexp.MustCompile(`^[a-zA-Z0-9]*$`)
+	actionPattern = regexp.MustCompile(`^([a-zA-Z0-9*?-]+):([a-zA-Z0-9*?]+)$`)
+)
+
+// operators holds all IAM condition operators without the IfExists suffix and set operator prefixes
+var operators = []string{
+	"StringEquals", "StringNotEquals", "StringEqualsIgnoreCase", "StringNotEqualsIgnoreCase", "StringLike",
+	"StringNotLike", "NumericEquals", "NumericNotEquals", "NumericLessThan", "NumericLessThanEquals",
+	"NumericGreaterThan", "NumericGreaterThanEquals", "DateEquals", "DateNotEquals", "DateLessThan",
+	"DateLessThanEquals", "DateGreaterThan", "DateGreaterThanEquals", "Bool", "BinaryEquals", "IpAddress",
+	"NotIpAddress", "ArnEquals", "ArnLike", "ArnNotEquals", "ArnNotLike", "Null",
+}
+
+// principalTypes holds the valid keys of a Principal element
+var principalTypes = []string{"AWS", "Service", "Federated", "CanonicalUser"}
+
+// trustActions holds the actions, which make sense in a trust policy
+var trustActions = []string{
+	"sts:AssumeRole", "sts:AssumeRoleWithWebIdentity", "sts:AssumeRoleWithSAML", "sts:TagSession",
+	"sts:SetSourceIdentity", "sts:SetContext",
+}
+
+// Lint checks the given policy document. If trust is true, the document is checked as a trust (assume role) policy.
+func Lint(doc iam.PolicyDocument, trust bool, opts Options) Result {
+	l := linter{opts: opts, trust: trust}
+	sids := map[string]bool{}
+	for i, stmt := range doc.Statement {
+		l.stmt = i
+
+		if stmt.Sid != "" {
+			if !sidPattern.MatchString(stmt.Sid) {
+				l.errorf("sid '%s' may only contain alphanumeric characters", stmt.Sid)
+			}
+			if sids[stmt.Sid] {
+				l.errorf("sid '%s' is not unique", stmt.Sid)
+			}
+			sids[stmt.Sid] = true
+		}
+
+		if stmt.Effect != iamv1beta1.AllowPolicyStatementEffect.String() && stmt.Effect != iamv1beta1.DenyPolicyStatementEffect.String() {
+			l.errorf("effect '%s' is neither Allow nor Deny", stmt.Effect)
+		}
+
+		l.actions(stmt)
+		if trust {
+			l.principals(stmt)
+		} else {
+			l.resources(stmt)
+		}
+		l.conditions(stmt)
+	}
+	return l.result
+}
+
+type linter struct {
+	opts   Options
+	trust  bool
+	stmt   int
+	result Result
+}
+
+func (l *linter) errorf(format string, args ...interface{}) {
+	l.result.Findings = append(l.result.Findings, Finding{Severity: ErrorSeverity, Statement: l.stmt, Message: fmt.Sprintf(format, args...)})
+}
+
+func (l *linter) warnf(format string, args ...interface{}) {
+	l.result.Findings = append(l.result.Findings, Finding{Severity: WarningSeverity, Statement: l.stmt, Message: fmt.Sprintf(format, args...)})
+}
+
+func (l *linter) actions(stmt iam.StatementEntry) {
+	if len(stmt.Action) == 0 {
+		l.errorf("no actions given")
+	}
+	allow := stmt.Effect == iamv1beta1.AllowPolicyStatementEffect.String()
+
+	for _, action := range stmt.Action {
+		if action == "*" {
+			if allow {
+				l.warnf("action '*' grants all actions of all services")
+			}
+			continue
+		}
+
+		parts := actionPattern.FindStringSubmatch(action)
+		if parts == nil {
+			l.errorf("action '%s' is not of the form 'service:action'", action)
+			continue
+		}
+		service, name := parts[1], parts[2]
+
+		if strings.ContainsAny(service, "*?") {
+			l.errorf("action '%s' uses a wildcard in the service prefix", action)
+			continue
+		}
+
+		if l.trust && !containsFold(trustActions, action) {
+			l.warnf("action '%s' has no effect in a trust policy", action)
+		}
+
+		svc, ok := bundledCatalog.service(service)
+		if !ok {
+			l.warnf("service prefix '%s' of action '%s' is unknown", service, action)
+			continue
+		}
+		if name == "*" {
+			if allow {
+				l.warnf("action '%s' grants all actions of the service", action)
+			}
+			continue
+		}
+		if strings.ContainsAny(name, "*?") || svc.hasAction(name) {
+			continue
+		}
+		if closest, ok := svc.closestAction(name); ok {
+			l.warnf("action '%s' is unknown, did you mean '%s:%s'?", action, strings.ToLower(service), closest)
+		}
+	}
+}
+
+func (l *linter) resources(stmt iam.StatementEntry) {
+	if len(stmt.Resource) == 0 {
+		l.errorf("no resources given")
+	}
+
+	for _, resource := range stmt.Resource {
+		if resource == "*" {
+			continue
+		}
+		if !strings.HasPrefix(resource, "arn:") {
+			l.errorf("resource '%s' is neither '*' nor an ARN", resource)
+			continue
+		}
+		// the partition variable holds a colon itself
+		parts := strings.SplitN(strings.Replace(resource, "${aws:partition}", "*", 1), ":", 6)
+		if len(parts) < 6 {
+			l.errorf("resource '%s' is not a valid ARN", resource)
+			continue
+		}
+		if partition := parts[1]; l.opts.Partition != "" && partition != "*" && partition != l.opts.Partition {
+			l.errorf("resource '%s' is in partition '%s', but the operator manages partition '%s'", resource, partition, l.opts.Partition)
+		}
+	}
+}
+
+func (l *linter) principals(stmt iam.StatementEntry) {
+	if len(stmt.Principal) == 0 {
+		l.errorf("no principal given")
+	}
+
+	for _, principalType := range sortedKeys(stmt.Principal) {
+		principal := stmt.Principal[principalType]
+		if !containsFold(principalTypes, principalType) {
+			l.errorf("principal type '%s' is not one of %s", principalType, strings.Join(principalTypes, ", "))
+		}
+		if principal == "*" && stmt.Effect == iamv1beta1.AllowPolicyStatementEffect.String() {
+			l.warnf("principal '*' allows anyone to assume the role")
+		}
+	}
+}
+
+func (l *linter) conditions(stmt iam.StatementEntry) {
+	for _, operator := range sortedKeys(stmt.Condition) {
+		if !validOperator(operator) {
+			l.errorf("condition operator '%s' is unknown", operator)
+		}
+		for _, key := range sortedKeys(stmt.Condition[operator]) {
+			prefix := strings.SplitN(key, ":", 2)[0]
+			if _, ok := bundledCatalog.service(prefix); !ok && !strings.EqualFold(prefix, "aws") {
+				// e.g. the keys of an OIDC provider, we know nothing about
+				continue
+			}
+			if !bundledCatalog.hasConditionKey(key) {
+				l.warnf("condition key '%s' is unknown", key)
+			}
+		}
+	}
+}
+
+func validOperator(operator string) bool {
+	operator = strings.TrimPrefix(operator, "ForAllValues:")
+	operator = strings.TrimPrefix(operator, "ForAnyValue:")
+	if operator != "NullIfExists" {
+		operator = strings.TrimSuffix(operator, "IfExists")
+	}
+	for _, op := range operators {
+		if op == operator {
+			return true
+		}
+	}
+	return false
+}
+
+// sortedKeys returns the keys of the given map in order, so our findings are stable
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,279 @@
+package lint
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/redradrat/cloud-objects/aws/iam"
+
+	iamv1beta1 "github.com/redradrat/aws-iam-operator/api/v1beta1"
+)
+
+func allow(actions ...string) iam.StatementEntry {
+	return iam.StatementEntry{Effect: "Allow", Action: actions, Resource: []string{"*"}}
+}
+
+func errorFinding(statement int, message string) Finding {
+	return Finding{Severity: ErrorSeverity, Statement: statement, Message: message}
+}
+
+func warningFinding(statement int, message string) Finding {
+	return Finding{Severity: WarningSeverity, Statement: statement, Message: message}
+}
+
+func TestLint(t *testing.T) {
+	tests := []struct {
+		name       string
+		statements []iam.StatementEntry
+		trust      bool
+		partition  string
+		want       []Finding
+	}{
+		// statement IDs and effects
+		{
+			name:       "alphanumeric unique sids",
+			statements: []iam.StatementEntry{{Sid: "Read1", Effect: "Allow", Action: []string{"s3:GetObject"}, Resource: []string{"*"}}, {Sid: "Read2", Effect: "Allow", Action: []string{"s3:GetObject"}, Resource: []string{"*"}}},
+		},
+		{
+			name:       "sid with invalid characters",
+			statements: []iam.StatementEntry{{Sid: "read-objects", Effect: "Allow", Action: []string{"s3:GetObject"}, Resource: []string{"*"}}},
+			want:       []Finding{errorFinding(0, "sid 'read-objects' may only contain alphanumeric characters")},
+		},
+		{
+			name:       "duplicate sids",
+			statements: []iam.StatementEntry{{Sid: "Read", Effect: "Allow", Action: []string{"s3:GetObject"}, Resource: []string{"*"}}, {Sid: "Read", Effect: "Deny", Action: []string{"s3:GetObject"}, Resource: []string{"*"}}},
+			want:       []Finding{errorFinding(1, "sid 'Read' is not unique")},
+		},
+		{
+			name:       "invalid effect",
+			statements: []iam.StatementEntry{{Effect: "allow", Action: []string{"s3:GetObject"}, Resource: []string{"*"}}},
+			want:       []Finding{errorFinding(0, "effect 'allow' is neither Allow nor Deny")},
+		},
+
+		// actions
+		{
+			name:       "known actions and wildcards in action names",
+			statements: []iam.StatementEntry{allow("s3:GetObject", "s3:get*", "S3:PutObject")},
+		},
+		{
+			name:       "no actions",
+			statements: []iam.StatementEntry{allow()},
+			want:       []Finding{errorFinding(0, "no actions given")},
+		},
+		{
+			name:       "all actions allowed",
+			statements: []iam.StatementEntry{allow("*")},
+			want:       []Finding{warningFinding(0, "action '*' grants all actions of all services")},
+		},
+		{
+			name:       "all actions denied",
+			statements: []iam.StatementEntry{{Effect: "Deny", Action: []string{"*", "s3:*"}, Resource: []string{"*"}}},
+		},
+		{
+			name:       "malformed action",
+			statements: []iam.StatementEntry{allow("s3GetObject")},
+			want:       []Finding{errorFinding(0, "action 's3GetObject' is not of the form 'service:action'")},
+		},
+		{
+			name:       "wildcard in the service prefix",
+			statements: []iam.StatementEntry{allow("s*:GetObject")},
+			want:       []Finding{errorFinding(0, "action 's*:GetObject' uses a wildcard in the service prefix")},
+		},
+		{
+			name:       "unknown service",
+			statements: []iam.StatementEntry{allow("foo:GetBar")},
+			want:       []Finding{warningFinding(0, "service prefix 'foo' of action 'foo:GetBar' is unknown")},
+		},
+		{
+			name:       "all actions of a service allowed",
+			statements: []iam.StatementEntry{allow("s3:*")},
+			want:       []Finding{warningFinding(0, "action 's3:*' grants all actions of the service")},
+		},
+		{
+			name:       "typo in an action",
+			statements: []iam.StatementEntry{allow("s3:GetObjct")},
+			want:       []Finding{warningFinding(0, "action 's3:GetObjct' is unknown, did you mean 's3:GetObject'?")},
+		},
+		{
+			name:       "unknown action far from known ones",
+			statements: []iam.StatementEntry{allow("s3:FrobnicateEverything")},
+		},
+
+		// resources
+		{
+			name:       "valid resources",
+			statements: []iam.StatementEntry{{Effect: "Allow", Action: []string{"s3:GetObject"}, Resource: []string{"*", "arn:aws:s3:::bucket/*", "arn:${aws:partition}:s3:::other/*"}}},
+			partition:  "aws",
+		},
+		{
+			name:       "no resources",
+			statements: []iam.StatementEntry{{Effect: "Allow", Action: []string{"s3:GetObject"}}},
+			want:       []Finding{errorFinding(0, "no resources given")},
+		},
+		{
+			name:       "resource which is no ARN",
+			statements: []iam.StatementEntry{{Effect: "Allow", Action: []string{"s3:GetObject"}, Resource: []string{"bucket"}}},
+			want:       []Finding{errorFinding(0, "resource 'bucket' is neither '*' nor an ARN")},
+		},
+		{
+			name:       "truncated ARN",
+			statements: []iam.StatementEntry{{Effect: "Allow", Action: []string{"s3:GetObject"}, Resource: []string{"arn:aws:s3"}}},
+			want:       []Finding{errorFinding(0, "resource 'arn:aws:s3' is not a valid ARN")},
+		},
+		{
+			name:       "resource in another partition",
+			statements: []iam.StatementEntry{{Effect: "Allow", Action: []string{"s3:GetObject"}, Resource: []string{"arn:aws-cn:s3:::bucket"}}},
+			partition:  "aws",
+			want:       []Finding{errorFinding(0, "resource 'arn:aws-cn:s3:::bucket' is in partition 'aws-cn', but the operator manages partition 'aws'")},
+		},
+
+		// trust policies
+		{
+			name:       "valid trust statement",
+			statements: []iam.StatementEntry{{Effect: "Allow", Action: []string{"sts:AssumeRole", "sts:TagSession"}, Principal: map[string]string{"Service": "ec2.amazonaws.com"}}},
+			trust:      true,
+		},
+		{
+			name:       "action without effect in a trust policy",
+			statements: []iam.StatementEntry{{Effect: "Allow", Action: []string{"s3:GetObject"}, Principal: map[string]string{"AWS": "arn:aws:iam::123456789012:root"}}},
+			trust:      true,
+			want:       []Finding{warningFinding(0, "action 's3:GetObject' has no effect in a trust policy")},
+		},
+		{
+			name:       "no principal",
+			statements: []iam.StatementEntry{{Effect: "Allow", Action: []string{"sts:AssumeRole"}}},
+			trust:      true,
+			want:       []Finding{errorFinding(0, "no principal given")},
+		},
+		{
+			name:       "invalid principal type",
+			statements: []iam.StatementEntry{{Effect: "Allow", Action: []string{"sts:AssumeRole"}, Principal: map[string]string{"User": "alice"}}},
+			trust:      true,
+			want:       []Finding{errorFinding(0, "principal type 'User' is not one of AWS, Service, Federated, CanonicalUser")},
+		},
+		{
+			name:       "anyone may assume the role",
+			statements: []iam.StatementEntry{{Effect: "Allow", Action: []string{"sts:AssumeRole"}, Principal: map[string]string{"AWS": "*"}}},
+			trust:      true,
+			want:       []Finding{warningFinding(0, "principal '*' allows anyone to assume the role")},
+		},
+		{
+			name:       "anyone is denied",
+			statements: []iam.StatementEntry{{Effect: "Deny", Action: []string{"sts:AssumeRole"}, Principal: map[string]string{"AWS": "*"}}},
+			trust:      true,
+		},
+
+		// conditions
+		{
+			name: "known operators and keys",
+			statements: []iam.StatementEntry{{Effect: "Allow", Action: []string{"s3:GetObject"}, Resource: []string{"*"}, Condition: map[string]map[string][]string{
+				"StringEqualsIfExists":      {"aws:SourceVpc": {"vpc-1"}},
+				"ForAllValues:StringEquals": {"aws:TagKeys": {"team"}},
+				"StringLike":                {"s3:ExistingObjectTag/team": {"a*"}},
+				"Null":                      {"aws:SecureTransport": {"false"}},
+			}}},
+		},
+		{
+			name: "IfExists on Null",
+			statements: []iam.StatementEntry{{Effect: "Allow", Action: []string{"s3:GetObject"}, Resource: []string{"*"}, Condition: map[string]map[string][]string{
+				"NullIfExists": {"aws:SecureTransport": {"false"}},
+			}}},
+			want: []Finding{errorFinding(0, "condition operator 'NullIfExists' is unknown")},
+		},
+		{
+			name: "unknown operator",
+			statements: []iam.StatementEntry{{Effect: "Allow", Action: []string{"s3:GetObject"}, Resource: []string{"*"}, Condition: map[string]map[string][]string{
+				"StringEqual": {"aws:SourceVpc": {"vpc-1"}},
+			}}},
+			want: []Finding{errorFinding(0, "condition operator 'StringEqual' is unknown")},
+		},
+		{
+			name: "unknown condition key of a known service",
+			statements: []iam.StatementEntry{{Effect: "Allow", Action: []string{"s3:GetObject"}, Resource: []string{"*"}, Condition: map[string]map[string][]string{
+				"StringEquals": {"aws:SourceVcp": {"vpc-1"}},
+			}}},
+			want: []Finding{warningFinding(0, "condition key 'aws:SourceVcp' is unknown")},
+		},
+		{
+			name: "condition key of an OIDC provider",
+			statements: []iam.StatementEntry{{Effect: "Allow", Action: []string{"sts:AssumeRoleWithWebIdentity"}, Principal: map[string]string{"Federated": "arn:aws:iam::123456789012:oidc-provider/oidc.example.com"}, Condition: map[string]map[string][]string{
+				"StringEquals": {"oidc.example.com:sub": {"system:serviceaccount:apps:app"}},
+			}}},
+			trust: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := iam.PolicyDocument{Version: iamv1beta1.PolicyVersion, Statement: tt.statements}
+			got := Lint(doc, tt.trust, Options{Partition: tt.partition})
+			if !reflect.DeepEqual(got.Findings, tt.want) {
+				t.Errorf("Lint() = %v, want %v", got.Findings, tt.want)
+			}
+		})
+	}
+}
+
+func TestResult(t *testing.T) {
+	res := Lint(iam.PolicyDocument{Statement: []iam.StatementEntry{allow("*"), allow()}}, false, Options{})
+	if len(res.Warnings()) != 1 || len(res.Errors()) != 1 {
+		t.Fatalf("Warnings() = %v, Errors() = %v", res.Warnings(), res.Errors())
+	}
+	if err := res.Error(); err == nil || err.Error() != "policy is invalid: statement 1: no actions given" {
+		t.Errorf("Error() = %v", err)
+	}
+
+	if err := Lint(iam.PolicyDocument{Statement: []iam.StatementEntry{allow("*")}}, false, Options{}).Error(); err != nil {
+		t.Errorf("Error() of warnings only = %v, want nil", err)
+	}
+}
+
+func TestLintPolicy(t *testing.T) {
+	policy := &iamv1beta1.Policy{Spec: iamv1beta1.PolicySpec{Statement: iamv1beta1.PolicyStatement{
+		{Effect: iamv1beta1.AllowPolicyStatementEffect, Actions: []string{"s3:GetObject"}, Resources: []string{"arn:aws-cn:s3:::bucket"}},
+	}}}
+	res := LintPolicy(policy, Options{Partition: PartitionForRegion("eu-west-1")})
+	if len(res.Errors()) != 1 {
+		t.Errorf("LintPolicy() = %v, want an error for the partition", res.Findings)
+	}
+
+	trust := iamv1beta1.AssumeRolePolicyStatement{
+		{PolicyStatementEntry: iamv1beta1.PolicyStatementEntry{Effect: iamv1beta1.AllowPolicyStatementEffect, Actions: []string{"sts:AssumeRole"}}, Principal: map[string]string{"Service": "ec2.amazonaws.com"}},
+	}
+	if res := LintAssumeRolePolicy(trust, Options{}); len(res.Findings) != 0 {
+		t.Errorf("LintAssumeRolePolicy() = %v, want no findings", res.Findings)
+	}
+}
+
+func TestPartitionForRegion(t *testing.T) {
+	tests := map[string]string{
+		"eu-west-1":      "aws",
+		"cn-north-1":     "aws-cn",
+		"us-gov-west-1":  "aws-us-gov",
+		"us-iso-east-1":  "aws-iso",
+		"us-isob-east-1": "aws-iso-b",
+	}
+	for region, want := range tests {
+		if got := PartitionForRegion(region); got != want {
+			t.Errorf("PartitionForRegion(%s) = %s, want %s", region, got, want)
+		}
+	}
+}
+
+func TestDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"getobject", "getobject", 0},
+		{"getobject", "getobjct", 1},
+		{"getobject", "putobject", 2},
+		{"getobject", "getobjectacl", 3},
+		{"", "abc", 3},
+	}
+	for _, tt := range tests {
+		if got := distance(tt.a, tt.b); got != tt.want {
+			t.Errorf("distance(%s, %s) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package render
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Diff returns a unified diff of the documents rendered from a previous and the current revision of the manifests.
+// Documents are matched by their ID, documents which could not be rendered show up with their error. Returns an empty
+// string, if nothing changed.
+func Diff(previous, current []Document) string {
+	prev, cur := documentTexts(previous), documentTexts(current)
+
+	var ids []string
+	seen := map[string]bool{}
+	for _, docs := range [][]Document{previous, current} {
+		for _, d := range docs {
+			if !seen[d.ID()] {
+				seen[d.ID()] = true
+				ids = append(ids, d.ID())
+			}
+		}
+	}
+
+	out := strings.Builder{}
+	for _, id := range ids {
+		if prev[id] == cur[id] {
+			continue
+		}
+		fmt.Fprintf(&out, "--- %s\n+++ %s\n", id, id)
+		for _, line := range diffLines(splitLines(prev[id]), splitLines(cur[id])) {
+			out.WriteString(line)
+			out.WriteString("\n")
+		}
+	}
+	return out.String()
+}
+
+func documentTexts(docs []Document) map[string]string {
+	texts := map[string]string{}
+	for _, d := range docs {
+		text, err := d.JSON()
+		if err != nil {
+			text = []byte(fmt.Sprintf("error: %s\n", err))
+		}
+		texts[d.ID()] = string(text)
+	}
+	return texts
+}
+
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// diffLines returns the lines of a and b, prefixed with " ", "-" or "+", based on their longest common subsequence.
+// Policy documents are small, so the quadratic effort doesn't matter.
+func diffLines(a, b []string) []string {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var lines []string
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			lines = append(lines, " "+a[i])
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			lines = append(lines, "-"+a[i])
+			i++
+		default:
+			lines = append(lines, "+"+b[j])
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		lines = append(lines, "-"+a[i])
+	}
+	for ; j < len(b); j++ {
+		lines = append(lines, "+"+b[j])
+	}
+	return lines
+}
@@ -0,0 +1,224 @@
+// Package render turns Policy, Role, AssumeRolePolicy and PolicyAttachment manifests into the IAM JSON the operator
+// would send to AWS. It works fully offline, without access to a cluster or AWS, so ConfigMaps and Secrets holding raw
+// policy documents have to be part of the manifests.
+package render
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/yaml"
+
+	iamv1beta1 "github.com/redradrat/aws-iam-operator/api/v1beta1"
+)
+
+// Manifests holds all resources read from a set of manifests
+type Manifests struct {
+	Policies              []iamv1beta1.Policy
+	Roles                 []iamv1beta1.Role
+	AssumeRolePolicies    []iamv1beta1.AssumeRolePolicy
+	PolicyAttachments     []iamv1beta1.PolicyAttachment
+	IAMConstraints        []iamv1beta1.IAMConstraint
+	ClusterIAMConstraints []iamv1beta1.ClusterIAMConstraint
+	ConfigMaps            []v1.ConfigMap
+	Secrets               []v1.Secret
+}
+
+// LoadFiles reads all manifests from the given paths. A path may be a file, a directory (all *.yaml, *.yml and *.json
+// files in it are read) or "-" for stdin. Resources without a namespace are put into defaultNamespace.
+func LoadFiles(paths []string, defaultNamespace string) (*Manifests, error) {
+	m := &Manifests{}
+	for _, path := range paths {
+		if path == "-" {
+			if err := m.Load(os.Stdin, defaultNamespace); err != nil {
+				return nil, fmt.Errorf("stdin: %w", err)
+			}
+			continue
+		}
+
+		files := []string{path}
+		if info, err := os.Stat(path); err != nil {
+			return nil, err
+		} else if info.IsDir() {
+			files = nil
+			for _, pattern := range []string{"*.yaml", "*.yml", "*.json"} {
+				matches, err := filepath.Glob(filepath.Join(path, pattern))
+				if err != nil {
+					return nil, err
+				}
+				files = append(files, matches...)
+			}
+		}
+
+		for _, file := range files {
+			f, err := os.Open(file)
+			if err != nil {
+				return nil, err
+			}
+			err = m.Load(f, defaultNamespace)
+			f.Close()
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", file, err)
+			}
+		}
+	}
+	return m, nil
+}
+
+// Load reads all documents of a YAML or JSON stream. Documents of other kinds than ours, ConfigMaps and Secrets are
+// skipped.
+func (m *Manifests) Load(r io.Reader, defaultNamespace string) error {
+	reader := utilyaml.NewYAMLReader(bufio.NewReader(r))
+	for {
+		raw, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if len(strings.TrimSpace(string(raw))) == 0 {
+			continue
+		}
+
+		typeMeta := metav1.TypeMeta{}
+		if err := yaml.Unmarshal(raw, &typeMeta); err != nil {
+			return err
+		}
+		if typeMeta.GroupVersionKind().GroupVersion() == v1.SchemeGroupVersion {
+			if err := m.loadCore(raw, typeMeta.Kind, defaultNamespace); err != nil {
+				return err
+			}
+			continue
+		}
+		if typeMeta.GroupVersionKind().GroupVersion() != iamv1beta1.GroupVersion {
+			continue
+		}
+
+		var obj interface {
+			GetNamespace() string
+			SetNamespace(string)
+		}
+		switch typeMeta.Kind {
+		case "Policy":
+			m.Policies = append(m.Policies, iamv1beta1.Policy{})
+			obj = &m.Policies[len(m.Policies)-1]
+		case "Role":
+			m.Roles = append(m.Roles, iamv1beta1.Role{})
+			obj = &m.Roles[len(m.Roles)-1]
+		case "AssumeRolePolicy":
+			m.AssumeRolePolicies = append(m.AssumeRolePolicies, iamv1beta1.AssumeRolePolicy{})
+			obj = &m.AssumeRolePolicies[len(m.AssumeRolePolicies)-1]
+		case "PolicyAttachment":
+			m.PolicyAttachments = append(m.PolicyAttachments, iamv1beta1.PolicyAttachment{})
+			obj = &m.PolicyAttachments[len(m.PolicyAttachments)-1]
+		case "IAMConstraint":
+			m.IAMConstraints = append(m.IAMConstraints, iamv1beta1.IAMConstraint{})
+			obj = &m.IAMConstraints[len(m.IAMConstraints)-1]
+		case "ClusterIAMConstraint":
+			m.ClusterIAMConstraints = append(m.ClusterIAMConstraints, iamv1beta1.ClusterIAMConstraint{})
+			// cluster scoped, so there's no namespace to default
+			if err := yaml.UnmarshalStrict(raw, &m.ClusterIAMConstraints[len(m.ClusterIAMConstraints)-1]); err != nil {
+				return err
+			}
+			continue
+		default:
+			continue
+		}
+
+		if err := yaml.UnmarshalStrict(raw, obj); err != nil {
+			return err
+		}
+		if obj.GetNamespace() == "" {
+			obj.SetNamespace(defaultNamespace)
+		}
+	}
+}
+
+// loadCore reads a ConfigMap or Secret, raw policy documents may be read from. Other core kinds are skipped.
+func (m *Manifests) loadCore(raw []byte, kind, defaultNamespace string) error {
+	var obj metav1.Object
+	switch kind {
+	case "ConfigMap":
+		m.ConfigMaps = append(m.ConfigMaps, v1.ConfigMap{})
+		obj = &m.ConfigMaps[len(m.ConfigMaps)-1]
+	case "Secret":
+		m.Secrets = append(m.Secrets, v1.Secret{})
+		obj = &m.Secrets[len(m.Secrets)-1]
+	default:
+		return nil
+	}
+
+	if err := yaml.UnmarshalStrict(raw, obj); err != nil {
+		return err
+	}
+	if obj.GetNamespace() == "" {
+		obj.SetNamespace(defaultNamespace)
+	}
+	return nil
+}
+
+// role returns the Role of the given namespace and name, or nil if it's not in the manifests
+func (m *Manifests) role(namespace, name string) *iamv1beta1.Role {
+	for i, role := range m.Roles {
+		if role.Namespace == namespace && role.Name == name {
+			return &m.Roles[i]
+		}
+	}
+	return nil
+}
+
+// policy returns the Policy of the given namespace and name, or nil if it's not in the manifests
+func (m *Manifests) policy(namespace, name string) *iamv1beta1.Policy {
+	for i, policy := range m.Policies {
+		if policy.Namespace == namespace && policy.Name == name {
+			return &m.Policies[i]
+		}
+	}
+	return nil
+}
+
+// configMap returns the ConfigMap of the given namespace and name, or nil if it's not in the manifests
+func (m *Manifests) configMap(namespace, name string) *v1.ConfigMap {
+	for i, cm := range m.ConfigMaps {
+		if cm.Namespace == namespace && cm.Name == name {
+			return &m.ConfigMaps[i]
+		}
+	}
+	return nil
+}
+
+// secret returns the Secret of the given namespace and name, or nil if it's not in the manifests. Its stringData is
+// merged into its data, like the API server does.
+func (m *Manifests) secret(namespace, name string) *v1.Secret {
+	for i, secret := range m.Secrets {
+		if secret.Namespace == namespace && secret.Name == name {
+			merged := m.Secrets[i].DeepCopy()
+			if len(merged.StringData) > 0 && merged.Data == nil {
+				merged.Data = map[string][]byte{}
+			}
+			for k, v := range merged.StringData {
+				merged.Data[k] = []byte(v)
+			}
+			return merged
+		}
+	}
+	return nil
+}
+
+// assumeRolePolicy returns the AssumeRolePolicy of the given namespace and name, or nil if it's not in the manifests
+func (m *Manifests) assumeRolePolicy(namespace, name string) *iamv1beta1.AssumeRolePolicy {
+	for i, arp := range m.AssumeRolePolicies {
+		if arp.Namespace == namespace && arp.Name == name {
+			return &m.AssumeRolePolicies[i]
+		}
+	}
+	return nil
+}
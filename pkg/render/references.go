@@ -0,0 +1,40 @@
+package render
+
+import (
+	"fmt"
+
+	iamv1beta1 "github.com/redradrat/aws-iam-operator/api/v1beta1"
+	"github.com/redradrat/aws-iam-operator/pkg/lint"
+)
+
+// arnResolver returns an iamv1beta1.ARNResolver, which predicts the ARNs the operator gives the referenced resources.
+// Names of Roles and Policies in the manifests are taken from their spec, all other resources are assumed to be named
+// like the referenced resource. Predicting ARNs needs the account ID.
+func (m *Manifests) arnResolver(opts Options) iamv1beta1.ARNResolver {
+	return func(ref iamv1beta1.ARNReference) (string, error) {
+		if opts.Values.AccountID == "" {
+			return "", fmt.Errorf("the ARN of the referenced %s '%s/%s' cannot be predicted without an account ID", ref.Kind, ref.Namespace, ref.Name)
+		}
+
+		var resourceType, name string
+		switch ref.Kind {
+		case "Role":
+			resourceType, name = "role", ref.Name
+			if role := m.role(ref.Namespace, ref.Name); role != nil {
+				name = role.RoleName()
+			}
+		case "Policy":
+			resourceType, name = "policy", ref.Name
+			if policy := m.policy(ref.Namespace, ref.Name); policy != nil {
+				name = policy.PolicyName()
+			}
+		case "User":
+			resourceType, name = "user", ref.Name
+		case "Group":
+			resourceType, name = "group", ref.Name
+		default:
+			return "", fmt.Errorf("cannot reference the ARN of a %s", ref.Kind)
+		}
+		return fmt.Sprintf("arn:%s:iam::%s:%s/%s%s", lint.PartitionForRegion(opts.Region), opts.Values.AccountID, resourceType, opts.Values.Prefix, name), nil
+	}
+}
@@ -0,0 +1,261 @@
+package render
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/redradrat/cloud-objects/aws/iam"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	iamv1beta1 "github.com/redradrat/aws-iam-operator/api/v1beta1"
+	"github.com/redradrat/aws-iam-operator/pkg/document"
+	"github.com/redradrat/aws-iam-operator/pkg/templating"
+)
+
+// Options configures rendering and validation
+type Options struct {
+	// OidcProviderARN is the ARN of the OIDC provider used for the IRSA statements of Roles
+	OidcProviderARN string
+	// Region is the AWS region of the operator, the partition of resource ARNs is checked against
+	Region string
+	// MaxTrustPolicySize is the maximum size of trust policies in characters
+	MaxTrustPolicySize int
+	// Values are the values of the template variables in policy statements
+	Values templating.Values
+}
+
+// Attachment describes a PolicyAttachment. Attachments have no IAM JSON of their own.
+type Attachment struct {
+	Policy     string `json:"Policy"`
+	TargetType string `json:"TargetType"`
+	Target     string `json:"Target"`
+}
+
+// Document is the rendered result of a single resource
+type Document struct {
+	Kind      string
+	Namespace string
+	Name      string
+
+	// Trust is true, if Policy is a trust (assume role) policy
+	Trust bool
+	// Policy is the IAM policy document of Policies, Roles and AssumeRolePolicies. For a raw document, it's the
+	// approximation linting and constraints work on.
+	Policy *iam.PolicyDocument
+	// Raw is the canonical JSON of a raw document, which is sent to AWS instead of Policy
+	Raw []byte
+	// Attachment is set for PolicyAttachments
+	Attachment *Attachment
+	// Err is set, if the resource could not be rendered
+	Err error
+}
+
+// ID identifies the resource the document has been rendered from
+func (d Document) ID() string {
+	return fmt.Sprintf("%s %s/%s", d.Kind, d.Namespace, d.Name)
+}
+
+// JSON returns the canonical, indented JSON of the document
+func (d Document) JSON() ([]byte, error) {
+	if d.Err != nil {
+		return nil, d.Err
+	}
+	var v interface{} = d.Policy
+	if d.Attachment != nil {
+		v = d.Attachment
+	}
+
+	buf := bytes.Buffer{}
+	if d.Raw != nil {
+		if err := json.Indent(&buf, d.Raw, "", "  "); err != nil {
+			return nil, err
+		}
+		buf.WriteString("\n")
+		return buf.Bytes(), nil
+	}
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Render renders all resources of the manifests, sorted by kind, namespace and name. Resources, which cannot be
+// rendered, are returned with their error set.
+func Render(m *Manifests, opts Options) []Document {
+	var docs []Document
+
+	for i := range m.Policies {
+		policy := &m.Policies[i]
+		d := Document{Kind: "Policy", Namespace: policy.Namespace, Name: policy.Name}
+		if doc, raw, err := PolicyDocument(m, policy, opts); err != nil {
+			d.Err = err
+		} else {
+			d.Policy, d.Raw = &doc, raw
+		}
+		docs = append(docs, d)
+	}
+
+	for i := range m.AssumeRolePolicies {
+		// on its own, the variables of an AssumeRolePolicy are expanded for itself
+		arp := &m.AssumeRolePolicies[i]
+		d := Document{Kind: "AssumeRolePolicy", Namespace: arp.Namespace, Name: arp.Name, Trust: true}
+		if doc, raw, err := assumeRolePolicyDocument(m, arp, opts); err != nil {
+			d.Err = err
+		} else {
+			d.Policy, d.Raw = &doc, raw
+		}
+		docs = append(docs, d)
+	}
+
+	for i := range m.Roles {
+		role := &m.Roles[i]
+		d := Document{Kind: "Role", Namespace: role.Namespace, Name: role.Name, Trust: true}
+		if doc, raw, err := TrustPolicyDocument(m, role, opts); err != nil {
+			d.Err = err
+		} else {
+			d.Policy, d.Raw = &doc, raw
+		}
+		docs = append(docs, d)
+	}
+
+	for i := range m.PolicyAttachments {
+		pa := &m.PolicyAttachments[i]
+		d := Document{Kind: "PolicyAttachment", Namespace: pa.Namespace, Name: pa.Name}
+		d.Attachment, d.Err = renderAttachment(pa)
+		docs = append(docs, d)
+	}
+
+	sort.SliceStable(docs, func(i, j int) bool {
+		return docs[i].ID() < docs[j].ID()
+	})
+	return docs
+}
+
+// PolicyDocument returns the document of the policy, just like the operator builds it. The ARNs of referenced
+// resources are predicted. For a raw document, its canonical JSON is returned as well, and the document is only an
+// approximation of it.
+func PolicyDocument(m *Manifests, policy *iamv1beta1.Policy, opts Options) (iam.PolicyDocument, []byte, error) {
+	raw, err := policy.UsesRawDocument()
+	if err != nil {
+		return iam.PolicyDocument{}, nil, err
+	}
+	if raw {
+		return m.rawDocument(policy.Namespace, policy.Spec.Document, policy.Spec.DocumentFrom, false)
+	}
+
+	statement, err := policy.Spec.Statement.ResolveReferences(policy.Namespace, m.arnResolver(opts))
+	if err != nil {
+		return iam.PolicyDocument{}, nil, err
+	}
+	resolved := policy.DeepCopy()
+	resolved.Spec.Statement = statement
+	doc, err := opts.Values.PolicyDocument(resolved)
+	return doc, nil, err
+}
+
+// TrustPolicyDocument returns the trust policy document of the role, just like the operator builds it. A referenced
+// AssumeRolePolicy has to be part of the manifests, the ARNs of referenced resources are predicted. If the referenced
+// AssumeRolePolicy has a raw document, its canonical JSON is returned as well, see PolicyDocument.
+func TrustPolicyDocument(m *Manifests, role *iamv1beta1.Role, opts Options) (iam.PolicyDocument, []byte, error) {
+	var arp *iamv1beta1.AssumeRolePolicy
+	if arpr := role.Spec.AssumeRolePolicyReference; role.ReferencesAssumeRolePolicy() && arpr.Name != "" {
+		if arp = m.assumeRolePolicy(arpr.Namespace, arpr.Name); arp == nil {
+			return iam.PolicyDocument{}, nil, fmt.Errorf("AssumeRolePolicy '%s/%s' is not part of the manifests", arpr.Namespace, arpr.Name)
+		}
+	}
+	return opts.Values.ComposeTrustPolicyDocument(role, arp, m.arnResolver(opts), opts.OidcProviderARN, func(arp *iamv1beta1.AssumeRolePolicy) (iam.PolicyDocument, []byte, error) {
+		return m.rawDocument(arp.Namespace, arp.Spec.Document, arp.Spec.DocumentFrom, true)
+	})
+}
+
+// assumeRolePolicyDocument returns the trust policy document of the AssumeRolePolicy on its own, see PolicyDocument.
+// Its template variables are expanded for itself.
+func assumeRolePolicyDocument(m *Manifests, arp *iamv1beta1.AssumeRolePolicy, opts Options) (iam.PolicyDocument, []byte, error) {
+	raw, err := arp.UsesRawDocument()
+	if err != nil {
+		return iam.PolicyDocument{}, nil, err
+	}
+	if raw {
+		return m.rawDocument(arp.Namespace, arp.Spec.Document, arp.Spec.DocumentFrom, true)
+	}
+
+	statement, err := arp.Spec.Statement.ResolveReferences(arp.Namespace, m.arnResolver(opts))
+	if err != nil {
+		return iam.PolicyDocument{}, nil, err
+	}
+	if statement, err = opts.Values.AssumeRolePolicyStatement(statement, arp); err != nil {
+		return iam.PolicyDocument{}, nil, err
+	}
+	return statement.MarshalPolicyDocument(), nil, nil
+}
+
+// rawDocument returns the approximation and the canonical JSON of a raw document, given inline or read from a
+// ConfigMap or Secret, which has to be part of the manifests
+func (m *Manifests) rawDocument(namespace string, inline *runtime.RawExtension, from *iamv1beta1.DocumentSource, trust bool) (iam.PolicyDocument, []byte, error) {
+	var data []byte
+	source := "spec.document"
+	switch {
+	case inline != nil:
+		data = inline.Raw
+	case from.ConfigMapKeyRef != nil:
+		ref := from.ConfigMapKeyRef
+		source = fmt.Sprintf("key '%s' of ConfigMap '%s/%s'", ref.Key, namespace, ref.Name)
+		cm := m.configMap(namespace, ref.Name)
+		if cm == nil {
+			return iam.PolicyDocument{}, nil, fmt.Errorf("ConfigMap '%s/%s' is not part of the manifests", namespace, ref.Name)
+		}
+		if value, ok := cm.Data[ref.Key]; ok {
+			data = []byte(value)
+		} else if data, ok = cm.BinaryData[ref.Key]; !ok {
+			return iam.PolicyDocument{}, nil, fmt.Errorf("%s does not exist", source)
+		}
+	case from.SecretKeyRef != nil:
+		ref := from.SecretKeyRef
+		source = fmt.Sprintf("key '%s' of Secret '%s/%s'", ref.Key, namespace, ref.Name)
+		secret := m.secret(namespace, ref.Name)
+		if secret == nil {
+			return iam.PolicyDocument{}, nil, fmt.Errorf("Secret '%s/%s' is not part of the manifests", namespace, ref.Name)
+		}
+		var ok bool
+		if data, ok = secret.Data[ref.Key]; !ok {
+			return iam.PolicyDocument{}, nil, fmt.Errorf("%s does not exist", source)
+		}
+	}
+
+	doc, canonical, err := document.Canonicalize(data, trust)
+	if err != nil {
+		return iam.PolicyDocument{}, nil, fmt.Errorf("invalid policy document in %s: %w", source, err)
+	}
+	return doc.Typed(), canonical, nil
+}
+
+func renderAttachment(pa *iamv1beta1.PolicyAttachment) (*Attachment, error) {
+	if _, err := pa.GetAttachmentType(); err != nil {
+		return nil, err
+	}
+
+	polRef, extPol := pa.Spec.PolicyReference, pa.Spec.ExternalPolicy
+	var policy string
+	switch {
+	case extPol.ARN != "" && polRef.Name != "":
+		return nil, fmt.Errorf("only one of policy reference or external policy can be specified")
+	case extPol.ARN != "":
+		policy = extPol.ARN
+	case polRef.Name != "":
+		policy = fmt.Sprintf("Policy %s/%s", polRef.Namespace, polRef.Name)
+	default:
+		return nil, fmt.Errorf("neither external policy nor policy reference specified")
+	}
+
+	tarRef := pa.Spec.TargetReference
+	return &Attachment{
+		Policy:     policy,
+		TargetType: string(tarRef.Type),
+		Target:     fmt.Sprintf("%s/%s", tarRef.Namespace, tarRef.Name),
+	}, nil
+}
@@ -0,0 +1,83 @@
+package render
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/redradrat/aws-iam-operator/pkg/templating"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+var testOptions = Options{
+	Region: "eu-west-1",
+	Values: templating.Values{AccountID: "123456789012", ClusterName: "prod", Prefix: "prefix-"},
+}
+
+func loadManifests(t *testing.T, dir string) *Manifests {
+	t.Helper()
+	m, err := LoadFiles([]string{filepath.Join("testdata", dir)}, "default")
+	if err != nil {
+		t.Fatalf("LoadFiles() error = %v", err)
+	}
+	return m
+}
+
+// TestRenderGolden renders the manifests in testdata/manifests like `iamctl render`, and compares them with the golden
+// file. Run the test with -update after intended changes.
+func TestRenderGolden(t *testing.T) {
+	out := bytes.Buffer{}
+	for _, d := range Render(loadManifests(t, "manifests"), testOptions) {
+		text, err := d.JSON()
+		if err != nil {
+			fmt.Fprintf(&out, "# %s\nerror: %s\n", d.ID(), err)
+			continue
+		}
+		fmt.Fprintf(&out, "# %s\n%s", d.ID(), text)
+	}
+	compareGolden(t, filepath.Join("testdata", "render.golden"), out.Bytes())
+}
+
+// TestValidateGolden validates the manifests in testdata/manifests like `iamctl validate`, see TestRenderGolden
+func TestValidateGolden(t *testing.T) {
+	m := loadManifests(t, "manifests")
+	var findings []string
+	for _, f := range Validate(m, Render(m, testOptions), testOptions) {
+		findings = append(findings, f.String())
+	}
+	compareGolden(t, filepath.Join("testdata", "validate.golden"), []byte(strings.Join(findings, "\n")+"\n"))
+}
+
+// TestDiffGolden diffs the manifests in testdata/previous and testdata/manifests like `iamctl diff`, see
+// TestRenderGolden
+func TestDiffGolden(t *testing.T) {
+	previous := Render(loadManifests(t, "previous"), testOptions)
+	current := Render(loadManifests(t, "manifests"), testOptions)
+	compareGolden(t, filepath.Join("testdata", "diff.golden"), []byte(Diff(previous, current)))
+
+	if diff := Diff(current, current); diff != "" {
+		t.Errorf("Diff() of the same documents = %q, want none", diff)
+	}
+}
+
+func compareGolden(t *testing.T, path string, got []byte) {
+	t.Helper()
+	if *update {
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s differs, got:\n%s", path, got)
+	}
+}
@@ -0,0 +1,111 @@
+package render
+
+import (
+	"fmt"
+	"unicode/utf8"
+
+	awsarn "github.com/aws/aws-sdk-go/aws/arn"
+
+	"github.com/redradrat/aws-iam-operator/pkg/constraints"
+	"github.com/redradrat/aws-iam-operator/pkg/limits"
+	"github.com/redradrat/aws-iam-operator/pkg/lint"
+)
+
+// Finding is a problem found in a rendered document
+type Finding struct {
+	Document string
+	Severity lint.Severity
+	Message  string
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("%s: %s: %s", f.Severity, f.Document, f.Message)
+}
+
+// Validate checks the rendered documents like the operator does before calling AWS: with the linter, against the IAM
+// limits, and against the IAMConstraints and ClusterIAMConstraints contained in the manifests. ClusterIAMConstraints
+// with a namespaceSelector cannot be evaluated without a cluster, and are skipped.
+func Validate(m *Manifests, docs []Document, opts Options) []Finding {
+	var findings []Finding
+	errorf := func(d Document, format string, args ...interface{}) {
+		findings = append(findings, Finding{Document: d.ID(), Severity: lint.ErrorSeverity, Message: fmt.Sprintf(format, args...)})
+	}
+	warnf := func(d Document, format string, args ...interface{}) {
+		findings = append(findings, Finding{Document: d.ID(), Severity: lint.WarningSeverity, Message: fmt.Sprintf(format, args...)})
+	}
+
+	lintOpts := lint.Options{Partition: lint.PartitionForRegion(opts.Region)}
+	maxTrustPolicySize := opts.MaxTrustPolicySize
+	if maxTrustPolicySize == 0 {
+		maxTrustPolicySize = limits.DefaultTrustPolicySizeLimit
+	}
+
+	for _, d := range docs {
+		if d.Err != nil {
+			errorf(d, "%s", d.Err)
+			continue
+		}
+		if d.Attachment != nil && awsarn.IsARN(d.Attachment.Policy) {
+			// an external policy is checked by its ARN, referenced Policies are validated themselves
+			violations := constraints.EvaluateAllManagedPolicy(d.Attachment.Policy, m.constraintsFor(d.Namespace))
+			for _, v := range violations.Denied {
+				errorf(d, "%s", v)
+			}
+			for _, v := range violations.Warned {
+				warnf(d, "%s", v)
+			}
+		}
+		if d.Policy == nil {
+			continue
+		}
+
+		result := lint.Lint(*d.Policy, d.Trust, lintOpts)
+		for _, f := range result.Errors() {
+			errorf(d, "%s", f)
+		}
+		for _, f := range result.Warnings() {
+			warnf(d, "%s", f)
+		}
+
+		limit := limits.ManagedPolicySizeLimit
+		if d.Trust {
+			limit = maxTrustPolicySize
+		}
+		var err error
+		if d.Raw != nil {
+			// a raw document is sent as it is, so its size is the one of its canonical JSON
+			err = limits.CheckSize(utf8.RuneCount(d.Raw), limit)
+		} else {
+			err = limits.CheckDocumentSize(*d.Policy, limit)
+		}
+		if err != nil {
+			errorf(d, "%s", err)
+		}
+
+		violations := constraints.EvaluateAll(*d.Policy, d.Trust, d.Raw != nil, m.constraintsFor(d.Namespace))
+		for _, v := range violations.Denied {
+			errorf(d, "%s", v)
+		}
+		for _, v := range violations.Warned {
+			warnf(d, "%s", v)
+		}
+	}
+
+	return findings
+}
+
+// constraintsFor returns the constraints of the manifests, which apply to the given namespace
+func (m *Manifests) constraintsFor(namespace string) []constraints.Constraint {
+	var cons []constraints.Constraint
+	for i := range m.IAMConstraints {
+		if m.IAMConstraints[i].Namespace == namespace {
+			cons = append(cons, constraints.FromIAMConstraint(&m.IAMConstraints[i]))
+		}
+	}
+	for i := range m.ClusterIAMConstraints {
+		if m.ClusterIAMConstraints[i].Spec.NamespaceSelector == nil {
+			cons = append(cons, constraints.FromClusterIAMConstraint(&m.ClusterIAMConstraints[i]))
+		}
+	}
+	return cons
+}
@@ -0,0 +1,205 @@
+package sinks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	awssdk "github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/secretsmanager/secretsmanageriface"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/aws/aws-sdk-go/service/ssm/ssmiface"
+)
+
+// SecretsManager is a sink, which writes credentials to AWS Secrets Manager. The data of a name is stored as JSON
+// object in the secret <prefix><name>.
+type SecretsManager struct {
+	svc      secretsmanageriface.SecretsManagerAPI
+	prefix   string
+	kmsKeyID string
+}
+
+// NewSecretsManager returns a sink writing secrets with the prefix, encrypted with the KMS key or the default key of
+// the account, if it's empty
+func NewSecretsManager(svc secretsmanageriface.SecretsManagerAPI, prefix, kmsKeyID string) *SecretsManager {
+	return &SecretsManager{svc: svc, prefix: prefix, kmsKeyID: kmsKeyID}
+}
+
+func (s *SecretsManager) Write(ctx context.Context, name string, data map[string][]byte) error {
+	values := map[string]string{}
+	for key, value := range data {
+		values[key] = string(value)
+	}
+	raw, err := json.Marshal(values)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.svc.PutSecretValueWithContext(ctx, &secretsmanager.PutSecretValueInput{
+		SecretId:     awssdk.String(s.prefix + name),
+		SecretString: awssdk.String(string(raw)),
+	})
+	if !isAWSErrorCode(err, secretsmanager.ErrCodeResourceNotFoundException) {
+		return err
+	}
+	input := &secretsmanager.CreateSecretInput{
+		Name:         awssdk.String(s.prefix + name),
+		SecretString: awssdk.String(string(raw)),
+	}
+	if s.kmsKeyID != "" {
+		input.KmsKeyId = awssdk.String(s.kmsKeyID)
+	}
+	_, err = s.svc.CreateSecretWithContext(ctx, input)
+	return err
+}
+
+func (s *SecretsManager) Read(ctx context.Context, name string) (map[string][]byte, error) {
+	out, err := s.svc.GetSecretValueWithContext(ctx, &secretsmanager.GetSecretValueInput{SecretId: awssdk.String(s.prefix + name)})
+	if isAWSErrorCode(err, secretsmanager.ErrCodeResourceNotFoundException) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	values := map[string]string{}
+	if err := json.Unmarshal([]byte(awssdk.StringValue(out.SecretString)), &values); err != nil {
+		return nil, fmt.Errorf("%s holds no JSON object: %w", s.Location(name), err)
+	}
+	data := map[string][]byte{}
+	for key, value := range values {
+		data[key] = []byte(value)
+	}
+	return data, nil
+}
+
+// Delete deletes the secret without a recovery window, so it can be created again right away. The credentials it held
+// have been revoked anyway.
+func (s *SecretsManager) Delete(ctx context.Context, name string) error {
+	_, err := s.svc.DeleteSecretWithContext(ctx, &secretsmanager.DeleteSecretInput{
+		SecretId:                   awssdk.String(s.prefix + name),
+		ForceDeleteWithoutRecovery: awssdk.Bool(true),
+	})
+	if isAWSErrorCode(err, secretsmanager.ErrCodeResourceNotFoundException) {
+		return nil
+	}
+	return err
+}
+
+func (s *SecretsManager) Location(name string) string {
+	return fmt.Sprintf("Secrets Manager secret '%s'", s.prefix+name)
+}
+
+// SSM is a sink, which writes credentials to the SSM Parameter Store. Every key of the data of a name is stored as
+// SecureString parameter /<path>/<name>/<key>.
+type SSM struct {
+	svc      ssmiface.SSMAPI
+	path     string
+	kmsKeyID string
+}
+
+// NewSSM returns a sink writing parameters below the path, encrypted with the KMS key or the default key of the
+// account, if it's empty
+func NewSSM(svc ssmiface.SSMAPI, path, kmsKeyID string) *SSM {
+	return &SSM{svc: svc, path: path, kmsKeyID: kmsKeyID}
+}
+
+func (s *SSM) parameterPath(name string) string {
+	return "/" + joinPath(s.path, name)
+}
+
+// Write puts a parameter for every key, and deletes the parameters of keys, which are no longer part of the data
+func (s *SSM) Write(ctx context.Context, name string, data map[string][]byte) error {
+	for key, value := range data {
+		input := &ssm.PutParameterInput{
+			Name:      awssdk.String(s.parameterPath(name) + "/" + key),
+			Value:     awssdk.String(string(value)),
+			Type:      awssdk.String(ssm.ParameterTypeSecureString),
+			Overwrite: awssdk.Bool(true),
+		}
+		if s.kmsKeyID != "" {
+			input.KeyId = awssdk.String(s.kmsKeyID)
+		}
+		if _, err := s.svc.PutParameterWithContext(ctx, input); err != nil {
+			return err
+		}
+	}
+
+	names, err := s.parameterNames(ctx, name)
+	if err != nil {
+		return err
+	}
+	var stale []string
+	for _, parameter := range names {
+		if _, ok := data[strings.TrimPrefix(parameter, s.parameterPath(name)+"/")]; !ok {
+			stale = append(stale, parameter)
+		}
+	}
+	return s.deleteParameters(ctx, stale)
+}
+
+func (s *SSM) Read(ctx context.Context, name string) (map[string][]byte, error) {
+	var data map[string][]byte
+	err := s.svc.GetParametersByPathPagesWithContext(ctx, &ssm.GetParametersByPathInput{
+		Path:           awssdk.String(s.parameterPath(name)),
+		WithDecryption: awssdk.Bool(true),
+	}, func(out *ssm.GetParametersByPathOutput, _ bool) bool {
+		for _, parameter := range out.Parameters {
+			if data == nil {
+				data = map[string][]byte{}
+			}
+			key := strings.TrimPrefix(awssdk.StringValue(parameter.Name), s.parameterPath(name)+"/")
+			data[key] = []byte(awssdk.StringValue(parameter.Value))
+		}
+		return true
+	})
+	return data, err
+}
+
+func (s *SSM) Delete(ctx context.Context, name string) error {
+	names, err := s.parameterNames(ctx, name)
+	if err != nil {
+		return err
+	}
+	return s.deleteParameters(ctx, names)
+}
+
+func (s *SSM) Location(name string) string {
+	return fmt.Sprintf("SSM parameters '%s/*'", s.parameterPath(name))
+}
+
+// parameterNames returns the names of all parameters of the name
+func (s *SSM) parameterNames(ctx context.Context, name string) ([]string, error) {
+	var names []string
+	err := s.svc.GetParametersByPathPagesWithContext(ctx, &ssm.GetParametersByPathInput{
+		Path: awssdk.String(s.parameterPath(name)),
+	}, func(out *ssm.GetParametersByPathOutput, _ bool) bool {
+		for _, parameter := range out.Parameters {
+			names = append(names, awssdk.StringValue(parameter.Name))
+		}
+		return true
+	})
+	return names, err
+}
+
+// deleteParameters deletes the parameters, in batches of the 10 parameters SSM allows
+func (s *SSM) deleteParameters(ctx context.Context, names []string) error {
+	for len(names) > 0 {
+		batch := names
+		if len(batch) > 10 {
+			batch = batch[:10]
+		}
+		names = names[len(batch):]
+		if _, err := s.svc.DeleteParametersWithContext(ctx, &ssm.DeleteParametersInput{Names: awssdk.StringSlice(batch)}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func isAWSErrorCode(err error, code string) bool {
+	aerr, ok := err.(awserr.Error)
+	return ok && aerr.Code() == code
+}
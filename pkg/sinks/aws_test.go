@@ -0,0 +1,248 @@
+package sinks
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	awssdk "github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/secretsmanager/secretsmanageriface"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/aws/aws-sdk-go/service/ssm/ssmiface"
+)
+
+// fakeSecretsManager keeps secrets in memory
+type fakeSecretsManager struct {
+	secretsmanageriface.SecretsManagerAPI
+
+	secrets map[string]string
+	kmsKeys map[string]string
+	puts    int
+}
+
+func newFakeSecretsManager() *fakeSecretsManager {
+	return &fakeSecretsManager{secrets: map[string]string{}, kmsKeys: map[string]string{}}
+}
+
+func (f *fakeSecretsManager) notFound(id string) error {
+	return awserr.New(secretsmanager.ErrCodeResourceNotFoundException, fmt.Sprintf("secret %s not found", id), nil)
+}
+
+func (f *fakeSecretsManager) PutSecretValueWithContext(_ awssdk.Context, in *secretsmanager.PutSecretValueInput, _ ...request.Option) (*secretsmanager.PutSecretValueOutput, error) {
+	if _, ok := f.secrets[*in.SecretId]; !ok {
+		return nil, f.notFound(*in.SecretId)
+	}
+	f.puts++
+	f.secrets[*in.SecretId] = *in.SecretString
+	return &secretsmanager.PutSecretValueOutput{}, nil
+}
+
+func (f *fakeSecretsManager) CreateSecretWithContext(_ awssdk.Context, in *secretsmanager.CreateSecretInput, _ ...request.Option) (*secretsmanager.CreateSecretOutput, error) {
+	if _, ok := f.secrets[*in.Name]; ok {
+		return nil, awserr.New(secretsmanager.ErrCodeResourceExistsException, "secret exists", nil)
+	}
+	f.secrets[*in.Name] = *in.SecretString
+	f.kmsKeys[*in.Name] = awssdk.StringValue(in.KmsKeyId)
+	return &secretsmanager.CreateSecretOutput{}, nil
+}
+
+func (f *fakeSecretsManager) GetSecretValueWithContext(_ awssdk.Context, in *secretsmanager.GetSecretValueInput, _ ...request.Option) (*secretsmanager.GetSecretValueOutput, error) {
+	value, ok := f.secrets[*in.SecretId]
+	if !ok {
+		return nil, f.notFound(*in.SecretId)
+	}
+	return &secretsmanager.GetSecretValueOutput{SecretString: awssdk.String(value)}, nil
+}
+
+func (f *fakeSecretsManager) DeleteSecretWithContext(_ awssdk.Context, in *secretsmanager.DeleteSecretInput, _ ...request.Option) (*secretsmanager.DeleteSecretOutput, error) {
+	if _, ok := f.secrets[*in.SecretId]; !ok {
+		return nil, f.notFound(*in.SecretId)
+	}
+	if !awssdk.BoolValue(in.ForceDeleteWithoutRecovery) {
+		return nil, fmt.Errorf("secret %s would be kept for recovery", *in.SecretId)
+	}
+	delete(f.secrets, *in.SecretId)
+	return &secretsmanager.DeleteSecretOutput{}, nil
+}
+
+func TestSecretsManager(t *testing.T) {
+	ctx := context.Background()
+	fake := newFakeSecretsManager()
+	sink := NewSecretsManager(fake, "aws-iam/", "alias/credentials")
+
+	if err := sink.Write(ctx, "alice", map[string][]byte{"key": []byte("first")}); err != nil {
+		t.Fatalf("Write() of a new secret error = %v", err)
+	}
+	if fake.kmsKeys["aws-iam/alice"] != "alias/credentials" {
+		t.Errorf("secret created with KMS key '%s', want 'alias/credentials'", fake.kmsKeys["aws-iam/alice"])
+	}
+
+	data := map[string][]byte{"key": []byte("second")}
+	if err := sink.Write(ctx, "alice", data); err != nil {
+		t.Fatalf("Write() of an existing secret error = %v", err)
+	}
+	if fake.puts != 1 {
+		t.Errorf("existing secret written %d times, want 1", fake.puts)
+	}
+
+	got, err := sink.Read(ctx, "alice")
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, data) {
+		t.Errorf("Read() = %v, want %v", got, data)
+	}
+
+	if err := sink.Delete(ctx, "alice"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if got, err := sink.Read(ctx, "alice"); err != nil || got != nil {
+		t.Errorf("Read() after Delete() = %v, %v, want nil, nil", got, err)
+	}
+	if err := sink.Delete(ctx, "alice"); err != nil {
+		t.Errorf("Delete() of a missing secret error = %v", err)
+	}
+}
+
+func TestSecretsManagerReadInvalid(t *testing.T) {
+	fake := newFakeSecretsManager()
+	fake.secrets["alice"] = "not json"
+	if _, err := NewSecretsManager(fake, "", "").Read(context.Background(), "alice"); err == nil {
+		t.Error("Read() of a secret without JSON object succeeded")
+	}
+}
+
+// fakeSSM keeps parameters in memory. GetParametersByPath returns pages of pageSize parameters, DeleteParameters
+// records the size of every batch.
+type fakeSSM struct {
+	ssmiface.SSMAPI
+
+	parameters map[string]string
+	pageSize   int
+	batches    []int
+}
+
+func newFakeSSM() *fakeSSM {
+	return &fakeSSM{parameters: map[string]string{}, pageSize: 3}
+}
+
+func (f *fakeSSM) PutParameterWithContext(_ awssdk.Context, in *ssm.PutParameterInput, _ ...request.Option) (*ssm.PutParameterOutput, error) {
+	if awssdk.StringValue(in.Type) != ssm.ParameterTypeSecureString {
+		return nil, fmt.Errorf("parameter %s is not a SecureString", *in.Name)
+	}
+	if _, ok := f.parameters[*in.Name]; ok && !awssdk.BoolValue(in.Overwrite) {
+		return nil, awserr.New(ssm.ErrCodeParameterAlreadyExists, "parameter exists", nil)
+	}
+	f.parameters[*in.Name] = *in.Value
+	return &ssm.PutParameterOutput{}, nil
+}
+
+func (f *fakeSSM) GetParametersByPathPagesWithContext(_ awssdk.Context, in *ssm.GetParametersByPathInput, fn func(*ssm.GetParametersByPathOutput, bool) bool, _ ...request.Option) error {
+	var names []string
+	for name := range f.parameters {
+		if strings.HasPrefix(name, *in.Path+"/") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for len(names) > 0 {
+		page := names
+		if len(page) > f.pageSize {
+			page = page[:f.pageSize]
+		}
+		names = names[len(page):]
+		out := &ssm.GetParametersByPathOutput{}
+		for _, name := range page {
+			out.Parameters = append(out.Parameters, &ssm.Parameter{Name: awssdk.String(name), Value: awssdk.String(f.parameters[name])})
+		}
+		if !fn(out, len(names) == 0) {
+			break
+		}
+	}
+	return nil
+}
+
+func (f *fakeSSM) DeleteParametersWithContext(_ awssdk.Context, in *ssm.DeleteParametersInput, _ ...request.Option) (*ssm.DeleteParametersOutput, error) {
+	if len(in.Names) > 10 {
+		return nil, awserr.New("ValidationException", "too many parameters", nil)
+	}
+	f.batches = append(f.batches, len(in.Names))
+	for _, name := range in.Names {
+		delete(f.parameters, *name)
+	}
+	return &ssm.DeleteParametersOutput{}, nil
+}
+
+func TestSSMWritePrunesStaleKeys(t *testing.T) {
+	ctx := context.Background()
+	fake := newFakeSSM()
+	fake.parameters["/aws-iam/bob/key"] = "other user"
+	sink := NewSSM(fake, "/aws-iam/", "")
+
+	if err := sink.Write(ctx, "alice", map[string][]byte{"username": []byte("alice"), "password": []byte("first")}); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	data := map[string][]byte{"AWS_ACCESS_KEY_ID": []byte("AKIA"), "password": []byte("second")}
+	if err := sink.Write(ctx, "alice", data); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	want := map[string]string{
+		"/aws-iam/alice/AWS_ACCESS_KEY_ID": "AKIA",
+		"/aws-iam/alice/password":          "second",
+		"/aws-iam/bob/key":                 "other user",
+	}
+	if !reflect.DeepEqual(fake.parameters, want) {
+		t.Errorf("parameters = %v, want %v", fake.parameters, want)
+	}
+
+	got, err := sink.Read(ctx, "alice")
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, data) {
+		t.Errorf("Read() = %v, want %v", got, data)
+	}
+	if got, err := sink.Read(ctx, "carol"); err != nil || got != nil {
+		t.Errorf("Read() of missing parameters = %v, %v, want nil, nil", got, err)
+	}
+}
+
+func TestSSMDeleteInBatches(t *testing.T) {
+	tests := []struct {
+		name        string
+		parameters  int
+		wantBatches []int
+	}{
+		{name: "nothing to delete", parameters: 0},
+		{name: "single batch", parameters: 10, wantBatches: []int{10}},
+		{name: "several batches", parameters: 23, wantBatches: []int{10, 10, 3}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeSSM()
+			for i := 0; i < tt.parameters; i++ {
+				fake.parameters[fmt.Sprintf("/aws-iam/alice/key-%02d", i)] = "value"
+			}
+			fake.parameters["/aws-iam/alice-2/key"] = "other user"
+
+			if err := NewSSM(fake, "aws-iam", "").Delete(context.Background(), "alice"); err != nil {
+				t.Fatalf("Delete() error = %v", err)
+			}
+			if !reflect.DeepEqual(fake.batches, tt.wantBatches) {
+				t.Errorf("deleted in batches %v, want %v", fake.batches, tt.wantBatches)
+			}
+			if len(fake.parameters) != 1 {
+				t.Errorf("parameters left = %v, want only the ones of another user", fake.parameters)
+			}
+		})
+	}
+}
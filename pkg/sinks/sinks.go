@@ -0,0 +1,33 @@
+// Package sinks stores the credentials of IAM users outside of the cluster: in HashiCorp Vault, AWS Secrets Manager or
+// the SSM Parameter Store. Every sink talks to its backend through an interface or a plain address, so it can be
+// pointed at a local stand-in like a Vault dev server or a fake of the AWS API.
+package sinks
+
+import (
+	"context"
+	"strings"
+)
+
+// Sink is where credentials are written to. Credentials are stored under a name, e.g. the one of the Secret they would
+// have been written to in the cluster, as a set of keys and values.
+type Sink interface {
+	// Write stores the data under the name, replacing everything stored there before
+	Write(ctx context.Context, name string, data map[string][]byte) error
+	// Read returns the data stored under the name, or nil if there is none
+	Read(ctx context.Context, name string) (map[string][]byte, error)
+	// Delete removes the data stored under the name, if there is any
+	Delete(ctx context.Context, name string) error
+	// Location describes where the data of the name is stored, for Events and log messages
+	Location(name string) string
+}
+
+// joinPath joins the parts of a path with slashes, ignoring empty parts and surplus slashes
+func joinPath(parts ...string) string {
+	var trimmed []string
+	for _, part := range parts {
+		if part = strings.Trim(part, "/"); part != "" {
+			trimmed = append(trimmed, part)
+		}
+	}
+	return strings.Join(trimmed, "/")
+}
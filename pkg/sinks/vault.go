@@ -0,0 +1,208 @@
+package sinks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+// DefaultKubernetesTokenFile is the ServiceAccount token of the operator, which it logs in to Vault with
+const DefaultKubernetesTokenFile = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+// VaultConfig configures how the operator connects to Vault
+type VaultConfig struct {
+	// Address is the address of the Vault server, e.g. https://vault.example.com:8200
+	Address string
+	// Token is the Vault token to use. If it's empty, the operator logs in with the Kubernetes auth method.
+	Token string
+	// KubernetesRole is the role of the Kubernetes auth method, the operator logs in with
+	KubernetesRole string
+	// KubernetesAuthMount is the mount path of the Kubernetes auth method. Defaults to "kubernetes".
+	KubernetesAuthMount string
+	// KubernetesTokenFile is the ServiceAccount token, the operator logs in with. Defaults to the one of its pod.
+	KubernetesTokenFile string
+	// HTTPClient is the client for all requests. Defaults to http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+// VaultClient makes requests to the Vault HTTP API. It logs in on first use, and again when its token is rejected. It
+// can be shared by several sinks.
+type VaultClient struct {
+	config VaultConfig
+
+	mu    sync.Mutex
+	token string
+}
+
+// NewVaultClient returns a client for the Vault server of the config
+func NewVaultClient(config VaultConfig) *VaultClient {
+	if config.KubernetesAuthMount == "" {
+		config.KubernetesAuthMount = "kubernetes"
+	}
+	if config.KubernetesTokenFile == "" {
+		config.KubernetesTokenFile = DefaultKubernetesTokenFile
+	}
+	if config.HTTPClient == nil {
+		config.HTTPClient = http.DefaultClient
+	}
+	return &VaultClient{config: config, token: config.Token}
+}
+
+// vaultError is an error response of Vault
+type vaultError struct {
+	StatusCode int
+	Errors     []string `json:"errors"`
+}
+
+func (e *vaultError) Error() string {
+	return fmt.Sprintf("vault responded with %d: %s", e.StatusCode, strings.Join(e.Errors, "; "))
+}
+
+// do sends a request to the given API path, and decodes the response into out, if it's not nil. A rejected token is
+// renewed through the Kubernetes auth method once.
+func (c *VaultClient) do(ctx context.Context, method, path string, body, out interface{}) error {
+	token, err := c.currentToken(ctx, false)
+	if err != nil {
+		return err
+	}
+	err = c.request(ctx, method, path, token, body, out)
+	if verr, ok := err.(*vaultError); ok && verr.StatusCode == http.StatusForbidden && c.config.KubernetesRole != "" {
+		if token, err = c.currentToken(ctx, true); err != nil {
+			return err
+		}
+		err = c.request(ctx, method, path, token, body, out)
+	}
+	return err
+}
+
+func (c *VaultClient) request(ctx context.Context, method, path, token string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		raw, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(raw)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(c.config.Address, "/")+"/v1/"+path, reader)
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.config.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		verr := &vaultError{StatusCode: resp.StatusCode}
+		_ = json.NewDecoder(resp.Body).Decode(verr)
+		return verr
+	}
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// currentToken returns the token to use, and logs in with the Kubernetes auth method, if there is none yet or renew is
+// set
+func (c *VaultClient) currentToken(ctx context.Context, renew bool) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token != "" && !renew {
+		return c.token, nil
+	}
+	if c.config.KubernetesRole == "" {
+		return "", fmt.Errorf("neither a Vault token nor a role for the Kubernetes auth method has been given")
+	}
+
+	jwt, err := os.ReadFile(c.config.KubernetesTokenFile)
+	if err != nil {
+		return "", err
+	}
+	login := struct {
+		Auth struct {
+			ClientToken string `json:"client_token"`
+		} `json:"auth"`
+	}{}
+	body := map[string]string{"role": c.config.KubernetesRole, "jwt": strings.TrimSpace(string(jwt))}
+	if err := c.request(ctx, http.MethodPost, joinPath("auth", c.config.KubernetesAuthMount, "login"), "", body, &login); err != nil {
+		return "", fmt.Errorf("unable to log in to Vault with role '%s': %w", c.config.KubernetesRole, err)
+	}
+	c.token = login.Auth.ClientToken
+	return c.token, nil
+}
+
+// Vault is a sink, which writes credentials to a KV version 2 secrets engine. The data of a name is stored as the
+// secret <mount>/<prefix>/<name>.
+type Vault struct {
+	client *VaultClient
+	mount  string
+	prefix string
+}
+
+// NewVault returns a sink writing to the KV secrets engine at the mount, below the prefix
+func NewVault(client *VaultClient, mount, prefix string) *Vault {
+	if mount == "" {
+		mount = "secret"
+	}
+	return &Vault{client: client, mount: mount, prefix: prefix}
+}
+
+func (v *Vault) Write(ctx context.Context, name string, data map[string][]byte) error {
+	values := map[string]string{}
+	for key, value := range data {
+		values[key] = string(value)
+	}
+	return v.client.do(ctx, http.MethodPost, joinPath(v.mount, "data", v.prefix, name), map[string]interface{}{"data": values}, nil)
+}
+
+func (v *Vault) Read(ctx context.Context, name string) (map[string][]byte, error) {
+	secret := struct {
+		Data struct {
+			Data map[string]string `json:"data"`
+		} `json:"data"`
+	}{}
+	err := v.client.do(ctx, http.MethodGet, joinPath(v.mount, "data", v.prefix, name), nil, &secret)
+	if verr, ok := err.(*vaultError); ok && verr.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	// a deleted version has no data
+	if secret.Data.Data == nil {
+		return nil, nil
+	}
+	data := map[string][]byte{}
+	for key, value := range secret.Data.Data {
+		data[key] = []byte(value)
+	}
+	return data, nil
+}
+
+// Delete removes all versions of the secret of the name
+func (v *Vault) Delete(ctx context.Context, name string) error {
+	err := v.client.do(ctx, http.MethodDelete, joinPath(v.mount, "metadata", v.prefix, name), nil, nil)
+	if verr, ok := err.(*vaultError); ok && verr.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	return err
+}
+
+func (v *Vault) Location(name string) string {
+	return fmt.Sprintf("Vault secret '%s'", joinPath(v.mount, v.prefix, name))
+}
@@ -0,0 +1,177 @@
+package sinks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeVault serves the parts of the Vault HTTP API the sink uses: a KV version 2 engine at "secret" and the Kubernetes
+// auth method at "kubernetes". Only the token of the last login is accepted.
+type fakeVault struct {
+	mu      sync.Mutex
+	token   string
+	logins  []map[string]string
+	secrets map[string]map[string]string
+}
+
+func newFakeVault(t *testing.T, token string) (*fakeVault, *httptest.Server) {
+	v := &fakeVault{token: token, secrets: map[string]map[string]string{}}
+	server := httptest.NewServer(v)
+	t.Cleanup(server.Close)
+	return v, server
+}
+
+func (v *fakeVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	path := strings.TrimPrefix(r.URL.Path, "/v1/")
+	if path == "auth/kubernetes/login" && r.Method == http.MethodPost {
+		body := map[string]string{}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		v.logins = append(v.logins, body)
+		v.token = fmt.Sprintf("token-%d", len(v.logins))
+		writeJSON(w, http.StatusOK, map[string]interface{}{"auth": map[string]string{"client_token": v.token}})
+		return
+	}
+	if r.Header.Get("X-Vault-Token") != v.token {
+		writeJSON(w, http.StatusForbidden, map[string][]string{"errors": {"permission denied"}})
+		return
+	}
+
+	switch {
+	case strings.HasPrefix(path, "secret/data/") && r.Method == http.MethodPost:
+		body := struct {
+			Data map[string]string `json:"data"`
+		}{}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		v.secrets[strings.TrimPrefix(path, "secret/data/")] = body.Data
+		writeJSON(w, http.StatusOK, map[string]interface{}{"data": map[string]int{"version": 1}})
+	case strings.HasPrefix(path, "secret/data/") && r.Method == http.MethodGet:
+		data, ok := v.secrets[strings.TrimPrefix(path, "secret/data/")]
+		if !ok {
+			writeJSON(w, http.StatusNotFound, map[string][]string{"errors": {}})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"data": map[string]interface{}{"data": data}})
+	case strings.HasPrefix(path, "secret/metadata/") && r.Method == http.MethodDelete:
+		name := strings.TrimPrefix(path, "secret/metadata/")
+		if _, ok := v.secrets[name]; !ok {
+			writeJSON(w, http.StatusNotFound, map[string][]string{"errors": {}})
+			return
+		}
+		delete(v.secrets, name)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeJSON(w, http.StatusNotFound, map[string][]string{"errors": {"no handler for route"}})
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func TestVaultWriteReadDelete(t *testing.T) {
+	ctx := context.Background()
+	fake, server := newFakeVault(t, "root")
+	sink := NewVault(NewVaultClient(VaultConfig{Address: server.URL, Token: "root"}), "", "/aws-iam/")
+
+	data := map[string][]byte{"AWS_ACCESS_KEY_ID": []byte("AKIA"), "AWS_SECRET_ACCESS_KEY": []byte("secret")}
+	if err := sink.Write(ctx, "alice", data); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if _, ok := fake.secrets["aws-iam/alice"]; !ok {
+		t.Fatalf("secret not written to aws-iam/alice, got %v", fake.secrets)
+	}
+
+	got, err := sink.Read(ctx, "alice")
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, data) {
+		t.Errorf("Read() = %v, want %v", got, data)
+	}
+
+	if err := sink.Delete(ctx, "alice"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if got, err := sink.Read(ctx, "alice"); err != nil || got != nil {
+		t.Errorf("Read() after Delete() = %v, %v, want nil, nil", got, err)
+	}
+	if err := sink.Delete(ctx, "alice"); err != nil {
+		t.Errorf("Delete() of a missing secret error = %v", err)
+	}
+	if got := sink.Location("alice"); got != "Vault secret 'secret/aws-iam/alice'" {
+		t.Errorf("Location() = %s", got)
+	}
+}
+
+func TestVaultLogin(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("jwt\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		config     VaultConfig
+		wantErr    bool
+		wantLogins int
+	}{
+		{
+			name:       "logs in without a token",
+			config:     VaultConfig{KubernetesRole: "operator", KubernetesTokenFile: tokenFile},
+			wantLogins: 1,
+		},
+		{
+			name:       "logs in again, when the token is rejected",
+			config:     VaultConfig{Token: "expired", KubernetesRole: "operator", KubernetesTokenFile: tokenFile},
+			wantLogins: 1,
+		},
+		{
+			name:    "fails on a rejected token without a role",
+			config:  VaultConfig{Token: "expired"},
+			wantErr: true,
+		},
+		{
+			name:    "fails without token and role",
+			config:  VaultConfig{},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake, server := newFakeVault(t, "valid")
+			tt.config.Address = server.URL
+			sink := NewVault(NewVaultClient(tt.config), "secret", "")
+
+			err := sink.Write(context.Background(), "alice", map[string][]byte{"key": []byte("value")})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Write() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(fake.logins) != tt.wantLogins {
+				t.Fatalf("logged in %d times, want %d", len(fake.logins), tt.wantLogins)
+			}
+			for _, login := range fake.logins {
+				if login["role"] != "operator" || login["jwt"] != "jwt" {
+					t.Errorf("login = %v, want role 'operator' and jwt 'jwt'", login)
+				}
+			}
+			if !tt.wantErr && fake.secrets["alice"]["key"] != "value" {
+				t.Errorf("secret not written after login, got %v", fake.secrets)
+			}
+		})
+	}
+}
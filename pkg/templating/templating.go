@@ -0,0 +1,204 @@
+// Package templating expands the template variables of the operator in policy statements, before they are marshalled
+// into IAM policy documents.
+//
+// The supported variables are ${k8s:namespace} and ${k8s:name} of the resource, ${aws:accountId} of the account the
+// operator manages, and ${operator:clusterName} and ${operator:prefix} of the operator. Native IAM policy variables like
+// ${aws:username} are left as they are, AWS expands them on evaluation.
+package templating
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/redradrat/cloud-objects/aws/iam"
+
+	iamv1beta1 "github.com/redradrat/aws-iam-operator/api/v1beta1"
+)
+
+// Values holds the values of the operator wide template variables
+type Values struct {
+	// AccountID is the ID of the AWS account the operator manages
+	AccountID string
+	// ClusterName is the name of the cluster the operator runs in
+	ClusterName string
+	// Prefix is the resource prefix of the operator
+	Prefix string
+}
+
+// Object is the resource the statements belong to
+type Object interface {
+	GetNamespace() string
+	GetName() string
+}
+
+var variablePattern = regexp.MustCompile(`\$\{([^}]*)\}`)
+
+// Expand replaces all template variables in s with their values for the given resource. Using a variable without a
+// value, or an unknown variable of the k8s or operator namespace, is an error.
+func (v Values) Expand(s string, obj Object) (string, error) {
+	var err error
+	expanded := variablePattern.ReplaceAllStringFunc(s, func(match string) string {
+		if err != nil {
+			return match
+		}
+		name := match[2 : len(match)-1]
+		var value string
+		switch name {
+		case "k8s:namespace":
+			value = obj.GetNamespace()
+		case "k8s:name":
+			value = obj.GetName()
+		case "aws:accountId":
+			if value = v.AccountID; value == "" {
+				err = fmt.Errorf("%s cannot be expanded, the account ID is not known", match)
+			}
+		case "operator:clusterName":
+			if value = v.ClusterName; value == "" {
+				err = fmt.Errorf("%s cannot be expanded, no cluster name is configured", match)
+			}
+		case "operator:prefix":
+			value = v.Prefix
+		default:
+			if strings.HasPrefix(name, "k8s:") || strings.HasPrefix(name, "operator:") {
+				err = fmt.Errorf("unknown template variable %s", match)
+			}
+			// a native IAM policy variable
+			return match
+		}
+		return value
+	})
+	return expanded, err
+}
+
+// PolicyStatement returns a copy of the statement with the template variables expanded in all actions, resources and
+// conditions
+func (v Values) PolicyStatement(statement iamv1beta1.PolicyStatement, obj Object) (iamv1beta1.PolicyStatement, error) {
+	var expanded iamv1beta1.PolicyStatement
+	for _, entry := range statement {
+		e, err := v.entry(entry, obj)
+		if err != nil {
+			return nil, err
+		}
+		expanded = append(expanded, e)
+	}
+	return expanded, nil
+}
+
+// AssumeRolePolicyStatement returns a copy of the statement with the template variables expanded in all actions,
+// resources, conditions and principals
+func (v Values) AssumeRolePolicyStatement(statement iamv1beta1.AssumeRolePolicyStatement, obj Object) (iamv1beta1.AssumeRolePolicyStatement, error) {
+	var expanded iamv1beta1.AssumeRolePolicyStatement
+	for _, entry := range statement {
+		e, err := v.entry(entry.PolicyStatementEntry, obj)
+		if err != nil {
+			return nil, err
+		}
+		var principal map[string]string
+		if entry.Principal != nil {
+			principal = map[string]string{}
+			for typ, p := range entry.Principal {
+				if principal[typ], err = v.Expand(p, obj); err != nil {
+					return nil, err
+				}
+			}
+		}
+		expanded = append(expanded, iamv1beta1.AssumeRolePolicyStatementEntry{PolicyStatementEntry: e, Principal: principal})
+	}
+	return expanded, nil
+}
+
+// PolicyDocument returns the document of the policy, with the template variables expanded
+func (v Values) PolicyDocument(policy *iamv1beta1.Policy) (iam.PolicyDocument, error) {
+	statement, err := v.PolicyStatement(policy.Spec.Statement, policy)
+	if err != nil {
+		return iam.PolicyDocument{}, err
+	}
+	expanded := policy.DeepCopy()
+	expanded.Spec.Statement = statement
+	return expanded.Marshal(), nil
+}
+
+// TrustPolicyDocument returns the trust policy document of the role, with the template variables expanded. The
+// variables of a referenced AssumeRolePolicy are expanded for the role, so it can be shared as a template.
+func (v Values) TrustPolicyDocument(role *iamv1beta1.Role, referenced *iamv1beta1.AssumeRolePolicyStatement, oidcProviderARN string) (iam.PolicyDocument, error) {
+	expanded := role.DeepCopy()
+	statement, err := v.AssumeRolePolicyStatement(role.Spec.AssumeRolePolicy, role)
+	if err != nil {
+		return iam.PolicyDocument{}, err
+	}
+	expanded.Spec.AssumeRolePolicy = statement
+
+	if referenced != nil {
+		statement, err := v.AssumeRolePolicyStatement(*referenced, role)
+		if err != nil {
+			return iam.PolicyDocument{}, err
+		}
+		referenced = &statement
+	}
+	return expanded.TrustPolicyDocument(referenced, oidcProviderARN)
+}
+
+// ComposeTrustPolicyDocument composes the trust policy document of the role from its own statements and the ones of
+// the AssumeRolePolicy it references, arp (nil, if it references none). A raw document of arp is the trust policy as it
+// is, and is read with readRaw, which also returns its canonical JSON. Otherwise, the references of both are resolved
+// with resolve, each in its own namespace, and the template variables are expanded as in TrustPolicyDocument.
+func (v Values) ComposeTrustPolicyDocument(role *iamv1beta1.Role, arp *iamv1beta1.AssumeRolePolicy, resolve iamv1beta1.ARNResolver, oidcProviderARN string, readRaw func(*iamv1beta1.AssumeRolePolicy) (iam.PolicyDocument, []byte, error)) (iam.PolicyDocument, []byte, error) {
+	var referenced *iamv1beta1.AssumeRolePolicyStatement
+	if arp != nil {
+		raw, err := arp.UsesRawDocument()
+		if err != nil {
+			return iam.PolicyDocument{}, nil, err
+		}
+		if raw {
+			return readRaw(arp)
+		}
+		statement, err := arp.Spec.Statement.ResolveReferences(arp.Namespace, resolve)
+		if err != nil {
+			return iam.PolicyDocument{}, nil, err
+		}
+		referenced = &statement
+	}
+
+	statement, err := role.Spec.AssumeRolePolicy.ResolveReferences(role.Namespace, resolve)
+	if err != nil {
+		return iam.PolicyDocument{}, nil, err
+	}
+	resolved := role.DeepCopy()
+	resolved.Spec.AssumeRolePolicy = statement
+	doc, err := v.TrustPolicyDocument(resolved, referenced, oidcProviderARN)
+	return doc, nil, err
+}
+
+func (v Values) entry(entry iamv1beta1.PolicyStatementEntry, obj Object) (iamv1beta1.PolicyStatementEntry, error) {
+	expanded := *entry.DeepCopy()
+	var err error
+	for i := range expanded.Actions {
+		if expanded.Actions[i], err = v.Expand(expanded.Actions[i], obj); err != nil {
+			return expanded, err
+		}
+	}
+	for i := range expanded.Resources {
+		if expanded.Resources[i], err = v.Expand(expanded.Resources[i], obj); err != nil {
+			return expanded, err
+		}
+	}
+
+	if entry.Conditions == nil {
+		return expanded, nil
+	}
+	expanded.Conditions = iamv1beta1.PolicyStatementCondition{}
+	for op, comparison := range entry.Conditions {
+		expanded.Conditions[op] = iamv1beta1.PolicyStatementConditionComparison{}
+		for key, value := range comparison {
+			k, err := v.Expand(string(key), obj)
+			if err != nil {
+				return expanded, err
+			}
+			if expanded.Conditions[op][iamv1beta1.PolicyStatementConditionKey(k)], err = v.Expand(value, obj); err != nil {
+				return expanded, err
+			}
+		}
+	}
+	return expanded, nil
+}
@@ -0,0 +1,225 @@
+package templating
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/redradrat/cloud-objects/aws/iam"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	iamv1beta1 "github.com/redradrat/aws-iam-operator/api/v1beta1"
+)
+
+var testValues = Values{AccountID: "123456789012", ClusterName: "prod", Prefix: "prod-"}
+
+func testObject() *iamv1beta1.Policy {
+	return &iamv1beta1.Policy{ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "reader"}}
+}
+
+func TestExpand(t *testing.T) {
+	tests := []struct {
+		name    string
+		values  Values
+		s       string
+		want    string
+		wantErr string
+	}{
+		{
+			name: "no variables",
+			s:    "arn:aws:s3:::bucket/*",
+			want: "arn:aws:s3:::bucket/*",
+		},
+		{
+			name:   "all variables",
+			values: testValues,
+			s:      "arn:aws:s3:::${operator:clusterName}-${k8s:namespace}/${operator:prefix}${k8s:name}/${aws:accountId}",
+			want:   "arn:aws:s3:::prod-team-a/prod-reader/123456789012",
+		},
+		{
+			name:   "native IAM policy variables are kept",
+			values: testValues,
+			s:      "arn:aws:s3:::home/${aws:username}/${k8s:name}",
+			want:   "arn:aws:s3:::home/${aws:username}/reader",
+		},
+		{
+			name: "an empty prefix is fine",
+			s:    "${operator:prefix}${k8s:name}",
+			want: "reader",
+		},
+		{
+			name:    "unknown account ID",
+			values:  Values{ClusterName: "prod"},
+			s:       "arn:aws:iam::${aws:accountId}:root",
+			wantErr: "${aws:accountId} cannot be expanded, the account ID is not known",
+		},
+		{
+			name:    "no cluster name",
+			values:  Values{AccountID: "123456789012"},
+			s:       "${operator:clusterName}",
+			wantErr: "${operator:clusterName} cannot be expanded, no cluster name is configured",
+		},
+		{
+			name:    "unknown k8s variable",
+			values:  testValues,
+			s:       "${k8s:namespace}/${k8s:uid}",
+			wantErr: "unknown template variable ${k8s:uid}",
+		},
+		{
+			name:    "unknown operator variable",
+			values:  testValues,
+			s:       "${operator:region}",
+			wantErr: "unknown template variable ${operator:region}",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.values.Expand(tt.s, testObject())
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("Expand() error = %v, want %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expand() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Expand() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolicyStatement(t *testing.T) {
+	statement := iamv1beta1.PolicyStatement{{
+		Effect:    iamv1beta1.AllowPolicyStatementEffect,
+		Actions:   []string{"s3:GetObject"},
+		Resources: []string{"arn:aws:s3:::${k8s:namespace}/*"},
+		Conditions: iamv1beta1.PolicyStatementCondition{
+			"StringEquals": {"aws:ResourceTag/${operator:clusterName}": "${k8s:name}"},
+		},
+	}}
+
+	got, err := testValues.PolicyStatement(statement, testObject())
+	if err != nil {
+		t.Fatalf("PolicyStatement() error = %v", err)
+	}
+	want := iamv1beta1.PolicyStatement{{
+		Effect:    iamv1beta1.AllowPolicyStatementEffect,
+		Actions:   []string{"s3:GetObject"},
+		Resources: []string{"arn:aws:s3:::team-a/*"},
+		Conditions: iamv1beta1.PolicyStatementCondition{
+			"StringEquals": {"aws:ResourceTag/prod": "reader"},
+		},
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("PolicyStatement() = %+v, want %+v", got, want)
+	}
+	if statement[0].Resources[0] != "arn:aws:s3:::${k8s:namespace}/*" {
+		t.Errorf("PolicyStatement() modified the given statement: %+v", statement)
+	}
+
+	statement[0].Actions = []string{"s3:${k8s:kind}"}
+	if _, err := testValues.PolicyStatement(statement, testObject()); err == nil {
+		t.Error("PolicyStatement() expanded an unknown variable")
+	}
+}
+
+func TestAssumeRolePolicyStatement(t *testing.T) {
+	statement := iamv1beta1.AssumeRolePolicyStatement{{
+		PolicyStatementEntry: iamv1beta1.PolicyStatementEntry{
+			Effect:  iamv1beta1.AllowPolicyStatementEffect,
+			Actions: []string{"sts:AssumeRole"},
+		},
+		Principal: map[string]string{"AWS": "arn:aws:iam::${aws:accountId}:role/${operator:prefix}${k8s:name}"},
+	}}
+
+	got, err := testValues.AssumeRolePolicyStatement(statement, testObject())
+	if err != nil {
+		t.Fatalf("AssumeRolePolicyStatement() error = %v", err)
+	}
+	if principal := got[0].Principal["AWS"]; principal != "arn:aws:iam::123456789012:role/prod-reader" {
+		t.Errorf("principal = %s", principal)
+	}
+
+	if _, err := (Values{}).AssumeRolePolicyStatement(statement, testObject()); err == nil {
+		t.Error("AssumeRolePolicyStatement() expanded ${aws:accountId} without an account ID")
+	}
+}
+
+func TestPolicyDocument(t *testing.T) {
+	policy := testObject()
+	policy.Spec.Statement = iamv1beta1.PolicyStatement{{
+		Effect:    iamv1beta1.AllowPolicyStatementEffect,
+		Actions:   []string{"sqs:SendMessage"},
+		Resources: []string{"arn:aws:sqs:eu-west-1:${aws:accountId}:${k8s:name}"},
+	}}
+
+	doc, err := testValues.PolicyDocument(policy)
+	if err != nil {
+		t.Fatalf("PolicyDocument() error = %v", err)
+	}
+	if got := doc.Statement[0].Resource; !reflect.DeepEqual(got, []string{"arn:aws:sqs:eu-west-1:123456789012:reader"}) {
+		t.Errorf("resources = %v", got)
+	}
+	if strings.Contains(policy.Spec.Statement[0].Resources[0], "123456789012") {
+		t.Error("PolicyDocument() modified the Policy")
+	}
+}
+
+func TestComposeTrustPolicyDocument(t *testing.T) {
+	role := &iamv1beta1.Role{ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "app"}}
+	role.Spec.AssumeRolePolicyReference = iamv1beta1.ResourceReference{Namespace: "shared", Name: "trust"}
+	arp := &iamv1beta1.AssumeRolePolicy{ObjectMeta: metav1.ObjectMeta{Namespace: "shared", Name: "trust"}}
+	arp.Spec.Statement = iamv1beta1.AssumeRolePolicyStatement{{
+		PolicyStatementEntry: iamv1beta1.PolicyStatementEntry{
+			Effect:  iamv1beta1.AllowPolicyStatementEffect,
+			Actions: []string{"sts:AssumeRole"},
+		},
+		PrincipalRefs: []iamv1beta1.ARNReference{{Kind: "Role", Name: "caller"}},
+		Principal:     map[string]string{"Service": "${k8s:name}.example.com"},
+	}}
+
+	var resolved []iamv1beta1.ARNReference
+	resolve := func(ref iamv1beta1.ARNReference) (string, error) {
+		resolved = append(resolved, ref)
+		return "arn:aws:iam::123456789012:role/" + ref.Name, nil
+	}
+	readRaw := func(*iamv1beta1.AssumeRolePolicy) (iam.PolicyDocument, []byte, error) {
+		t.Fatal("readRaw called for an AssumeRolePolicy with statements")
+		return iam.PolicyDocument{}, nil, nil
+	}
+
+	doc, raw, err := testValues.ComposeTrustPolicyDocument(role, arp, resolve, "", readRaw)
+	if err != nil {
+		t.Fatalf("ComposeTrustPolicyDocument() error = %v", err)
+	}
+	if raw != nil {
+		t.Errorf("raw document = %s, want none", raw)
+	}
+	if len(resolved) != 1 || resolved[0].Namespace != "shared" {
+		t.Errorf("resolved %+v, want the reference in the namespace of the AssumeRolePolicy", resolved)
+	}
+	want := map[string]string{"AWS": "arn:aws:iam::123456789012:role/caller", "Service": "app.example.com"}
+	if len(doc.Statement) != 1 || !reflect.DeepEqual(doc.Statement[0].Principal, want) {
+		t.Errorf("statement = %+v, want principal %v expanded for the Role", doc.Statement, want)
+	}
+
+	// a raw document is the trust policy as it is
+	arp.Spec.Statement = nil
+	arp.Spec.Document = &runtime.RawExtension{Raw: []byte(`{"Version":"2012-10-17","Statement":[]}`)}
+	readRaw = func(*iamv1beta1.AssumeRolePolicy) (iam.PolicyDocument, []byte, error) {
+		return iam.PolicyDocument{Version: "2012-10-17"}, []byte("{}"), nil
+	}
+	if _, raw, err := testValues.ComposeTrustPolicyDocument(role, arp, resolve, "", readRaw); err != nil || string(raw) != "{}" {
+		t.Errorf("ComposeTrustPolicyDocument() of a raw document = %s, %v", raw, err)
+	}
+
+	// a missing AssumeRolePolicy is an error
+	if _, _, err := testValues.ComposeTrustPolicyDocument(role, nil, resolve, "", readRaw); err == nil {
+		t.Error("ComposeTrustPolicyDocument() succeeded without the referenced AssumeRolePolicy")
+	}
+}
@@ -0,0 +1,84 @@
+package webhooks
+
+import (
+	"context"
+	"net/http"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	iamv1beta1 "github.com/redradrat/aws-iam-operator/api/v1beta1"
+	"github.com/redradrat/aws-iam-operator/pkg/constraints"
+	"github.com/redradrat/aws-iam-operator/pkg/templating"
+)
+
+// ConstraintValidatorPath is the path the ConstraintValidator is served on
+const ConstraintValidatorPath = "/validate-iam-constraints"
+
+// +kubebuilder:webhook:path=/validate-iam-constraints,mutating=false,failurePolicy=fail,sideEffects=None,groups=aws-iam.redradrat.xyz,resources=policies;roles;assumerolepolicies;policyattachments,verbs=create;update,versions=v1beta1,name=constraints.aws-iam.redradrat.xyz,admissionReviewVersions=v1
+
+// +kubebuilder:rbac:groups=aws-iam.redradrat.xyz,resources=iamconstraints;clusteriamconstraints,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
+
+// ConstraintValidator rejects Policies, Roles and AssumeRolePolicies, whose policy documents violate a denying
+// IAMConstraint or ClusterIAMConstraint, and PolicyAttachments attaching a managed policy they deny. It warns about
+// violations of warning constraints.
+type ConstraintValidator struct {
+	Client          client.Client
+	OidcProviderARN string
+	TemplateValues  templating.Values
+
+	decoder *admission.Decoder
+}
+
+func (v *ConstraintValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	if req.Operation != admissionv1.Create && req.Operation != admissionv1.Update {
+		return admission.Allowed("")
+	}
+
+	if req.Kind.Kind == "PolicyAttachment" {
+		return v.handlePolicyAttachment(ctx, req)
+	}
+
+	doc, trust, err := policyDocument(ctx, v.decoder, v.Client, v.OidcProviderARN, v.TemplateValues, req)
+	if err == errNoDocument {
+		return admission.Allowed("")
+	}
+	if err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	result, err := constraints.Check(ctx, v.Client, req.Namespace, doc.PolicyDocument, trust, doc.Raw != nil)
+	return constraintResponse(result, err)
+}
+
+// handlePolicyAttachment checks the managed policy, which the admitted PolicyAttachment attaches as externalPolicy
+func (v *ConstraintValidator) handlePolicyAttachment(ctx context.Context, req admission.Request) admission.Response {
+	policyAttachment := iamv1beta1.PolicyAttachment{}
+	if err := v.decoder.Decode(req, &policyAttachment); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	if policyAttachment.Spec.ExternalPolicy.ARN == "" {
+		return admission.Allowed("")
+	}
+	result, err := constraints.CheckManagedPolicy(ctx, v.Client, req.Namespace, policyAttachment.Spec.ExternalPolicy.ARN)
+	return constraintResponse(result, err)
+}
+
+// constraintResponse denies the admission, if there are violations of denying constraints
+func constraintResponse(result constraints.Result, err error) admission.Response {
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	if err := result.Error(); err != nil {
+		return admission.Denied(err.Error()).WithWarnings(result.Warnings()...)
+	}
+	return admission.Allowed("").WithWarnings(result.Warnings()...)
+}
+
+// InjectDecoder injects the decoder
+func (v *ConstraintValidator) InjectDecoder(d *admission.Decoder) error {
+	v.decoder = d
+	return nil
+}
@@ -0,0 +1,64 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	iamv1beta1 "github.com/redradrat/aws-iam-operator/api/v1beta1"
+	"github.com/redradrat/aws-iam-operator/controllers"
+	"github.com/redradrat/aws-iam-operator/pkg/templating"
+)
+
+// errNoDocument is returned by policyDocument, if the admitted object has no policy document we can validate (yet)
+var errNoDocument = errors.New("no policy document to validate")
+
+// policyDocument decodes the admitted object and returns its policy document, and whether it is a trust policy.
+// Returns errNoDocument, if there is nothing to validate. A document read from a ConfigMap or Secret is validated by
+// the reconciler, as it may change independently of the admitted object.
+func policyDocument(ctx context.Context, decoder *admission.Decoder, c client.Client, oidcProviderARN string, values templating.Values, req admission.Request) (controllers.Document, bool, error) {
+	switch req.Kind.Kind {
+	case "Policy":
+		policy := iamv1beta1.Policy{}
+		if err := decoder.Decode(req, &policy); err != nil {
+			return controllers.Document{}, false, err
+		}
+		if _, err := policy.UsesRawDocument(); err != nil {
+			return controllers.Document{}, false, err
+		}
+		doc, err := controllers.GetPolicyDocument(&policy, values, c, ctx)
+		if controllers.IsReferenceNotReady(err) || (err != nil && policy.Spec.DocumentFrom != nil) {
+			// the referenced ARNs or the document source are not there yet, the reconciler waits for them
+			return controllers.Document{}, false, errNoDocument
+		}
+		return doc, false, err
+	case "AssumeRolePolicy":
+		arp := iamv1beta1.AssumeRolePolicy{}
+		if err := decoder.Decode(req, &arp); err != nil {
+			return controllers.Document{}, false, err
+		}
+		if _, err := arp.UsesRawDocument(); err != nil {
+			return controllers.Document{}, true, err
+		}
+		// on its own, the variables of an AssumeRolePolicy are expanded for itself
+		doc, err := controllers.GetAssumeRolePolicyDocument(&arp, values, c, ctx)
+		if controllers.IsReferenceNotReady(err) || (err != nil && arp.Spec.DocumentFrom != nil) {
+			return controllers.Document{}, true, errNoDocument
+		}
+		return doc, true, err
+	case "Role":
+		role := iamv1beta1.Role{}
+		if err := decoder.Decode(req, &role); err != nil {
+			return controllers.Document{}, false, err
+		}
+		doc, _, err := controllers.GetPolicyDoc(&role, oidcProviderARN, values, c, ctx)
+		if err != nil {
+			// the trust policy cannot be built (yet), the reconciler reports on that
+			return controllers.Document{}, false, errNoDocument
+		}
+		return doc, true, nil
+	}
+	return controllers.Document{}, false, errNoDocument
+}
@@ -0,0 +1,94 @@
+package webhooks
+
+import (
+	"context"
+	"net/http"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	iamv1beta1 "github.com/redradrat/aws-iam-operator/api/v1beta1"
+	"github.com/redradrat/aws-iam-operator/controllers"
+	"github.com/redradrat/aws-iam-operator/pkg/limits"
+	"github.com/redradrat/aws-iam-operator/pkg/templating"
+)
+
+// LimitValidatorPath is the path the LimitValidator is served on
+const LimitValidatorPath = "/validate-iam-limits"
+
+// +kubebuilder:webhook:path=/validate-iam-limits,mutating=false,failurePolicy=fail,sideEffects=None,groups=aws-iam.redradrat.xyz,resources=policies;roles;assumerolepolicies;policyattachments,verbs=create;update,versions=v1beta1,name=limits.aws-iam.redradrat.xyz,admissionReviewVersions=v1
+
+// LimitValidator rejects Policies, Roles and AssumeRolePolicies, whose policy documents exceed the IAM size limits,
+// and PolicyAttachments, whose target has already reached the limit of attached policies.
+type LimitValidator struct {
+	Client              client.Client
+	OidcProviderARN     string
+	TemplateValues      templating.Values
+	MaxTrustPolicySize  int
+	MaxAttachedPolicies int
+
+	decoder *admission.Decoder
+}
+
+func (v *LimitValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	if req.Operation != admissionv1.Create && req.Operation != admissionv1.Update {
+		return admission.Allowed("")
+	}
+
+	if req.Kind.Kind == "PolicyAttachment" {
+		return v.handlePolicyAttachment(ctx, req)
+	}
+
+	doc, trust, err := policyDocument(ctx, v.decoder, v.Client, v.OidcProviderARN, v.TemplateValues, req)
+	if err == errNoDocument {
+		return admission.Allowed("")
+	}
+	if err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	limit := limits.ManagedPolicySizeLimit
+	if trust {
+		limit = v.MaxTrustPolicySize
+	}
+	size, err := doc.Size()
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	if err := limits.CheckSize(size, limit); err != nil {
+		return admission.Denied(err.Error())
+	}
+	return admission.Allowed("")
+}
+
+func (v *LimitValidator) handlePolicyAttachment(ctx context.Context, req admission.Request) admission.Response {
+	policyAttachment := iamv1beta1.PolicyAttachment{}
+	if err := v.decoder.Decode(req, &policyAttachment); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	// count all other attachments of the target, whether they're attached yet or not. Attachments may live in other
+	// namespaces than their target.
+	attachments, err := controllers.ListTargetPolicyAttachments(ctx, v.Client, policyAttachment.Spec.TargetReference)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	attached := 0
+	for _, att := range attachments {
+		if !(att.Namespace == req.Namespace && att.Name == req.Name) {
+			attached++
+		}
+	}
+
+	if err := limits.CheckAttachedPolicies(attached, v.MaxAttachedPolicies); err != nil {
+		return admission.Denied(err.Error())
+	}
+	return admission.Allowed("")
+}
+
+// InjectDecoder injects the decoder
+func (v *LimitValidator) InjectDecoder(d *admission.Decoder) error {
+	v.decoder = d
+	return nil
+}
@@ -0,0 +1,59 @@
+package webhooks
+
+import (
+	"context"
+	"net/http"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"github.com/redradrat/aws-iam-operator/pkg/lint"
+	"github.com/redradrat/aws-iam-operator/pkg/templating"
+)
+
+// LintValidatorPath is the path the LintValidator is served on
+const LintValidatorPath = "/validate-iam-lint"
+
+// +kubebuilder:webhook:path=/validate-iam-lint,mutating=false,failurePolicy=fail,sideEffects=None,groups=aws-iam.redradrat.xyz,resources=policies;roles;assumerolepolicies,verbs=create;update,versions=v1beta1,name=lint.aws-iam.redradrat.xyz,admissionReviewVersions=v1
+
+// LintValidator rejects Policies, Roles and AssumeRolePolicies, in whose policy documents the offline linter finds
+// errors, and returns its warnings as admission warnings.
+type LintValidator struct {
+	Client          client.Client
+	OidcProviderARN string
+	TemplateValues  templating.Values
+	Region          string
+
+	decoder *admission.Decoder
+}
+
+func (v *LintValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	if req.Operation != admissionv1.Create && req.Operation != admissionv1.Update {
+		return admission.Allowed("")
+	}
+
+	doc, trust, err := policyDocument(ctx, v.decoder, v.Client, v.OidcProviderARN, v.TemplateValues, req)
+	if err == errNoDocument {
+		return admission.Allowed("")
+	}
+	if err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	result := lint.Lint(doc.PolicyDocument, trust, lint.Options{Partition: lint.PartitionForRegion(v.Region)})
+	var warnings []string
+	for _, f := range result.Warnings() {
+		warnings = append(warnings, f.String())
+	}
+	if err := result.Error(); err != nil {
+		return admission.Denied(err.Error()).WithWarnings(warnings...)
+	}
+	return admission.Allowed("").WithWarnings(warnings...)
+}
+
+// InjectDecoder injects the decoder
+func (v *LintValidator) InjectDecoder(d *admission.Decoder) error {
+	v.decoder = d
+	return nil
+}
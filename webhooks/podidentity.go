@@ -0,0 +1,179 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	iamv1beta1 "github.com/redradrat/aws-iam-operator/api/v1beta1"
+	"github.com/redradrat/aws-iam-operator/controllers"
+)
+
+// PodIdentityMutatorPath is the path the PodIdentityMutator is served on
+const PodIdentityMutatorPath = "/mutate-pod-identity"
+
+// The MutatingWebhookConfiguration of the PodIdentityMutator is not generated, but maintained in the optional
+// config/podidentity component, so it is only deployed where it is wanted.
+
+const (
+	// skipContainersAnnotation lists the comma-separated names of the containers of a pod, which are not mutated
+	skipContainersAnnotation = "eks.amazonaws.com/skip-containers"
+
+	podIdentityTokenVolume = "aws-iam-token"
+	podIdentityMountPath   = "/var/run/secrets/eks.amazonaws.com/serviceaccount"
+	podIdentityTokenPath   = "token"
+
+	// defaultTokenExpiration is the expiration of the projected tokens in seconds, if the ServiceAccount doesn't set one
+	defaultTokenExpiration int64 = 86400
+	// minTokenExpiration is the minimum expiration of projected tokens in seconds, the kubelet accepts
+	minTokenExpiration int64 = 600
+)
+
+// PodIdentityMutator injects web identity credentials into pods, whose ServiceAccount is annotated with a role ARN, the
+// way the EKS pod identity webhook does: a projected ServiceAccount token volume, and the environment variables the AWS
+// SDKs pick it up from. It makes IRSA work on clusters, which don't run that webhook.
+type PodIdentityMutator struct {
+	Client client.Client
+	// Region is injected as AWS_REGION and AWS_DEFAULT_REGION, if set
+	Region string
+
+	decoder *admission.Decoder
+}
+
+func (m *PodIdentityMutator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	if req.Operation != admissionv1.Create {
+		return admission.Allowed("")
+	}
+
+	pod := v1.Pod{}
+	if err := m.decoder.Decode(req, &pod); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	name := pod.Spec.ServiceAccountName
+	if name == "" {
+		name = "default"
+	}
+	sa := v1.ServiceAccount{}
+	if err := m.Client.Get(ctx, client.ObjectKey{Namespace: req.Namespace, Name: name}, &sa); errors.IsNotFound(err) {
+		return admission.Allowed("")
+	} else if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+
+	roleARN := sa.Annotations[controllers.RoleARNAnnotation]
+	if roleARN == "" {
+		return admission.Allowed("")
+	}
+	for _, volume := range pod.Spec.Volumes {
+		if volume.Name == podIdentityTokenVolume {
+			return admission.Allowed("")
+		}
+	}
+
+	if !mutatePodIdentity(&pod, roleARN, m.podIdentityEnv(&sa), tokenProjection(&sa)) {
+		return admission.Allowed("")
+	}
+	mutated, err := json.Marshal(pod)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	return admission.PatchResponseFromRaw(req.Object.Raw, mutated)
+}
+
+// InjectDecoder injects the decoder
+func (m *PodIdentityMutator) InjectDecoder(d *admission.Decoder) error {
+	m.decoder = d
+	return nil
+}
+
+// podIdentityEnv returns the environment variables, which are injected into the containers besides AWS_ROLE_ARN
+func (m *PodIdentityMutator) podIdentityEnv(sa *v1.ServiceAccount) []v1.EnvVar {
+	env := []v1.EnvVar{{Name: "AWS_WEB_IDENTITY_TOKEN_FILE", Value: path.Join(podIdentityMountPath, podIdentityTokenPath)}}
+	if regional, _ := strconv.ParseBool(sa.Annotations[controllers.STSRegionalEndpointsAnnotation]); regional {
+		env = append(env, v1.EnvVar{Name: "AWS_STS_REGIONAL_ENDPOINTS", Value: "regional"})
+	}
+	if m.Region != "" {
+		env = append(env, v1.EnvVar{Name: "AWS_REGION", Value: m.Region}, v1.EnvVar{Name: "AWS_DEFAULT_REGION", Value: m.Region})
+	}
+	return env
+}
+
+// tokenProjection returns the projection of the ServiceAccount token, with the audience and expiration the
+// ServiceAccount is annotated with
+func tokenProjection(sa *v1.ServiceAccount) *v1.ServiceAccountTokenProjection {
+	audience := sa.Annotations[controllers.AudienceAnnotation]
+	if audience == "" {
+		audience = iamv1beta1.DefaultIRSAAudience
+	}
+	expiration, err := strconv.ParseInt(sa.Annotations[controllers.TokenExpirationAnnotation], 10, 64)
+	if err != nil {
+		expiration = defaultTokenExpiration
+	} else if expiration < minTokenExpiration {
+		expiration = minTokenExpiration
+	}
+	return &v1.ServiceAccountTokenProjection{Audience: audience, ExpirationSeconds: &expiration, Path: podIdentityTokenPath}
+}
+
+// mutatePodIdentity adds the token volume to the pod, and mounts it into all containers and init containers, which are
+// not skipped and don't bring their own AWS_ROLE_ARN. Variables a container already sets are left alone. It returns
+// false, if no container has been mutated.
+func mutatePodIdentity(pod *v1.Pod, roleARN string, env []v1.EnvVar, projection *v1.ServiceAccountTokenProjection) bool {
+	skipped := map[string]bool{}
+	for _, name := range strings.Split(pod.Annotations[skipContainersAnnotation], ",") {
+		skipped[strings.TrimSpace(name)] = true
+	}
+
+	mutated := false
+	mutate := func(containers []v1.Container) {
+		for i := range containers {
+			container := &containers[i]
+			if skipped[container.Name] || hasEnv(container, "AWS_ROLE_ARN") {
+				continue
+			}
+			container.Env = append(container.Env, v1.EnvVar{Name: "AWS_ROLE_ARN", Value: roleARN})
+			for _, e := range env {
+				if !hasEnv(container, e.Name) {
+					container.Env = append(container.Env, e)
+				}
+			}
+			container.VolumeMounts = append(container.VolumeMounts, v1.VolumeMount{
+				Name:      podIdentityTokenVolume,
+				MountPath: podIdentityMountPath,
+				ReadOnly:  true,
+			})
+			mutated = true
+		}
+	}
+	mutate(pod.Spec.InitContainers)
+	mutate(pod.Spec.Containers)
+	if !mutated {
+		return false
+	}
+
+	pod.Spec.Volumes = append(pod.Spec.Volumes, v1.Volume{
+		Name: podIdentityTokenVolume,
+		VolumeSource: v1.VolumeSource{Projected: &v1.ProjectedVolumeSource{
+			Sources: []v1.VolumeProjection{{ServiceAccountToken: projection}},
+		}},
+	})
+	return true
+}
+
+func hasEnv(container *v1.Container, name string) bool {
+	for _, e := range container.Env {
+		if e.Name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,175 @@
+package webhooks
+
+import (
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	iamv1beta1 "github.com/redradrat/aws-iam-operator/api/v1beta1"
+	"github.com/redradrat/aws-iam-operator/controllers"
+)
+
+const testRoleARN = "arn:aws:iam::123456789012:role/app"
+
+func TestTokenProjection(t *testing.T) {
+	tests := []struct {
+		name           string
+		annotations    map[string]string
+		wantAudience   string
+		wantExpiration int64
+	}{
+		{
+			name:           "defaults",
+			wantAudience:   iamv1beta1.DefaultIRSAAudience,
+			wantExpiration: defaultTokenExpiration,
+		},
+		{
+			name: "annotated audience and expiration",
+			annotations: map[string]string{
+				controllers.AudienceAnnotation:        "vault",
+				controllers.TokenExpirationAnnotation: "3600",
+			},
+			wantAudience:   "vault",
+			wantExpiration: 3600,
+		},
+		{
+			name:           "expiration below the minimum",
+			annotations:    map[string]string{controllers.TokenExpirationAnnotation: "60"},
+			wantAudience:   iamv1beta1.DefaultIRSAAudience,
+			wantExpiration: minTokenExpiration,
+		},
+		{
+			name:           "invalid expiration",
+			annotations:    map[string]string{controllers.TokenExpirationAnnotation: "1h"},
+			wantAudience:   iamv1beta1.DefaultIRSAAudience,
+			wantExpiration: defaultTokenExpiration,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sa := &v1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Annotations: tt.annotations}}
+			projection := tokenProjection(sa)
+			if projection.Audience != tt.wantAudience {
+				t.Errorf("audience = %q, want %q", projection.Audience, tt.wantAudience)
+			}
+			if projection.ExpirationSeconds == nil || *projection.ExpirationSeconds != tt.wantExpiration {
+				t.Errorf("expiration = %v, want %d", projection.ExpirationSeconds, tt.wantExpiration)
+			}
+			if projection.Path != podIdentityTokenPath {
+				t.Errorf("path = %q, want %q", projection.Path, podIdentityTokenPath)
+			}
+		})
+	}
+}
+
+func TestMutatePodIdentity(t *testing.T) {
+	tokenFile := v1.EnvVar{Name: "AWS_WEB_IDENTITY_TOKEN_FILE", Value: "/var/run/secrets/eks.amazonaws.com/serviceaccount/token"}
+	region := v1.EnvVar{Name: "AWS_REGION", Value: "eu-west-1"}
+	roleARN := v1.EnvVar{Name: "AWS_ROLE_ARN", Value: testRoleARN}
+	mount := v1.VolumeMount{Name: podIdentityTokenVolume, MountPath: podIdentityMountPath, ReadOnly: true}
+
+	tests := []struct {
+		name           string
+		annotations    map[string]string
+		initContainers []v1.Container
+		containers     []v1.Container
+		wantMutated    bool
+		wantInit       []v1.Container
+		wantContainers []v1.Container
+	}{
+		{
+			name:        "all containers",
+			containers:  []v1.Container{{Name: "app"}, {Name: "sidecar"}},
+			wantMutated: true,
+			wantContainers: []v1.Container{
+				{Name: "app", Env: []v1.EnvVar{roleARN, tokenFile, region}, VolumeMounts: []v1.VolumeMount{mount}},
+				{Name: "sidecar", Env: []v1.EnvVar{roleARN, tokenFile, region}, VolumeMounts: []v1.VolumeMount{mount}},
+			},
+		},
+		{
+			name:           "init containers",
+			initContainers: []v1.Container{{Name: "migrate"}},
+			containers:     []v1.Container{{Name: "app"}},
+			wantMutated:    true,
+			wantInit: []v1.Container{
+				{Name: "migrate", Env: []v1.EnvVar{roleARN, tokenFile, region}, VolumeMounts: []v1.VolumeMount{mount}},
+			},
+			wantContainers: []v1.Container{
+				{Name: "app", Env: []v1.EnvVar{roleARN, tokenFile, region}, VolumeMounts: []v1.VolumeMount{mount}},
+			},
+		},
+		{
+			name:           "skipped containers",
+			annotations:    map[string]string{skipContainersAnnotation: "migrate, sidecar"},
+			initContainers: []v1.Container{{Name: "migrate"}},
+			containers:     []v1.Container{{Name: "app"}, {Name: "sidecar"}},
+			wantMutated:    true,
+			wantInit:       []v1.Container{{Name: "migrate"}},
+			wantContainers: []v1.Container{
+				{Name: "app", Env: []v1.EnvVar{roleARN, tokenFile, region}, VolumeMounts: []v1.VolumeMount{mount}},
+				{Name: "sidecar"},
+			},
+		},
+		{
+			name: "a container with its own AWS_ROLE_ARN",
+			containers: []v1.Container{
+				{Name: "app", Env: []v1.EnvVar{{Name: "AWS_ROLE_ARN", Value: "arn:aws:iam::123456789012:role/own"}}},
+				{Name: "sidecar"},
+			},
+			wantMutated: true,
+			wantContainers: []v1.Container{
+				{Name: "app", Env: []v1.EnvVar{{Name: "AWS_ROLE_ARN", Value: "arn:aws:iam::123456789012:role/own"}}},
+				{Name: "sidecar", Env: []v1.EnvVar{roleARN, tokenFile, region}, VolumeMounts: []v1.VolumeMount{mount}},
+			},
+		},
+		{
+			name:        "variables a container already sets",
+			containers:  []v1.Container{{Name: "app", Env: []v1.EnvVar{{Name: "AWS_REGION", Value: "us-east-1"}}}},
+			wantMutated: true,
+			wantContainers: []v1.Container{
+				{Name: "app", Env: []v1.EnvVar{{Name: "AWS_REGION", Value: "us-east-1"}, roleARN, tokenFile}, VolumeMounts: []v1.VolumeMount{mount}},
+			},
+		},
+		{
+			name:           "no container to mutate",
+			annotations:    map[string]string{skipContainersAnnotation: "app"},
+			containers:     []v1.Container{{Name: "app"}},
+			wantContainers: []v1.Container{{Name: "app"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &v1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Annotations: tt.annotations},
+				Spec:       v1.PodSpec{InitContainers: tt.initContainers, Containers: tt.containers},
+			}
+			projection := tokenProjection(&v1.ServiceAccount{})
+
+			mutated := mutatePodIdentity(pod, testRoleARN, []v1.EnvVar{tokenFile, region}, projection)
+			if mutated != tt.wantMutated {
+				t.Fatalf("mutatePodIdentity() = %v, want %v", mutated, tt.wantMutated)
+			}
+			if !reflect.DeepEqual(pod.Spec.InitContainers, tt.wantInit) {
+				t.Errorf("init containers = %+v, want %+v", pod.Spec.InitContainers, tt.wantInit)
+			}
+			if !reflect.DeepEqual(pod.Spec.Containers, tt.wantContainers) {
+				t.Errorf("containers = %+v, want %+v", pod.Spec.Containers, tt.wantContainers)
+			}
+
+			var wantVolumes []v1.Volume
+			if tt.wantMutated {
+				wantVolumes = []v1.Volume{{
+					Name: podIdentityTokenVolume,
+					VolumeSource: v1.VolumeSource{Projected: &v1.ProjectedVolumeSource{
+						Sources: []v1.VolumeProjection{{ServiceAccountToken: projection}},
+					}},
+				}}
+			}
+			if !reflect.DeepEqual(pod.Spec.Volumes, wantVolumes) {
+				t.Errorf("volumes = %+v, want %+v", pod.Spec.Volumes, wantVolumes)
+			}
+		})
+	}
+}